@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"testing"
 	"time"
 	"purchase-tracker-service/dao"
@@ -9,7 +10,7 @@ import (
 
 func TestListAllAccounts(t *testing.T) {
 	var testedObject = dao.NewLocalPayerStore()
-	var actualListing = testedObject.ListAllAccounts()
+	var actualListing = testedObject.ListAllAccounts(context.Background())
 	expectNoAccounts(t, actualListing)
 
 	var firstAccount = &domain.PayerAccount{
@@ -22,9 +23,9 @@ func TestListAllAccounts(t *testing.T) {
 		"Brand 2",
 		time.Now(),
 	}
-	testedObject.AddAccount(firstAccount)
-	testedObject.AddAccount(secondAccount)
-	actualListing = testedObject.ListAllAccounts()
+	testedObject.AddAccount(context.Background(), firstAccount)
+	testedObject.AddAccount(context.Background(), secondAccount)
+	actualListing = testedObject.ListAllAccounts(context.Background())
 	expectSpecificAccounts(t, actualListing, 2)
 	expectAccountById(t, actualListing, firstAccount.Id)
 	expectAccountById(t, actualListing, secondAccount.Id)
@@ -38,12 +39,12 @@ func TestGetWithId(t *testing.T) {
 		time.Now(),
 	}
 
-	var actualAccount = testedObject.GetWithId(testAccount.Id)
+	var actualAccount = testedObject.GetWithId(context.Background(), testAccount.Id)
 	if actualAccount != nil {
 		t.Fatalf("Did not expect Account to be found by id %s", testAccount.Id)
 	}
-	testedObject.AddAccount(testAccount)
-	actualAccount = testedObject.GetWithId(testAccount.Id)
+	testedObject.AddAccount(context.Background(), testAccount)
+	actualAccount = testedObject.GetWithId(context.Background(), testAccount.Id)
 	if actualAccount == nil {
 		t.Fatalf("Expected Account to be found by id %s", testAccount.Id)
 	}
@@ -66,12 +67,12 @@ func TestGetWithName(t *testing.T) {
 		time.Now(),
 	}
 
-	var actualAccount = testedObject.GetWithName(testAccount.Name)
+	var actualAccount = testedObject.GetWithName(context.Background(), testAccount.Name)
 	if actualAccount != nil {
 		t.Fatalf("Did not expect Account to be found by id %s", testAccount.Id)
 	}
-	testedObject.AddAccount(testAccount)
-	actualAccount = testedObject.GetWithName(testAccount.Name)
+	testedObject.AddAccount(context.Background(), testAccount)
+	actualAccount = testedObject.GetWithName(context.Background(), testAccount.Name)
 	if actualAccount == nil {
 		t.Fatalf("Expected Account to be found by id %s", testAccount.Id)
 	}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+// Random funds for up to six Payers, some with lots holding more than their balance as adjustments
+// leave them, and some expiring.
+func randomFundsForTest(random *rand.Rand) []*service.PayerFunds {
+	var funds []*service.PayerFunds
+	var started = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for payer := 0; payer < 1 + random.Intn(6); payer++ {
+		var payerFunds = &service.PayerFunds{Payer: fmt.Sprintf("PAYER-%d", payer)}
+		for lot := 0; lot < 1 + random.Intn(5); lot++ {
+			var fundsLot = &service.FundsLot{
+				Points: 1 + random.Intn(500),
+				Accumulated: started.Add(time.Duration(random.Intn(10000)) * time.Minute),
+			}
+			if random.Intn(2) == 0 {
+				fundsLot.Expires = fundsLot.Accumulated.Add(time.Duration(random.Intn(10000)) * time.Minute)
+			}
+			payerFunds.Lots = append(payerFunds.Lots, fundsLot)
+			payerFunds.Balance += fundsLot.Points
+		}
+		payerFunds.Balance -= random.Intn(payerFunds.Balance)
+		funds = append(funds, payerFunds)
+	}
+	return funds
+}
+
+func TestAllocationStrategiesSpendExactlyAndNeverOverdraw(t *testing.T) {
+	var strategies = []service.AllocationStrategy{
+		service.FifoAllocation{},
+		service.SoonestExpiringAllocation{},
+		service.PayerPriorityAllocation{Priority: []string{"PAYER-3", "PAYER-0", "UNKNOWN"}},
+		service.ProportionalAllocation{},
+		service.LargestBalanceAllocation{},
+	}
+	var random = rand.New(rand.NewSource(40))
+	for run := 0; run < 2000; run++ {
+		var funds = randomFundsForTest(random)
+		var available = 0
+		for _, payerFunds := range funds {
+			available += payerFunds.Balance
+		}
+		var points = random.Intn(available + 1)
+		for _, strategy := range strategies {
+			var allocation = strategy.Allocate(points, funds)
+			var allocated = 0
+			for _, payerFunds := range funds {
+				var taken = allocation[payerFunds.Payer]
+				if taken < 0 || taken > payerFunds.Balance {
+					t.Fatalf("Expected %s to take between 0 and %d from %s but it took %d", strategy.Name(), payerFunds.Balance, payerFunds.Payer, taken)
+				}
+				allocated += taken
+			}
+			if allocated != points || len(allocation) > len(funds) {
+				t.Fatalf("Expected %s to allocate exactly %d among %d Payers but allocated %d as %v", strategy.Name(), points, len(funds), allocated, allocation)
+			}
+		}
+	}
+}
+
+func TestAllocationStrategiesChoosePayers(t *testing.T) {
+	var day = func(n int) time.Time {
+		return time.Date(2024, 1, n, 0, 0, 0, 0, time.UTC)
+	}
+	var funds = []*service.PayerFunds{
+		{Payer: "DANNON", Balance: 300, Lots: []*service.FundsLot{{Points: 300, Accumulated: day(1), Expires: day(30)}}},
+		{Payer: "UNILEVER", Balance: 100, Lots: []*service.FundsLot{{Points: 100, Accumulated: day(2), Expires: day(10)}}},
+		{Payer: "MILLER COORS", Balance: 600, Lots: []*service.FundsLot{{Points: 600, Accumulated: day(3)}}},
+	}
+	var cases = []struct {
+		strategy service.AllocationStrategy
+		expected map[string]int
+	}{
+		{service.FifoAllocation{}, map[string]int{"DANNON": 300, "UNILEVER": 100, "MILLER COORS": 100}},
+		{service.SoonestExpiringAllocation{}, map[string]int{"UNILEVER": 100, "DANNON": 300, "MILLER COORS": 100}},
+		{service.PayerPriorityAllocation{Priority: []string{"MILLER COORS"}}, map[string]int{"MILLER COORS": 500}},
+		{service.ProportionalAllocation{}, map[string]int{"DANNON": 150, "UNILEVER": 50, "MILLER COORS": 300}},
+		{service.LargestBalanceAllocation{}, map[string]int{"MILLER COORS": 500}},
+	}
+	for _, c := range cases {
+		var allocation = c.strategy.Allocate(500, funds)
+		if fmt.Sprint(allocation) != fmt.Sprint(c.expected) {
+			t.Fatalf("Expected %s to allocate %v but allocated %v", c.strategy.Name(), c.expected, allocation)
+		}
+	}
+}
+
+func TestSpendChoosesAllocationPerRequestOrByPolicy(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	// imported so that the timestamps are kept; Dannon's points are the oldest though recorded last
+	transactionService.ImportLedger(context.Background(), &domain.LedgerExport{Transactions: []*domain.RewardTransaction{
+		{Payer: "UNILEVER", Points: 900, TransactionTimestamp: time.Now().Add(-time.Minute)},
+		{Payer: "DANNON", Points: 300, TransactionTimestamp: time.Now().Add(-time.Hour)},
+	}})
+	transactionService.SetSpendPolicy(service.SpendPolicy{Allocation: service.LargestBalanceAllocation{}})
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+
+	serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 100})
+	expectPayerBalanceForTest(t, transactionService, "UNILEVER", 800)
+	serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 100, Allocation: domain.AllocationFifo})
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 200)
+	serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 100, Allocation: domain.AllocationPayerPriority, PayerPriority: []string{"DANNON"}})
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 100)
+
+	var _, unknownErr = serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 100, Allocation: "random"})
+	expectStatus(t, unknownErr, 400, "a spend naming an unknown allocation")
+	var _, unorderedErr = serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 100, Allocation: domain.AllocationPayerPriority})
+	expectStatus(t, unorderedErr, 400, "a payer-priority spend without priorities")
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 100)
+	expectPayerBalanceForTest(t, transactionService, "UNILEVER", 800)
+}
+
+func expectPayerBalanceForTest(t *testing.T, transactionService *service.LocalTransactionService, payerId string, expectedPoints int) {
+	var balance, _ = transactionService.GetPointsProgressForPayer(context.Background(), payerId)
+	if balance.Points != expectedPoints {
+		t.Fatalf("Expected %s to hold %d Points but it holds %d", payerId, expectedPoints, balance.Points)
+	}
+}
+
+func TestSpendRestrictedToPayers(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	transactionService.AddPayer(context.Background(), "MILLER COORS", "Miller Coors")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 300})
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "UNILEVER", Points: 300})
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "MILLER COORS", Points: 300})
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+
+	serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 100, IncludePayers: []string{"MILLER COORS"}})
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 300)
+	expectPayerBalanceForTest(t, transactionService, "MILLER COORS", 200)
+	serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 400, ExcludePayers: []string{"DANNON"}, PayerCaps: map[string]int{"UNILEVER": 250}})
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 300)
+	expectPayerBalanceForTest(t, transactionService, "UNILEVER", 50)
+	expectPayerBalanceForTest(t, transactionService, "MILLER COORS", 50)
+
+	// a restricted spend falling short is refused even though spends are otherwise partial
+	var _, shortErr = serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 400, IncludePayers: []string{"DANNON", "UNILEVER"}})
+	expectStatus(t, shortErr, 409, "a restricted spend its Payers cannot cover")
+	var _, cappedErr = serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 200, PayerCaps: map[string]int{"DANNON": 100, "UNILEVER": 0, "MILLER COORS": 50}})
+	expectStatus(t, cappedErr, 409, "a spend its caps cannot cover")
+	var _, unknownErr = serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 10, IncludePayers: []string{"NESTLE"}})
+	expectStatus(t, unknownErr, 404, "a spend restricted to an unknown Payer")
+	var _, negativeErr = serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 10, PayerCaps: map[string]int{"DANNON": -1}})
+	expectStatus(t, negativeErr, 400, "a spend with a negative cap")
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 300)
+	expectPayerBalanceForTest(t, transactionService, "UNILEVER", 50)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/domain"
+)
+
+func TestAuditTrailRecordsActorsAndSurvivesRestart(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "ledger.journal")
+	var transactionService, journal = openJournaledServiceForTest(t, path)
+	var access, _ = newAccessService(config.AuthConfig{Enabled: true, BootstrapAdminKey: testBootstrapAdminKey}, transactionService)
+	var application = NewApplication(transactionService)
+	application.SetAccessService(access)
+	var server = httptest.NewServer(application.NewRouter())
+	var admin = newClientWithKey(server.URL, testBootstrapAdminKey)
+	admin.AddPayer("DANNON", "Dannon")
+	var dannonKey = issueKeyForTest(t, admin, &domain.ApiKey{Role: "payer", PayerId: "DANNON"})
+	var dannon = newClientWithKey(server.URL, dannonKey)
+	dannon.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Points: 300})
+	dannon.AddPurchase(&domain.RewardTransaction{Payer: "UNILEVER", Points: 100})
+	admin.SpendPoints(&domain.PointsSpendTransaction{Points: 100})
+	server.Close()
+	journal.Close()
+
+	var restarted, restartedJournal = openJournaledServiceForTest(t, path)
+	defer restartedJournal.Close()
+	var entries = restarted.ListAuditEntries(context.Background(), &domain.AuditFilter{})
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 audit entries to be replayed but found %d", len(entries))
+	}
+	var expected = []struct {
+		actor string
+		action string
+		result string
+	}{
+		{"bootstrap", domain.AuditActionAddPayer, domain.AuditResultSucceeded},
+		{entries[1].Actor, domain.AuditActionReceivePurchase, domain.AuditResultSucceeded},
+		{entries[1].Actor, domain.AuditActionReceivePurchase, domain.AuditResultRefused},
+		{"bootstrap", domain.AuditActionSpendPoints, domain.AuditResultSucceeded},
+	}
+	for i, entry := range entries {
+		if entry.Actor != expected[i].actor || entry.Action != expected[i].action || entry.Result != expected[i].result {
+			t.Errorf("Expected entry %d to record %s %s %s but was %s %s %s", i, expected[i].actor, expected[i].action, expected[i].result, entry.Actor, entry.Action, entry.Result)
+		}
+		if i > 0 && entry.Sequence <= entries[i - 1].Sequence {
+			t.Errorf("Expected entry %d to follow the entry before it but its sequence was %d", i, entry.Sequence)
+		}
+	}
+	if entries[1].Actor == "anonymous" || entries[1].Roles[0] != "payer" || entries[1].Payer != "DANNON" || entries[2].Error == "" {
+		t.Fatalf("Expected the purchases to be attributed to the payer key but got %+v and %+v", entries[1], entries[2])
+	}
+	var spendDigest = sha256.Sum256([]byte(`{"points":100}`))
+	if entries[3].PayloadHash != hex.EncodeToString(spendDigest[:]) {
+		t.Fatalf("Expected the spend's payload hash to be the SHA-256 of its request but was %s", entries[3].PayloadHash)
+	}
+
+	var restartedAccess, _ = newAccessService(config.AuthConfig{Enabled: true, BootstrapAdminKey: testBootstrapAdminKey}, restarted)
+	var restartedApplication = NewApplication(restarted)
+	restartedApplication.SetAccessService(restartedAccess)
+	var restartedServer = httptest.NewServer(restartedApplication.NewRouter())
+	defer restartedServer.Close()
+	var refused, queryErr = newClientWithKey(restartedServer.URL, testBootstrapAdminKey).ListAuditEntries(&domain.AuditFilter{Result: domain.AuditResultRefused, Payer: "UNILEVER"})
+	if queryErr != nil || len(refused) != 1 || refused[0].Sequence != entries[2].Sequence {
+		t.Fatalf("Expected the refused purchase to be found by filtering but got %v (%v)", refused, queryErr)
+	}
+	var page, _ = newClientWithKey(restartedServer.URL, testBootstrapAdminKey).ListAuditEntries(&domain.AuditFilter{AfterSequence: entries[1].Sequence, Limit: 1})
+	if len(page) != 1 || page[0].Sequence != entries[2].Sequence {
+		t.Fatalf("Expected a page of the single entry after the first purchase but got %v", page)
+	}
+}
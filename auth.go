@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+	"purchase-tracker-service/service"
+)
+
+const (
+	apiKeyHeader = "X-Api-Key"
+	bearerTokenPrefix = "Bearer "
+)
+
+// Require every request to present an API key issued through access, or the configured bootstrap
+// key; without an access service requests are not authenticated at all.
+func (a *Application) SetAccessService(access *service.LocalAccessService) {
+	a.access = access
+}
+
+// Open the configured key store and build the access service authenticating against it.
+func newAccessService(authConfig config.AuthConfig, transactionService *service.LocalTransactionService) (*service.LocalAccessService, error) {
+	var keyStore = dao.NewLocalApiKeyStore()
+	if authConfig.KeysPath != "" {
+		var openErr error
+		if keyStore, openErr = dao.OpenFileApiKeyStore(authConfig.KeysPath); openErr != nil {
+			return nil, openErr
+		}
+	}
+	var access = service.NewLocalAccessService(keyStore, transactionService)
+	if authConfig.BootstrapAdminKey != "" {
+		access.AddBootstrapAdminKey(authConfig.BootstrapAdminKey)
+	}
+	return access, nil
+}
+
+// Accept bearer tokens verified by verifier alongside API keys; only takes effect once an access
+// service is set.
+func (a *Application) SetTokenVerifier(verifier *auth.TokenVerifier) {
+	a.tokenVerifier = verifier
+}
+
+// Read the configured key set and build the verifier of bearer tokens signed with it.
+func newTokenVerifier(jwtConfig config.JwtConfig) (*auth.TokenVerifier, error) {
+	var keys, keysErr = auth.OpenKeySet(jwtConfig.Jwks)
+	if keysErr != nil {
+		return nil, keysErr
+	}
+	var verifier = auth.NewTokenVerifier(keys, jwtConfig.Audience)
+	verifier.SetIssuer(jwtConfig.Issuer)
+	verifier.SetClaimMapping(auth.ClaimMapping{
+		Purchaser: jwtConfig.PurchaserClaim,
+		Roles: jwtConfig.RolesClaim,
+		Payer: jwtConfig.PayerClaim,
+	})
+	return verifier, nil
+}
+
+// Router middleware identifying the caller from a bearer token in the Authorization header, when
+// a token verifier is set, or otherwise from the X-Api-Key header.  The identity is added to the
+// request's context, where the service finds it to restrict what the caller may see and do, and
+// to the request's logger.
+func (a *Application) AuthenticationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.access == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.throttleRefusedAddress(w, r) {
+			return
+		}
+		var identity, authenticateErr = a.authenticate(r)
+		if authenticateErr != nil {
+			if !a.chargeRefusedAddress(w, r) {
+				return
+			}
+			w.Header().Add("WWW-Authenticate", "ApiKey header=\"" + apiKeyHeader + "\"")
+			if a.tokenVerifier != nil {
+				w.Header().Add("WWW-Authenticate", "Bearer error=\"invalid_token\"")
+			}
+			WriteServiceResponse(w, nil, authenticateErr)
+			return
+		}
+		var ctx = auth.WithIdentity(r.Context(), identity)
+		ctx = logging.WithLogger(ctx, log.With(logging.FromContext(ctx), "subject", identity.Subject))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (a *Application) authenticate(r *http.Request) (*auth.Identity, error) {
+	var authorization = r.Header.Get("Authorization")
+	if a.tokenVerifier != nil && strings.HasPrefix(authorization, bearerTokenPrefix) {
+		return a.tokenVerifier.Verify(strings.TrimSpace(strings.TrimPrefix(authorization, bearerTokenPrefix)))
+	}
+	return a.access.Authenticate(r.Context(), r.Header.Get(apiKeyHeader))
+}
+
+// Only let callers holding one of roles reach handler; any role will do when none are given.
+func (a *Application) authorize(handler http.Handler, roles ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var identity = auth.FromContext(r.Context())
+		if a.access == nil || identity == nil || len(roles) == 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		for _, role := range roles {
+			if identity.HasRole(role) {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		WriteServiceResponse(w, nil, service.ForbiddenError{Reason: "the API key's role may not use this endpoint"})
+	})
+}
+
+func (a *Application) HandleListApiKeys() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteServiceResponse(w, a.access.ListApiKeys(r.Context()), nil)
+	})
+}
+
+func (a *Application) HandleIssueApiKey() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request domain.ApiKey
+		if decodeErr := json.NewDecoder(r.Body).Decode(&request); decodeErr != nil {
+			WriteDecodeErrorResponse(w, decodeErr)
+			return
+		}
+		var result, serviceError = a.access.IssueApiKey(r.Context(), &request)
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandleRevokeApiKey() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.access.RevokeApiKey(r.Context(), mux.Vars(r)["keyId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
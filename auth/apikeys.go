@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+// API keys read "<key id>.<secret>"; the id locates the stored key and only a hash of the whole
+// key is ever stored.
+const apiKeySeparator = "."
+
+// Generate a new API key and the id it is stored under.
+func GenerateApiKey() (string, string) {
+	var keyId = randomHex(6)
+	return keyId, keyId + apiKeySeparator + randomHex(32)
+}
+
+func randomHex(length int) string {
+	var randomBytes = make([]byte, length)
+	if _, readErr := rand.Read(randomBytes); readErr != nil {
+		panic(readErr)
+	}
+	return hex.EncodeToString(randomBytes)
+}
+
+// The keys are long random secrets rather than passwords, so a plain SHA-256 is enough to make a
+// leaked key store useless.
+func HashApiKey(key string) string {
+	var digest = sha256.Sum256([]byte(key))
+	return hex.EncodeToString(digest[:])
+}
+
+func ApiKeyId(key string) (string, bool) {
+	var keyId, _, hasSeparator = strings.Cut(key, apiKeySeparator)
+	return keyId, hasSeparator && keyId != ""
+}
+
+func ApiKeyMatches(key string, keyHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashApiKey(key)), []byte(keyHash)) == 1
+}
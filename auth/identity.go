@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+)
+
+const (
+	// May manage Payers and API keys, export and import the ledger, and act on any balance.
+	RoleAdmin = "admin"
+	// A Payer's integration, which may only post Purchases accumulating Points under that Payer.
+	RolePayer = "payer"
+	// A Purchaser, who may only spend and read the balances of Points they accumulated.
+	RolePurchaser = "purchaser"
+)
+
+func IsRole(role string) bool {
+	return role == RoleAdmin || role == RolePayer || role == RolePurchaser
+}
+
+// The authenticated caller of a request.
+type Identity struct {
+	// Identifies the credential, such as the id of an API key.
+	Subject string
+	Roles []string
+	// The Payer a payer integration acts for.
+	PayerId string
+	// The Purchaser a purchaser acts as.
+	PurchaserId string
+}
+
+func (i *Identity) HasRole(role string) bool {
+	for _, held := range i.Roles {
+		if held == role {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey int
+
+const identityContextKey contextKey = 0
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey, identity)
+}
+
+// The identity of the caller ctx serves, or nil when authentication is disabled or ctx did not
+// begin with a request.
+func FromContext(ctx context.Context) *Identity {
+	var identity, _ = ctx.Value(identityContextKey).(*Identity)
+	return identity
+}
+
+// Stands in for the Purchaser of a purchaser that does not say which it is.  It is not a usable
+// Purchaser id, so such a caller is restricted to no Points at all rather than to the Points no
+// Purchaser accumulated.
+const unidentifiedPurchaser = "\x00unidentified"
+
+// The Purchaser whose Points the caller of ctx is restricted to; administrators and unauthenticated
+// contexts are not restricted.
+func PurchaserScope(ctx context.Context) (string, bool) {
+	var identity = FromContext(ctx)
+	if identity == nil || identity.HasRole(RoleAdmin) || !identity.HasRole(RolePurchaser) {
+		return "", false
+	}
+	if identity.PurchaserId == "" {
+		return unidentifiedPurchaser, true
+	}
+	return identity.PurchaserId, true
+}
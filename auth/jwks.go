@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A JWKS fetched over HTTP is fetched again when a token names a key it does not hold, as after
+// the issuer rotates keys, but no more often than this.
+const minimumKeySetRefreshInterval = time.Minute
+
+// The public keys bearer tokens are verified with, read from a JSON Web Key Set kept in a file or
+// served at an http(s) URL.
+type KeySet struct {
+	lock sync.Mutex
+	source string
+	httpClient *http.Client
+	keysById map[string]crypto.PublicKey
+	loadedTimestamp time.Time
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	KeyId string `json:"kid"`
+	KeyType string `json:"kty"`
+	Use string `json:"use"`
+	N string `json:"n"`
+	E string `json:"e"`
+	Curve string `json:"crv"`
+	X string `json:"x"`
+	Y string `json:"y"`
+}
+
+// Read the key set at source, a file path or an http(s) URL.
+func OpenKeySet(source string) (*KeySet, error) {
+	var keySet = &KeySet{
+		source: source,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	if loadErr := keySet.load(); loadErr != nil {
+		return nil, loadErr
+	}
+	return keySet, nil
+}
+
+func (k *KeySet) isRemote() bool {
+	return strings.HasPrefix(k.source, "http://") || strings.HasPrefix(k.source, "https://")
+}
+
+// The key a token names by keyId; tokens naming no key may use the only key of a single key set.
+func (k *KeySet) Key(keyId string) (crypto.PublicKey, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if key := k.lookup(keyId); key != nil {
+		return key, nil
+	}
+	if k.isRemote() && time.Since(k.loadedTimestamp) >= minimumKeySetRefreshInterval {
+		if loadErr := k.load(); loadErr != nil {
+			return nil, loadErr
+		}
+		if key := k.lookup(keyId); key != nil {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no key '%s' in the key set", keyId)
+}
+
+func (k *KeySet) lookup(keyId string) crypto.PublicKey {
+	if keyId == "" && len(k.keysById) == 1 {
+		for _, key := range k.keysById {
+			return key
+		}
+	}
+	return k.keysById[keyId]
+}
+
+func (k *KeySet) load() error {
+	var content, readErr = k.read()
+	if readErr != nil {
+		return fmt.Errorf("Unable to read the key set %s: %w", k.source, readErr)
+	}
+	var keySet jsonWebKeySet
+	if decodeErr := json.Unmarshal(content, &keySet); decodeErr != nil {
+		return fmt.Errorf("Unable to parse the key set %s: %w", k.source, decodeErr)
+	}
+	var keysById = make(map[string]crypto.PublicKey)
+	for _, webKey := range keySet.Keys {
+		if webKey.Use != "" && webKey.Use != "sig" {
+			continue
+		}
+		var key, keyErr = webKey.publicKey()
+		if keyErr != nil {
+			return fmt.Errorf("Unable to read key '%s' of the key set %s: %w", webKey.KeyId, k.source, keyErr)
+		}
+		if key != nil {
+			keysById[webKey.KeyId] = key
+		}
+	}
+	k.keysById = keysById
+	k.loadedTimestamp = time.Now()
+	return nil
+}
+
+func (k *KeySet) read() ([]byte, error) {
+	if !k.isRemote() {
+		return os.ReadFile(k.source)
+	}
+	var response, getErr = k.httpClient.Get(k.source)
+	if getErr != nil {
+		return nil, getErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", response.StatusCode)
+	}
+	return io.ReadAll(response.Body)
+}
+
+// Keys of types other than RSA and EC are skipped, since no accepted algorithm could use them.
+func (webKey *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch webKey.KeyType {
+	case "RSA":
+		var modulus, modulusErr = decodeKeyInteger(webKey.N)
+		var exponent, exponentErr = decodeKeyInteger(webKey.E)
+		if modulusErr != nil || exponentErr != nil || !exponent.IsInt64() {
+			return nil, fmt.Errorf("invalid RSA modulus or exponent")
+		}
+		return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+	case "EC":
+		if webKey.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve '%s'", webKey.Curve)
+		}
+		var x, xErr = decodeKeyInteger(webKey.X)
+		var y, yErr = decodeKeyInteger(webKey.Y)
+		if xErr != nil || yErr != nil || !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeKeyInteger(encoded string) (*big.Int, error) {
+	var decoded, decodeErr = base64.RawURLEncoding.DecodeString(encoded)
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+	return new(big.Int).SetBytes(decoded), nil
+}
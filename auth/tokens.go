@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Names the claims of a bearer token an Identity is read from.
+type ClaimMapping struct {
+	// The Purchaser a purchaser acts as.
+	Purchaser string
+	// Either a list of roles or a single space separated string of them; unknown roles are ignored.
+	Roles string
+	// The Payer a payer integration acts for.
+	Payer string
+}
+
+func DefaultClaimMapping() ClaimMapping {
+	return ClaimMapping{Purchaser: "sub", Roles: "roles", Payer: "payer_id"}
+}
+
+// Verifies RS256 and ES256 bearer tokens issued for audience and signed by a key of keys.
+type TokenVerifier struct {
+	keys *KeySet
+	audience string
+	issuer string
+	claims ClaimMapping
+	parser *jwt.Parser
+}
+
+func NewTokenVerifier(keys *KeySet, audience string) *TokenVerifier {
+	return &TokenVerifier{
+		keys: keys,
+		audience: audience,
+		claims: DefaultClaimMapping(),
+		parser: jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "ES256"})),
+	}
+}
+
+// Also require tokens to have been issued by issuer.
+func (v *TokenVerifier) SetIssuer(issuer string) {
+	v.issuer = issuer
+}
+
+func (v *TokenVerifier) SetClaimMapping(claims ClaimMapping) {
+	v.claims = claims
+}
+
+type InvalidTokenError struct {
+	Reason string
+}
+
+func (e InvalidTokenError) Error() string {
+	return fmt.Sprintf("The bearer token is not valid: %s", e.Reason)
+}
+
+// Identify the caller presenting token, refusing it when it is expired, not yet valid, meant for
+// another audience or issuer, or not signed by a key of the key set.
+func (v *TokenVerifier) Verify(token string) (*Identity, error) {
+	var claims = jwt.MapClaims{}
+	var _, parseErr = v.parser.ParseWithClaims(token, claims, func(parsed *jwt.Token) (interface{}, error) {
+		var keyId, _ = parsed.Header["kid"].(string)
+		return v.keys.Key(keyId)
+	})
+	if parseErr != nil {
+		return nil, InvalidTokenError{tokenErrorReason(parseErr)}
+	}
+	if _, hasExpiry := claims["exp"]; !hasExpiry {
+		return nil, InvalidTokenError{"token has no expiry"}
+	}
+	if !claims.VerifyAudience(v.audience, true) {
+		return nil, InvalidTokenError{"token is not meant for this audience"}
+	}
+	if v.issuer != "" && !claims.VerifyIssuer(v.issuer, true) {
+		return nil, InvalidTokenError{"token was issued by an unknown issuer"}
+	}
+	var subject, _ = claims["sub"].(string)
+	var purchaserId, _ = claims[v.claims.Purchaser].(string)
+	var payerId, _ = claims[v.claims.Payer].(string)
+	var identity = &Identity{
+		Subject: subject,
+		Roles: rolesFromClaim(claims[v.claims.Roles]),
+		PayerId: payerId,
+		PurchaserId: purchaserId,
+	}
+	// as an API key must, a token acting as a Purchaser or for a Payer must say which
+	if identity.HasRole(RolePurchaser) && purchaserId == "" {
+		return nil, InvalidTokenError{fmt.Sprintf("token has the %s role but no %s claim", RolePurchaser, v.claims.Purchaser)}
+	}
+	if identity.HasRole(RolePayer) && payerId == "" {
+		return nil, InvalidTokenError{fmt.Sprintf("token has the %s role but no %s claim", RolePayer, v.claims.Payer)}
+	}
+	return identity, nil
+}
+
+func rolesFromClaim(claim interface{}) []string {
+	var named []string
+	switch value := claim.(type) {
+	case string:
+		named = strings.Fields(value)
+	case []interface{}:
+		for _, role := range value {
+			if roleName, isString := role.(string); isString {
+				named = append(named, roleName)
+			}
+		}
+	}
+	var roles []string
+	for _, role := range named {
+		if IsRole(role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Say why a token was refused without echoing anything the caller could use to forge one.
+func tokenErrorReason(parseErr error) string {
+	var validationErr *jwt.ValidationError
+	if !errors.As(parseErr, &validationErr) {
+		return "token could not be parsed"
+	}
+	switch {
+	case validationErr.Errors & jwt.ValidationErrorExpired != 0:
+		return "token has expired"
+	case validationErr.Errors & jwt.ValidationErrorNotValidYet != 0:
+		return "token is not valid yet"
+	case validationErr.Errors & jwt.ValidationErrorMalformed != 0:
+		return "token is malformed"
+	case validationErr.Errors & (jwt.ValidationErrorSignatureInvalid | jwt.ValidationErrorUnverifiable) != 0:
+		return "token signature could not be verified"
+	default:
+		return "token could not be verified"
+	}
+}
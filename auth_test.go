@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"github.com/golang-jwt/jwt/v4"
+	"purchase-tracker-service/client"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+const testBootstrapAdminKey = "bootstrap-admin-key-for-tests"
+
+func newAuthTestServer(t *testing.T, keysPath string) *httptest.Server {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	var access, accessErr = newAccessService(config.AuthConfig{Enabled: true, KeysPath: keysPath, BootstrapAdminKey: testBootstrapAdminKey}, transactionService)
+	if accessErr != nil {
+		t.Fatalf("Expected the access service to open: %s", accessErr)
+	}
+	var application = NewApplication(transactionService)
+	application.SetAccessService(access)
+	return httptest.NewServer(application.NewRouter())
+}
+
+func newClientWithKey(serverUrl string, key string) *client.Client {
+	var keyClient = client.NewClient(serverUrl)
+	keyClient.SetApiKey(key)
+	return keyClient
+}
+
+func issueKeyForTest(t *testing.T, admin *client.Client, request *domain.ApiKey) string {
+	var issued, issueErr = admin.IssueApiKey(request)
+	if issueErr != nil {
+		t.Fatalf("Expected a %s key to be issued: %s", request.Role, issueErr)
+	}
+	return issued.Key
+}
+
+func expectStatus(t *testing.T, err error, statusCode int, action string) {
+	var serviceError client.ServiceError
+	if !errors.As(err, &serviceError) || serviceError.StatusCode != statusCode {
+		t.Fatalf("Expected %s to be answered with %d but got %v", action, statusCode, err)
+	}
+}
+
+func TestApiKeyRolesRestrictPayersAndPurchasers(t *testing.T) {
+	var server = newAuthTestServer(t, "")
+	defer server.Close()
+	var admin = newClientWithKey(server.URL, testBootstrapAdminKey)
+	var dannon = newClientWithKey(server.URL, issueKeyForTest(t, admin, &domain.ApiKey{Role: "payer", PayerId: "DANNON"}))
+	var alice = newClientWithKey(server.URL, issueKeyForTest(t, admin, &domain.ApiKey{Role: "purchaser", PurchaserId: "alice"}))
+	var bob = newClientWithKey(server.URL, issueKeyForTest(t, admin, &domain.ApiKey{Role: "purchaser", PurchaserId: "bob"}))
+
+	var _, anonymousErr = client.NewClient(server.URL).ListPayers()
+	expectStatus(t, anonymousErr, 401, "a request without a key")
+	var _, wrongKeyErr = newClientWithKey(server.URL, "0123456789ab.not-the-secret").ListPayers()
+	expectStatus(t, wrongKeyErr, 401, "a request with an unknown key")
+
+	if _, err := dannon.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: "alice", Points: 300}); err != nil {
+		t.Fatalf("Expected the payer key to post a purchase for its own payer: %s", err)
+	}
+	if _, err := dannon.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: "bob", Points: 200}); err != nil {
+		t.Fatalf("Expected the payer key to post a purchase for its own payer: %s", err)
+	}
+	var _, otherPayerErr = dannon.AddPurchase(&domain.RewardTransaction{Payer: "UNILEVER", Purchaser: "alice", Points: 100})
+	expectStatus(t, otherPayerErr, 403, "a purchase for another payer")
+	var _, payerSpendErr = dannon.SpendPoints(&domain.PointsSpendTransaction{Points: 10})
+	expectStatus(t, payerSpendErr, 403, "a spend with a payer key")
+	var _, purchaserPurchaseErr = alice.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Points: 100})
+	expectStatus(t, purchaserPurchaseErr, 403, "a purchase with a purchaser key")
+	var _, purchaserExportErr = alice.ExportLedger()
+	expectStatus(t, purchaserExportErr, 403, "an export with a purchaser key")
+
+	var aliceBalance, _ = alice.GetPayerBalance("DANNON")
+	if aliceBalance.Points != 300 {
+		t.Fatalf("Expected alice to see only her 300 points but saw %d", aliceBalance.Points)
+	}
+	var balances, spendErr = alice.SpendPoints(&domain.PointsSpendTransaction{Points: 500})
+	if spendErr != nil {
+		t.Fatalf("Expected alice to spend her points: %s", spendErr)
+	}
+	for _, balance := range balances {
+		if balance.Points != 0 {
+			t.Errorf("Expected alice to have spent everything under %s but %d remain", balance.Payer.Id, balance.Points)
+		}
+	}
+	var bobBalance, _ = bob.GetPayerBalance("DANNON")
+	if bobBalance.Points != 200 {
+		t.Fatalf("Expected bob's 200 points to be untouched by alice's spend but saw %d", bobBalance.Points)
+	}
+	var payerBalance, _ = admin.GetPayerBalance("DANNON")
+	if payerBalance.Points != 200 {
+		t.Fatalf("Expected the administrator to see DANNON's whole balance of 200 but saw %d", payerBalance.Points)
+	}
+	if _, err := admin.SpendPoints(&domain.PointsSpendTransaction{Points: 150}); err != nil {
+		t.Fatalf("Expected the administrator to spend across purchasers: %s", err)
+	}
+	bobBalance, _ = bob.GetPayerBalance("DANNON")
+	if bobBalance.Points != 50 {
+		t.Fatalf("Expected the administrator's spend to be charged to bob, the only holder, leaving 50 but saw %d", bobBalance.Points)
+	}
+}
+
+func TestRevokedApiKeysAreRefusedAndKeysAreStoredHashed(t *testing.T) {
+	var keysPath = filepath.Join(t.TempDir(), "api-keys.json")
+	var server = newAuthTestServer(t, keysPath)
+	defer server.Close()
+	var admin = newClientWithKey(server.URL, testBootstrapAdminKey)
+	var issued, issueErr = admin.IssueApiKey(&domain.ApiKey{Name: "reporting", Role: "admin"})
+	if issueErr != nil {
+		t.Fatalf("Expected an admin key to be issued: %s", issueErr)
+	}
+	var _, unknownPayerErr = admin.IssueApiKey(&domain.ApiKey{Role: "payer", PayerId: "NOBODY"})
+	expectStatus(t, unknownPayerErr, 404, "a payer key for an unknown payer")
+	var _, badRoleErr = admin.IssueApiKey(&domain.ApiKey{Role: "owner"})
+	expectStatus(t, badRoleErr, 400, "a key with an unknown role")
+
+	var stored, readErr = os.ReadFile(keysPath)
+	if readErr != nil {
+		t.Fatalf("Expected the key store to be written: %s", readErr)
+	}
+	var _, secret, _ = strings.Cut(issued.Key, ".")
+	if !strings.Contains(string(stored), issued.ApiKey.Id) || strings.Contains(string(stored), secret) {
+		t.Fatalf("Expected the key store to hold the key id but not the key itself: %s", stored)
+	}
+
+	var reporting = newClientWithKey(server.URL, issued.Key)
+	if _, err := reporting.ExportLedger(); err != nil {
+		t.Fatalf("Expected the issued admin key to export the ledger: %s", err)
+	}
+	var purchaser = newClientWithKey(server.URL, issueKeyForTest(t, admin, &domain.ApiKey{Role: "purchaser", PurchaserId: "alice"}))
+	var _, purchaserAdminErr = purchaser.ListApiKeys()
+	expectStatus(t, purchaserAdminErr, 403, "a purchaser listing keys")
+	if _, err := admin.RevokeApiKey(issued.ApiKey.Id); err != nil {
+		t.Fatalf("Expected the key to be revoked: %s", err)
+	}
+	var _, revokedErr = reporting.ExportLedger()
+	expectStatus(t, revokedErr, 401, "a request with a revoked key")
+	var _, missingKeyErr = admin.RevokeApiKey("000000000000")
+	expectStatus(t, missingKeyErr, 404, "revoking an unknown key")
+	var keys, _ = admin.ListApiKeys()
+	if len(keys) != 2 {
+		t.Fatalf("Expected both issued keys to be listed but got %d", len(keys))
+	}
+}
+
+func encodeKeyInteger(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+// Write a JWKS holding the public halves of an RSA and an EC key and return its path.
+func writeJwksForTest(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	var jwks = map[string]interface{}{"keys": []map[string]string{
+		{"kid": "rsa-1", "kty": "RSA", "use": "sig", "n": encodeKeyInteger(rsaKey.N), "e": encodeKeyInteger(big.NewInt(int64(rsaKey.E)))},
+		{"kid": "ec-1", "kty": "EC", "crv": "P-256", "x": encodeKeyInteger(ecKey.X), "y": encodeKeyInteger(ecKey.Y)},
+	}}
+	var path = filepath.Join(t.TempDir(), "jwks.json")
+	var content, _ = json.Marshal(jwks)
+	if writeErr := os.WriteFile(path, content, 0600); writeErr != nil {
+		t.Fatalf("Expected the JWKS to be written: %s", writeErr)
+	}
+	return path
+}
+
+func signTokenForTest(t *testing.T, method jwt.SigningMethod, keyId string, key interface{}, claims jwt.MapClaims) string {
+	var token = jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = keyId
+	var signed, signErr = token.SignedString(key)
+	if signErr != nil {
+		t.Fatalf("Expected the token to be signed: %s", signErr)
+	}
+	return signed
+}
+
+func TestBearerTokensAreVerifiedAgainstTheJwks(t *testing.T) {
+	var rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	var ecKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var otherKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	var jwtConfig = config.Default().Auth.Jwt
+	jwtConfig.Jwks = writeJwksForTest(t, rsaKey, ecKey)
+	jwtConfig.Audience = "purchase-tracker"
+	jwtConfig.Issuer = "https://gateway.example"
+	var verifier, verifierErr = newTokenVerifier(jwtConfig)
+	if verifierErr != nil {
+		t.Fatalf("Expected the JWKS to load: %s", verifierErr)
+	}
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var application = NewApplication(transactionService)
+	var access, _ = newAccessService(config.AuthConfig{Enabled: true}, transactionService)
+	application.SetAccessService(access)
+	application.SetTokenVerifier(verifier)
+	var server = httptest.NewServer(application.NewRouter())
+	defer server.Close()
+
+	var claims = func(subject string, roles interface{}, audience string, expires time.Time) jwt.MapClaims {
+		return jwt.MapClaims{"sub": subject, "roles": roles, "aud": audience, "iss": jwtConfig.Issuer, "exp": expires.Unix(), "payer_id": "DANNON"}
+	}
+	var hourFromNow = time.Now().Add(time.Hour)
+	var request = func(method string, path string, token string, body string) (int, string) {
+		var httpRequest, _ = http.NewRequest(method, server.URL + path, strings.NewReader(body))
+		httpRequest.Header.Set("Authorization", "Bearer " + token)
+		var response, requestErr = http.DefaultClient.Do(httpRequest)
+		if requestErr != nil {
+			t.Fatalf("Expected %s %s to be answered: %s", method, path, requestErr)
+		}
+		defer response.Body.Close()
+		var responseBody, _ = io.ReadAll(response.Body)
+		return response.StatusCode, string(responseBody)
+	}
+
+	var payerToken = signTokenForTest(t, jwt.SigningMethodES256, "ec-1", ecKey, claims("dannon-integration", "payer", "purchase-tracker", hourFromNow))
+	if status, body := request("POST", "/purchases", payerToken, `{"payer": "DANNON", "purchaser": "alice", "points": 300}`); status != 200 {
+		t.Fatalf("Expected an ES256 payer token to post a purchase but got %d: %s", status, body)
+	}
+	request("POST", "/purchases", payerToken, `{"payer": "DANNON", "purchaser": "bob", "points": 200}`)
+	var aliceToken = signTokenForTest(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims("alice", []string{"purchaser"}, "purchase-tracker", hourFromNow))
+	var status, body = request("GET", "/payers/DANNON/balances", aliceToken, "")
+	var balance domain.RewardsAccumulateProgress
+	json.Unmarshal([]byte(body), &balance)
+	if status != 200 || balance.Points != 300 {
+		t.Fatalf("Expected alice's RS256 token to see only her 300 points but got %d: %s", status, body)
+	}
+	if status, _ = request("POST", "/purchases", aliceToken, `{"payer": "DANNON", "points": 5}`); status != 403 {
+		t.Fatalf("Expected a purchaser token to be forbidden from posting purchases but got %d", status)
+	}
+
+	// a token that does not say which Purchaser it acts as may not spend the unattributed points
+	var unattributedToken = signTokenForTest(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, jwt.MapClaims{"roles": "purchaser", "aud": "purchase-tracker", "iss": jwtConfig.Issuer, "exp": hourFromNow.Unix()})
+	request("POST", "/purchases", payerToken, `{"payer": "DANNON", "points": 1000}`)
+	if status, body := request("POST", "/rewards/spend", unattributedToken, `{"points": 500}`); status != 401 {
+		t.Fatalf("Expected a purchaser token without a purchaser claim to be answered with 401 but got %d: %s", status, body)
+	}
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 1500)
+	if allocations, spendErr := transactionService.SpendPoints(purchaserContextForTest(""), 500); spendErr == nil && len(allocations) > 0 {
+		t.Fatalf("Expected a purchaser identity without a Purchaser to be restricted to no points but spent %v", allocations)
+	}
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 1500)
+	var payerlessToken = signTokenForTest(t, jwt.SigningMethodES256, "ec-1", ecKey, jwt.MapClaims{"sub": "integration", "roles": "payer", "aud": "purchase-tracker", "iss": jwtConfig.Issuer, "exp": hourFromNow.Unix()})
+	if status, body := request("GET", "/payers/balances", payerlessToken, ""); status != 401 {
+		t.Fatalf("Expected a payer token without a payer claim to be answered with 401 but got %d: %s", status, body)
+	}
+
+	for _, refused := range []struct {
+		description string
+		token string
+	}{
+		{"an expired token", signTokenForTest(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims("alice", "purchaser", "purchase-tracker", time.Now().Add(-time.Minute)))},
+		{"a token for another audience", signTokenForTest(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims("alice", "purchaser", "billing", hourFromNow))},
+		{"a token signed by an unknown key", signTokenForTest(t, jwt.SigningMethodRS256, "rsa-1", otherKey, claims("alice", "purchaser", "purchase-tracker", hourFromNow))},
+		{"a token with an unaccepted algorithm", signTokenForTest(t, jwt.SigningMethodHS256, "rsa-1", []byte("secret"), claims("alice", "purchaser", "purchase-tracker", hourFromNow))},
+		{"a malformed token", "not.a.token"},
+	} {
+		if status, body := request("GET", "/payers/balances", refused.token, ""); status != 401 {
+			t.Errorf("Expected %s to be answered with 401 but got %d: %s", refused.description, status, body)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+const (
+	lastEventIdHeader = "Last-Event-ID"
+	// How often an idle stream is sent a comment, so that proxies keep it open and a subscriber
+	// that went away is noticed.
+	balanceStreamHeartbeat = 15 * time.Second
+)
+
+// Wakes the balance streams being served whenever a change is committed.  A stream is only told
+// that something changed and reads the changes from the transaction log itself, so a slow
+// subscriber falls behind without holding up the ledger or any other subscriber.
+type balanceStreams struct {
+	lock sync.Mutex
+	subscribers map[chan struct{}]bool
+	// Closed when the server shuts down, ending every stream being served.
+	done chan struct{}
+}
+
+func newBalanceStreams(transactionService *service.LocalTransactionService) *balanceStreams {
+	var streams = &balanceStreams{subscribers: make(map[chan struct{}]bool), done: make(chan struct{})}
+	transactionService.AddCommitObserver(streams.notify)
+	return streams
+}
+
+func (b *balanceStreams) subscribe() chan struct{} {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var changed = make(chan struct{}, 1)
+	b.subscribers[changed] = true
+	return changed
+}
+
+func (b *balanceStreams) unsubscribe(changed chan struct{}) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.subscribers, changed)
+}
+
+// End every stream being served, and any opened later.  Streams never finish on their own, so a
+// server shutting down would otherwise wait out its whole shutdown timeout for them.
+func (b *balanceStreams) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	select {
+	case <-b.done:
+	default:
+		close(b.done)
+	}
+}
+
+// Called with the service's lock held, so never blocks: a subscriber already told of an earlier
+// change it has not yet read will find this one too.
+func (b *balanceStreams) notify(commit *service.LedgerCommit) {
+	if len(commit.Transactions) == 0 {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for changed := range b.subscribers {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Stream every change to the balances the caller may see as Server-Sent Events, beginning after
+// the position of the Last-Event-ID header, or the lastEventId query parameter, when resuming and
+// with the next change otherwise.
+func (a *Application) HandleBalanceEvents() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var flusher, isFlusher = w.(http.Flusher)
+		if !isFlusher {
+			WriteServiceResponse(w, nil, fmt.Errorf("the response cannot be streamed"))
+			return
+		}
+		// a stream outlives the server's write timeout, which would otherwise cut it off
+		if deadlineErr := http.NewResponseController(w).SetWriteDeadline(time.Time{}); deadlineErr != nil {
+			WriteServiceResponse(w, nil, fmt.Errorf("the response cannot be streamed: %w", deadlineErr))
+			return
+		}
+		var position, requestDecodeErr = decodeLastEventPosition(r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+			return
+		}
+		// subscribing first so that no change made while catching up is missed
+		var changed = a.balanceStreams.subscribe()
+		defer a.balanceStreams.unsubscribe(changed)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(200)
+		var heartbeat = time.NewTicker(balanceStreamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			var changes []*domain.BalanceChange
+			changes, position = a.transactionService.GetBalanceChangesSince(r.Context(), position)
+			for _, change := range changes {
+				if writeErr := writeBalanceEvent(w, change); writeErr != nil {
+					return
+				}
+			}
+			flusher.Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-a.balanceStreams.done:
+				return
+			case <-changed:
+			case <-heartbeat.C:
+				if _, writeErr := io.WriteString(w, ": heartbeat\n\n"); writeErr != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+// End the balance streams being served; registered with the server to run when it shuts down.
+func (a *Application) CloseBalanceStreams() {
+	a.balanceStreams.close()
+}
+
+// The position to resume a balance stream after; negative when the subscriber is not resuming.
+func decodeLastEventPosition(r *http.Request) (int, error) {
+	var lastEventId = r.Header.Get(lastEventIdHeader)
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("lastEventId")
+	}
+	if lastEventId == "" {
+		return -1, nil
+	}
+	var position, parseErr = strconv.Atoi(lastEventId)
+	if parseErr != nil || position < 0 {
+		return 0, fmt.Errorf("%s must be the id of a balance event", lastEventIdHeader)
+	}
+	return position, nil
+}
+
+func writeBalanceEvent(w io.Writer, change *domain.BalanceChange) error {
+	var data, encodeErr = json.Marshal(change)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	var _, writeErr = fmt.Fprintf(w, "id: %d\nevent: balance\ndata: %s\n\n", change.Position, data)
+	return writeErr
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"github.com/go-kit/kit/log"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+type balanceEvent struct {
+	id string
+	change *domain.BalanceChange
+}
+
+type balanceStreamForTest struct {
+	response *http.Response
+	events chan *balanceEvent
+}
+
+// Subscribe to the balance stream of serverUrl, resuming after lastEventId unless it is empty.
+func openBalanceStreamForTest(t *testing.T, serverUrl string, apiKey string, lastEventId string) *balanceStreamForTest {
+	var request, _ = http.NewRequest("GET", serverUrl + "/events/balances", nil)
+	if apiKey != "" {
+		request.Header.Set(apiKeyHeader, apiKey)
+	}
+	if lastEventId != "" {
+		request.Header.Set(lastEventIdHeader, lastEventId)
+	}
+	var response, responseErr = http.DefaultClient.Do(request)
+	if responseErr != nil || response.StatusCode != 200 || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected the balance stream to open but got %v (%v)", response, responseErr)
+	}
+	var stream = &balanceStreamForTest{response: response, events: make(chan *balanceEvent, 10000)}
+	go func() {
+		defer close(stream.events)
+		var scanner = bufio.NewScanner(response.Body)
+		var event = &balanceEvent{}
+		for scanner.Scan() {
+			var line = scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				event.change = &domain.BalanceChange{}
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), event.change)
+			case line == "" && event.change != nil:
+				stream.events <- event
+				event = &balanceEvent{}
+			}
+		}
+	}()
+	return stream
+}
+
+func (s *balanceStreamForTest) next(t *testing.T) *balanceEvent {
+	select {
+	case event, isOpen := <-s.events:
+		if !isOpen {
+			t.Fatalf("Expected another balance event but the stream ended")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for a balance event")
+	}
+	return nil
+}
+
+func (s *balanceStreamForTest) close() {
+	s.response.Body.Close()
+}
+
+func expectBalanceEvent(t *testing.T, event *balanceEvent, payerId string, points int, balance int) {
+	if event.change.Payer != payerId || event.change.Points != points || event.change.Balance != balance || event.id != strconv.Itoa(event.change.Position) {
+		t.Fatalf("Expected a change of %d to %s leaving %d but got %+v with id %s", points, payerId, balance, event.change, event.id)
+	}
+}
+
+func TestBalanceStreamPushesChangesAndResumesFromLastEventId(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 1000})
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+
+	var stream = openBalanceStreamForTest(t, server.URL, "", "")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "UNILEVER", Points: 200})
+	var purchase = stream.next(t)
+	expectBalanceEvent(t, purchase, "UNILEVER", 200, 200)
+	transactionService.SpendPoints(context.Background(), 1100)
+	var firstSpent, secondSpent = stream.next(t), stream.next(t)
+	if firstSpent.change.Kind != domain.TransactionKindSpend || firstSpent.change.Points + secondSpent.change.Points != -1100 {
+		t.Fatalf("Expected the spend to be streamed as deductions of 1100 but got %+v and %+v", firstSpent.change, secondSpent.change)
+	}
+	stream.close()
+
+	// a subscriber that missed the spend resumes after the purchase it last saw
+	var resumed = openBalanceStreamForTest(t, server.URL, "", purchase.id)
+	defer resumed.close()
+	var replayed = resumed.next(t)
+	if replayed.id != firstSpent.id || replayed.change.Balance != firstSpent.change.Balance {
+		t.Fatalf("Expected the stream to resume with the spend but got %+v", replayed.change)
+	}
+	if next := resumed.next(t); next.id != secondSpent.id {
+		t.Fatalf("Expected the rest of the spend to follow but got %+v", next.change)
+	}
+
+	// a subscriber not reading its stream holds up neither the ledger nor itself once it reads
+	var slow = openBalanceStreamForTest(t, server.URL, "", secondSpent.id)
+	defer slow.close()
+	var started = time.Now()
+	for i := 0; i < 2000; i++ {
+		transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 1})
+	}
+	if elapsed := time.Since(started); elapsed > 5 * time.Second {
+		t.Fatalf("Expected purchases not to wait for the slow subscriber but they took %s", elapsed)
+	}
+	var last *balanceEvent
+	for i := 0; i < 2000; i++ {
+		last = slow.next(t)
+	}
+	var dannonBalance, _ = transactionService.GetPointsProgressForPayer(context.Background(), "DANNON")
+	expectBalanceEvent(t, last, "DANNON", 1, dannonBalance.Points)
+}
+
+func TestBalanceStreamShowsPurchasersOnlyTheirOwnChanges(t *testing.T) {
+	var server = newAuthTestServer(t, "")
+	defer server.Close()
+	var admin = newClientWithKey(server.URL, testBootstrapAdminKey)
+	var dannonKey = issueKeyForTest(t, admin, &domain.ApiKey{Role: "payer", PayerId: "DANNON"})
+	var dannon = newClientWithKey(server.URL, dannonKey)
+	var aliceKey = issueKeyForTest(t, admin, &domain.ApiKey{Role: "purchaser", PurchaserId: "alice"})
+
+	var request, _ = http.NewRequest("GET", server.URL + "/events/balances", nil)
+	request.Header.Set(apiKeyHeader, dannonKey)
+	var refused, _ = http.DefaultClient.Do(request)
+	if refused.StatusCode != 403 {
+		t.Fatalf("Expected a payer key to be refused the balance stream but got %d", refused.StatusCode)
+	}
+
+	var stream = openBalanceStreamForTest(t, server.URL, aliceKey, "")
+	defer stream.close()
+	dannon.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: "bob", Points: 500})
+	dannon.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: "alice", Points: 300})
+	var event = stream.next(t)
+	if event.change.Purchaser != "alice" {
+		t.Fatalf("Expected alice to see only her own purchase but saw %+v", event.change)
+	}
+	expectBalanceEvent(t, event, "DANNON", 300, 300)
+}
+
+func TestBalanceStreamOutlivesWriteTimeoutAndEndsOnShutdown(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var application = NewApplication(transactionService)
+	var serverConfig = config.Default().Server
+	serverConfig.WriteTimeout = config.Duration(200 * time.Millisecond)
+	var server = newHttpServer(serverConfig, application.NewRouter())
+	server.RegisterOnShutdown(application.CloseBalanceStreams)
+	var listener, _ = net.Listen("tcp", "127.0.0.1:0")
+	var shutdownContext, beginShutdown = context.WithCancel(context.Background())
+	defer beginShutdown()
+	var serveResult = make(chan error, 1)
+	go func() {
+		serveResult <- serveUntilShutdown(shutdownContext, server, listener, NewProbes(), 0, 5 * time.Second, log.NewNopLogger())
+	}()
+
+	var stream = openBalanceStreamForTest(t, "http://" + listener.Addr().String(), "", "")
+	defer stream.close()
+	time.Sleep(2 * time.Duration(serverConfig.WriteTimeout))
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 100})
+	expectBalanceEvent(t, stream.next(t), "DANNON", 100, 100)
+
+	var started = time.Now()
+	beginShutdown()
+	select {
+	case serveErr := <-serveResult:
+		if serveErr != nil {
+			t.Fatalf("Expected the server to shut down cleanly but got %v", serveErr)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Expected the open stream not to hold up shutdown")
+	}
+	if elapsed := time.Since(started); elapsed > 2 * time.Second {
+		t.Fatalf("Expected shutdown to end the stream at once but it took %s", elapsed)
+	}
+	if event, isOpen := <-stream.events; isOpen {
+		t.Fatalf("Expected the stream to end on shutdown but got %+v", event.change)
+	}
+}
@@ -2,4 +2,6 @@
 
 go mod download
 go get purchase-tracker-service
-go build -v -o run_http_service
+BUILD_COMMIT=$(git rev-parse --short HEAD 2> /dev/null || echo unknown)
+BUILD_TIME=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+go build -v -ldflags "-X main.buildCommit=${BUILD_COMMIT} -X main.buildTime=${BUILD_TIME}" -o run_http_service
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"github.com/gorilla/mux"
+	"purchase-tracker-service/domain"
+)
+
+func (a *Application) HandleListCampaigns() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.ListCampaigns(r.Context(), mux.Vars(r)["payerId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandleCreateCampaign() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		campaign, requestDecodeErr := decodeCampaignRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.transactionService.CreateCampaign(r.Context(), campaign)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+func (a *Application) HandleGetCampaign() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.GetCampaign(r.Context(), mux.Vars(r)["campaignId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandleReverseCampaign() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.ReverseCampaign(r.Context(), mux.Vars(r)["campaignId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+// The campaign runs under the Payer in the path; a body naming a different one is refused.
+func decodeCampaignRequest(_ context.Context, r *http.Request) (*domain.Campaign, error) {
+	var request domain.Campaign
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	var payerId = mux.Vars(r)["payerId"]
+	if request.Payer != "" && request.Payer != payerId {
+		return nil, errors.New("payer must match the path")
+	}
+	request.Payer = payerId
+	return &request, nil
+}
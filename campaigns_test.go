@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func TestCampaignsBookBonusesWithinBudgetUntilReversed(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+	var started = time.Now().Add(-time.Hour)
+	var ends = time.Now().Add(time.Hour)
+
+	var doubled, _ = serviceClient.CreateCampaign(&domain.Campaign{Payer: "DANNON", Name: "Double points", StartTimestamp: started, EndTimestamp: ends, Multiplier: 2, Budget: 150})
+	var online, _ = serviceClient.CreateCampaign(&domain.Campaign{Payer: "DANNON", Name: "Online bonus", StartTimestamp: started, EndTimestamp: ends, FlatBonus: 25,
+		Eligibility: &domain.CampaignEligibility{Channels: []string{"online"}, MinimumPoints: 50}})
+	serviceClient.CreateCampaign(&domain.Campaign{Payer: "DANNON", Name: "Next week", StartTimestamp: ends, EndTimestamp: ends.Add(time.Hour), Multiplier: 3})
+
+	var cases = []struct {
+		purchase *domain.RewardTransaction
+		bonuses map[string]int
+		balance int
+	}{
+		{&domain.RewardTransaction{Purchaser: "alice", Points: 100, Channel: "online"}, map[string]int{doubled.Id: 100, online.Id: 25}, 225},
+		// the doubling has 50 left of its budget, and the purchase was not made online
+		{&domain.RewardTransaction{Purchaser: "bob", Points: 100, Channel: "in-store"}, map[string]int{doubled.Id: 50}, 375},
+		{&domain.RewardTransaction{Purchaser: "alice", Points: 40, Channel: "online"}, map[string]int{}, 415},
+	}
+	for _, c := range cases {
+		c.purchase.Payer = "DANNON"
+		var progress, purchaseErr = serviceClient.AddPurchase(c.purchase)
+		if purchaseErr != nil {
+			t.Fatalf("Expected the purchase to be recorded: %s", purchaseErr)
+		}
+		var bonuses = make(map[string]int)
+		for _, bonus := range progress.Bonuses {
+			bonuses[bonus.CampaignId] = bonus.Points
+		}
+		if len(bonuses) != len(c.bonuses) || bonuses[doubled.Id] != c.bonuses[doubled.Id] || bonuses[online.Id] != c.bonuses[online.Id] || progress.Points != c.balance {
+			t.Fatalf("Expected bonuses %v leaving %d but got %v leaving %d", c.bonuses, c.balance, bonuses, progress.Points)
+		}
+	}
+	var bonusTransactions = 0
+	var transactionLog, _ = serviceClient.GetTransactionLog()
+	for _, transaction := range transactionLog {
+		if transaction.Kind == domain.TransactionKindBonus && transaction.CampaignId != "" {
+			bonusTransactions++
+		}
+	}
+	if bonusTransactions != 3 {
+		t.Fatalf("Expected the bonuses to be booked as 3 Transactions of their own but found %d", bonusTransactions)
+	}
+	if campaign, _ := serviceClient.GetCampaign(doubled.Id); campaign.Awarded != 150 {
+		t.Fatalf("Expected the doubling to have awarded its budget of 150 but awarded %d", campaign.Awarded)
+	}
+
+	var reversed, reverseErr = serviceClient.ReverseCampaign(doubled.Id)
+	if reverseErr != nil || reversed.ReversedTimestamp == nil || reversed.Awarded != 0 {
+		t.Fatalf("Expected the doubling to be reversed but got %+v (%v)", reversed, reverseErr)
+	}
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 265)
+	var _, reverseAgainErr = serviceClient.ReverseCampaign(doubled.Id)
+	expectStatus(t, reverseAgainErr, 409, "reversing a campaign twice")
+	if progress, _ := serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Points: 100, Channel: "online"}); len(progress.Bonuses) != 1 || progress.Points != 390 {
+		t.Fatalf("Expected only the online bonus after the reversal but got %+v", progress)
+	}
+	if campaigns, _ := serviceClient.ListCampaigns("DANNON"); len(campaigns) != 3 {
+		t.Fatalf("Expected the Payer's 3 campaigns to be listed but got %d", len(campaigns))
+	}
+}
+
+func TestCampaignReversalTakesBackOnlyWhatIsLeft(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var campaign, _ = transactionService.CreateCampaign(context.Background(), &domain.Campaign{Payer: "DANNON", Name: "Welcome", StartTimestamp: time.Now().Add(-time.Hour), EndTimestamp: time.Now().Add(time.Hour), FlatBonus: 50})
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 10})
+	transactionService.SpendPoints(context.Background(), 55)
+	if _, reverseErr := transactionService.ReverseCampaign(context.Background(), campaign.Id); reverseErr != nil {
+		t.Fatalf("Expected the campaign to be reversed: %s", reverseErr)
+	}
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 0)
+
+	var invalid = []*domain.Campaign{
+		{Payer: "DANNON", Name: "Backwards", StartTimestamp: time.Now(), EndTimestamp: time.Now().Add(-time.Hour), FlatBonus: 10},
+		{Payer: "DANNON", Name: "Shrinking", StartTimestamp: time.Now(), EndTimestamp: time.Now().Add(time.Hour), Multiplier: 0.5},
+		{Payer: "DANNON", Name: "Nothing", StartTimestamp: time.Now(), EndTimestamp: time.Now().Add(time.Hour)},
+		{Payer: "NESTLE", Name: "Unknown", StartTimestamp: time.Now(), EndTimestamp: time.Now().Add(time.Hour), FlatBonus: 10},
+	}
+	for _, invalidCampaign := range invalid {
+		if _, createErr := transactionService.CreateCampaign(context.Background(), invalidCampaign); createErr == nil {
+			t.Fatalf("Expected the campaign %s to be refused", invalidCampaign.Name)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"github.com/gorilla/mux"
+	"purchase-tracker-service/domain"
+)
+
+func (a *Application) HandleListCatalogItems() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteServiceResponse(w, a.transactionService.ListCatalogItems(r.Context()), nil)
+	})
+}
+
+func (a *Application) HandleGetCatalogItem() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.GetCatalogItem(r.Context(), mux.Vars(r)["itemId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandlePutCatalogItem() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item, requestDecodeErr := decodeCatalogItemRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.transactionService.PutCatalogItem(r.Context(), item)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+func (a *Application) HandleRedeem() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, requestDecodeErr := decodeRedemptionRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.transactionService.Redeem(r.Context(), request)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+func (a *Application) HandleGetRedemption() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.GetRedemption(r.Context(), mux.Vars(r)["redemptionId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandleCancelRedemption() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.CancelRedemption(r.Context(), mux.Vars(r)["redemptionId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+// The item takes the Id in the path; a body naming a different one is refused.
+func decodeCatalogItemRequest(_ context.Context, r *http.Request) (*domain.CatalogItem, error) {
+	var request domain.CatalogItem
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	var itemId = mux.Vars(r)["itemId"]
+	if request.Id != "" && request.Id != itemId {
+		return nil, errors.New("item id must match the path")
+	}
+	request.Id = itemId
+	return &request, nil
+}
+
+func decodeRedemptionRequest(_ context.Context, r *http.Request) (*domain.RedemptionRequest, error) {
+	var request domain.RedemptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	if request.ItemId == "" {
+		return nil, errors.New("item id is required")
+	}
+	return &request, nil
+}
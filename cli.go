@@ -0,0 +1,543 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"gopkg.in/yaml.v3"
+	"purchase-tracker-service/client"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/domain"
+)
+
+const (
+	cliExitOk = 0
+	cliExitServiceError = 1
+	cliExitUsageError = 2
+	cliDefaultServerUrl = "http://localhost:8999"
+	cliServerUrlEnvironmentVariable = "PURCHASE_TRACKER_URL"
+	cliApiKeyEnvironmentVariable = "PURCHASE_TRACKER_API_KEY"
+)
+
+// The operator commands are run out of the same executable as the server; the first argument
+// selects the command and anything else starts the HTTP server.
+var cliCommands = map[string]func(*cliContext) error {
+	"payers": runPayersCommand,
+	"purchase": runPurchaseCommand,
+	"spend": runSpendCommand,
+	"balances": runBalancesCommand,
+	"transactions": runTransactionsCommand,
+	"export": runExportCommand,
+	"import": runImportCommand,
+	"keys": runKeysCommand,
+	"audit": runAuditCommand,
+}
+
+func IsCliCommand(name string) bool {
+	_, isCommand := cliCommands[name]
+	return isCommand || name == "help" || name == "config"
+}
+
+type cliContext struct {
+	client *client.Client
+	output string
+	args []string
+	file string
+	// The name, Payer and Purchaser given for a key to be created.
+	keyRequest *domain.ApiKey
+	// The allocation strategy, Payer priority and Payers given for a spend.
+	spendRequest *domain.PointsSpendTransaction
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type cliUsageError struct {
+	message string
+}
+
+func (e cliUsageError) Error() string {
+	return e.message
+}
+
+// Run a single operator command, returning the process exit code: zero on success, one when the
+// service or transport failed and two when the command line itself was wrong.
+func RunCli(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" {
+		printCliUsage(stdout)
+		return cliExitOk
+	}
+	if args[0] == "config" {
+		return runConfigCommand(args[1:], stdout, stderr)
+	}
+	var command, isCommand = cliCommands[args[0]]
+	if !isCommand {
+		fmt.Fprintf(stderr, "Unknown command '%s'\n", args[0])
+		printCliUsage(stderr)
+		return cliExitUsageError
+	}
+	var defaultServerUrl = os.Getenv(cliServerUrlEnvironmentVariable)
+	if defaultServerUrl == "" {
+		defaultServerUrl = cliDefaultServerUrl
+	}
+	var flagSet = flag.NewFlagSet(args[0], flag.ContinueOnError)
+	flagSet.SetOutput(stderr)
+	var (
+		serverUrl = flagSet.String("server", defaultServerUrl, "Base URL of the Purchase Tracker service.")
+		output = flagSet.String("output", "table", "Output format: table or json.")
+		file = flagSet.String("file", "", "File to read (import) or write (export); defaults to stdin/stdout.")
+		apiKey = flagSet.String("api-key", os.Getenv(cliApiKeyEnvironmentVariable), "API key presented to the service.")
+		name = flagSet.String("name", "", "Name of the API key created by keys create.")
+		payerId = flagSet.String("payer", "", "Payer a payer API key created by keys create acts for.")
+		purchaserId = flagSet.String("purchaser", "", "Purchaser a purchaser API key created by keys create acts as.")
+		allocation = flagSet.String("allocation", "", "Allocation strategy of a spend; defaults to the one the service is configured with.")
+		payerPriority = flagSet.String("priority", "", "Comma separated Payers a payer-priority spend drains first.")
+		includePayers = flagSet.String("include", "", "Comma separated Payers a spend may only be funded by.")
+		excludePayers = flagSet.String("exclude", "", "Comma separated Payers a spend may not be funded by.")
+	)
+	if parseErr := flagSet.Parse(interleaveFlags(args[1:])); parseErr != nil {
+		return cliExitUsageError
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "Unsupported output format '%s'; use table or json\n", *output)
+		return cliExitUsageError
+	}
+	var serviceClient = client.NewClient(*serverUrl)
+	serviceClient.SetApiKey(*apiKey)
+	var commandErr = command(&cliContext{
+		client: serviceClient,
+		output: *output,
+		args: flagSet.Args(),
+		file: *file,
+		keyRequest: &domain.ApiKey{Name: *name, PayerId: *payerId, PurchaserId: *purchaserId},
+		spendRequest: &domain.PointsSpendTransaction{
+			Allocation: *allocation,
+			PayerPriority: splitPayerList(*payerPriority),
+			IncludePayers: splitPayerList(*includePayers),
+			ExcludePayers: splitPayerList(*excludePayers),
+		},
+		stdout: stdout,
+		stderr: stderr,
+	})
+	var usageError cliUsageError
+	switch {
+	case commandErr == nil:
+		return cliExitOk
+	case errors.As(commandErr, &usageError):
+		fmt.Fprintf(stderr, "%s\n", usageError.message)
+		return cliExitUsageError
+	default:
+		fmt.Fprintf(stderr, "%s\n", commandErr)
+		return cliExitServiceError
+	}
+}
+
+// The standard flag package stops at the first positional argument, so flags are moved ahead of
+// positional arguments to allow `payers add DANNON Dannon -output json`.
+func interleaveFlags(args []string) []string {
+	var flags []string
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		var arg = args[i]
+		if arg == "--" {
+			positional = append(positional, args[i + 1:]...)
+			break
+		}
+		if _, numberErr := strconv.Atoi(arg); len(arg) > 1 && arg[0] == '-' && numberErr != nil {
+			flags = append(flags, arg)
+			// every flag takes a value, either inline as -flag=value or as the following argument
+			if !strings.Contains(arg, "=") && i + 1 < len(args) {
+				flags = append(flags, args[i + 1])
+				i++
+			}
+		} else {
+			positional = append(positional, arg)
+		}
+	}
+	return append(flags, positional...)
+}
+
+func splitPayerList(value string) []string {
+	var payers []string
+	for _, payer := range strings.Split(value, ",") {
+		if payer = strings.TrimSpace(payer); payer != "" {
+			payers = append(payers, payer)
+		}
+	}
+	return payers
+}
+
+func printCliUsage(w io.Writer) {
+	fmt.Fprint(w, `Usage: run_http_service <command> [arguments] [-server URL] [-output table|json]
+
+Commands:
+  payers list                   List registered Payers
+  payers add <id> [name]        Register a new Payer
+  payers show <id>              Show a single Payer
+  purchase add <payer> <points> Record a Purchase accumulating Points under a Payer
+  spend <points>                Spend Points across Payers, chosen by -allocation fifo,
+                                soonest-expiring, payer-priority (-priority a,b), proportional
+                                or largest-balance, from the Payers given by -include a,b
+                                less those given by -exclude a,b
+  balances [payer]              Show Points balances for every Payer or a single Payer
+  transactions                  Show the Transaction Log
+  export [-file path]           Write the Payers and Transaction Log as JSON
+  import [-file path]           Load Payers and Transactions from an export
+  audit [name=value ...]        Show the audit trail, filtered by actor, action, result, payer,
+                                since, until (RFC 3339), after (sequence) or limit
+  keys list                     List issued API keys
+  keys create <role>            Issue an admin, payer (-payer id) or purchaser (-purchaser id) key
+  keys revoke <key id>          Revoke an API key
+  config print [server flags]   Show the effective server configuration (-output yaml|json)
+
+With no command the HTTP server is started.
+The server URL defaults to $PURCHASE_TRACKER_URL or http://localhost:8999.
+The API key presented with -api-key defaults to $PURCHASE_TRACKER_API_KEY.
+`)
+}
+
+// Unlike the other commands this does not talk to a running service; it assembles the
+// configuration exactly as the server would from the file, environment and flags given.  Secrets
+// are never printed, only whether they are set.
+func runConfigCommand(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(stderr, "Usage: config print [-config file] [server flags] [-output yaml|json]")
+		return cliExitUsageError
+	}
+	var flagSet = flag.NewFlagSet("config print", flag.ContinueOnError)
+	flagSet.SetOutput(stderr)
+	var configFlags = config.RegisterFlags(flagSet)
+	var output = flagSet.String("output", "yaml", "Output format: yaml or json.")
+	if parseErr := flagSet.Parse(args[1:]); parseErr != nil {
+		return cliExitUsageError
+	}
+	var serviceConfig, configErr = configFlags.Load(os.LookupEnv)
+	if configErr != nil {
+		fmt.Fprintln(stderr, configErr)
+		return cliExitUsageError
+	}
+	serviceConfig = serviceConfig.Redacted()
+	switch *output {
+	case "json":
+		var encoder = json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(serviceConfig)
+	case "yaml":
+		var encoder = yaml.NewEncoder(stdout)
+		encoder.SetIndent(2)
+		encoder.Encode(serviceConfig)
+		encoder.Close()
+	default:
+		fmt.Fprintf(stderr, "Unsupported output format '%s'; use yaml or json\n", *output)
+		return cliExitUsageError
+	}
+	return cliExitOk
+}
+
+func runPayersCommand(c *cliContext) error {
+	if len(c.args) == 0 {
+		return cliUsageError{"Usage: payers list|add <id> [name]|show <id>"}
+	}
+	switch c.args[0] {
+	case "list":
+		var payers, err = c.client.ListPayers()
+		if err != nil {
+			return err
+		}
+		return c.writePayers(payers)
+	case "add":
+		if len(c.args) < 2 || len(c.args) > 3 {
+			return cliUsageError{"Usage: payers add <id> [name]"}
+		}
+		var name = c.args[1]
+		if len(c.args) == 3 {
+			name = c.args[2]
+		}
+		var payer, err = c.client.AddPayer(c.args[1], name)
+		if err != nil {
+			return err
+		}
+		return c.writePayers([]*domain.PayerAccount{payer})
+	case "show":
+		if len(c.args) != 2 {
+			return cliUsageError{"Usage: payers show <id>"}
+		}
+		var payer, err = c.client.GetPayer(c.args[1])
+		if err != nil {
+			return err
+		}
+		return c.writePayers([]*domain.PayerAccount{payer})
+	default:
+		return cliUsageError{fmt.Sprintf("Unknown payers command '%s'", c.args[0])}
+	}
+}
+
+func runPurchaseCommand(c *cliContext) error {
+	if len(c.args) != 3 || c.args[0] != "add" {
+		return cliUsageError{"Usage: purchase add <payer> <points>"}
+	}
+	var points, pointsErr = strconv.Atoi(c.args[2])
+	if pointsErr != nil {
+		return cliUsageError{fmt.Sprintf("Points must be a whole number: %s", c.args[2])}
+	}
+	var balance, err = c.client.AddPurchase(&domain.RewardTransaction{Payer: c.args[1], Points: points})
+	if err != nil {
+		return err
+	}
+	return c.writeBalances([]*domain.RewardsAccumulateProgress{balance})
+}
+
+func runSpendCommand(c *cliContext) error {
+	if len(c.args) != 1 {
+		return cliUsageError{"Usage: spend <points>"}
+	}
+	var points, pointsErr = strconv.Atoi(c.args[0])
+	if pointsErr != nil || points <= 0 {
+		return cliUsageError{fmt.Sprintf("Points must be a positive whole number: %s", c.args[0])}
+	}
+	var spend = *c.spendRequest
+	spend.Points = points
+	var balances, err = c.client.SpendPoints(&spend)
+	if err != nil {
+		return err
+	}
+	return c.writeBalances(balances)
+}
+
+func runBalancesCommand(c *cliContext) error {
+	switch len(c.args) {
+	case 0:
+		var balances, err = c.client.GetAllPayersBalances()
+		if err != nil {
+			return err
+		}
+		return c.writeBalances(balances)
+	case 1:
+		var balance, err = c.client.GetPayerBalance(c.args[0])
+		if err != nil {
+			return err
+		}
+		return c.writeBalances([]*domain.RewardsAccumulateProgress{balance})
+	default:
+		return cliUsageError{"Usage: balances [payer]"}
+	}
+}
+
+func runTransactionsCommand(c *cliContext) error {
+	if len(c.args) != 0 {
+		return cliUsageError{"Usage: transactions"}
+	}
+	var transactions, err = c.client.GetTransactionLog()
+	if err != nil {
+		return err
+	}
+	if c.output == "json" {
+		return c.writeJson(transactions)
+	}
+	var table = tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "TIMESTAMP\tPAYER\tPOINTS")
+	for _, transaction := range transactions {
+		fmt.Fprintf(table, "%s\t%s\t%d\n", transaction.TransactionTimestamp.Format(time.RFC3339), transaction.Payer, transaction.Points)
+	}
+	return table.Flush()
+}
+
+// Exports are always written as JSON since they are meant to be fed back into `import`.
+func runExportCommand(c *cliContext) error {
+	if len(c.args) != 0 {
+		return cliUsageError{"Usage: export [-file path]"}
+	}
+	var ledger, err = c.client.ExportLedger()
+	if err != nil {
+		return err
+	}
+	var out = c.stdout
+	if c.file != "" && c.file != "-" {
+		var exportFile, createErr = os.Create(c.file)
+		if createErr != nil {
+			return createErr
+		}
+		defer exportFile.Close()
+		out = exportFile
+	}
+	var encoder = json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(ledger)
+}
+
+func runImportCommand(c *cliContext) error {
+	var path = c.file
+	if len(c.args) == 1 && path == "" {
+		path = c.args[0]
+	} else if len(c.args) != 0 {
+		return cliUsageError{"Usage: import [-file path]"}
+	}
+	var in io.Reader = os.Stdin
+	if path != "" && path != "-" {
+		var importFile, openErr = os.Open(path)
+		if openErr != nil {
+			return openErr
+		}
+		defer importFile.Close()
+		in = importFile
+	}
+	var ledger domain.LedgerExport
+	if decodeErr := json.NewDecoder(in).Decode(&ledger); decodeErr != nil {
+		return fmt.Errorf("Import file is not a valid ledger export: %w", decodeErr)
+	}
+	var result, err = c.client.ImportLedger(&ledger)
+	if err != nil {
+		return err
+	}
+	if c.output == "json" {
+		return c.writeJson(result)
+	}
+	fmt.Fprintf(c.stdout, "Imported %d payers (%d already registered) and %d transactions (%d already recorded)\n", result.PayersAdded, result.PayersSkipped, result.TransactionsAdded, result.TransactionsSkipped)
+	return nil
+}
+
+func runAuditCommand(c *cliContext) error {
+	var filter = &domain.AuditFilter{}
+	for _, arg := range c.args {
+		var name, value, hasValue = strings.Cut(arg, "=")
+		if !hasValue {
+			return cliUsageError{"Usage: audit [actor=|action=|result=|payer=|since=|until=|after=|limit=value ...]"}
+		}
+		var parseErr error
+		switch name {
+		case "actor":
+			filter.Actor = value
+		case "action":
+			filter.Action = value
+		case "result":
+			filter.Result = value
+		case "payer":
+			filter.Payer = value
+		case "since":
+			filter.Since, parseErr = time.Parse(time.RFC3339, value)
+		case "until":
+			filter.Until, parseErr = time.Parse(time.RFC3339, value)
+		case "after":
+			filter.AfterSequence, parseErr = strconv.ParseInt(value, 10, 64)
+		case "limit":
+			filter.Limit, parseErr = strconv.Atoi(value)
+		default:
+			return cliUsageError{fmt.Sprintf("Unknown audit filter '%s'", name)}
+		}
+		if parseErr != nil {
+			return cliUsageError{fmt.Sprintf("Invalid audit filter %s", arg)}
+		}
+	}
+	var entries, err = c.client.ListAuditEntries(filter)
+	if err != nil {
+		return err
+	}
+	if c.output == "json" {
+		return c.writeJson(entries)
+	}
+	var table = tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "SEQUENCE\tTIMESTAMP\tACTOR\tACTION\tPAYER\tRESULT\tERROR")
+	for _, entry := range entries {
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", entry.Sequence, entry.Timestamp.Format(time.RFC3339), entry.Actor, entry.Action, entry.Payer, entry.Result, entry.Error)
+	}
+	return table.Flush()
+}
+
+func runKeysCommand(c *cliContext) error {
+	if len(c.args) == 0 {
+		return cliUsageError{"Usage: keys list|create <role>|revoke <key id>"}
+	}
+	switch c.args[0] {
+	case "list":
+		var keys, err = c.client.ListApiKeys()
+		if err != nil {
+			return err
+		}
+		return c.writeApiKeys(keys)
+	case "create":
+		if len(c.args) != 2 {
+			return cliUsageError{"Usage: keys create admin|payer|purchaser [-name name] [-payer id] [-purchaser id]"}
+		}
+		c.keyRequest.Role = c.args[1]
+		var issued, err = c.client.IssueApiKey(c.keyRequest)
+		if err != nil {
+			return err
+		}
+		if c.output == "json" {
+			return c.writeJson(issued)
+		}
+		if writeErr := c.writeApiKeys([]*domain.ApiKey{issued.ApiKey}); writeErr != nil {
+			return writeErr
+		}
+		// the key cannot be read back from the service, so it is shown once here
+		fmt.Fprintf(c.stdout, "\nKey: %s\n", issued.Key)
+		return nil
+	case "revoke":
+		if len(c.args) != 2 {
+			return cliUsageError{"Usage: keys revoke <key id>"}
+		}
+		var key, err = c.client.RevokeApiKey(c.args[1])
+		if err != nil {
+			return err
+		}
+		return c.writeApiKeys([]*domain.ApiKey{key})
+	default:
+		return cliUsageError{fmt.Sprintf("Unknown keys command '%s'", c.args[0])}
+	}
+}
+
+func (c *cliContext) writeApiKeys(keys []*domain.ApiKey) error {
+	if c.output == "json" {
+		return c.writeJson(keys)
+	}
+	var table = tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tNAME\tROLE\tPAYER\tPURCHASER\tCREATED\tREVOKED")
+	for _, key := range keys {
+		var revoked = ""
+		if key.RevokedTimestamp != nil {
+			revoked = key.RevokedTimestamp.Format(time.RFC3339)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", key.Id, key.Name, key.Role, key.PayerId, key.PurchaserId, key.CreationTimestamp.Format(time.RFC3339), revoked)
+	}
+	return table.Flush()
+}
+
+func (c *cliContext) writePayers(payers []*domain.PayerAccount) error {
+	if c.output == "json" {
+		return c.writeJson(payers)
+	}
+	var table = tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tNAME\tCREATED")
+	for _, payer := range payers {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", payer.Id, payer.Name, payer.CreationTimestamp.Format(time.RFC3339))
+	}
+	return table.Flush()
+}
+
+func (c *cliContext) writeBalances(balances []*domain.RewardsAccumulateProgress) error {
+	if c.output == "json" {
+		return c.writeJson(balances)
+	}
+	var table = tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "PAYER\tNAME\tPOINTS")
+	for _, balance := range balances {
+		if balance.Payer == nil {
+			continue
+		}
+		fmt.Fprintf(table, "%s\t%s\t%d\n", balance.Payer.Id, balance.Payer.Name, balance.Points)
+	}
+	return table.Flush()
+}
+
+func (c *cliContext) writeJson(value interface{}) error {
+	var encoder = json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func newCliTestServer() (*httptest.Server, *service.LocalTransactionService) {
+	var transactionService = service.NewLocalTransactionService()
+	var application = NewApplication(transactionService)
+	return httptest.NewServer(application.NewRouter()), transactionService
+}
+
+func runCliForTest(t *testing.T, serverUrl string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	var exitCode = RunCli(append(args, "-server", serverUrl), &stdout, &stderr)
+	return exitCode, stdout.String(), stderr.String()
+}
+
+func TestCliPayersAddListShow(t *testing.T) {
+	var server, _ = newCliTestServer()
+	defer server.Close()
+
+	var exitCode, stdout, stderr = runCliForTest(t, server.URL, "payers", "add", "DANNON", "Dannon")
+	if exitCode != 0 {
+		t.Fatalf("Expected payers add to succeed but exited %d: %s", exitCode, stderr)
+	}
+	if !strings.Contains(stdout, "DANNON") {
+		t.Fatalf("Expected the added payer to be printed but got %s", stdout)
+	}
+	exitCode, _, _ = runCliForTest(t, server.URL, "payers", "add", "DANNON", "Dannon")
+	if exitCode != cliExitServiceError {
+		t.Fatalf("Expected a duplicate payer to exit %d but exited %d", cliExitServiceError, exitCode)
+	}
+	exitCode, stdout, _ = runCliForTest(t, server.URL, "payers", "list", "-output", "json")
+	var payers []*domain.PayerAccount
+	if decodeErr := json.Unmarshal([]byte(stdout), &payers); decodeErr != nil || exitCode != 0 {
+		t.Fatalf("Expected payers list to print JSON but got %s (%s)", stdout, decodeErr)
+	}
+	if len(payers) != 1 || payers[0].Id != "DANNON" {
+		t.Fatalf("Expected exactly the DANNON payer to be listed but got %d payers", len(payers))
+	}
+	exitCode, _, stderr = runCliForTest(t, server.URL, "payers", "show", "UNILEVER")
+	if exitCode != cliExitServiceError {
+		t.Fatalf("Expected an unknown payer to exit %d but exited %d", cliExitServiceError, exitCode)
+	}
+	if !strings.Contains(stderr, "404") {
+		t.Fatalf("Expected the not found status to be reported but got %s", stderr)
+	}
+}
+
+func TestCliPurchaseSpendAndBalances(t *testing.T) {
+	var server, transactionService = newCliTestServer()
+	defer server.Close()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+
+	for _, purchase := range [][]string{{"DANNON", "300"}, {"UNILEVER", "200"}, {"DANNON", "-200"}} {
+		if exitCode, _, stderr := runCliForTest(t, server.URL, "purchase", "add", purchase[0], purchase[1]); exitCode != 0 {
+			t.Fatalf("Expected purchase add %v to succeed but exited %d: %s", purchase, exitCode, stderr)
+		}
+	}
+	if exitCode, _, _ := runCliForTest(t, server.URL, "purchase", "add", "MILLER COORS", "10"); exitCode != cliExitServiceError {
+		t.Fatalf("Expected a purchase for an unknown payer to exit %d but exited %d", cliExitServiceError, exitCode)
+	}
+	if exitCode, _, _ := runCliForTest(t, server.URL, "spend", "lots"); exitCode != cliExitUsageError {
+		t.Fatalf("Expected a malformed spend to exit %d but exited %d", cliExitUsageError, exitCode)
+	}
+	var exitCode, stdout, stderr = runCliForTest(t, server.URL, "spend", "250", "-output", "json")
+	if exitCode != 0 {
+		t.Fatalf("Expected spend to succeed but exited %d: %s", exitCode, stderr)
+	}
+	var balances []*domain.RewardsAccumulateProgress
+	json.Unmarshal([]byte(stdout), &balances)
+	for _, balance := range balances {
+		if balance.Payer.Id == "DANNON" && balance.Points != 0 {
+			t.Fatalf("Expected DANNON to be spent down to 0 but has %d", balance.Points)
+		}
+		if balance.Payer.Id == "UNILEVER" && balance.Points != 50 {
+			t.Fatalf("Expected UNILEVER to be spent down to 50 but has %d", balance.Points)
+		}
+	}
+	exitCode, stdout, _ = runCliForTest(t, server.URL, "balances", "UNILEVER")
+	if exitCode != 0 || !strings.Contains(stdout, "UNILEVER") || !strings.Contains(stdout, "50") {
+		t.Fatalf("Expected the UNILEVER balance table but got %s", stdout)
+	}
+}
+
+func TestCliExportImport(t *testing.T) {
+	var source, sourceService = newCliTestServer()
+	defer source.Close()
+	sourceService.AddPayer(context.Background(), "DANNON", "Dannon")
+	sourceService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 300})
+	sourceService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 700})
+
+	var exportPath = filepath.Join(t.TempDir(), "ledger.json")
+	if exitCode, _, stderr := runCliForTest(t, source.URL, "export", "-file", exportPath); exitCode != 0 {
+		t.Fatalf("Expected export to succeed but exited %d: %s", exitCode, stderr)
+	}
+	if _, statErr := os.Stat(exportPath); statErr != nil {
+		t.Fatalf("Expected export file to be written: %s", statErr)
+	}
+
+	var target, targetService = newCliTestServer()
+	defer target.Close()
+	var exitCode, stdout, stderr = runCliForTest(t, target.URL, "import", "-file", exportPath)
+	if exitCode != 0 {
+		t.Fatalf("Expected import to succeed but exited %d: %s", exitCode, stderr)
+	}
+	if !strings.Contains(stdout, "Imported 1 payers") || !strings.Contains(stdout, "2 transactions") {
+		t.Fatalf("Expected an import summary but got %s", stdout)
+	}
+	var progress, getError = targetService.GetPointsProgressForPayer(context.Background(), "DANNON")
+	if getError != nil || progress.Points != 1000 {
+		t.Fatalf("Expected the imported DANNON balance to be 1000")
+	}
+	var sourceLog = sourceService.GetTransactionLog(context.Background())
+	var targetLog = targetService.GetTransactionLog(context.Background())
+	if !sourceLog[0].TransactionTimestamp.Equal(targetLog[0].TransactionTimestamp) {
+		t.Fatalf("Expected imported transactions to keep their timestamps")
+	}
+
+	// importing the same export again records nothing twice
+	exitCode, stdout, stderr = runCliForTest(t, target.URL, "import", "-file", exportPath)
+	if exitCode != 0 || !strings.Contains(stdout, "Imported 0 payers") || !strings.Contains(stdout, "0 transactions (2 already recorded)") {
+		t.Fatalf("Expected the second import to skip everything but exited %d: %s%s", exitCode, stdout, stderr)
+	}
+	if progress, _ = targetService.GetPointsProgressForPayer(context.Background(), "DANNON"); progress.Points != 1000 {
+		t.Fatalf("Expected the DANNON balance to stay 1000 after importing twice but was %d", progress.Points)
+	}
+	if targetLog = targetService.GetTransactionLog(context.Background()); len(targetLog) != 2 {
+		t.Fatalf("Expected 2 transactions after importing twice but found %d", len(targetLog))
+	}
+}
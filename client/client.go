@@ -0,0 +1,336 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/webhooks"
+)
+
+// A thin client of the Purchase Tracker HTTP API used by the command-line tooling.
+type Client struct {
+	baseUrl string
+	httpClient *http.Client
+	apiKey string
+}
+
+func NewClient(baseUrl string) *Client {
+	return &Client{
+		baseUrl: strings.TrimRight(baseUrl, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Present key in the X-Api-Key header of every request.
+func (c *Client) SetApiKey(key string) {
+	c.apiKey = key
+}
+
+// Returned whenever the service answers with a non-2xx status.
+type ServiceError struct {
+	StatusCode int
+	Status string `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e ServiceError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Service responded with HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("Service responded with HTTP %d (%s): %s", e.StatusCode, e.Status, e.Message)
+}
+
+func (c *Client) ListPayers() ([]*domain.PayerAccount, error) {
+	var payers []*domain.PayerAccount
+	return payers, c.do("GET", "/payers", nil, &payers)
+}
+
+func (c *Client) AddPayer(id string, name string) (*domain.PayerAccount, error) {
+	var payer domain.PayerAccount
+	var request = &domain.PayerAccount{Id: id, Name: name}
+	return &payer, c.do("POST", "/payers", request, &payer)
+}
+
+func (c *Client) GetPayer(payerId string) (*domain.PayerAccount, error) {
+	var payer domain.PayerAccount
+	return &payer, c.do("GET", "/payers/" + url.PathEscape(payerId), nil, &payer)
+}
+
+func (c *Client) GetAllPayersBalances() ([]*domain.RewardsAccumulateProgress, error) {
+	var balances []*domain.RewardsAccumulateProgress
+	return balances, c.do("GET", "/payers/balances", nil, &balances)
+}
+
+func (c *Client) GetPayerBalance(payerId string) (*domain.RewardsAccumulateProgress, error) {
+	var balance domain.RewardsAccumulateProgress
+	return &balance, c.do("GET", "/payers/" + url.PathEscape(payerId) + "/balances", nil, &balance)
+}
+
+func (c *Client) AddPurchase(transaction *domain.RewardTransaction) (*domain.RewardsAccumulateProgress, error) {
+	var balance domain.RewardsAccumulateProgress
+	return &balance, c.do("POST", "/purchases", transaction, &balance)
+}
+
+func (c *Client) SpendPoints(transaction *domain.PointsSpendTransaction) ([]*domain.RewardsAccumulateProgress, error) {
+	var balances []*domain.RewardsAccumulateProgress
+	return balances, c.do("POST", "/rewards/spend", transaction, &balances)
+}
+
+func (c *Client) PreviewSpend(transaction *domain.PointsSpendTransaction) (*domain.SpendPreview, error) {
+	var preview domain.SpendPreview
+	return &preview, c.do("POST", "/rewards/spend:preview", transaction, &preview)
+}
+
+func (c *Client) HoldPoints(transaction *domain.PointsSpendTransaction) (*domain.SpendHold, error) {
+	var hold domain.SpendHold
+	return &hold, c.do("POST", "/rewards/holds", transaction, &hold)
+}
+
+func (c *Client) GetHold(holdId string) (*domain.SpendHold, error) {
+	var hold domain.SpendHold
+	return &hold, c.do("GET", "/rewards/holds/" + url.PathEscape(holdId), nil, &hold)
+}
+
+func (c *Client) CaptureHold(holdId string) (*domain.SpendHold, error) {
+	var hold domain.SpendHold
+	return &hold, c.do("POST", "/rewards/holds/" + url.PathEscape(holdId) + "/capture", nil, &hold)
+}
+
+func (c *Client) ReleaseHold(holdId string) (*domain.SpendHold, error) {
+	var hold domain.SpendHold
+	return &hold, c.do("POST", "/rewards/holds/" + url.PathEscape(holdId) + "/release", nil, &hold)
+}
+
+func (c *Client) GetEarningRules(payerId string) (*domain.EarningRules, error) {
+	var rules domain.EarningRules
+	return &rules, c.do("GET", "/payers/" + url.PathEscape(payerId) + "/earning-rules", nil, &rules)
+}
+
+func (c *Client) PutEarningRules(rules *domain.EarningRules) (*domain.EarningRules, error) {
+	var stored domain.EarningRules
+	return &stored, c.do("PUT", "/payers/" + url.PathEscape(rules.Payer) + "/earning-rules", rules, &stored)
+}
+
+func (c *Client) GetPayerLimits(payerId string) (*domain.PayerLimits, error) {
+	var limits domain.PayerLimits
+	return &limits, c.do("GET", "/payers/" + url.PathEscape(payerId) + "/limits", nil, &limits)
+}
+
+func (c *Client) PutPayerLimits(limits *domain.PayerLimits) (*domain.PayerLimits, error) {
+	var stored domain.PayerLimits
+	return &stored, c.do("PUT", "/payers/" + url.PathEscape(limits.Payer) + "/limits", limits, &stored)
+}
+
+func (c *Client) CreateCampaign(campaign *domain.Campaign) (*domain.Campaign, error) {
+	var created domain.Campaign
+	return &created, c.do("POST", "/payers/" + url.PathEscape(campaign.Payer) + "/campaigns", campaign, &created)
+}
+
+func (c *Client) ListCampaigns(payerId string) ([]*domain.Campaign, error) {
+	var campaigns []*domain.Campaign
+	return campaigns, c.do("GET", "/payers/" + url.PathEscape(payerId) + "/campaigns", nil, &campaigns)
+}
+
+func (c *Client) GetCampaign(campaignId string) (*domain.Campaign, error) {
+	var campaign domain.Campaign
+	return &campaign, c.do("GET", "/campaigns/" + url.PathEscape(campaignId), nil, &campaign)
+}
+
+func (c *Client) ReverseCampaign(campaignId string) (*domain.Campaign, error) {
+	var campaign domain.Campaign
+	return &campaign, c.do("POST", "/campaigns/" + url.PathEscape(campaignId) + "/reverse", nil, &campaign)
+}
+
+func (c *Client) CreatePurchaser(purchaser *domain.PurchaserAccount) (*domain.PurchaserAccount, error) {
+	var created domain.PurchaserAccount
+	return &created, c.do("POST", "/purchasers", purchaser, &created)
+}
+
+func (c *Client) ListPurchasers() ([]*domain.PurchaserAccount, error) {
+	var purchasers []*domain.PurchaserAccount
+	return purchasers, c.do("GET", "/purchasers", nil, &purchasers)
+}
+
+func (c *Client) GetPurchaser(purchaserId string) (*domain.PurchaserAccount, error) {
+	var purchaser domain.PurchaserAccount
+	return &purchaser, c.do("GET", "/purchasers/" + url.PathEscape(purchaserId), nil, &purchaser)
+}
+
+func (c *Client) UpdatePurchaser(purchaser *domain.PurchaserAccount) (*domain.PurchaserAccount, error) {
+	var updated domain.PurchaserAccount
+	return &updated, c.do("PUT", "/purchasers/" + url.PathEscape(purchaser.Id), purchaser, &updated)
+}
+
+func (c *Client) SuspendPurchaser(purchaserId string) (*domain.PurchaserAccount, error) {
+	var purchaser domain.PurchaserAccount
+	return &purchaser, c.do("POST", "/purchasers/" + url.PathEscape(purchaserId) + "/suspend", nil, &purchaser)
+}
+
+func (c *Client) ReactivatePurchaser(purchaserId string) (*domain.PurchaserAccount, error) {
+	var purchaser domain.PurchaserAccount
+	return &purchaser, c.do("POST", "/purchasers/" + url.PathEscape(purchaserId) + "/reactivate", nil, &purchaser)
+}
+
+func (c *Client) ClosePurchaser(purchaserId string) (*domain.PurchaserAccount, error) {
+	var purchaser domain.PurchaserAccount
+	return &purchaser, c.do("POST", "/purchasers/" + url.PathEscape(purchaserId) + "/close", nil, &purchaser)
+}
+
+func (c *Client) TransferPoints(request *domain.TransferRequest) (*domain.PointsTransfer, error) {
+	var transfer domain.PointsTransfer
+	return &transfer, c.do("POST", "/transfers", request, &transfer)
+}
+
+func (c *Client) GetTransfer(transferId string) (*domain.PointsTransfer, error) {
+	var transfer domain.PointsTransfer
+	return &transfer, c.do("GET", "/transfers/" + url.PathEscape(transferId), nil, &transfer)
+}
+
+func (c *Client) ListTransfers(purchaserId string) ([]*domain.PointsTransfer, error) {
+	var transfers []*domain.PointsTransfer
+	return transfers, c.do("GET", "/purchasers/" + url.PathEscape(purchaserId) + "/transfers", nil, &transfers)
+}
+
+func (c *Client) ReverseTransfer(transferId string) (*domain.PointsTransfer, error) {
+	var transfer domain.PointsTransfer
+	return &transfer, c.do("POST", "/transfers/" + url.PathEscape(transferId) + "/reverse", nil, &transfer)
+}
+
+func (c *Client) GetPurchaserTier(purchaserId string) (*domain.PurchaserTier, error) {
+	var tier domain.PurchaserTier
+	return &tier, c.do("GET", "/purchasers/" + url.PathEscape(purchaserId) + "/tier", nil, &tier)
+}
+
+func (c *Client) ListCatalogItems() ([]*domain.CatalogItem, error) {
+	var items []*domain.CatalogItem
+	return items, c.do("GET", "/catalog/items", nil, &items)
+}
+
+func (c *Client) GetCatalogItem(itemId string) (*domain.CatalogItem, error) {
+	var item domain.CatalogItem
+	return &item, c.do("GET", "/catalog/items/" + url.PathEscape(itemId), nil, &item)
+}
+
+func (c *Client) PutCatalogItem(item *domain.CatalogItem) (*domain.CatalogItem, error) {
+	var stored domain.CatalogItem
+	return &stored, c.do("PUT", "/catalog/items/" + url.PathEscape(item.Id), item, &stored)
+}
+
+func (c *Client) Redeem(request *domain.RedemptionRequest) (*domain.Redemption, error) {
+	var redemption domain.Redemption
+	return &redemption, c.do("POST", "/redemptions", request, &redemption)
+}
+
+func (c *Client) GetRedemption(redemptionId string) (*domain.Redemption, error) {
+	var redemption domain.Redemption
+	return &redemption, c.do("GET", "/redemptions/" + url.PathEscape(redemptionId), nil, &redemption)
+}
+
+func (c *Client) CancelRedemption(redemptionId string) (*domain.Redemption, error) {
+	var redemption domain.Redemption
+	return &redemption, c.do("POST", "/redemptions/" + url.PathEscape(redemptionId) + "/cancel", nil, &redemption)
+}
+
+func (c *Client) GetTransactionLog() ([]*domain.RewardTransaction, error) {
+	var transactions []*domain.RewardTransaction
+	return transactions, c.do("GET", "/transactions", nil, &transactions)
+}
+
+func (c *Client) ExportLedger() (*domain.LedgerExport, error) {
+	var ledger domain.LedgerExport
+	return &ledger, c.do("GET", "/ledger/export", nil, &ledger)
+}
+
+func (c *Client) ImportLedger(ledger *domain.LedgerExport) (*domain.LedgerImportResult, error) {
+	var result domain.LedgerImportResult
+	return &result, c.do("POST", "/ledger/import", ledger, &result)
+}
+
+// Page through the audit trail; filter's zero fields select everything.
+func (c *Client) ListAuditEntries(filter *domain.AuditFilter) ([]*domain.AuditEntry, error) {
+	var query = url.Values{}
+	for name, value := range map[string]string{"actor": filter.Actor, "action": filter.Action, "result": filter.Result, "payer": filter.Payer} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		query.Set("until", filter.Until.Format(time.RFC3339))
+	}
+	if filter.AfterSequence > 0 {
+		query.Set("after", strconv.FormatInt(filter.AfterSequence, 10))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	var entries []*domain.AuditEntry
+	return entries, c.do("GET", "/admin/audit?" + query.Encode(), nil, &entries)
+}
+
+func (c *Client) ListApiKeys() ([]*domain.ApiKey, error) {
+	var keys []*domain.ApiKey
+	return keys, c.do("GET", "/admin/api-keys", nil, &keys)
+}
+
+func (c *Client) IssueApiKey(request *domain.ApiKey) (*domain.IssuedApiKey, error) {
+	var issued domain.IssuedApiKey
+	return &issued, c.do("POST", "/admin/api-keys", request, &issued)
+}
+
+func (c *Client) RevokeApiKey(keyId string) (*domain.ApiKey, error) {
+	var key domain.ApiKey
+	return &key, c.do("DELETE", "/admin/api-keys/" + url.PathEscape(keyId), nil, &key)
+}
+
+func (c *Client) ListDeadLetters() ([]*webhooks.DeadLetter, error) {
+	var deadLetters []*webhooks.DeadLetter
+	return deadLetters, c.do("GET", "/admin/webhooks/dead-letters", nil, &deadLetters)
+}
+
+func (c *Client) RedeliverDeadLetter(deadLetterId string) (*webhooks.DeadLetter, error) {
+	var deadLetter webhooks.DeadLetter
+	return &deadLetter, c.do("POST", "/admin/webhooks/dead-letters/" + url.PathEscape(deadLetterId) + "/redeliver", nil, &deadLetter)
+}
+
+func (c *Client) do(method string, path string, requestBody interface{}, responseBody interface{}) error {
+	var body io.Reader
+	if requestBody != nil {
+		var encoded, encodeErr = json.Marshal(requestBody)
+		if encodeErr != nil {
+			return encodeErr
+		}
+		body = bytes.NewReader(encoded)
+	}
+	var request, requestErr = http.NewRequest(method, c.baseUrl + path, body)
+	if requestErr != nil {
+		return requestErr
+	}
+	request.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		request.Header.Set("X-Api-Key", c.apiKey)
+	}
+	if requestBody != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	var response, responseErr = c.httpClient.Do(request)
+	if responseErr != nil {
+		return responseErr
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		var serviceError = ServiceError{StatusCode: response.StatusCode}
+		json.NewDecoder(response.Body).Decode(&serviceError)
+		return serviceError
+	}
+	return json.NewDecoder(response.Body).Decode(responseBody)
+}
@@ -0,0 +1,832 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"gopkg.in/yaml.v3"
+	"purchase-tracker-service/domain"
+)
+
+const (
+	StorageBackendMemory = "memory"
+	StorageBackendJournal = "journal"
+	ShortfallPartial = "partial"
+	ShortfallReject = "reject"
+	LogFormatLogfmt = "logfmt"
+	LogFormatJson = "json"
+	TracingExporterNone = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOtlp = "otlp"
+	// Names the configuration file when -config is not given.
+	ConfigFileEnvironmentVariable = "PURCHASE_TRACKER_CONFIG"
+)
+
+// The effective configuration of the service, assembled from defaults, an optional YAML or JSON
+// file, environment variables and command-line flags, each layer overriding the one before.
+type Config struct {
+	Server ServerConfig `json:"server" yaml:"server"`
+	Storage StorageConfig `json:"storage" yaml:"storage"`
+	Payers []PayerConfig `json:"payers" yaml:"payers"`
+	SpendPolicy SpendPolicyConfig `json:"spendPolicy" yaml:"spendPolicy"`
+	Expiry ExpiryConfig `json:"expiry" yaml:"expiry"`
+	Tiers TiersConfig `json:"tiers" yaml:"tiers"`
+	Purchasers PurchasersConfig `json:"purchasers" yaml:"purchasers"`
+	Transfers TransfersConfig `json:"transfers" yaml:"transfers"`
+	RateLimits RateLimitConfig `json:"rateLimits" yaml:"rateLimits"`
+	Logging LoggingConfig `json:"logging" yaml:"logging"`
+	Tracing TracingConfig `json:"tracing" yaml:"tracing"`
+	Auth AuthConfig `json:"auth" yaml:"auth"`
+	Webhooks WebhooksConfig `json:"webhooks" yaml:"webhooks"`
+}
+
+type ServerConfig struct {
+	HttpAddress string `json:"httpAddress" yaml:"httpAddress"`
+	ReadTimeout Duration `json:"readTimeout" yaml:"readTimeout"`
+	WriteTimeout Duration `json:"writeTimeout" yaml:"writeTimeout"`
+	IdleTimeout Duration `json:"idleTimeout" yaml:"idleTimeout"`
+	// How long readiness reports not ready before the listener is closed on shutdown, giving load
+	// balancers time to stop routing new requests.
+	DrainDelay Duration `json:"drainDelay" yaml:"drainDelay"`
+	// How long in-flight requests are given to finish once shutdown begins.
+	ShutdownTimeout Duration `json:"shutdownTimeout" yaml:"shutdownTimeout"`
+}
+
+type StorageConfig struct {
+	// Either "memory", which loses everything on exit, or "journal", which appends to Path.
+	Backend string `json:"backend" yaml:"backend"`
+	Path string `json:"path" yaml:"path"`
+	// Flush the journal to stable storage on every write rather than only on shutdown.
+	SyncWrites bool `json:"syncWrites" yaml:"syncWrites"`
+}
+
+// A Payer registered at startup when not already known.
+type PayerConfig struct {
+	Id string `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+}
+
+type SpendPolicyConfig struct {
+	// Either "partial", spending whatever is available, or "reject", refusing the whole spend.
+	Shortfall string `json:"shortfall" yaml:"shortfall"`
+	// How spends not naming a strategy choose the Payers funding them: fifo, soonest-expiring,
+	// payer-priority, proportional or largest-balance.
+	Allocation string `json:"allocation" yaml:"allocation"`
+	// The Payers drained first, in order, by the payer-priority allocation.
+	PayerPriority []string `json:"payerPriority" yaml:"payerPriority"`
+	// How long a hold reserves its Points unless captured or released.
+	HoldTtl Duration `json:"holdTtl" yaml:"holdTtl"`
+}
+
+type ExpiryConfig struct {
+	// Zero disables expiry.
+	PointsLifetime Duration `json:"pointsLifetime" yaml:"pointsLifetime"`
+	SweepInterval Duration `json:"sweepInterval" yaml:"sweepInterval"`
+}
+
+type TiersConfig struct {
+	// How far back the Points deciding a Purchaser's tier reach.
+	Window Duration `json:"window" yaml:"window"`
+	// In ascending order of minimumPoints, the first needing none; empty disables tiers.
+	Levels []domain.Tier `json:"levels" yaml:"levels"`
+}
+
+type PurchasersConfig struct {
+	// What becomes of the Points of a Purchaser whose account closes: forfeit or payout.
+	Closure string `json:"closure" yaml:"closure"`
+}
+
+type TransfersConfig struct {
+	// The most Points one transfer may move; zero is unlimited.
+	MaxPoints int `json:"maxPoints" yaml:"maxPoints"`
+	// The most Points a Purchaser may give away each UTC day; zero is unlimited.
+	DailyLimit int `json:"dailyLimit" yaml:"dailyLimit"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	ReadsPerSecond float64 `json:"readsPerSecond" yaml:"readsPerSecond"`
+	ReadBurst int `json:"readBurst" yaml:"readBurst"`
+	WritesPerSecond float64 `json:"writesPerSecond" yaml:"writesPerSecond"`
+	WriteBurst int `json:"writeBurst" yaml:"writeBurst"`
+}
+
+type LoggingConfig struct {
+	Level string `json:"level" yaml:"level"`
+	Format string `json:"format" yaml:"format"`
+}
+
+type TracingConfig struct {
+	// Either "none", "stdout", which writes spans to standard output, or "otlp", which sends them
+	// to an OpenTelemetry collector over OTLP/HTTP.
+	Exporter string `json:"exporter" yaml:"exporter"`
+	// The host:port of the collector when exporting over OTLP.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Send spans to the collector over plain HTTP rather than HTTPS.
+	Insecure bool `json:"insecure" yaml:"insecure"`
+	// The fraction, from 0 to 1, of traces started here that are recorded; traces started by a
+	// caller follow the caller's decision.
+	SampleRatio float64 `json:"sampleRatio" yaml:"sampleRatio"`
+	ServiceName string `json:"serviceName" yaml:"serviceName"`
+}
+
+type AuthConfig struct {
+	// Require every ledger request to present an API key.
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Path of the file issued API keys are kept in, hashed; empty keeps them only in memory.
+	KeysPath string `json:"keysPath" yaml:"keysPath"`
+	// A key always accepted as an administrator's, so the first keys can be issued.
+	BootstrapAdminKey string `json:"bootstrapAdminKey" yaml:"bootstrapAdminKey"`
+	Jwt JwtConfig `json:"jwt" yaml:"jwt"`
+}
+
+// Bearer tokens, such as those issued by a gateway, accepted alongside API keys.
+type JwtConfig struct {
+	// Path or http(s) URL of the JSON Web Key Set tokens are signed with; empty refuses tokens.
+	Jwks string `json:"jwks" yaml:"jwks"`
+	// When set, tokens must carry it as their iss claim.
+	Issuer string `json:"issuer" yaml:"issuer"`
+	// Tokens must carry it in their aud claim.
+	Audience string `json:"audience" yaml:"audience"`
+	// The claims naming the caller's Purchaser, roles and, for payer integrations, Payer.
+	PurchaserClaim string `json:"purchaserClaim" yaml:"purchaserClaim"`
+	RolesClaim string `json:"rolesClaim" yaml:"rolesClaim"`
+	PayerClaim string `json:"payerClaim" yaml:"payerClaim"`
+}
+
+// Receivers of the domain events emitted as the ledger changes, and how failed deliveries to them
+// are retried before being dead-lettered.
+type WebhooksConfig struct {
+	Endpoints []WebhookEndpointConfig `json:"endpoints" yaml:"endpoints"`
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	InitialBackoff Duration `json:"initialBackoff" yaml:"initialBackoff"`
+	MaxBackoff Duration `json:"maxBackoff" yaml:"maxBackoff"`
+	// How long a single delivery may take.
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+}
+
+type WebhookEndpointConfig struct {
+	Id string `json:"id" yaml:"id"`
+	Url string `json:"url" yaml:"url"`
+	// Signs every delivery so the receiver can tell it came from here.
+	Secret string `json:"secret" yaml:"secret"`
+	// The event types delivered; empty delivers every type.
+	Events []string `json:"events" yaml:"events"`
+}
+
+// A time.Duration written as a Go duration string such as "720h" or "30s".
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	return d.parse(text)
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.parse(node.Value)
+}
+
+func (d *Duration) parse(text string) error {
+	var parsed, parseErr = time.ParseDuration(text)
+	if parseErr != nil {
+		return parseErr
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			HttpAddress: ":8999",
+			ReadTimeout: Duration(10 * time.Second),
+			WriteTimeout: Duration(30 * time.Second),
+			IdleTimeout: Duration(2 * time.Minute),
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Storage: StorageConfig{Backend: StorageBackendMemory, SyncWrites: true},
+		Payers: []PayerConfig{
+			{Id: "DANNON", Name: "Dannon"},
+			{Id: "UNILEVER", Name: "Unilever"},
+			{Id: "MILLER COORS", Name: "Miller Coors"},
+		},
+		SpendPolicy: SpendPolicyConfig{Shortfall: ShortfallPartial, Allocation: domain.AllocationFifo, HoldTtl: Duration(15 * time.Minute)},
+		Expiry: ExpiryConfig{SweepInterval: Duration(time.Hour)},
+		Tiers: TiersConfig{Window: Duration(365 * 24 * time.Hour), Levels: []domain.Tier{}},
+		Purchasers: PurchasersConfig{Closure: domain.ClosureForfeit},
+		RateLimits: RateLimitConfig{
+			ReadsPerSecond: 50,
+			ReadBurst: 100,
+			WritesPerSecond: 10,
+			WriteBurst: 20,
+		},
+		Logging: LoggingConfig{Level: "info", Format: LogFormatLogfmt},
+		Tracing: TracingConfig{
+			Exporter: TracingExporterNone,
+			Endpoint: "localhost:4318",
+			Insecure: true,
+			SampleRatio: 1,
+			ServiceName: "purchase-tracker-service",
+		},
+		Auth: AuthConfig{
+			Jwt: JwtConfig{PurchaserClaim: "sub", RolesClaim: "roles", PayerClaim: "payer_id"},
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts: 8,
+			InitialBackoff: Duration(time.Second),
+			MaxBackoff: Duration(5 * time.Minute),
+			Timeout: Duration(10 * time.Second),
+		},
+	}
+}
+
+// Shown in place of a secret that is set when the configuration is printed.
+const RedactedSecret = "<redacted>"
+
+// A copy of the configuration safe to print or log, with every credential and signing secret
+// that is set replaced by RedactedSecret.
+func (c *Config) Redacted() *Config {
+	var redacted = *c
+	if redacted.Auth.BootstrapAdminKey != "" {
+		redacted.Auth.BootstrapAdminKey = RedactedSecret
+	}
+	// the endpoints are copied so that the configuration redacted keeps its secrets
+	redacted.Webhooks.Endpoints = nil
+	for _, endpoint := range c.Webhooks.Endpoints {
+		if endpoint.Secret != "" {
+			endpoint.Secret = RedactedSecret
+		}
+		redacted.Webhooks.Endpoints = append(redacted.Webhooks.Endpoints, endpoint)
+	}
+	return &redacted
+}
+
+// Every problem found while validating, reported together so an operator can fix them at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("Invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+func (c *Config) Validate() error {
+	var problems []string
+	if c.Server.HttpAddress == "" {
+		problems = append(problems, "server.httpAddress must not be empty")
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		problems = append(problems, "server.readTimeout, server.writeTimeout and server.idleTimeout must be positive")
+	}
+	if c.Server.DrainDelay < 0 {
+		problems = append(problems, "server.drainDelay must not be negative")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdownTimeout must be positive")
+	}
+	switch c.Storage.Backend {
+	case StorageBackendMemory:
+	case StorageBackendJournal:
+		if c.Storage.Path == "" {
+			problems = append(problems, "storage.path is required when storage.backend is journal")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("storage.backend must be %s or %s but was '%s'", StorageBackendMemory, StorageBackendJournal, c.Storage.Backend))
+	}
+	var seenPayers = make(map[string]bool)
+	for i, payer := range c.Payers {
+		if payer.Id == "" {
+			problems = append(problems, fmt.Sprintf("payers[%d].id must not be empty", i))
+		} else if seenPayers[payer.Id] {
+			problems = append(problems, fmt.Sprintf("payers[%d].id '%s' is listed more than once", i, payer.Id))
+		}
+		seenPayers[payer.Id] = true
+	}
+	if c.SpendPolicy.Shortfall != ShortfallPartial && c.SpendPolicy.Shortfall != ShortfallReject {
+		problems = append(problems, fmt.Sprintf("spendPolicy.shortfall must be %s or %s but was '%s'", ShortfallPartial, ShortfallReject, c.SpendPolicy.Shortfall))
+	}
+	if !isAllocation(c.SpendPolicy.Allocation) {
+		problems = append(problems, fmt.Sprintf("spendPolicy.allocation must be one of %s but was '%s'", strings.Join(domain.AllocationNames(), ", "), c.SpendPolicy.Allocation))
+	} else if c.SpendPolicy.Allocation == domain.AllocationPayerPriority && len(c.SpendPolicy.PayerPriority) == 0 {
+		problems = append(problems, "spendPolicy.payerPriority must list at least one Payer for the payer-priority allocation")
+	}
+	if c.SpendPolicy.HoldTtl <= 0 {
+		problems = append(problems, "spendPolicy.holdTtl must be positive")
+	}
+	if c.Expiry.PointsLifetime < 0 {
+		problems = append(problems, "expiry.pointsLifetime must not be negative")
+	}
+	if c.Expiry.PointsLifetime > 0 && c.Expiry.SweepInterval <= 0 {
+		problems = append(problems, "expiry.sweepInterval must be positive when expiry.pointsLifetime is set")
+	}
+	problems = append(problems, c.Tiers.validate()...)
+	if c.Purchasers.Closure != domain.ClosureForfeit && c.Purchasers.Closure != domain.ClosurePayout {
+		problems = append(problems, fmt.Sprintf("purchasers.closure must be %s or %s but was '%s'", domain.ClosureForfeit, domain.ClosurePayout, c.Purchasers.Closure))
+	}
+	if c.Transfers.MaxPoints < 0 || c.Transfers.DailyLimit < 0 {
+		problems = append(problems, "transfers.maxPoints and transfers.dailyLimit must not be negative")
+	}
+	if c.RateLimits.Enabled {
+		if c.RateLimits.ReadsPerSecond <= 0 || c.RateLimits.WritesPerSecond <= 0 {
+			problems = append(problems, "rateLimits.readsPerSecond and rateLimits.writesPerSecond must be positive")
+		}
+		if c.RateLimits.ReadBurst < 1 || c.RateLimits.WriteBurst < 1 {
+			problems = append(problems, "rateLimits.readBurst and rateLimits.writeBurst must be at least 1")
+		}
+	}
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("logging.level must be debug, info, warn or error but was '%s'", c.Logging.Level))
+	}
+	if c.Logging.Format != LogFormatLogfmt && c.Logging.Format != LogFormatJson {
+		problems = append(problems, fmt.Sprintf("logging.format must be %s or %s but was '%s'", LogFormatLogfmt, LogFormatJson, c.Logging.Format))
+	}
+	switch c.Tracing.Exporter {
+	case TracingExporterNone, TracingExporterStdout:
+	case TracingExporterOtlp:
+		if c.Tracing.Endpoint == "" {
+			problems = append(problems, "tracing.endpoint is required when tracing.exporter is otlp")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter must be %s, %s or %s but was '%s'", TracingExporterNone, TracingExporterStdout, TracingExporterOtlp, c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sampleRatio must be between 0 and 1")
+	}
+	if c.Auth.Enabled && c.Auth.KeysPath == "" && c.Auth.BootstrapAdminKey == "" && c.Auth.Jwt.Jwks == "" {
+		problems = append(problems, "auth.keysPath, auth.bootstrapAdminKey or auth.jwt.jwks is required when auth is enabled")
+	}
+	if c.Auth.Jwt.Jwks != "" {
+		if c.Auth.Jwt.Audience == "" {
+			problems = append(problems, "auth.jwt.audience is required when auth.jwt.jwks is set")
+		}
+		if c.Auth.Jwt.PurchaserClaim == "" || c.Auth.Jwt.RolesClaim == "" || c.Auth.Jwt.PayerClaim == "" {
+			problems = append(problems, "auth.jwt.purchaserClaim, auth.jwt.rolesClaim and auth.jwt.payerClaim must not be empty")
+		}
+	}
+	problems = append(problems, c.Webhooks.validate()...)
+	if len(problems) > 0 {
+		return ValidationError{problems}
+	}
+	return nil
+}
+
+func (c *WebhooksConfig) validate() []string {
+	var problems []string
+	var seenEndpoints = make(map[string]bool)
+	for i, endpoint := range c.Endpoints {
+		if endpoint.Id == "" {
+			problems = append(problems, fmt.Sprintf("webhooks.endpoints[%d].id must not be empty", i))
+		} else if seenEndpoints[endpoint.Id] {
+			problems = append(problems, fmt.Sprintf("webhooks.endpoints[%d].id '%s' is listed more than once", i, endpoint.Id))
+		}
+		seenEndpoints[endpoint.Id] = true
+		if !strings.HasPrefix(endpoint.Url, "http://") && !strings.HasPrefix(endpoint.Url, "https://") {
+			problems = append(problems, fmt.Sprintf("webhooks.endpoints[%d].url must be an http or https URL", i))
+		}
+		if endpoint.Secret == "" {
+			problems = append(problems, fmt.Sprintf("webhooks.endpoints[%d].secret must not be empty", i))
+		}
+		for _, eventType := range endpoint.Events {
+			if !domain.IsEventType(eventType) {
+				problems = append(problems, fmt.Sprintf("webhooks.endpoints[%d].events names unknown event type '%s'", i, eventType))
+			}
+		}
+	}
+	if c.MaxAttempts < 1 {
+		problems = append(problems, "webhooks.maxAttempts must be at least 1")
+	}
+	if c.InitialBackoff <= 0 || c.MaxBackoff < c.InitialBackoff {
+		problems = append(problems, "webhooks.initialBackoff must be positive and no longer than webhooks.maxBackoff")
+	}
+	if c.Timeout <= 0 {
+		problems = append(problems, "webhooks.timeout must be positive")
+	}
+	return problems
+}
+
+func (c *TiersConfig) validate() []string {
+	if len(c.Levels) == 0 {
+		return nil
+	}
+	var problems []string
+	if c.Window <= 0 {
+		problems = append(problems, "tiers.window must be positive when tiers.levels are set")
+	}
+	if c.Levels[0].MinimumPoints != 0 {
+		problems = append(problems, "tiers.levels[0].minimumPoints must be 0")
+	}
+	var seenLevels = make(map[string]bool)
+	for i, level := range c.Levels {
+		if level.Name == "" {
+			problems = append(problems, fmt.Sprintf("tiers.levels[%d].name must not be empty", i))
+		} else if seenLevels[level.Name] {
+			problems = append(problems, fmt.Sprintf("tiers.levels[%d].name '%s' is listed more than once", i, level.Name))
+		}
+		seenLevels[level.Name] = true
+		if i > 0 && level.MinimumPoints <= c.Levels[i - 1].MinimumPoints {
+			problems = append(problems, fmt.Sprintf("tiers.levels[%d].minimumPoints must be above that of the level before", i))
+		}
+		if level.Multiplier <= 0 {
+			problems = append(problems, fmt.Sprintf("tiers.levels[%d].multiplier must be positive", i))
+		}
+	}
+	return problems
+}
+
+// Read a configuration file over c; files ending in .json are JSON and anything else is YAML.
+func (c *Config) LoadFile(path string) error {
+	var content, readErr = os.ReadFile(path)
+	if readErr != nil {
+		return fmt.Errorf("Unable to read configuration file: %w", readErr)
+	}
+	var decodeErr error
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decodeErr = json.Unmarshal(content, c)
+	} else {
+		decodeErr = yaml.Unmarshal(content, c)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("Unable to parse configuration file %s: %w", path, decodeErr)
+	}
+	return nil
+}
+
+// Binds an environment variable onto a configuration setting.
+type environmentBinding struct {
+	name string
+	apply func(c *Config, value string) error
+}
+
+var environmentBindings = []environmentBinding{
+	{"PURCHASE_TRACKER_HTTP_ADDRESS", func(c *Config, value string) error {
+		c.Server.HttpAddress = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_READ_TIMEOUT", func(c *Config, value string) error {
+		return c.Server.ReadTimeout.parse(value)
+	}},
+	{"PURCHASE_TRACKER_WRITE_TIMEOUT", func(c *Config, value string) error {
+		return c.Server.WriteTimeout.parse(value)
+	}},
+	{"PURCHASE_TRACKER_IDLE_TIMEOUT", func(c *Config, value string) error {
+		return c.Server.IdleTimeout.parse(value)
+	}},
+	{"PURCHASE_TRACKER_DRAIN_DELAY", func(c *Config, value string) error {
+		return c.Server.DrainDelay.parse(value)
+	}},
+	{"PURCHASE_TRACKER_SHUTDOWN_TIMEOUT", func(c *Config, value string) error {
+		return c.Server.ShutdownTimeout.parse(value)
+	}},
+	{"PURCHASE_TRACKER_STORAGE_BACKEND", func(c *Config, value string) error {
+		c.Storage.Backend = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_STORAGE_PATH", func(c *Config, value string) error {
+		c.Storage.Path = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_STORAGE_SYNC_WRITES", func(c *Config, value string) error {
+		return parseBool(value, &c.Storage.SyncWrites)
+	}},
+	{"PURCHASE_TRACKER_PAYERS", func(c *Config, value string) error {
+		c.Payers = parsePayers(value)
+		return nil
+	}},
+	{"PURCHASE_TRACKER_SPEND_SHORTFALL", func(c *Config, value string) error {
+		c.SpendPolicy.Shortfall = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_SPEND_ALLOCATION", func(c *Config, value string) error {
+		c.SpendPolicy.Allocation = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_SPEND_PAYER_PRIORITY", func(c *Config, value string) error {
+		c.SpendPolicy.PayerPriority = parseList(value)
+		return nil
+	}},
+	{"PURCHASE_TRACKER_SPEND_HOLD_TTL", func(c *Config, value string) error {
+		return c.SpendPolicy.HoldTtl.parse(value)
+	}},
+	{"PURCHASE_TRACKER_POINTS_LIFETIME", func(c *Config, value string) error {
+		return c.Expiry.PointsLifetime.parse(value)
+	}},
+	{"PURCHASE_TRACKER_EXPIRY_SWEEP_INTERVAL", func(c *Config, value string) error {
+		return c.Expiry.SweepInterval.parse(value)
+	}},
+	{"PURCHASE_TRACKER_TIERS", func(c *Config, value string) error {
+		var levels, parseErr = parseTiers(value)
+		if parseErr != nil {
+			return parseErr
+		}
+		c.Tiers.Levels = levels
+		return nil
+	}},
+	{"PURCHASE_TRACKER_TIERS_WINDOW", func(c *Config, value string) error {
+		return c.Tiers.Window.parse(value)
+	}},
+	{"PURCHASE_TRACKER_PURCHASER_CLOSURE", func(c *Config, value string) error {
+		c.Purchasers.Closure = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_TRANSFER_MAX_POINTS", func(c *Config, value string) error {
+		return parseInt(value, &c.Transfers.MaxPoints)
+	}},
+	{"PURCHASE_TRACKER_TRANSFER_DAILY_LIMIT", func(c *Config, value string) error {
+		return parseInt(value, &c.Transfers.DailyLimit)
+	}},
+	{"PURCHASE_TRACKER_RATE_LIMITS_ENABLED", func(c *Config, value string) error {
+		return parseBool(value, &c.RateLimits.Enabled)
+	}},
+	{"PURCHASE_TRACKER_RATE_LIMITS_READS_PER_SECOND", func(c *Config, value string) error {
+		return parseFloat(value, &c.RateLimits.ReadsPerSecond)
+	}},
+	{"PURCHASE_TRACKER_RATE_LIMITS_READ_BURST", func(c *Config, value string) error {
+		return parseInt(value, &c.RateLimits.ReadBurst)
+	}},
+	{"PURCHASE_TRACKER_RATE_LIMITS_WRITES_PER_SECOND", func(c *Config, value string) error {
+		return parseFloat(value, &c.RateLimits.WritesPerSecond)
+	}},
+	{"PURCHASE_TRACKER_RATE_LIMITS_WRITE_BURST", func(c *Config, value string) error {
+		return parseInt(value, &c.RateLimits.WriteBurst)
+	}},
+	{"PURCHASE_TRACKER_LOG_LEVEL", func(c *Config, value string) error {
+		c.Logging.Level = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_LOG_FORMAT", func(c *Config, value string) error {
+		c.Logging.Format = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_TRACING_EXPORTER", func(c *Config, value string) error {
+		c.Tracing.Exporter = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_TRACING_ENDPOINT", func(c *Config, value string) error {
+		c.Tracing.Endpoint = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_TRACING_INSECURE", func(c *Config, value string) error {
+		return parseBool(value, &c.Tracing.Insecure)
+	}},
+	{"PURCHASE_TRACKER_TRACING_SAMPLE_RATIO", func(c *Config, value string) error {
+		return parseFloat(value, &c.Tracing.SampleRatio)
+	}},
+	{"PURCHASE_TRACKER_TRACING_SERVICE_NAME", func(c *Config, value string) error {
+		c.Tracing.ServiceName = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_AUTH_ENABLED", func(c *Config, value string) error {
+		return parseBool(value, &c.Auth.Enabled)
+	}},
+	{"PURCHASE_TRACKER_AUTH_KEYS_PATH", func(c *Config, value string) error {
+		c.Auth.KeysPath = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_AUTH_BOOTSTRAP_ADMIN_KEY", func(c *Config, value string) error {
+		c.Auth.BootstrapAdminKey = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_AUTH_JWKS", func(c *Config, value string) error {
+		c.Auth.Jwt.Jwks = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_AUTH_JWT_ISSUER", func(c *Config, value string) error {
+		c.Auth.Jwt.Issuer = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_AUTH_JWT_AUDIENCE", func(c *Config, value string) error {
+		c.Auth.Jwt.Audience = value
+		return nil
+	}},
+	{"PURCHASE_TRACKER_WEBHOOKS_MAX_ATTEMPTS", func(c *Config, value string) error {
+		return parseInt(value, &c.Webhooks.MaxAttempts)
+	}},
+	{"PURCHASE_TRACKER_WEBHOOKS_INITIAL_BACKOFF", func(c *Config, value string) error {
+		return c.Webhooks.InitialBackoff.parse(value)
+	}},
+	{"PURCHASE_TRACKER_WEBHOOKS_MAX_BACKOFF", func(c *Config, value string) error {
+		return c.Webhooks.MaxBackoff.parse(value)
+	}},
+	{"PURCHASE_TRACKER_WEBHOOKS_TIMEOUT", func(c *Config, value string) error {
+		return c.Webhooks.Timeout.parse(value)
+	}},
+}
+
+func (c *Config) ApplyEnvironment(lookupEnv func(string) (string, bool)) error {
+	var problems []string
+	for _, binding := range environmentBindings {
+		var value, isSet = lookupEnv(binding.name)
+		if !isSet {
+			continue
+		}
+		if applyErr := binding.apply(c, value); applyErr != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", binding.name, applyErr))
+		}
+	}
+	if len(problems) > 0 {
+		return ValidationError{problems}
+	}
+	return nil
+}
+
+// The command-line flags of the server, each overriding the file and environment only when given.
+type Flags struct {
+	flagSet *flag.FlagSet
+	configFile *string
+	httpAddress *string
+	shutdownTimeout *string
+	storageBackend *string
+	storagePath *string
+	shortfall *string
+	allocation *string
+	pointsLifetime *string
+	logLevel *string
+	logFormat *string
+	tracingExporter *string
+	tracingEndpoint *string
+}
+
+func RegisterFlags(flagSet *flag.FlagSet) *Flags {
+	return &Flags{
+		flagSet: flagSet,
+		configFile: flagSet.String("config", "", "Path of a YAML or JSON configuration file; defaults to $" + ConfigFileEnvironmentVariable + "."),
+		httpAddress: flagSet.String("http-address", ":8999", "The host:port address to bind to a server socket and listen for requests."),
+		shutdownTimeout: flagSet.String("shutdown-timeout", "30s", "How long in-flight requests are given to finish on shutdown."),
+		storageBackend: flagSet.String("storage-backend", StorageBackendMemory, "Where the ledger is kept: memory or journal."),
+		storagePath: flagSet.String("storage-path", "", "Path of the journal file when the storage backend is journal."),
+		shortfall: flagSet.String("spend-shortfall", ShortfallPartial, "How spends behave when balances fall short: partial or reject."),
+		allocation: flagSet.String("spend-allocation", domain.AllocationFifo, "How spends choose the Payers funding them: " + strings.Join(domain.AllocationNames(), ", ") + "."),
+		pointsLifetime: flagSet.String("points-lifetime", "0s", "How long Points remain spendable; 0s disables expiry."),
+		logLevel: flagSet.String("log-level", "info", "Minimum level logged: debug, info, warn or error."),
+		logFormat: flagSet.String("log-format", LogFormatLogfmt, "Log line format: logfmt or json."),
+		tracingExporter: flagSet.String("tracing-exporter", TracingExporterNone, "Where spans are exported: none, stdout or otlp."),
+		tracingEndpoint: flagSet.String("tracing-endpoint", "localhost:4318", "The host:port of the OTLP/HTTP collector spans are sent to."),
+	}
+}
+
+func (f *Flags) apply(c *Config) error {
+	var applyErr error
+	f.flagSet.Visit(func(set *flag.Flag) {
+		switch set.Name {
+		case "http-address":
+			c.Server.HttpAddress = *f.httpAddress
+		case "shutdown-timeout":
+			if parseErr := c.Server.ShutdownTimeout.parse(*f.shutdownTimeout); parseErr != nil {
+				applyErr = fmt.Errorf("-shutdown-timeout: %w", parseErr)
+			}
+		case "storage-backend":
+			c.Storage.Backend = *f.storageBackend
+		case "storage-path":
+			c.Storage.Path = *f.storagePath
+		case "spend-shortfall":
+			c.SpendPolicy.Shortfall = *f.shortfall
+		case "spend-allocation":
+			c.SpendPolicy.Allocation = *f.allocation
+		case "points-lifetime":
+			if parseErr := c.Expiry.PointsLifetime.parse(*f.pointsLifetime); parseErr != nil {
+				applyErr = fmt.Errorf("-points-lifetime: %w", parseErr)
+			}
+		case "log-level":
+			c.Logging.Level = *f.logLevel
+		case "log-format":
+			c.Logging.Format = *f.logFormat
+		case "tracing-exporter":
+			c.Tracing.Exporter = *f.tracingExporter
+		case "tracing-endpoint":
+			c.Tracing.Endpoint = *f.tracingEndpoint
+		}
+	})
+	return applyErr
+}
+
+// Assemble and validate the effective configuration from defaults, the configuration file,
+// environment variables and the already parsed flags, in that order of precedence.
+func (f *Flags) Load(lookupEnv func(string) (string, bool)) (*Config, error) {
+	var c = Default()
+	var configFile = *f.configFile
+	if configFile == "" {
+		configFile, _ = lookupEnv(ConfigFileEnvironmentVariable)
+	}
+	if configFile != "" {
+		if loadErr := c.LoadFile(configFile); loadErr != nil {
+			return nil, loadErr
+		}
+	}
+	if envErr := c.ApplyEnvironment(lookupEnv); envErr != nil {
+		return nil, envErr
+	}
+	if flagErr := f.apply(c); flagErr != nil {
+		return nil, flagErr
+	}
+	if validateErr := c.Validate(); validateErr != nil {
+		return nil, validateErr
+	}
+	return c, nil
+}
+
+// Parse "ID=Name,ID=Name"; a Payer without a name is named after its Id.
+func parsePayers(value string) []PayerConfig {
+	var payers = make([]PayerConfig, 0)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var id, name, hasName = strings.Cut(entry, "=")
+		if !hasName {
+			name = id
+		}
+		payers = append(payers, PayerConfig{Id: strings.TrimSpace(id), Name: strings.TrimSpace(name)})
+	}
+	return payers
+}
+
+// Read tiers written Name:minimumPoints:multiplier, separated by commas.
+func parseTiers(value string) ([]domain.Tier, error) {
+	var tiers = make([]domain.Tier, 0)
+	for _, entry := range parseList(value) {
+		var fields = strings.Split(entry, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("tier '%s' must be written Name:minimumPoints:multiplier", entry)
+		}
+		var tier = domain.Tier{Name: strings.TrimSpace(fields[0])}
+		if parseErr := parseInt(strings.TrimSpace(fields[1]), &tier.MinimumPoints); parseErr != nil {
+			return nil, fmt.Errorf("the minimum points of tier '%s' %s", tier.Name, parseErr)
+		}
+		if parseErr := parseFloat(strings.TrimSpace(fields[2]), &tier.Multiplier); parseErr != nil {
+			return nil, fmt.Errorf("the multiplier of tier '%s' %s", tier.Name, parseErr)
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
+
+// Read a comma separated list, dropping empty entries.
+func parseList(value string) []string {
+	var entries = make([]string, 0)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func isAllocation(name string) bool {
+	for _, allocation := range domain.AllocationNames() {
+		if allocation == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseBool(value string, target *bool) error {
+	var parsed, parseErr = strconv.ParseBool(value)
+	if parseErr != nil {
+		return errors.New("must be true or false")
+	}
+	*target = parsed
+	return nil
+}
+
+func parseInt(value string, target *int) error {
+	var parsed, parseErr = strconv.Atoi(value)
+	if parseErr != nil {
+		return errors.New("must be a whole number")
+	}
+	*target = parsed
+	return nil
+}
+
+func parseFloat(value string, target *float64) error {
+	var parsed, parseErr = strconv.ParseFloat(value, 64)
+	if parseErr != nil {
+		return errors.New("must be a number")
+	}
+	*target = parsed
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"purchase-tracker-service/config"
+)
+
+func loadConfigForTest(t *testing.T, env map[string]string, args ...string) (*config.Config, error) {
+	var flagSet = flag.NewFlagSet("http-server", flag.ContinueOnError)
+	var configFlags = config.RegisterFlags(flagSet)
+	if parseErr := flagSet.Parse(args); parseErr != nil {
+		t.Fatalf("Unable to parse flags %v: %s", args, parseErr)
+	}
+	return configFlags.Load(func(name string) (string, bool) {
+		var value, isSet = env[name]
+		return value, isSet
+	})
+}
+
+func writeConfigFileForTest(t *testing.T, name string, content string) string {
+	var path = filepath.Join(t.TempDir(), name)
+	if writeErr := os.WriteFile(path, []byte(content), 0o644); writeErr != nil {
+		t.Fatalf("Unable to write config file: %s", writeErr)
+	}
+	return path
+}
+
+func TestConfigDefaults(t *testing.T) {
+	var serviceConfig, loadErr = loadConfigForTest(t, nil)
+	if loadErr != nil {
+		t.Fatalf("Expected the defaults to be valid but got %s", loadErr)
+	}
+	if serviceConfig.Server.HttpAddress != ":8999" {
+		t.Fatalf("Expected the default address :8999 but was %s", serviceConfig.Server.HttpAddress)
+	}
+	if len(serviceConfig.Payers) != 3 {
+		t.Fatalf("Expected the three default seed payers but got %d", len(serviceConfig.Payers))
+	}
+	if serviceConfig.Storage.Backend != config.StorageBackendMemory {
+		t.Fatalf("Expected the memory storage backend by default but was %s", serviceConfig.Storage.Backend)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	var configFile = writeConfigFileForTest(t, "service.yaml", `
+server:
+  httpAddress: ":7000"
+storage:
+  backend: journal
+  path: /tmp/from-file.journal
+payers:
+  - id: ACME
+    name: Acme
+spendPolicy:
+  shortfall: reject
+expiry:
+  pointsLifetime: 720h
+logging:
+  level: debug
+`)
+	var env = map[string]string{
+		"PURCHASE_TRACKER_HTTP_ADDRESS": ":7001",
+		"PURCHASE_TRACKER_STORAGE_PATH": "/tmp/from-env.journal",
+		"PURCHASE_TRACKER_LOG_LEVEL": "warn",
+		"PURCHASE_TRACKER_LOG_FORMAT": "json",
+	}
+	var serviceConfig, loadErr = loadConfigForTest(t, env, "-config", configFile, "-http-address", ":7002")
+	if loadErr != nil {
+		t.Fatalf("Expected the layered configuration to be valid but got %s", loadErr)
+	}
+	if serviceConfig.Server.HttpAddress != ":7002" {
+		t.Fatalf("Expected the flag to win for the address but was %s", serviceConfig.Server.HttpAddress)
+	}
+	if serviceConfig.Storage.Path != "/tmp/from-env.journal" {
+		t.Fatalf("Expected the environment to win over the file for the storage path but was %s", serviceConfig.Storage.Path)
+	}
+	if serviceConfig.Storage.Backend != config.StorageBackendJournal {
+		t.Fatalf("Expected the file to set the storage backend but was %s", serviceConfig.Storage.Backend)
+	}
+	if len(serviceConfig.Payers) != 1 || serviceConfig.Payers[0].Id != "ACME" {
+		t.Fatalf("Expected the file's seed payers to replace the defaults")
+	}
+	if time.Duration(serviceConfig.Expiry.PointsLifetime) != 720 * time.Hour {
+		t.Fatalf("Expected a points lifetime of 720h but was %s", serviceConfig.Expiry.PointsLifetime)
+	}
+	if serviceConfig.Logging.Level != "warn" {
+		t.Fatalf("Expected the environment to win over the file for the log level but was %s", serviceConfig.Logging.Level)
+	}
+	if serviceConfig.Logging.Format != "json" {
+		t.Fatalf("Expected json logging but was %s", serviceConfig.Logging.Format)
+	}
+}
+
+func TestConfigJsonFile(t *testing.T) {
+	var configFile = writeConfigFileForTest(t, "service.json", `{"payers": [{"id": "ACME", "name": "Acme"}], "logging": {"format": "json"}, "expiry": {"pointsLifetime": "24h", "sweepInterval": "1m"}}`)
+	var serviceConfig, loadErr = loadConfigForTest(t, map[string]string{config.ConfigFileEnvironmentVariable: configFile})
+	if loadErr != nil {
+		t.Fatalf("Expected the JSON configuration to be valid but got %s", loadErr)
+	}
+	if len(serviceConfig.Payers) != 1 || serviceConfig.Payers[0].Name != "Acme" {
+		t.Fatalf("Expected the file's seed payers to replace the defaults")
+	}
+	if serviceConfig.Logging.Format != config.LogFormatJson {
+		t.Fatalf("Expected json logging but was %s", serviceConfig.Logging.Format)
+	}
+	if time.Duration(serviceConfig.Expiry.SweepInterval) != time.Minute {
+		t.Fatalf("Expected a sweep interval of 1m but was %s", serviceConfig.Expiry.SweepInterval)
+	}
+}
+
+func TestConfigValidationReportsEveryProblem(t *testing.T) {
+	var env = map[string]string{
+		"PURCHASE_TRACKER_STORAGE_BACKEND": "journal",
+		"PURCHASE_TRACKER_SPEND_SHORTFALL": "sometimes",
+		"PURCHASE_TRACKER_LOG_FORMAT": "xml",
+		"PURCHASE_TRACKER_PAYERS": "DANNON=Dannon,DANNON=Dannon Again",
+		"PURCHASE_TRACKER_TRACING_SAMPLE_RATIO": "2",
+		"PURCHASE_TRACKER_AUTH_JWKS": "/etc/purchase-tracker/jwks.json",
+		"PURCHASE_TRACKER_WEBHOOKS_MAX_ATTEMPTS": "0",
+		"PURCHASE_TRACKER_TIERS": "Gold:500:2,Silver:100:1.5",
+		"PURCHASE_TRACKER_PURCHASER_CLOSURE": "donate",
+		"PURCHASE_TRACKER_TRANSFER_DAILY_LIMIT": "-1",
+	}
+	var _, loadErr = loadConfigForTest(t, env, "-log-level", "chatty", "-tracing-exporter", "zipkin", "-spend-allocation", "random")
+	if loadErr == nil {
+		t.Fatalf("Expected the configuration to be rejected")
+	}
+	for _, expected := range []string{"storage.path", "spendPolicy.shortfall", "payers[1].id", "logging.level", "logging.format", "tracing.exporter", "tracing.sampleRatio", "auth.jwt.audience", "webhooks.maxAttempts", "spendPolicy.allocation", "tiers.levels[0].minimumPoints", "tiers.levels[1].minimumPoints", "purchasers.closure", "transfers.dailyLimit"} {
+		if !strings.Contains(loadErr.Error(), expected) {
+			t.Fatalf("Expected the error to mention %s but was %s", expected, loadErr)
+		}
+	}
+	_, loadErr = loadConfigForTest(t, map[string]string{"PURCHASE_TRACKER_RATE_LIMITS_READ_BURST": "many"})
+	if loadErr == nil || !strings.Contains(loadErr.Error(), "PURCHASE_TRACKER_RATE_LIMITS_READ_BURST") {
+		t.Fatalf("Expected a malformed environment variable to be named in the error but got %v", loadErr)
+	}
+}
+
+func TestCliConfigPrint(t *testing.T) {
+	t.Setenv("PURCHASE_TRACKER_LOG_FORMAT", "json")
+	var stdout, stderr bytes.Buffer
+	var exitCode = RunCli([]string{"config", "print", "-http-address", ":9000"}, &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("Expected config print to succeed but exited %d: %s", exitCode, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "httpAddress: :9000") || !strings.Contains(stdout.String(), "format: json") {
+		t.Fatalf("Expected the effective configuration to be printed but got %s", stdout.String())
+	}
+	stdout.Reset()
+	exitCode = RunCli([]string{"config", "print", "-log-level", "chatty"}, &stdout, &stderr)
+	if exitCode != cliExitUsageError {
+		t.Fatalf("Expected an invalid configuration to exit %d but exited %d", cliExitUsageError, exitCode)
+	}
+}
+
+func TestCliConfigPrintRedactsSecrets(t *testing.T) {
+	t.Setenv("PURCHASE_TRACKER_AUTH_BOOTSTRAP_ADMIN_KEY", "bootstrap-admin-key-value")
+	var configFile = writeConfigFileForTest(t, "service.yaml", `
+webhooks:
+  endpoints:
+    - id: warehouse
+      url: https://warehouse.example.com/hooks
+      secret: warehouse-signing-secret
+`)
+	for _, output := range []string{"yaml", "json"} {
+		var stdout, stderr bytes.Buffer
+		if exitCode := RunCli([]string{"config", "print", "-config", configFile, "-output", output}, &stdout, &stderr); exitCode != 0 {
+			t.Fatalf("Expected config print to succeed but exited %d: %s", exitCode, stderr.String())
+		}
+		if strings.Contains(stdout.String(), "bootstrap-admin-key-value") || strings.Contains(stdout.String(), "warehouse-signing-secret") {
+			t.Fatalf("Expected the %s configuration printed to hide its secrets but got %s", output, stdout.String())
+		}
+		if strings.Count(stdout.String(), config.RedactedSecret) != 2 || !strings.Contains(stdout.String(), "warehouse.example.com") {
+			t.Fatalf("Expected the %s configuration printed to show the secrets are set but got %s", output, stdout.String())
+		}
+	}
+}
@@ -1,29 +1,33 @@
 package dao
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"regexp"
 	"strings"
+	"github.com/go-kit/kit/log/level"
 	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
 )
 
 const (
 	whitespaceTokenizerPattern = "\\s"
 )
 
+var whitespaceTokenizer = regexp.MustCompile(whitespaceTokenizerPattern)
+
 // This Interface reflects the desired contract for storing and retrieving Payers.
 type PayerAccountsDao interface {
-	AddAccount(*domain.PayerAccount)
-	ListAllAccounts() []*domain.PayerAccount
-	GetWithId(id string) *domain.PayerAccount
-	GetWithName(name string) *domain.PayerAccount
-	SearchWithNameQuery(query string) []*domain.PayerAccount
+	AddAccount(ctx context.Context, payer *domain.PayerAccount) error
+	ListAllAccounts(ctx context.Context) []*domain.PayerAccount
+	GetWithId(ctx context.Context, id string) *domain.PayerAccount
+	GetWithName(ctx context.Context, name string) *domain.PayerAccount
+	SearchWithNameQuery(ctx context.Context, query string) []*domain.PayerAccount
 }
 
 // This concrete implementation makes the object access only require in-memory map objects for
 // storage and retrieval.
-		type LocalPayerStore struct {
+type LocalPayerStore struct {
 	cacheById map[string]*domain.PayerAccount
 	cacheByName map[string]*domain.PayerAccount
 	cacheByTokens map[string][]*domain.PayerAccount
@@ -45,7 +49,12 @@ func (e AccountExistsError) Error() string {
 	return fmt.Sprintf("Payer Account already registered: %s", e.PayerId)
 }
 
-func (s *LocalPayerStore) AddAccount(payer *domain.PayerAccount) error {
+func (s *LocalPayerStore) AddAccount(ctx context.Context, payer *domain.PayerAccount) error {
+	var _, span = tracer.Start(ctx, "PayerStore.AddAccount")
+	defer span.End()
+	if _, exists := s.cacheById[payer.Id]; exists {
+		return AccountExistsError{payer.Id}
+	}
 	s.cacheById[payer.Id] = payer
 	s.cacheByName[payer.Name] = payer
 	nameTokens := tokenizeSearchableTerm(payer.Name)
@@ -57,11 +66,13 @@ func (s *LocalPayerStore) AddAccount(payer *domain.PayerAccount) error {
 		}
 		cacheOfToken = append(cacheOfToken, payer)
 	}
-	log.Printf("Added account %s with tokens %s", payer.Id, nameTokens)
+	level.Debug(logging.FromContext(ctx)).Log("msg", "Added account", logging.PayerKey, payer.Id, "tokens", len(nameTokens))
 	return nil
 }
 
-func (s *LocalPayerStore) ListAllAccounts() []*domain.PayerAccount {
+func (s *LocalPayerStore) ListAllAccounts(ctx context.Context) []*domain.PayerAccount {
+	var _, span = tracer.Start(ctx, "PayerStore.ListAllAccounts")
+	defer span.End()
 	var allPayers []*domain.PayerAccount
 	for _, payer := range s.cacheById {
 		allPayers = append(allPayers, payer)
@@ -69,15 +80,21 @@ func (s *LocalPayerStore) ListAllAccounts() []*domain.PayerAccount {
 	return allPayers
 }
 
-func (s *LocalPayerStore) GetWithId(id string) *domain.PayerAccount {
+func (s *LocalPayerStore) GetWithId(ctx context.Context, id string) *domain.PayerAccount {
+	var _, span = tracer.Start(ctx, "PayerStore.GetWithId")
+	defer span.End()
 	return s.cacheById[id]
 }
 
-func (s *LocalPayerStore) GetWithName(name string) *domain.PayerAccount {
+func (s *LocalPayerStore) GetWithName(ctx context.Context, name string) *domain.PayerAccount {
+	var _, span = tracer.Start(ctx, "PayerStore.GetWithName")
+	defer span.End()
 	return s.cacheByName[name]
 }
 
-func (s *LocalPayerStore) SearchWithNameQuery(query string) []*domain.PayerAccount {
+func (s *LocalPayerStore) SearchWithNameQuery(ctx context.Context, query string) []*domain.PayerAccount {
+	var _, span = tracer.Start(ctx, "PayerStore.SearchWithNameQuery")
+	defer span.End()
 	var queryTokens = tokenizeSearchableTerm(query)
 	for _, queryToken := range queryTokens {
 		cacheItems, cacheHit := s.cacheByTokens[queryToken]
@@ -91,10 +108,6 @@ func (s *LocalPayerStore) SearchWithNameQuery(query string) []*domain.PayerAccou
 // derive a set of searchable tokens found within a name.
 func tokenizeSearchableTerm(name string) []string {
 	var searchableTokens []string = make([]string, 0)
-	var whitespaceTokenizer, whitespaceTokenizerErr = regexp.Compile("\\s")
-	if whitespaceTokenizerErr != nil {
-		log.Fatalf("REGEX error %s", whitespaceTokenizerErr)
-	}
 	var tokensAroundWhitespace = whitespaceTokenizer.FindAll([]byte(name), -1)
 	for _, tokenAroundWhitespace := range tokensAroundWhitespace {
 		searchableTokens = append(searchableTokens, strings.ToLower(string(tokenAroundWhitespace)))
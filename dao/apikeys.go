@@ -0,0 +1,149 @@
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"purchase-tracker-service/domain"
+)
+
+// This Interface reflects the desired contract for storing API keys by their hash.
+type ApiKeysDao interface {
+	AddKey(ctx context.Context, key *domain.ApiKey, keyHash string) error
+	// Return the key stored under keyId and its hash, or nil when there is none.
+	GetKey(ctx context.Context, keyId string) (*domain.ApiKey, string)
+	ListKeys(ctx context.Context) []*domain.ApiKey
+	// Replace the stored key, keeping its hash, such as to record its revocation.
+	UpdateKey(ctx context.Context, key *domain.ApiKey) error
+}
+
+type ApiKeyNotFoundError struct {
+	KeyId string
+}
+
+func (e ApiKeyNotFoundError) Error() string {
+	return fmt.Sprintf("API key was not found: %s", e.KeyId)
+}
+
+type storedApiKey struct {
+	Key *domain.ApiKey `json:"key"`
+	KeyHash string `json:"keyHash"`
+}
+
+// Keeps keys in memory and, when given a path, rewrites the whole file on every change; keys
+// change rarely enough that an append-only journal is not worth it.
+type LocalApiKeyStore struct {
+	lock sync.Mutex
+	path string
+	keysById map[string]*storedApiKey
+}
+
+func NewLocalApiKeyStore() *LocalApiKeyStore {
+	return &LocalApiKeyStore{keysById: make(map[string]*storedApiKey)}
+}
+
+// Open, creating on the first change if necessary, the key store kept at path.
+func OpenFileApiKeyStore(path string) (*LocalApiKeyStore, error) {
+	var store = NewLocalApiKeyStore()
+	store.path = path
+	var content, readErr = os.ReadFile(path)
+	if errors.Is(readErr, os.ErrNotExist) {
+		return store, nil
+	} else if readErr != nil {
+		return nil, readErr
+	}
+	var storedKeys []*storedApiKey
+	if decodeErr := json.Unmarshal(content, &storedKeys); decodeErr != nil {
+		return nil, fmt.Errorf("API key store %s is corrupt: %w", path, decodeErr)
+	}
+	for _, stored := range storedKeys {
+		store.keysById[stored.Key.Id] = stored
+	}
+	return store, nil
+}
+
+func (s *LocalApiKeyStore) AddKey(ctx context.Context, key *domain.ApiKey, keyHash string) error {
+	var _, span = tracer.Start(ctx, "ApiKeyStore.AddKey")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.keysById[key.Id] = &storedApiKey{key, keyHash}
+	return s.save()
+}
+
+func (s *LocalApiKeyStore) GetKey(ctx context.Context, keyId string) (*domain.ApiKey, string) {
+	var _, span = tracer.Start(ctx, "ApiKeyStore.GetKey")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if stored, exists := s.keysById[keyId]; exists {
+		return stored.Key, stored.KeyHash
+	}
+	return nil, ""
+}
+
+func (s *LocalApiKeyStore) ListKeys(ctx context.Context) []*domain.ApiKey {
+	var _, span = tracer.Start(ctx, "ApiKeyStore.ListKeys")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var keys = make([]*domain.ApiKey, 0, len(s.keysById))
+	for _, stored := range s.keysById {
+		keys = append(keys, stored.Key)
+	}
+	sort.Slice(keys, func(i int, j int) bool {
+		return keys[i].CreationTimestamp.Before(keys[j].CreationTimestamp)
+	})
+	return keys
+}
+
+func (s *LocalApiKeyStore) UpdateKey(ctx context.Context, key *domain.ApiKey) error {
+	var _, span = tracer.Start(ctx, "ApiKeyStore.UpdateKey")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var stored, exists = s.keysById[key.Id]
+	if !exists {
+		return ApiKeyNotFoundError{key.Id}
+	}
+	stored.Key = key
+	return s.save()
+}
+
+// Write every key to a temporary file and rename it over the store so a crash never leaves the
+// store half written.
+func (s *LocalApiKeyStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	var storedKeys = make([]*storedApiKey, 0, len(s.keysById))
+	for _, stored := range s.keysById {
+		storedKeys = append(storedKeys, stored)
+	}
+	var encoded, encodeErr = json.MarshalIndent(storedKeys, "", "  ")
+	if encodeErr != nil {
+		return encodeErr
+	}
+	var temporaryFile, createErr = os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path) + ".*")
+	if createErr != nil {
+		return createErr
+	}
+	defer os.Remove(temporaryFile.Name())
+	if _, writeErr := temporaryFile.Write(encoded); writeErr != nil {
+		temporaryFile.Close()
+		return writeErr
+	}
+	if syncErr := temporaryFile.Sync(); syncErr != nil {
+		temporaryFile.Close()
+		return syncErr
+	}
+	if closeErr := temporaryFile.Close(); closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(temporaryFile.Name(), s.path)
+}
@@ -0,0 +1,45 @@
+package dao
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"purchase-tracker-service/domain"
+)
+
+// This Interface reflects the desired contract for keeping the audit trail; entries are only ever
+// added, never changed or removed.
+type AuditDao interface {
+	AddEntry(ctx context.Context, entry *domain.AuditEntry)
+	// Return the entries filter selects in the order they were added.
+	ListEntries(ctx context.Context, filter *domain.AuditFilter) []*domain.AuditEntry
+}
+
+type LocalAuditStore struct {
+	cache []*domain.AuditEntry
+}
+
+func NewLocalAuditStore() *LocalAuditStore {
+	return &LocalAuditStore{make([]*domain.AuditEntry, 0)}
+}
+
+func (store *LocalAuditStore) AddEntry(ctx context.Context, entry *domain.AuditEntry) {
+	var _, span = tracer.Start(ctx, "AuditStore.AddEntry")
+	defer span.End()
+	store.cache = append(store.cache, entry)
+}
+
+func (store *LocalAuditStore) ListEntries(ctx context.Context, filter *domain.AuditFilter) []*domain.AuditEntry {
+	var _, span = tracer.Start(ctx, "AuditStore.ListEntries", trace.WithAttributes(attribute.Int("audit.entries", len(store.cache))))
+	defer span.End()
+	var entries = make([]*domain.AuditEntry, 0)
+	for _, entry := range store.cache {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+		if filter.Matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"purchase-tracker-service/domain"
+)
+
+// This Interface reflects the desired contract for storing campaigns.  Campaigns are never deleted;
+// a reversed campaign is replaced by its reversed state.
+type CampaignsDao interface {
+	PutCampaign(ctx context.Context, campaign *domain.Campaign)
+	// Return the campaign stored under campaignId, or nil when there is none.
+	GetCampaign(ctx context.Context, campaignId string) *domain.Campaign
+	// Return every campaign of payerId, by start and then Id.
+	ListForPayer(ctx context.Context, payerId string) []*domain.Campaign
+}
+
+type LocalCampaignStore struct {
+	campaignsById map[string]*domain.Campaign
+}
+
+func NewLocalCampaignStore() *LocalCampaignStore {
+	return &LocalCampaignStore{make(map[string]*domain.Campaign)}
+}
+
+func (store *LocalCampaignStore) PutCampaign(ctx context.Context, campaign *domain.Campaign) {
+	var _, span = tracer.Start(ctx, "CampaignStore.PutCampaign")
+	defer span.End()
+	store.campaignsById[campaign.Id] = campaign
+}
+
+func (store *LocalCampaignStore) GetCampaign(ctx context.Context, campaignId string) *domain.Campaign {
+	var _, span = tracer.Start(ctx, "CampaignStore.GetCampaign")
+	defer span.End()
+	return store.campaignsById[campaignId]
+}
+
+func (store *LocalCampaignStore) ListForPayer(ctx context.Context, payerId string) []*domain.Campaign {
+	var _, span = tracer.Start(ctx, "CampaignStore.ListForPayer")
+	defer span.End()
+	var campaigns []*domain.Campaign
+	for _, campaign := range store.campaignsById {
+		if campaign.Payer == payerId {
+			campaigns = append(campaigns, campaign)
+		}
+	}
+	sort.Slice(campaigns, func(i int, j int) bool {
+		if !campaigns[i].StartTimestamp.Equal(campaigns[j].StartTimestamp) {
+			return campaigns[i].StartTimestamp.Before(campaigns[j].StartTimestamp)
+		}
+		return campaigns[i].Id < campaigns[j].Id
+	})
+	return campaigns
+}
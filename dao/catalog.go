@@ -0,0 +1,69 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"purchase-tracker-service/domain"
+)
+
+// This Interface reflects the desired contract for storing the reward catalog and the redemptions
+// of its items.  Neither is ever deleted; changes replace what was stored.
+type CatalogDao interface {
+	PutItem(ctx context.Context, item *domain.CatalogItem)
+	// Return the item stored under itemId, or nil when there is none.
+	GetItem(ctx context.Context, itemId string) *domain.CatalogItem
+	// Return every item by Id.
+	ListItems(ctx context.Context) []*domain.CatalogItem
+	PutRedemption(ctx context.Context, redemption *domain.Redemption)
+	// Return the redemption stored under redemptionId, or nil when there is none.
+	GetRedemption(ctx context.Context, redemptionId string) *domain.Redemption
+}
+
+type LocalCatalogStore struct {
+	itemsById map[string]*domain.CatalogItem
+	redemptionsById map[string]*domain.Redemption
+}
+
+func NewLocalCatalogStore() *LocalCatalogStore {
+	return &LocalCatalogStore{
+		itemsById: make(map[string]*domain.CatalogItem),
+		redemptionsById: make(map[string]*domain.Redemption),
+	}
+}
+
+func (store *LocalCatalogStore) PutItem(ctx context.Context, item *domain.CatalogItem) {
+	var _, span = tracer.Start(ctx, "CatalogStore.PutItem")
+	defer span.End()
+	store.itemsById[item.Id] = item
+}
+
+func (store *LocalCatalogStore) GetItem(ctx context.Context, itemId string) *domain.CatalogItem {
+	var _, span = tracer.Start(ctx, "CatalogStore.GetItem")
+	defer span.End()
+	return store.itemsById[itemId]
+}
+
+func (store *LocalCatalogStore) ListItems(ctx context.Context) []*domain.CatalogItem {
+	var _, span = tracer.Start(ctx, "CatalogStore.ListItems")
+	defer span.End()
+	var items = make([]*domain.CatalogItem, 0, len(store.itemsById))
+	for _, item := range store.itemsById {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i int, j int) bool {
+		return items[i].Id < items[j].Id
+	})
+	return items
+}
+
+func (store *LocalCatalogStore) PutRedemption(ctx context.Context, redemption *domain.Redemption) {
+	var _, span = tracer.Start(ctx, "CatalogStore.PutRedemption")
+	defer span.End()
+	store.redemptionsById[redemption.Id] = redemption
+}
+
+func (store *LocalCatalogStore) GetRedemption(ctx context.Context, redemptionId string) *domain.Redemption {
+	var _, span = tracer.Start(ctx, "CatalogStore.GetRedemption")
+	defer span.End()
+	return store.redemptionsById[redemptionId]
+}
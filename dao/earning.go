@@ -0,0 +1,33 @@
+package dao
+
+import (
+	"context"
+	"purchase-tracker-service/domain"
+)
+
+// This Interface reflects the desired contract for storing the earning rules of each Payer.
+type EarningRulesDao interface {
+	PutRules(ctx context.Context, rules *domain.EarningRules)
+	// Return the rules of payerId, or nil when it has none.
+	GetRules(ctx context.Context, payerId string) *domain.EarningRules
+}
+
+type LocalEarningRulesStore struct {
+	rulesByPayer map[string]*domain.EarningRules
+}
+
+func NewLocalEarningRulesStore() *LocalEarningRulesStore {
+	return &LocalEarningRulesStore{make(map[string]*domain.EarningRules)}
+}
+
+func (store *LocalEarningRulesStore) PutRules(ctx context.Context, rules *domain.EarningRules) {
+	var _, span = tracer.Start(ctx, "EarningRulesStore.PutRules")
+	defer span.End()
+	store.rulesByPayer[rules.Payer] = rules
+}
+
+func (store *LocalEarningRulesStore) GetRules(ctx context.Context, payerId string) *domain.EarningRules {
+	var _, span = tracer.Start(ctx, "EarningRulesStore.GetRules")
+	defer span.End()
+	return store.rulesByPayer[payerId]
+}
@@ -0,0 +1,52 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"purchase-tracker-service/domain"
+)
+
+// This Interface reflects the desired contract for storing spend holds.  Holds are never deleted;
+// a settled hold is replaced by its settled state.
+type HoldsDao interface {
+	PutHold(ctx context.Context, hold *domain.SpendHold)
+	// Return the hold stored under holdId, or nil when there is none.
+	GetHold(ctx context.Context, holdId string) *domain.SpendHold
+	// Return every hold still held, oldest first, whether or not it has expired.
+	ListHeld(ctx context.Context) []*domain.SpendHold
+}
+
+type LocalHoldStore struct {
+	holdsById map[string]*domain.SpendHold
+}
+
+func NewLocalHoldStore() *LocalHoldStore {
+	return &LocalHoldStore{make(map[string]*domain.SpendHold)}
+}
+
+func (store *LocalHoldStore) PutHold(ctx context.Context, hold *domain.SpendHold) {
+	var _, span = tracer.Start(ctx, "HoldStore.PutHold")
+	defer span.End()
+	store.holdsById[hold.Id] = hold
+}
+
+func (store *LocalHoldStore) GetHold(ctx context.Context, holdId string) *domain.SpendHold {
+	var _, span = tracer.Start(ctx, "HoldStore.GetHold")
+	defer span.End()
+	return store.holdsById[holdId]
+}
+
+func (store *LocalHoldStore) ListHeld(ctx context.Context) []*domain.SpendHold {
+	var _, span = tracer.Start(ctx, "HoldStore.ListHeld")
+	defer span.End()
+	var held []*domain.SpendHold
+	for _, hold := range store.holdsById {
+		if hold.Status == domain.HoldStatusHeld {
+			held = append(held, hold)
+		}
+	}
+	sort.Slice(held, func(i int, j int) bool {
+		return held[i].CreationTimestamp.Before(held[j].CreationTimestamp)
+	})
+	return held
+}
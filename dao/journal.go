@@ -0,0 +1,270 @@
+package dao
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+// A single durable change to the ledger.  Every record is written whole or not at all so that the
+// Transactions of a spend are never partially persisted.
+type JournalRecord struct {
+	Sequence int64 `json:"sequence"`
+	Timestamp time.Time `json:"timestamp"`
+	Payer *domain.PayerAccount `json:"payer,omitempty"`
+	// A Purchaser's account as it stands after the change.
+	Purchaser *domain.PurchaserAccount `json:"purchaser,omitempty"`
+	Transactions []*domain.RewardTransaction `json:"transactions,omitempty"`
+	Audit *domain.AuditEntry `json:"audit,omitempty"`
+	// A spend hold as it stands after the change.
+	Hold *domain.SpendHold `json:"hold,omitempty"`
+	// A catalog item and a redemption of one as they stand after the change.
+	CatalogItem *domain.CatalogItem `json:"catalogItem,omitempty"`
+	Redemption *domain.Redemption `json:"redemption,omitempty"`
+	// A Payer's earning rules as they stand after the change.
+	EarningRules *domain.EarningRules `json:"earningRules,omitempty"`
+	// A campaign as it stands after the change.
+	Campaign *domain.Campaign `json:"campaign,omitempty"`
+	// A transfer as it stands after the change.
+	Transfer *domain.PointsTransfer `json:"transfer,omitempty"`
+	// A Payer's funding limits as they stand after the change.
+	PayerLimits *domain.PayerLimits `json:"payerLimits,omitempty"`
+	// A Payer's balance reaching the alert threshold of its cap.
+	CapAlert *domain.PayerCapApproached `json:"capAlert,omitempty"`
+	// A Purchaser moving to another tier.
+	TierChange *domain.TierChange `json:"tierChange,omitempty"`
+	// The domain events the change emits, written with it so that none are lost or invented by a
+	// crash; see the outbox.
+	Events []*domain.DomainEvent `json:"events,omitempty"`
+	// Marks the events of every record up to and including this sequence as published.
+	PublishedThrough int64 `json:"publishedThrough,omitempty"`
+}
+
+// This Interface reflects the desired contract for persisting ledger changes and replaying them
+// on startup.
+type JournalDao interface {
+	// Durably record a change; the record's Sequence is assigned by the journal.
+	Append(ctx context.Context, record *JournalRecord) error
+	// Hand every previously appended record, in order, to apply.
+	Replay(ctx context.Context, apply func(record *JournalRecord) error) error
+	// Force any buffered records to stable storage.
+	Flush() error
+	// Report why the journal could not currently accept a record, if it could not.
+	Check() error
+	Close() error
+}
+
+// Keeps records in memory only; everything is lost when the process exits.
+type LocalJournal struct {
+	lock sync.Mutex
+	records []*JournalRecord
+}
+
+func NewLocalJournal() *LocalJournal {
+	return &LocalJournal{records: make([]*JournalRecord, 0)}
+}
+
+func (j *LocalJournal) Append(_ context.Context, record *JournalRecord) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	record.Sequence = int64(len(j.records) + 1)
+	j.records = append(j.records, record)
+	return nil
+}
+
+func (j *LocalJournal) Replay(_ context.Context, apply func(record *JournalRecord) error) error {
+	j.lock.Lock()
+	var records = append([]*JournalRecord{}, j.records...)
+	j.lock.Unlock()
+	for _, record := range records {
+		if err := apply(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *LocalJournal) Flush() error {
+	return nil
+}
+
+func (j *LocalJournal) Check() error {
+	return nil
+}
+
+func (j *LocalJournal) Close() error {
+	return nil
+}
+
+// Appends each record as a line of JSON to a file.  A final line left incomplete by a crash is
+// discarded on replay since the change it held was never acknowledged.
+type FileJournal struct {
+	lock sync.Mutex
+	path string
+	file *os.File
+	writer *bufio.Writer
+	sequence int64
+	syncWrites bool
+	closed bool
+}
+
+type JournalCorruptError struct {
+	Path string
+	Line int
+	Cause error
+}
+
+func (e JournalCorruptError) Error() string {
+	return fmt.Sprintf("Journal %s is corrupt at line %d: %s", e.Path, e.Line, e.Cause)
+}
+
+func (e JournalCorruptError) Unwrap() error {
+	return e.Cause
+}
+
+// Open, creating if necessary, the journal at path.  When syncWrites is set every Append is
+// flushed to stable storage before returning.
+func OpenFileJournal(path string, syncWrites bool) (*FileJournal, error) {
+	var file, openErr = os.OpenFile(path, os.O_RDWR | os.O_CREATE, 0o644)
+	if openErr != nil {
+		return nil, openErr
+	}
+	var journal = &FileJournal{
+		path: path,
+		file: file,
+		syncWrites: syncWrites,
+	}
+	if truncateErr := journal.truncateTornRecord(); truncateErr != nil {
+		file.Close()
+		return nil, truncateErr
+	}
+	if _, seekErr := file.Seek(0, io.SeekEnd); seekErr != nil {
+		file.Close()
+		return nil, seekErr
+	}
+	journal.writer = bufio.NewWriter(file)
+	return journal, nil
+}
+
+// Scan the file for the last complete record, dropping any trailing bytes written after it.
+func (j *FileJournal) truncateTornRecord() error {
+	if _, seekErr := j.file.Seek(0, io.SeekStart); seekErr != nil {
+		return seekErr
+	}
+	var reader = bufio.NewReader(j.file)
+	var validLength int64
+	var lineNumber = 0
+	for {
+		var line, readErr = reader.ReadBytes('\n')
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return readErr
+		}
+		lineNumber++
+		var record JournalRecord
+		if decodeErr := json.Unmarshal(bytes.TrimSpace(line), &record); decodeErr != nil {
+			return JournalCorruptError{j.path, lineNumber, decodeErr}
+		}
+		validLength += int64(len(line))
+		j.sequence = record.Sequence
+	}
+	return j.file.Truncate(validLength)
+}
+
+func (j *FileJournal) Append(ctx context.Context, record *JournalRecord) error {
+	var _, span = tracer.Start(ctx, "FileJournal.Append", trace.WithAttributes(attribute.Bool("journal.sync_writes", j.syncWrites)))
+	defer span.End()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	record.Sequence = j.sequence + 1
+	var encoded, encodeErr = json.Marshal(record)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	if _, writeErr := j.writer.Write(append(encoded, '\n')); writeErr != nil {
+		return writeErr
+	}
+	if flushErr := j.writer.Flush(); flushErr != nil {
+		return flushErr
+	}
+	if j.syncWrites {
+		if syncErr := j.file.Sync(); syncErr != nil {
+			return syncErr
+		}
+	}
+	j.sequence = record.Sequence
+	level.Debug(logging.FromContext(ctx)).Log("msg", "Journaled record", "sequence", record.Sequence, "transactions", len(record.Transactions))
+	return nil
+}
+
+func (j *FileJournal) Replay(ctx context.Context, apply func(record *JournalRecord) error) error {
+	var _, span = tracer.Start(ctx, "FileJournal.Replay")
+	defer span.End()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	var file, openErr = os.Open(j.path)
+	if openErr != nil {
+		return openErr
+	}
+	defer file.Close()
+	var scanner = bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64 * 1024), 64 * 1024 * 1024)
+	var lineNumber = 0
+	for scanner.Scan() {
+		lineNumber++
+		var record JournalRecord
+		if decodeErr := json.Unmarshal(scanner.Bytes(), &record); decodeErr != nil {
+			return JournalCorruptError{j.path, lineNumber, decodeErr}
+		}
+		if applyErr := apply(&record); applyErr != nil {
+			return applyErr
+		}
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return scanErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Replayed journal", "path", j.path, "records", lineNumber)
+	return nil
+}
+
+func (j *FileJournal) Flush() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if flushErr := j.writer.Flush(); flushErr != nil {
+		return flushErr
+	}
+	return j.file.Sync()
+}
+
+func (j *FileJournal) Check() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.closed {
+		return fmt.Errorf("Journal %s is closed", j.path)
+	}
+	var _, statErr = j.file.Stat()
+	return statErr
+}
+
+func (j *FileJournal) Close() error {
+	j.lock.Lock()
+	j.closed = true
+	j.lock.Unlock()
+	if flushErr := j.Flush(); flushErr != nil {
+		j.file.Close()
+		return flushErr
+	}
+	return j.file.Close()
+}
@@ -0,0 +1,33 @@
+package dao
+
+import (
+	"context"
+	"purchase-tracker-service/domain"
+)
+
+// This Interface reflects the desired contract for storing the funding limits of each Payer.
+type PayerLimitsDao interface {
+	PutLimits(ctx context.Context, limits *domain.PayerLimits)
+	// Return the limits of payerId, or nil when it has none.
+	GetLimits(ctx context.Context, payerId string) *domain.PayerLimits
+}
+
+type LocalPayerLimitsStore struct {
+	limitsByPayer map[string]*domain.PayerLimits
+}
+
+func NewLocalPayerLimitsStore() *LocalPayerLimitsStore {
+	return &LocalPayerLimitsStore{make(map[string]*domain.PayerLimits)}
+}
+
+func (store *LocalPayerLimitsStore) PutLimits(ctx context.Context, limits *domain.PayerLimits) {
+	var _, span = tracer.Start(ctx, "PayerLimitsStore.PutLimits")
+	defer span.End()
+	store.limitsByPayer[limits.Payer] = limits
+}
+
+func (store *LocalPayerLimitsStore) GetLimits(ctx context.Context, payerId string) *domain.PayerLimits {
+	var _, span = tracer.Start(ctx, "PayerLimitsStore.GetLimits")
+	defer span.End()
+	return store.limitsByPayer[payerId]
+}
@@ -0,0 +1,54 @@
+package dao
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"purchase-tracker-service/domain"
+)
+
+// The domain events of a committed journal record, held until they have been published.
+type OutboxEntry struct {
+	Sequence int64
+	Events []*domain.DomainEvent
+}
+
+// This Interface reflects the desired contract for the transactional outbox: events are added
+// with the change that emitted them and only forgotten once marked published.
+type OutboxDao interface {
+	AddEntry(ctx context.Context, entry *OutboxEntry)
+	// Forget every entry up to and including the record at sequence.
+	MarkPublished(ctx context.Context, sequence int64)
+	// Return the entries not yet published, oldest first.
+	PendingEntries(ctx context.Context) []*OutboxEntry
+}
+
+type LocalOutboxStore struct {
+	pending []*OutboxEntry
+}
+
+func NewLocalOutboxStore() *LocalOutboxStore {
+	return &LocalOutboxStore{make([]*OutboxEntry, 0)}
+}
+
+func (store *LocalOutboxStore) AddEntry(ctx context.Context, entry *OutboxEntry) {
+	var _, span = tracer.Start(ctx, "OutboxStore.AddEntry", trace.WithAttributes(attribute.Int("outbox.events", len(entry.Events))))
+	defer span.End()
+	store.pending = append(store.pending, entry)
+}
+
+func (store *LocalOutboxStore) MarkPublished(ctx context.Context, sequence int64) {
+	var _, span = tracer.Start(ctx, "OutboxStore.MarkPublished")
+	defer span.End()
+	var published = 0
+	for published < len(store.pending) && store.pending[published].Sequence <= sequence {
+		published++
+	}
+	store.pending = store.pending[published:]
+}
+
+func (store *LocalOutboxStore) PendingEntries(ctx context.Context) []*OutboxEntry {
+	var _, span = tracer.Start(ctx, "OutboxStore.PendingEntries", trace.WithAttributes(attribute.Int("outbox.entries", len(store.pending))))
+	defer span.End()
+	return append([]*OutboxEntry{}, store.pending...)
+}
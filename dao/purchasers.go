@@ -0,0 +1,81 @@
+package dao
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+// This Interface reflects the desired contract for storing and retrieving Purchasers.
+type PurchaserAccountsDao interface {
+	AddAccount(ctx context.Context, purchaser *domain.PurchaserAccount) error
+	// Replace the account with the same Id.
+	UpdateAccount(ctx context.Context, purchaser *domain.PurchaserAccount) error
+	ListAllAccounts(ctx context.Context) []*domain.PurchaserAccount
+	GetWithId(ctx context.Context, id string) *domain.PurchaserAccount
+}
+
+// This concrete implementation makes the object access only require in-memory map objects for
+// storage and retrieval.
+type LocalPurchaserStore struct {
+	cacheById map[string]*domain.PurchaserAccount
+}
+
+func NewLocalPurchaserStore() *LocalPurchaserStore {
+	return &LocalPurchaserStore{make(map[string]*domain.PurchaserAccount)}
+}
+
+type PurchaserExistsError struct {
+	PurchaserId string
+}
+
+func (e PurchaserExistsError) Error() string {
+	return fmt.Sprintf("Purchaser Account already registered: %s", e.PurchaserId)
+}
+
+type PurchaserNotFoundError struct {
+	PurchaserId string
+}
+
+func (e PurchaserNotFoundError) Error() string {
+	return fmt.Sprintf("Purchaser Account was not found: %s", e.PurchaserId)
+}
+
+func (s *LocalPurchaserStore) AddAccount(ctx context.Context, purchaser *domain.PurchaserAccount) error {
+	var _, span = tracer.Start(ctx, "PurchaserStore.AddAccount")
+	defer span.End()
+	if _, exists := s.cacheById[purchaser.Id]; exists {
+		return PurchaserExistsError{purchaser.Id}
+	}
+	s.cacheById[purchaser.Id] = purchaser
+	level.Debug(logging.FromContext(ctx)).Log("msg", "Added purchaser account", logging.PurchaserKey, purchaser.Id)
+	return nil
+}
+
+func (s *LocalPurchaserStore) UpdateAccount(ctx context.Context, purchaser *domain.PurchaserAccount) error {
+	var _, span = tracer.Start(ctx, "PurchaserStore.UpdateAccount")
+	defer span.End()
+	if _, exists := s.cacheById[purchaser.Id]; !exists {
+		return PurchaserNotFoundError{purchaser.Id}
+	}
+	s.cacheById[purchaser.Id] = purchaser
+	return nil
+}
+
+func (s *LocalPurchaserStore) ListAllAccounts(ctx context.Context) []*domain.PurchaserAccount {
+	var _, span = tracer.Start(ctx, "PurchaserStore.ListAllAccounts")
+	defer span.End()
+	var allPurchasers []*domain.PurchaserAccount
+	for _, purchaser := range s.cacheById {
+		allPurchasers = append(allPurchasers, purchaser)
+	}
+	return allPurchasers
+}
+
+func (s *LocalPurchaserStore) GetWithId(ctx context.Context, id string) *domain.PurchaserAccount {
+	var _, span = tracer.Start(ctx, "PurchaserStore.GetWithId")
+	defer span.End()
+	return s.cacheById[id]
+}
@@ -1,36 +1,62 @@
 package dao
 
 import (
-	"log"
+	"context"
+	"github.com/go-kit/kit/log/level"
 	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
 )
 
 type RewardsDao interface {
-	AddTransaction(transaction *domain.RewardTransaction)
-	GetPointsForPayer(payerId string) *int
+	AddTransaction(ctx context.Context, transaction *domain.RewardTransaction)
+	GetPointsForPayer(ctx context.Context, payerId string) *int
+	// The Points a single Purchaser holds under a Payer; Transactions naming no Purchaser are
+	// held by the empty Purchaser id.
+	GetPointsForPurchaser(ctx context.Context, purchaserId string, payerId string) *int
 }
 
 type LocalRewardsStore struct {
 	cache map[string]int
+	cacheByPurchaser map[string]map[string]int
 }
 
 func NewLocalRewardsStore() *LocalRewardsStore {
-	return &LocalRewardsStore{make(map[string]int)}
+	return &LocalRewardsStore{make(map[string]int), make(map[string]map[string]int)}
 }
 
-func (store *LocalRewardsStore) AddTransaction(transaction *domain.RewardTransaction) {
-	log.Printf("Payer transaction %s : %d", transaction.Payer, transaction.Points)
+func (store *LocalRewardsStore) AddTransaction(ctx context.Context, transaction *domain.RewardTransaction) {
+	var _, span = tracer.Start(ctx, "RewardsStore.AddTransaction")
+	defer span.End()
+	level.Debug(logging.WithTransaction(logging.FromContext(ctx), transaction)).Log("msg", "Applied transaction to balance")
 	var currentProgress, exists = store.cache[transaction.Payer]
 	if !exists {
 		currentProgress = 0
 	}
 	store.cache[transaction.Payer] = currentProgress + transaction.Points
+	var purchaserCache, purchaserTracked = store.cacheByPurchaser[transaction.Purchaser]
+	if !purchaserTracked {
+		purchaserCache = make(map[string]int)
+		store.cacheByPurchaser[transaction.Purchaser] = purchaserCache
+	}
+	purchaserCache[transaction.Payer] += transaction.Points
 }
 
-func (store *LocalRewardsStore) GetPointsForPayer(payerId string) *int {
+func (store *LocalRewardsStore) GetPointsForPayer(ctx context.Context, payerId string) *int {
+	var _, span = tracer.Start(ctx, "RewardsStore.GetPointsForPayer")
+	defer span.End()
 	if currentProgress, tracked := store.cache[payerId]; tracked {
 		return &currentProgress
 	} else {
 		return nil
 	}
 }
+
+func (store *LocalRewardsStore) GetPointsForPurchaser(ctx context.Context, purchaserId string, payerId string) *int {
+	var _, span = tracer.Start(ctx, "RewardsStore.GetPointsForPurchaser")
+	defer span.End()
+	if currentProgress, tracked := store.cacheByPurchaser[purchaserId][payerId]; tracked {
+		return &currentProgress
+	} else {
+		return nil
+	}
+}
@@ -0,0 +1,49 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"purchase-tracker-service/domain"
+)
+
+// This Interface reflects the desired contract for storing the tier each Purchaser was last
+// moved to.  Purchasers never moved are in the lowest tier.
+type TiersDao interface {
+	PutTierChange(ctx context.Context, change *domain.TierChange)
+	// Return the tier purchaserId was last moved to, and whether it ever was.
+	GetTier(ctx context.Context, purchaserId string) (string, bool)
+	// Return every Purchaser ever moved, by Id.
+	ListPurchasers(ctx context.Context) []string
+}
+
+type LocalTierStore struct {
+	tiersByPurchaser map[string]string
+}
+
+func NewLocalTierStore() *LocalTierStore {
+	return &LocalTierStore{make(map[string]string)}
+}
+
+func (store *LocalTierStore) PutTierChange(ctx context.Context, change *domain.TierChange) {
+	var _, span = tracer.Start(ctx, "TierStore.PutTierChange")
+	defer span.End()
+	store.tiersByPurchaser[change.Purchaser] = change.Tier
+}
+
+func (store *LocalTierStore) GetTier(ctx context.Context, purchaserId string) (string, bool) {
+	var _, span = tracer.Start(ctx, "TierStore.GetTier")
+	defer span.End()
+	var tier, isKnown = store.tiersByPurchaser[purchaserId]
+	return tier, isKnown
+}
+
+func (store *LocalTierStore) ListPurchasers(ctx context.Context) []string {
+	var _, span = tracer.Start(ctx, "TierStore.ListPurchasers")
+	defer span.End()
+	var purchasers = make([]string, 0, len(store.tiersByPurchaser))
+	for purchaser := range store.tiersByPurchaser {
+		purchasers = append(purchasers, purchaser)
+	}
+	sort.Strings(purchasers)
+	return purchasers
+}
@@ -0,0 +1,8 @@
+package dao
+
+import (
+	"go.opentelemetry.io/otel"
+)
+
+// Spans of every store operation; they are only recorded once a tracer provider is installed.
+var tracer = otel.Tracer("purchase-tracker-service/dao")
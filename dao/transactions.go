@@ -1,7 +1,10 @@
 package dao
 
 import (
+	"context"
 	"sort"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"purchase-tracker-service/domain"
 )
 
@@ -21,28 +24,55 @@ func (t RewardTransactionByTimestamp) Swap(i int, j int) {
 
 type TransactionsDao interface {
 	// Add a new Transaction to the system.
-	AddTransaction(transaction *domain.RewardTransaction)
+	AddTransaction(ctx context.Context, transaction *domain.RewardTransaction)
 	// Return all Transactions sorted by the Transaction Timestamp
-	GetTransactionLog() []*domain.RewardTransaction
+	GetTransactionLog(ctx context.Context) []*domain.RewardTransaction
+	// Return the number of Transactions recorded.
+	Count(ctx context.Context) int
+	// Return, in the order they were added, the Transactions added after the first position of
+	// them; a position is therefore the Count at some moment.
+	GetTransactionsAddedSince(ctx context.Context, position int) []*domain.RewardTransaction
 }
 
 type LocalTransactionsStore struct {
 	cache []*domain.RewardTransaction
+	// The same Transactions as cache in the order they were added, which sorting cache loses.
+	added []*domain.RewardTransaction
 }
 
 func NewLocalTransactionsStore() *LocalTransactionsStore {
-	return &LocalTransactionsStore{make([]*domain.RewardTransaction, 0)}
+	return &LocalTransactionsStore{make([]*domain.RewardTransaction, 0), make([]*domain.RewardTransaction, 0)}
 }
 
-func (store *LocalTransactionsStore) AddTransaction(transaction *domain.RewardTransaction) {
+func (store *LocalTransactionsStore) AddTransaction(ctx context.Context, transaction *domain.RewardTransaction) {
+	var _, span = tracer.Start(ctx, "TransactionsStore.AddTransaction")
+	defer span.End()
 	store.cache = append(store.cache, transaction)
+	store.added = append(store.added, transaction)
 }
 
-func (store *LocalTransactionsStore) GetTransactionLog() []*domain.RewardTransaction {
+func (store *LocalTransactionsStore) GetTransactionLog(ctx context.Context) []*domain.RewardTransaction {
+	var _, span = tracer.Start(ctx, "TransactionsStore.GetTransactionLog", trace.WithAttributes(attribute.Int("ledger.transactions", len(store.cache))))
+	defer span.End()
 	// this definitely is inefficient in an actual business to store a transaction log by a field
 	// persistence systems like a relational DB can hash-sort items by the timestamp, but for
 	// this exercise we need only achieve the requested functionality.
-	sort.Sort(RewardTransactionByTimestamp(store.cache))
+	sort.Stable(RewardTransactionByTimestamp(store.cache))
 	return store.cache
 }
 
+func (store *LocalTransactionsStore) Count(_ context.Context) int {
+	return len(store.cache)
+}
+
+func (store *LocalTransactionsStore) GetTransactionsAddedSince(ctx context.Context, position int) []*domain.RewardTransaction {
+	var _, span = tracer.Start(ctx, "TransactionsStore.GetTransactionsAddedSince", trace.WithAttributes(attribute.Int("ledger.position", position)))
+	defer span.End()
+	if position < 0 {
+		position = 0
+	}
+	if position >= len(store.added) {
+		return nil
+	}
+	return append([]*domain.RewardTransaction{}, store.added[position:]...)
+}
@@ -0,0 +1,55 @@
+package dao
+
+import (
+	"context"
+	"sort"
+	"purchase-tracker-service/domain"
+)
+
+// This Interface reflects the desired contract for storing transfers.  Transfers are never deleted;
+// a reversed transfer is replaced by its reversed state.
+type TransfersDao interface {
+	PutTransfer(ctx context.Context, transfer *domain.PointsTransfer)
+	// Return the transfer stored under transferId, or nil when there is none.
+	GetTransfer(ctx context.Context, transferId string) *domain.PointsTransfer
+	// Return every transfer purchaserId gave or received, oldest first.
+	ListForPurchaser(ctx context.Context, purchaserId string) []*domain.PointsTransfer
+}
+
+type LocalTransferStore struct {
+	transfersById map[string]*domain.PointsTransfer
+}
+
+func NewLocalTransferStore() *LocalTransferStore {
+	return &LocalTransferStore{make(map[string]*domain.PointsTransfer)}
+}
+
+func (store *LocalTransferStore) PutTransfer(ctx context.Context, transfer *domain.PointsTransfer) {
+	var _, span = tracer.Start(ctx, "TransferStore.PutTransfer")
+	defer span.End()
+	store.transfersById[transfer.Id] = transfer
+}
+
+func (store *LocalTransferStore) GetTransfer(ctx context.Context, transferId string) *domain.PointsTransfer {
+	var _, span = tracer.Start(ctx, "TransferStore.GetTransfer")
+	defer span.End()
+	return store.transfersById[transferId]
+}
+
+func (store *LocalTransferStore) ListForPurchaser(ctx context.Context, purchaserId string) []*domain.PointsTransfer {
+	var _, span = tracer.Start(ctx, "TransferStore.ListForPurchaser")
+	defer span.End()
+	var transfers = []*domain.PointsTransfer{}
+	for _, transfer := range store.transfersById {
+		if transfer.From == purchaserId || transfer.To == purchaserId {
+			transfers = append(transfers, transfer)
+		}
+	}
+	sort.Slice(transfers, func(i int, j int) bool {
+		if !transfers[i].CreationTimestamp.Equal(transfers[j].CreationTimestamp) {
+			return transfers[i].CreationTimestamp.Before(transfers[j].CreationTimestamp)
+		}
+		return transfers[i].Id < transfers[j].Id
+	})
+	return transfers
+}
@@ -9,3 +9,35 @@ type PayerAccount struct {
 	Name string `json:"name"`
 	CreationTimestamp time.Time `json:"creationTimestamp"`
 }
+
+// The states of a Purchaser's account; only an active Purchaser may spend, and a closed one no
+// longer accumulates Points.
+const (
+	PurchaserStatusActive = "active"
+	PurchaserStatusSuspended = "suspended"
+	PurchaserStatusClosed = "closed"
+)
+
+// What becomes of the Points a Purchaser holds when its account is closed.
+const (
+	ClosureForfeit = "forfeit"
+	ClosurePayout = "payout"
+)
+
+type PurchaserAccount struct {
+	Id string `json:"id"`
+	Name string `json:"name"`
+	Email string `json:"email,omitempty"`
+	Status string `json:"status"`
+	CreationTimestamp time.Time `json:"creationTimestamp"`
+	UpdatedTimestamp time.Time `json:"updatedTimestamp"`
+	// How the Points held were settled, once the account is closed.
+	Closure *PurchaserClosure `json:"closure,omitempty"`
+}
+
+type PurchaserClosure struct {
+	// Either forfeit or payout.
+	Disposition string `json:"disposition"`
+	Points int `json:"points"`
+	Timestamp time.Time `json:"timestamp"`
+}
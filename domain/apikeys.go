@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"time"
+)
+
+// A credential granting a role to whoever presents it.  The key itself is only ever known to the
+// holder; the service keeps a hash of it.
+type ApiKey struct {
+	Id string `json:"id"`
+	// Describes who holds the key, such as the integration it was issued to.
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// The Payer a payer key posts Purchases for.
+	PayerId string `json:"payerId,omitempty"`
+	// The Purchaser a purchaser key acts as.
+	PurchaserId string `json:"purchaserId,omitempty"`
+	CreationTimestamp time.Time `json:"creationTimestamp"`
+	RevokedTimestamp *time.Time `json:"revokedTimestamp,omitempty"`
+}
+
+// A newly created API key along with the key, which is shown this once and cannot be recovered.
+type IssuedApiKey struct {
+	ApiKey *ApiKey `json:"apiKey"`
+	Key string `json:"key"`
+}
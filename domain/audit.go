@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"time"
+)
+
+// The state-changing actions of the ledger that are audited.
+const (
+	AuditActionAddPayer = "payer.add"
+	AuditActionReceivePurchase = "purchase.receive"
+	AuditActionSpendPoints = "points.spend"
+	AuditActionExpirePoints = "points.expire"
+	AuditActionHoldPoints = "points.hold"
+	AuditActionCaptureHold = "hold.capture"
+	AuditActionReleaseHold = "hold.release"
+	AuditActionExpireHolds = "hold.expire"
+	AuditActionImportLedger = "ledger.import"
+	AuditActionPutCatalogItem = "catalog.put"
+	AuditActionRedeem = "redemption.create"
+	AuditActionCancelRedemption = "redemption.cancel"
+	AuditActionPutEarningRules = "earning.put"
+	AuditActionCreateCampaign = "campaign.create"
+	AuditActionReverseCampaign = "campaign.reverse"
+	AuditActionSweepTiers = "tier.sweep"
+	AuditActionCreatePurchaser = "purchaser.create"
+	AuditActionUpdatePurchaser = "purchaser.update"
+	AuditActionSuspendPurchaser = "purchaser.suspend"
+	AuditActionReactivatePurchaser = "purchaser.reactivate"
+	AuditActionClosePurchaser = "purchaser.close"
+	AuditActionTransferPoints = "transfer.create"
+	AuditActionReverseTransfer = "transfer.reverse"
+	AuditActionPutPayerLimits = "limits.put"
+)
+
+// How an audited action ended: it either changed the ledger, was refused, such as for an unknown
+// Payer or a caller without permission, or failed, such as when the journal could not be written.
+const (
+	AuditResultSucceeded = "succeeded"
+	AuditResultRefused = "refused"
+	AuditResultFailed = "failed"
+)
+
+// An immutable record of who attempted a state-changing action and how it ended.
+type AuditEntry struct {
+	// Assigned in the order entries are recorded; later entries have greater sequences.
+	Sequence int64 `json:"sequence"`
+	Timestamp time.Time `json:"timestamp"`
+	// The subject of the caller's credential, or "anonymous" when the caller was not authenticated.
+	Actor string `json:"actor"`
+	Roles []string `json:"roles,omitempty"`
+	RequestId string `json:"requestId,omitempty"`
+	Action string `json:"action"`
+	// The Payer the action named, if it named one.
+	Payer string `json:"payer,omitempty"`
+	// The SHA-256 of the action's request payload as JSON, identifying it without repeating it.
+	PayloadHash string `json:"payloadHash"`
+	Result string `json:"result"`
+	Error string `json:"error,omitempty"`
+}
+
+// Selects audit entries; empty fields select everything.
+type AuditFilter struct {
+	Actor string
+	Action string
+	Result string
+	Payer string
+	Since time.Time
+	Until time.Time
+	// Only entries with a greater sequence, for paging through entries in order.
+	AfterSequence int64
+	// At most this many of the earliest matching entries; zero means no limit.
+	Limit int
+}
+
+func (f *AuditFilter) Matches(entry *AuditEntry) bool {
+	return (f.Actor == "" || entry.Actor == f.Actor) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.Result == "" || entry.Result == f.Result) &&
+		(f.Payer == "" || entry.Payer == f.Payer) &&
+		(f.Since.IsZero() || !entry.Timestamp.Before(f.Since)) &&
+		(f.Until.IsZero() || entry.Timestamp.Before(f.Until)) &&
+		entry.Sequence > f.AfterSequence
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"time"
+)
+
+// A promotion under which a Payer's Purchases earn bonus Points for a while.
+type Campaign struct {
+	Id string `json:"id"`
+	Payer string `json:"payer"`
+	Name string `json:"name"`
+	// Purchases recorded from StartTimestamp until EndTimestamp earn the bonus.
+	StartTimestamp time.Time `json:"startTimestamp"`
+	EndTimestamp time.Time `json:"endTimestamp"`
+	// Multiplies the Points of an eligible Purchase, so 2 doubles them; the Points beyond the
+	// Purchase's own are the bonus.  Zero or one adds nothing.
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// Points added to every eligible Purchase on top of any multiplier.
+	FlatBonus int `json:"flatBonus,omitempty"`
+	Eligibility *CampaignEligibility `json:"eligibility,omitempty"`
+	// The most bonus Points the campaign books in all; zero means no limit.
+	Budget int `json:"budget,omitempty"`
+	// The bonus Points booked so far, net of reversals.
+	Awarded int `json:"awarded"`
+	CreationTimestamp time.Time `json:"creationTimestamp"`
+	// Set once the campaign's bonuses were reversed; it books no more.
+	ReversedTimestamp *time.Time `json:"reversedTimestamp,omitempty"`
+}
+
+// Which Purchases a campaign rewards; every condition set must hold.
+type CampaignEligibility struct {
+	MinimumPoints int `json:"minimumPoints,omitempty"`
+	MinimumAmount float64 `json:"minimumAmount,omitempty"`
+	// The Purchase must list one of the categories.
+	Categories []string `json:"categories,omitempty"`
+	// The Purchase must be made through one of the channels.
+	Channels []string `json:"channels,omitempty"`
+}
+
+// Whether the campaign books bonuses for Purchases recorded at now.
+func (c *Campaign) IsActive(now time.Time) bool {
+	return c.ReversedTimestamp == nil && !now.Before(c.StartTimestamp) && now.Before(c.EndTimestamp)
+}
+
+// The bonus a campaign booked for a Purchase just received.
+type CampaignBonus struct {
+	CampaignId string `json:"campaignId"`
+	Points int `json:"points"`
+}
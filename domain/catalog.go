@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"time"
+)
+
+// The states of a redemption.
+const (
+	RedemptionStatusCompleted = "completed"
+	RedemptionStatusCancelled = "cancelled"
+)
+
+// A reward Purchasers may redeem Points for.
+type CatalogItem struct {
+	Id string `json:"id"`
+	Name string `json:"name"`
+	// The Points one unit costs.
+	Points int `json:"points"`
+	// Only these Payers may fund a redemption of the item; empty means any.
+	FundingPayers []string `json:"fundingPayers,omitempty"`
+	// The units left to redeem.
+	Stock int `json:"stock"`
+	// The item may only be redeemed from ActiveFrom until ActiveUntil; either may be left open.
+	ActiveFrom *time.Time `json:"activeFrom,omitempty"`
+	ActiveUntil *time.Time `json:"activeUntil,omitempty"`
+	CreationTimestamp time.Time `json:"creationTimestamp"`
+}
+
+// Whether the item may be redeemed as of now, stock aside.
+func (i *CatalogItem) IsActive(now time.Time) bool {
+	return (i.ActiveFrom == nil || !now.Before(*i.ActiveFrom)) && (i.ActiveUntil == nil || now.Before(*i.ActiveUntil))
+}
+
+type RedemptionRequest struct {
+	ItemId string `json:"itemId"`
+	// Defaults to one.
+	Quantity int `json:"quantity"`
+}
+
+// An order of catalog items paid for by a spend.
+type Redemption struct {
+	Id string `json:"id"`
+	ItemId string `json:"itemId"`
+	Quantity int `json:"quantity"`
+	Points int `json:"points"`
+	Status string `json:"status"`
+	// The Purchaser who redeemed, when a Purchaser did.
+	Purchaser string `json:"purchaser,omitempty"`
+	// The spend that paid for the order and the Points it took from each Payer.
+	SpendId string `json:"spendId"`
+	Allocations []*PointsSpentAllocation `json:"allocations"`
+	CreationTimestamp time.Time `json:"creationTimestamp"`
+	CancellationTimestamp *time.Time `json:"cancellationTimestamp,omitempty"`
+}
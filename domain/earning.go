@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"time"
+)
+
+// How the Points a purchase earns are rounded to a whole number.
+const (
+	RoundingDown = "down"
+	RoundingUp = "up"
+	RoundingNearest = "nearest"
+)
+
+func RoundingNames() []string {
+	return []string{RoundingDown, RoundingUp, RoundingNearest}
+}
+
+// How a Payer's purchases earn Points when they carry an amount rather than Points.
+type EarningRules struct {
+	Payer string `json:"payer"`
+	// The rate each currency earns at, by currency code; purchases in other currencies are refused.
+	Rates map[string]*EarningRate `json:"rates"`
+	// Multiply the Points of a purchase listing the category; where several apply, the largest does.
+	CategoryMultipliers map[string]float64 `json:"categoryMultipliers,omitempty"`
+	// One of the Rounding constants; empty rounds down.
+	Rounding string `json:"rounding,omitempty"`
+	// The most Points a Purchaser earns from the Payer's purchases each UTC day; zero means no cap.
+	DailyCap int `json:"dailyCap,omitempty"`
+	UpdatedTimestamp time.Time `json:"updatedTimestamp"`
+}
+
+type EarningRate struct {
+	PointsPerUnit float64 `json:"pointsPerUnit"`
+	// Purchases of less than this amount earn nothing.
+	MinimumAmount float64 `json:"minimumAmount,omitempty"`
+}
+
+// How the Points of a purchase were worked out from its amount.
+type EarningBreakdown struct {
+	Amount float64 `json:"amount"`
+	Currency string `json:"currency"`
+	PointsPerUnit float64 `json:"pointsPerUnit"`
+	// The category whose multiplier applied, if any did.
+	Category string `json:"category,omitempty"`
+	Multiplier float64 `json:"multiplier"`
+	// Set when the amount fell short of the currency's minimum, so nothing was earned.
+	BelowMinimum bool `json:"belowMinimum,omitempty"`
+	Rounding string `json:"rounding"`
+	// The Points earned before the daily cap, and those the cap withheld.
+	Earned int `json:"earned"`
+	Capped int `json:"capped,omitempty"`
+	Points int `json:"points"`
+}
@@ -0,0 +1,154 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// The types of domain event emitted once a change to the ledger is committed.
+const (
+	EventTypePayerCreated = "PayerCreated"
+	EventTypePurchaseRecorded = "PurchaseRecorded"
+	EventTypePointsSpent = "PointsSpent"
+	EventTypePointsExpired = "PointsExpired"
+	EventTypePointsRefunded = "PointsRefunded"
+	EventTypeBonusAwarded = "BonusAwarded"
+	EventTypeTierChanged = "TierChanged"
+	EventTypePurchaserClosed = "PurchaserClosed"
+	EventTypePointsTransferred = "PointsTransferred"
+	EventTypePayerCapApproached = "PayerCapApproached"
+)
+
+func IsEventType(eventType string) bool {
+	switch eventType {
+	case EventTypePayerCreated, EventTypePurchaseRecorded, EventTypePointsSpent, EventTypePointsExpired, EventTypePointsRefunded,
+		EventTypeBonusAwarded, EventTypeTierChanged, EventTypePurchaserClosed,
+		EventTypePointsTransferred, EventTypePayerCapApproached:
+		return true
+	default:
+		return false
+	}
+}
+
+// A committed change to the ledger as told to downstream systems.  Data holds the event of Type:
+// a *PayerCreated, *PurchaseRecorded, *PointsSpent, *PointsExpired, *PointsRefunded, *BonusAwarded
+// or *TierChange.
+type DomainEvent struct {
+	// Unique to the event, so consumers may discard events delivered more than once.
+	Id string `json:"id"`
+	Type string `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Data interface{} `json:"data"`
+}
+
+type PayerCreated struct {
+	Payer *PayerAccount `json:"payer"`
+}
+
+// Points accumulated, or adjusted when negative, under a Payer.
+type PurchaseRecorded struct {
+	Payer string `json:"payer"`
+	Purchaser string `json:"purchaser,omitempty"`
+	Points int `json:"points"`
+	TransactionTimestamp time.Time `json:"transactionTimestamp"`
+}
+
+// A spend and the Points deducted from each Payer to fund it.
+type PointsSpent struct {
+	SpendId string `json:"spendId"`
+	Points int `json:"points"`
+	Allocations []*PointsSpentAllocation `json:"allocations"`
+}
+
+type PointsSpentAllocation struct {
+	Payer string `json:"payer"`
+	Purchaser string `json:"purchaser,omitempty"`
+	Points int `json:"points"`
+}
+
+type PointsExpired struct {
+	Payer string `json:"payer"`
+	Purchaser string `json:"purchaser,omitempty"`
+	Points int `json:"points"`
+}
+
+// A reversed spend and the Points given back to each Payer that funded it.
+type PointsRefunded struct {
+	SpendId string `json:"spendId"`
+	Points int `json:"points"`
+	Allocations []*PointsSpentAllocation `json:"allocations"`
+}
+
+// Bonus Points a campaign booked for a Purchase, or took back, when negative, on reversal.
+type BonusAwarded struct {
+	CampaignId string `json:"campaignId"`
+	Payer string `json:"payer"`
+	Purchaser string `json:"purchaser,omitempty"`
+	Points int `json:"points"`
+}
+
+// A Purchaser's account closed and the Points it held forfeited or paid out, from each Payer.
+type PurchaserClosed struct {
+	Purchaser string `json:"purchaser"`
+	Disposition string `json:"disposition"`
+	Points int `json:"points"`
+	Allocations []*PointsSpentAllocation `json:"allocations"`
+}
+
+// Points moved from one Purchaser to another, or moved back by a reversal, and the Points moved
+// under each Payer.
+type PointsTransferred struct {
+	TransferId string `json:"transferId"`
+	From string `json:"from"`
+	To string `json:"to"`
+	Points int `json:"points"`
+	Reversal bool `json:"reversal,omitempty"`
+	Allocations []*PointsSpentAllocation `json:"allocations"`
+}
+
+// Decode Data into the event type Type names.
+func (e *DomainEvent) UnmarshalJSON(content []byte) error {
+	var envelope struct {
+		Id string `json:"id"`
+		Type string `json:"type"`
+		Timestamp time.Time `json:"timestamp"`
+		Data json.RawMessage `json:"data"`
+	}
+	if decodeErr := json.Unmarshal(content, &envelope); decodeErr != nil {
+		return decodeErr
+	}
+	var data interface{}
+	switch envelope.Type {
+	case EventTypePayerCreated:
+		data = &PayerCreated{}
+	case EventTypePurchaseRecorded:
+		data = &PurchaseRecorded{}
+	case EventTypePointsSpent:
+		data = &PointsSpent{}
+	case EventTypePointsExpired:
+		data = &PointsExpired{}
+	case EventTypePointsRefunded:
+		data = &PointsRefunded{}
+	case EventTypeBonusAwarded:
+		data = &BonusAwarded{}
+	case EventTypeTierChanged:
+		data = &TierChange{}
+	case EventTypePurchaserClosed:
+		data = &PurchaserClosed{}
+	case EventTypePointsTransferred:
+		data = &PointsTransferred{}
+	case EventTypePayerCapApproached:
+		data = &PayerCapApproached{}
+	default:
+		return fmt.Errorf("unknown event type '%s'", envelope.Type)
+	}
+	if decodeErr := json.Unmarshal(envelope.Data, data); decodeErr != nil {
+		return decodeErr
+	}
+	e.Id = envelope.Id
+	e.Type = envelope.Type
+	e.Timestamp = envelope.Timestamp
+	e.Data = data
+	return nil
+}
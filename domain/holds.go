@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"time"
+)
+
+// The states of a hold; only a held hold reserves Points, and only until it expires.
+const (
+	HoldStatusHeld = "held"
+	HoldStatusCaptured = "captured"
+	HoldStatusReleased = "released"
+	HoldStatusExpired = "expired"
+)
+
+// The Points a hold reserves from one Purchaser under one Payer.
+type HoldAllocation struct {
+	Payer string `json:"payer"`
+	Purchaser string `json:"purchaser,omitempty"`
+	Points int `json:"points"`
+}
+
+// Points reserved for a spend that is yet to be confirmed.  Reserved Points are not available to
+// other spends until the hold is released or expires; capturing it spends them.
+type SpendHold struct {
+	Id string `json:"id"`
+	Status string `json:"status"`
+	// The Purchaser whose Points are held, when a Purchaser placed the hold.
+	Purchaser string `json:"purchaser,omitempty"`
+	// The Points held, which fall short of those requested when balances did.
+	Points int `json:"points"`
+	Allocation string `json:"allocation"`
+	Allocations []*HoldAllocation `json:"allocations"`
+	// The spend made by capturing the hold.
+	SpendId string `json:"spendId,omitempty"`
+	CreationTimestamp time.Time `json:"creationTimestamp"`
+	ExpiresTimestamp time.Time `json:"expiresTimestamp"`
+	// When the hold was captured, released or expired.
+	SettledTimestamp *time.Time `json:"settledTimestamp,omitempty"`
+}
+
+// Whether the hold still reserves its Points as of now.
+func (h *SpendHold) IsActive(now time.Time) bool {
+	return h.Status == HoldStatusHeld && now.Before(h.ExpiresTimestamp)
+}
@@ -0,0 +1,16 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Generate a random identifier, such as for a spend or request, that is unique for all practical
+// purposes.
+func NewIdentifier() string {
+	var idBytes = make([]byte, 16)
+	if _, readErr := rand.Read(idBytes); readErr != nil {
+		panic(readErr)
+	}
+	return hex.EncodeToString(idBytes)
+}
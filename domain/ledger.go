@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"time"
+)
+
+// The portable form of the ledger used to move Payers and their Transactions between instances.
+type LedgerExport struct {
+	Payers []*PayerAccount `json:"payers"`
+	Transactions []*RewardTransaction `json:"transactions"`
+	ExportTimestamp time.Time `json:"exportTimestamp"`
+}
+
+func (l *LedgerExport) HasPayer(payerId string) bool {
+	for _, payer := range l.Payers {
+		if payer.Id == payerId {
+			return true
+		}
+	}
+	return false
+}
+
+type LedgerImportResult struct {
+	PayersAdded int `json:"payersAdded"`
+	PayersSkipped int `json:"payersSkipped"`
+	TransactionsAdded int `json:"transactionsAdded"`
+	TransactionsSkipped int `json:"transactionsSkipped"`
+}
@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"time"
+)
+
+// The Points a Payer is willing to fund; zero limits are not enforced.
+type PayerLimits struct {
+	Payer string `json:"payer"`
+	// The most Points the Payer's balance may reach.
+	MaxOutstandingPoints int `json:"maxOutstandingPoints,omitempty"`
+	// The most Points one purchase may book under the Payer, bonuses included.
+	MaxPointsPerPurchase int `json:"maxPointsPerPurchase,omitempty"`
+	// The most Points the Payer's purchases may book each UTC day, bonuses included.
+	DailyLimit int `json:"dailyLimit,omitempty"`
+	// The fraction of MaxOutstandingPoints at which the Payer is alerted that it nears its cap.
+	AlertThreshold float64 `json:"alertThreshold,omitempty"`
+	UpdatedTimestamp time.Time `json:"updatedTimestamp"`
+}
+
+// A Payer's balance reaching the alert threshold of its cap on outstanding Points.
+type PayerCapApproached struct {
+	Payer string `json:"payer"`
+	OutstandingPoints int `json:"outstandingPoints"`
+	MaxOutstandingPoints int `json:"maxOutstandingPoints"`
+	AlertThreshold float64 `json:"alertThreshold"`
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 type RewardsSpendAllocation struct {
 	Payer *PayerAccount `json:"payer"`
 	Points int `json:"points"`
@@ -8,5 +10,39 @@ type RewardsSpendAllocation struct {
 type RewardsAccumulateProgress struct {
 	// this field could be the Id or Name of the Payer since
 	Payer *PayerAccount `json:"payer"`
+	// The Points available to spend, which leaves out those held.
+	Points int `json:"points"`
+	// The Points reserved by holds not yet captured, released or expired.
+	Held int `json:"held"`
+	// How a Purchase just received earned its Points, when the earning rules worked them out.
+	Earning *EarningBreakdown `json:"earning,omitempty"`
+	// The bonuses campaigns booked for a Purchase just received.
+	Bonuses []*CampaignBonus `json:"bonuses,omitempty"`
+	// How the Purchaser's tier changed the Points of a Purchase just received.
+	Tier *TierEarning `json:"tier,omitempty"`
+}
+
+// What a spend would do were it made now: the Points each Payer would fund and every Payer's
+// balance afterwards.
+type SpendPreview struct {
+	Points int `json:"points"`
+	Allocation string `json:"allocation"`
+	Allocations []*RewardsSpendAllocation `json:"allocations"`
+	Balances []*RewardsAccumulateProgress `json:"balances"`
+	// The Points that could not be funded.
+	Shortfall int `json:"shortfall"`
+}
+
+// A Transaction as it changed a balance, told to subscribers of the balance stream.  Position
+// counts every Transaction recorded up to and including this one, so a subscriber can resume
+// after the last change it saw.
+type BalanceChange struct {
+	Position int `json:"position"`
+	Payer string `json:"payer"`
+	Purchaser string `json:"purchaser,omitempty"`
+	Kind string `json:"kind,omitempty"`
 	Points int `json:"points"`
+	// The balance, as the subscriber sees it, once the change was made.
+	Balance int `json:"balance"`
+	TransactionTimestamp time.Time `json:"timestamp"`
 }
@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"time"
+)
+
+// A loyalty status Purchasers reach by the Points their Purchases accumulate within the window.
+type Tier struct {
+	Name string `json:"name" yaml:"name"`
+	MinimumPoints int `json:"minimumPoints" yaml:"minimumPoints"`
+	// Multiplies the Points of every Purchase made in the tier.
+	Multiplier float64 `json:"multiplier" yaml:"multiplier"`
+}
+
+// Where a Purchaser stands among the tiers.
+type PurchaserTier struct {
+	Purchaser string `json:"purchaser"`
+	Tier string `json:"tier"`
+	Multiplier float64 `json:"multiplier"`
+	// The Points the Purchaser's Purchases accumulated since WindowStart.
+	Points int `json:"points"`
+	WindowStart time.Time `json:"windowStart"`
+	NextTier string `json:"nextTier,omitempty"`
+	PointsToNextTier int `json:"pointsToNextTier,omitempty"`
+	// When Points leaving the window drop the Purchaser out of the tier unless it accumulates more;
+	// never for the lowest tier.
+	ExpiresTimestamp *time.Time `json:"expiresTimestamp,omitempty"`
+}
+
+// A Purchaser moving from one tier to another.
+type TierChange struct {
+	Purchaser string `json:"purchaser"`
+	PreviousTier string `json:"previousTier"`
+	Tier string `json:"tier"`
+	Points int `json:"points"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// How the Purchaser's tier changed the Points of a Purchase just received.
+type TierEarning struct {
+	Tier string `json:"tier"`
+	Multiplier float64 `json:"multiplier"`
+	// The Points before the multiplier applied.
+	BasePoints int `json:"basePoints"`
+	Points int `json:"points"`
+}
@@ -4,14 +4,85 @@ import (
 	"time"
 )
 
+const (
+	// Points accumulated, or adjusted when negative, by a Purchase.
+	TransactionKindPurchase = "PURCHASE"
+	// Points deducted from a Payer to fund a spend.
+	TransactionKindSpend = "SPEND"
+	// Points removed because they outlived the configured Points lifetime.
+	TransactionKindExpiry = "EXPIRY"
+	// Points given back to a Payer when the spend that took them is reversed.
+	TransactionKindRefund = "REFUND"
+	// Points a campaign added to a Purchase, or took back when negative and the campaign is reversed.
+	TransactionKindBonus = "BONUS"
+	// Points a Purchaser gave up when its account was closed.
+	TransactionKindForfeit = "FORFEIT"
+	// Points paid out to a Purchaser when its account was closed.
+	TransactionKindPayout = "PAYOUT"
+	// Points moved from one Purchaser to another, or moved back when the transfer is reversed.
+	TransactionKindTransfer = "TRANSFER"
+)
+
 type RewardTransaction struct {
 	// this field could be the Id of the Payer.
 	//  - eg. "DANNON" will match a PayerAccount with an Id of 'DANNON".
 	Payer string `json:"payer"`
 	Points int `json:"points"`
-	TransactionTimestamp time.Time
+	TransactionTimestamp time.Time `json:"timestamp"`
+	// One of the TransactionKind constants; Transactions recorded before kinds existed are empty
+	// and treated as Purchases.
+	Kind string `json:"kind,omitempty"`
+	// The Purchaser whose Purchase accumulated the Points, when the caller identified one.
+	Purchaser string `json:"purchaser,omitempty"`
+	// Shared by every Transaction deducted to fund the same spend.
+	SpendId string `json:"spendId,omitempty"`
+	// What a Purchase cost, when its Points are to be earned by the Payer's earning rules rather
+	// than given.
+	Amount float64 `json:"amount,omitempty"`
+	Currency string `json:"currency,omitempty"`
+	// The SKUs or categories of what was bought, matched against category multipliers.
+	Categories []string `json:"categories,omitempty"`
+	// Where the Purchase was made, such as "online" or "in-store".
+	Channel string `json:"channel,omitempty"`
+	// The campaign that booked a bonus.
+	CampaignId string `json:"campaignId,omitempty"`
+	// The tier of the Purchaser, whose multiplier applied, when the Purchase was received.
+	Tier string `json:"tier,omitempty"`
+	// The transfer that moved the Points; both sides of a transfer carry it.
+	TransferId string `json:"transferId,omitempty"`
+	// When Points a transfer moved were first accumulated, which decides the order they are spent
+	// and when they expire; empty means the Transaction Timestamp.
+	AccumulatedTimestamp *time.Time `json:"accumulatedTimestamp,omitempty"`
+}
+
+// The strategies by which a spend chooses the Payers funding it.
+const (
+	AllocationFifo = "fifo"
+	AllocationSoonestExpiring = "soonest-expiring"
+	AllocationPayerPriority = "payer-priority"
+	AllocationProportional = "proportional"
+	AllocationLargestBalance = "largest-balance"
+)
+
+func AllocationNames() []string {
+	return []string{AllocationFifo, AllocationSoonestExpiring, AllocationPayerPriority, AllocationProportional, AllocationLargestBalance}
 }
 
 type PointsSpendTransaction struct {
 	Points int `json:"points"`
+	// The allocation strategy deciding which Payers fund the spend; empty uses the configured one.
+	Allocation string `json:"allocation,omitempty"`
+	// The Payers drained first, in order, by the payer-priority allocation.
+	PayerPriority []string `json:"payerPriority,omitempty"`
+	// Only these Payers may fund the spend; empty means any.
+	IncludePayers []string `json:"includePayers,omitempty"`
+	// These Payers may not fund the spend.
+	ExcludePayers []string `json:"excludePayers,omitempty"`
+	// The most Points the spend may take from each Payer named.
+	PayerCaps map[string]int `json:"payerCaps,omitempty"`
+}
+
+// Whether the spend limits which Payers may fund it, or how much each may.
+func (t *PointsSpendTransaction) IsRestricted() bool {
+	return len(t.IncludePayers) > 0 || len(t.ExcludePayers) > 0 || len(t.PayerCaps) > 0
 }
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"time"
+)
+
+// The states of a transfer.
+const (
+	TransferStatusCompleted = "completed"
+	TransferStatusReversed = "reversed"
+)
+
+type TransferRequest struct {
+	// The Purchaser giving the Points; a Purchaser's own key may leave it out.
+	From string `json:"from"`
+	To string `json:"to"`
+	Points int `json:"points"`
+}
+
+// Points moved from one Purchaser to another.  The Points keep the Payer they were accumulated
+// under and when they were accumulated.
+type PointsTransfer struct {
+	Id string `json:"id"`
+	From string `json:"from"`
+	To string `json:"to"`
+	Points int `json:"points"`
+	Status string `json:"status"`
+	// The lots moved, oldest first.
+	Allocations []*TransferAllocation `json:"allocations"`
+	// The Points a reversal moved back, which fall short of Points when the recipient had already
+	// spent some.
+	ReversedPoints int `json:"reversedPoints,omitempty"`
+	CreationTimestamp time.Time `json:"creationTimestamp"`
+	ReversalTimestamp *time.Time `json:"reversalTimestamp,omitempty"`
+}
+
+type TransferAllocation struct {
+	Payer string `json:"payer"`
+	Points int `json:"points"`
+	AccumulatedTimestamp time.Time `json:"accumulatedTimestamp"`
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"github.com/gorilla/mux"
+	"purchase-tracker-service/domain"
+)
+
+func (a *Application) HandleGetEarningRules() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.GetEarningRules(r.Context(), mux.Vars(r)["payerId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandlePutEarningRules() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules, requestDecodeErr := decodeEarningRulesRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.transactionService.PutEarningRules(r.Context(), rules)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+// The rules are those of the Payer in the path; a body naming a different one is refused.
+func decodeEarningRulesRequest(_ context.Context, r *http.Request) (*domain.EarningRules, error) {
+	var request domain.EarningRules
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	var payerId = mux.Vars(r)["payerId"]
+	if request.Payer != "" && request.Payer != payerId {
+		return nil, errors.New("payer must match the path")
+	}
+	request.Payer = payerId
+	return &request, nil
+}
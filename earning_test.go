@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func TestPurchaseEarnsPointsByPayerRules(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+	var _, rulesErr = serviceClient.PutEarningRules(&domain.EarningRules{
+		Payer: "DANNON",
+		Rates: map[string]*domain.EarningRate{"usd": {PointsPerUnit: 10, MinimumAmount: 5}, "EUR": {PointsPerUnit: 12.5}},
+		CategoryMultipliers: map[string]float64{"dairy": 2, "yogurt": 3},
+		DailyCap: 1000,
+	})
+	if rulesErr != nil {
+		t.Fatalf("Expected the earning rules to be stored: %s", rulesErr)
+	}
+
+	var cases = []struct {
+		purchase *domain.RewardTransaction
+		expected domain.EarningBreakdown
+	}{
+		// 10.1 * 10 is 100.99999999999999 in floating point but earns 101
+		{&domain.RewardTransaction{Amount: 10.1, Currency: "USD"}, domain.EarningBreakdown{Multiplier: 1, Earned: 101, Points: 101}},
+		{&domain.RewardTransaction{Amount: 10, Currency: "USD", Categories: []string{"dairy", "yogurt", "SKU-1"}, Purchaser: "alice"}, domain.EarningBreakdown{Category: "yogurt", Multiplier: 3, Earned: 300, Points: 300}},
+		{&domain.RewardTransaction{Amount: 4.99, Currency: "USD", Purchaser: "alice"}, domain.EarningBreakdown{Multiplier: 1, BelowMinimum: true, Points: 0}},
+		{&domain.RewardTransaction{Amount: 0.9, Currency: "eur", Purchaser: "alice"}, domain.EarningBreakdown{Multiplier: 1, Earned: 11, Points: 11}},
+		// alice has earned 311 today, leaving 689 of the cap
+		{&domain.RewardTransaction{Amount: 100, Currency: "USD", Purchaser: "alice", Channel: "online"}, domain.EarningBreakdown{Multiplier: 1, Earned: 1000, Capped: 311, Points: 689}},
+		{&domain.RewardTransaction{Amount: 100, Currency: "USD", Purchaser: "bob"}, domain.EarningBreakdown{Multiplier: 1, Earned: 1000, Points: 1000}},
+	}
+	for _, c := range cases {
+		c.purchase.Payer = "DANNON"
+		var progress, purchaseErr = serviceClient.AddPurchase(c.purchase)
+		if purchaseErr != nil || progress.Earning == nil {
+			t.Fatalf("Expected the purchase of %v %s to earn points but got %v", c.purchase.Amount, c.purchase.Currency, purchaseErr)
+		}
+		var earning = *progress.Earning
+		if earning.Category != c.expected.Category || earning.Multiplier != c.expected.Multiplier || earning.BelowMinimum != c.expected.BelowMinimum ||
+			earning.Earned != c.expected.Earned || earning.Capped != c.expected.Capped || earning.Points != c.expected.Points {
+			t.Fatalf("Expected the purchase of %v %s to earn %+v but earned %+v", c.purchase.Amount, c.purchase.Currency, c.expected, earning)
+		}
+	}
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 101 + 300 + 11 + 689 + 1000)
+
+	var _, bothErr = serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Points: 10, Amount: 10, Currency: "USD"})
+	expectStatus(t, bothErr, 400, "a purchase giving both points and an amount")
+	var _, currencyErr = serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Amount: 10, Currency: "GBP"})
+	expectStatus(t, currencyErr, 400, "a purchase in a currency without a rate")
+	var _, noRulesErr = serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "UNILEVER", Amount: 10, Currency: "USD"})
+	expectStatus(t, noRulesErr, 400, "a purchase for a Payer without earning rules")
+	var _, unknownErr = serviceClient.GetEarningRules("UNILEVER")
+	expectStatus(t, unknownErr, 404, "the earning rules of a Payer without any")
+	if progress, _ := serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "UNILEVER", Points: 50}); progress.Earning != nil || progress.Points != 50 {
+		t.Fatalf("Expected a purchase giving points to keep them but got %+v", progress)
+	}
+}
+
+func TestEarningRulesRoundAndValidate(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var rates = map[string]*domain.EarningRate{"USD": {PointsPerUnit: 1}}
+	for rounding, expected := range map[string]int{domain.RoundingDown: 2, domain.RoundingUp: 3, domain.RoundingNearest: 3} {
+		transactionService.PutEarningRules(context.Background(), &domain.EarningRules{Payer: "DANNON", Rates: rates, Rounding: rounding})
+		var progress, _ = transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Amount: 2.5, Currency: "USD"})
+		if progress.Earning.Points != expected || progress.Earning.Rounding != rounding {
+			t.Fatalf("Expected 2.5 points rounded %s to be %d but was %d", rounding, expected, progress.Earning.Points)
+		}
+	}
+
+	var invalid = []*domain.EarningRules{
+		{Payer: "DANNON"},
+		{Payer: "DANNON", Rates: map[string]*domain.EarningRate{"USD": {PointsPerUnit: 0}}},
+		{Payer: "DANNON", Rates: rates, Rounding: "sideways"},
+		{Payer: "DANNON", Rates: rates, DailyCap: -1},
+		{Payer: "DANNON", Rates: rates, CategoryMultipliers: map[string]float64{"dairy": -2}},
+	}
+	for _, rules := range invalid {
+		if _, putErr := transactionService.PutEarningRules(context.Background(), rules); putErr == nil {
+			t.Fatalf("Expected the earning rules %+v to be refused", rules)
+		}
+	}
+	if _, payerErr := transactionService.PutEarningRules(context.Background(), &domain.EarningRules{Payer: "NESTLE", Rates: rates}); payerErr == nil {
+		t.Fatalf("Expected earning rules for an unknown Payer to be refused")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set at build time by build.sh through -ldflags "-X main.buildCommit=... -X main.buildTime=...".
+var (
+	buildCommit = ""
+	buildTime = ""
+)
+
+type BuildInfo struct {
+	Commit string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Falls back on the version control stamp the Go toolchain embeds when the linker flags were
+// not supplied, as with a plain `go build`.
+func currentBuildInfo() BuildInfo {
+	var info = BuildInfo{buildCommit, buildTime, runtime.Version()}
+	if embedded, hasEmbedded := debug.ReadBuildInfo(); hasEmbedded {
+		for _, setting := range embedded.Settings {
+			if setting.Key == "vcs.revision" && info.Commit == "" {
+				info.Commit = setting.Value
+			} else if setting.Key == "vcs.time" && info.BuildTime == "" {
+				info.BuildTime = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = "unknown"
+	}
+	return info
+}
+
+type readinessCheck struct {
+	name string
+	check func() error
+}
+
+// Tracks whether the process should receive traffic.  It is not ready until startup has loaded
+// the stores and replayed the journal, and stops being ready as soon as shutdown begins.
+type Probes struct {
+	lock sync.RWMutex
+	ready bool
+	shuttingDown bool
+	checks []readinessCheck
+}
+
+func NewProbes() *Probes {
+	return &Probes{}
+}
+
+// Register a dependency that must be reachable for the process to report ready.
+func (p *Probes) AddCheck(name string, check func() error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.checks = append(p.checks, readinessCheck{name, check})
+}
+
+func (p *Probes) MarkReady() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.ready = true
+}
+
+func (p *Probes) MarkShuttingDown() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.shuttingDown = true
+}
+
+// Report whether the process is ready along with the reason for each failing condition.
+func (p *Probes) Readiness() (bool, map[string]string) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	var problems = make(map[string]string)
+	if !p.ready {
+		problems["startup"] = "stores are still loading"
+	}
+	if p.shuttingDown {
+		problems["shutdown"] = "server is shutting down"
+	}
+	for _, check := range p.checks {
+		if checkErr := check.check(); checkErr != nil {
+			problems[check.name] = checkErr.Error()
+		}
+	}
+	return len(problems) == 0, problems
+}
+
+// Liveness only shows the process can answer; it says nothing of whether it should get traffic.
+func (p *Probes) HandleHealthz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProbeResponse(w, 200, map[string]interface{} {"status": "ok"})
+	})
+}
+
+func (p *Probes) HandleReadyz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ready, problems = p.Readiness()
+		if ready {
+			writeProbeResponse(w, 200, map[string]interface{} {"status": "ready"})
+		} else {
+			writeProbeResponse(w, 503, map[string]interface{} {"status": "not ready", "checks": problems})
+		}
+	})
+}
+
+func HandleVersion() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeProbeResponse(w, 200, currentBuildInfo())
+	})
+}
+
+func writeProbeResponse(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Serves the probes and metrics from the moment the listener opens and hands everything else to the
+// application once startup has installed it; until then other requests are answered with 503.
+type probedHandler struct {
+	probes *Probes
+	metrics http.Handler
+	lock sync.RWMutex
+	application http.Handler
+}
+
+func newProbedHandler(probes *Probes, metrics http.Handler) *probedHandler {
+	return &probedHandler{probes: probes, metrics: metrics}
+}
+
+func (h *probedHandler) SetApplication(application http.Handler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.application = application
+}
+
+func (h *probedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		h.probes.HandleHealthz().ServeHTTP(w, r)
+		return
+	case "/readyz":
+		h.probes.HandleReadyz().ServeHTTP(w, r)
+		return
+	case "/version":
+		HandleVersion().ServeHTTP(w, r)
+		return
+	case "/metrics":
+		h.metrics.ServeHTTP(w, r)
+		return
+	}
+	h.lock.RLock()
+	var application = h.application
+	h.lock.RUnlock()
+	if application == nil {
+		writeProbeResponse(w, 503, map[string]string {
+			"status": "SERVICE UNAVAILABLE",
+			"message": "The service is still starting",
+		})
+		return
+	}
+	application.ServeHTTP(w, r)
+}
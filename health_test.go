@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+	"github.com/go-kit/kit/log"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/service"
+)
+
+func probeStatus(t *testing.T, handler http.Handler, path string) (int, map[string]interface{}) {
+	var recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	var body map[string]interface{}
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	return recorder.Code, body
+}
+
+func TestReadinessFollowsStartup(t *testing.T) {
+	var probes = NewProbes()
+	var handler = newProbedHandler(probes, NewDiscardMetrics().Handler())
+
+	if statusCode, _ := probeStatus(t, handler, "/healthz"); statusCode != 200 {
+		t.Fatalf("Expected the process to be live while starting but got %d", statusCode)
+	}
+	if statusCode, _ := probeStatus(t, handler, "/readyz"); statusCode != 503 {
+		t.Fatalf("Expected the process not to be ready while starting but got %d", statusCode)
+	}
+	if statusCode, _ := probeStatus(t, handler, "/payers/balances"); statusCode != 503 {
+		t.Fatalf("Expected ledger requests to be refused while starting but got %d", statusCode)
+	}
+
+	var transactionService = service.NewLocalTransactionService()
+	handler.SetApplication(NewApplication(transactionService).NewRouter())
+	var storageErr error
+	probes.AddCheck("storage", func() error {
+		return storageErr
+	})
+	probes.MarkReady()
+	if statusCode, _ := probeStatus(t, handler, "/readyz"); statusCode != 200 {
+		t.Fatalf("Expected the process to be ready once started but got %d", statusCode)
+	}
+	if statusCode, _ := probeStatus(t, handler, "/payers/balances"); statusCode != 200 {
+		t.Fatalf("Expected ledger requests to be served once started but got %d", statusCode)
+	}
+
+	storageErr = errors.New("disk unreachable")
+	var statusCode, body = probeStatus(t, handler, "/readyz")
+	if statusCode != 503 {
+		t.Fatalf("Expected a failing dependency to make the process not ready but got %d", statusCode)
+	}
+	if checks, _ := body["checks"].(map[string]interface{}); checks["storage"] != "disk unreachable" {
+		t.Fatalf("Expected the failing storage check to be reported but got %v", body)
+	}
+}
+
+func TestReadinessFlipsDuringShutdown(t *testing.T) {
+	var probes = NewProbes()
+	var handler = newProbedHandler(probes, NewDiscardMetrics().Handler())
+	probes.MarkReady()
+	var server = newHttpServer(config.Default().Server, handler)
+	var listener, _ = net.Listen("tcp", "127.0.0.1:0")
+	var shutdownContext, beginShutdown = context.WithCancel(context.Background())
+	var serveResult = make(chan error, 1)
+	go func() {
+		serveResult <- serveUntilShutdown(shutdownContext, server, listener, probes, 300 * time.Millisecond, time.Second, log.NewNopLogger())
+	}()
+	var readyz = "http://" + listener.Addr().String() + "/readyz"
+	if response, getErr := http.Get(readyz); getErr != nil || response.StatusCode != 200 {
+		t.Fatalf("Expected the server to be ready before shutdown")
+	}
+
+	beginShutdown()
+	time.Sleep(50 * time.Millisecond)
+	var response, getErr = http.Get(readyz)
+	if getErr != nil {
+		t.Fatalf("Expected the listener to stay open during the drain delay: %s", getErr)
+	}
+	if response.StatusCode != 503 {
+		t.Fatalf("Expected readiness to be false once shutdown began but got %d", response.StatusCode)
+	}
+	if serveErr := <-serveResult; serveErr != nil {
+		t.Fatalf("Expected a clean shutdown but got %s", serveErr)
+	}
+}
+
+func TestVersionReportsBuildInfo(t *testing.T) {
+	var statusCode, body = probeStatus(t, newProbedHandler(NewProbes(), NewDiscardMetrics().Handler()), "/version")
+	if statusCode != 200 {
+		t.Fatalf("Expected version to be served at any time but got %d", statusCode)
+	}
+	if body["goVersion"] != runtime.Version() {
+		t.Fatalf("Expected the Go version %s but got %v", runtime.Version(), body["goVersion"])
+	}
+	if body["commit"] == "" || body["buildTime"] == "" {
+		t.Fatalf("Expected a commit and build time to always be reported but got %v", body)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"time"
+	"github.com/gorilla/mux"
+)
+
+// How often holds that outlived their TTL are recorded as expired.
+const holdSweepInterval = time.Minute
+
+func (a *Application) HandleHoldPoints() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		transaction, requestDecodeErr := decodePointsSpendTransactionRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.transactionService.HoldPoints(r.Context(), transaction)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+func (a *Application) HandleGetHold() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.GetHold(r.Context(), mux.Vars(r)["holdId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandleCaptureHold() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.CaptureHold(r.Context(), mux.Vars(r)["holdId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandleReleaseHold() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.ReleaseHold(r.Context(), mux.Vars(r)["holdId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	"purchase-tracker-service/client"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func newHoldTestServer(transactionService *service.LocalTransactionService) (*httptest.Server, *client.Client) {
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 600})
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "UNILEVER", Points: 400})
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	return server, newClientWithKey(server.URL, "")
+}
+
+func expectHeldBalanceForTest(t *testing.T, serviceClient *client.Client, payerId string, available int, held int) {
+	var balance, _ = serviceClient.GetPayerBalance(payerId)
+	if balance.Points != available || balance.Held != held {
+		t.Fatalf("Expected %s to have %d available and %d held but had %d and %d", payerId, available, held, balance.Points, balance.Held)
+	}
+}
+
+func TestHoldReservesPointsUntilCaptured(t *testing.T) {
+	var server, serviceClient = newHoldTestServer(service.NewLocalTransactionService())
+	defer server.Close()
+
+	var hold, holdErr = serviceClient.HoldPoints(&domain.PointsSpendTransaction{Points: 700})
+	if holdErr != nil || hold.Status != domain.HoldStatusHeld || hold.Points != 700 || len(hold.Allocations) != 2 {
+		t.Fatalf("Expected 700 points to be held from both Payers but got %+v (%v)", hold, holdErr)
+	}
+	expectHeldBalanceForTest(t, serviceClient, "DANNON", 0, 600)
+	expectHeldBalanceForTest(t, serviceClient, "UNILEVER", 300, 100)
+
+	// other spends may only draw on what the hold left available
+	serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 1000})
+	expectHeldBalanceForTest(t, serviceClient, "DANNON", 0, 600)
+	expectHeldBalanceForTest(t, serviceClient, "UNILEVER", 0, 100)
+
+	var captured, captureErr = serviceClient.CaptureHold(hold.Id)
+	if captureErr != nil || captured.Status != domain.HoldStatusCaptured || captured.SpendId == "" {
+		t.Fatalf("Expected the hold to be captured but got %+v (%v)", captured, captureErr)
+	}
+	expectHeldBalanceForTest(t, serviceClient, "DANNON", 0, 0)
+	expectHeldBalanceForTest(t, serviceClient, "UNILEVER", 0, 0)
+	var spent = 0
+	var transactionLog, _ = serviceClient.GetTransactionLog()
+	for _, transaction := range transactionLog {
+		if transaction.SpendId == captured.SpendId {
+			spent -= transaction.Points
+		}
+	}
+	if spent != 700 {
+		t.Fatalf("Expected the capture to spend the 700 points held but spent %d", spent)
+	}
+	var _, recaptureErr = serviceClient.CaptureHold(hold.Id)
+	expectStatus(t, recaptureErr, 409, "capturing a hold twice")
+	var _, unknownErr = serviceClient.GetHold("unknown")
+	expectStatus(t, unknownErr, 404, "looking up an unknown hold")
+	var _, zeroErr = serviceClient.HoldPoints(&domain.PointsSpendTransaction{Points: 0})
+	expectStatus(t, zeroErr, 400, "holding no points")
+	var _, negativeErr = serviceClient.HoldPoints(&domain.PointsSpendTransaction{Points: -100})
+	expectStatus(t, negativeErr, 400, "holding negative points")
+}
+
+func TestReleasedAndExpiredHoldsFreeTheirPoints(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.SetSpendPolicy(service.SpendPolicy{HoldTtl: 200 * time.Millisecond})
+	var server, serviceClient = newHoldTestServer(transactionService)
+	defer server.Close()
+
+	var released, _ = serviceClient.HoldPoints(&domain.PointsSpendTransaction{Points: 500})
+	if settled, releaseErr := serviceClient.ReleaseHold(released.Id); releaseErr != nil || settled.Status != domain.HoldStatusReleased {
+		t.Fatalf("Expected the hold to be released but got %+v (%v)", settled, releaseErr)
+	}
+	expectHeldBalanceForTest(t, serviceClient, "DANNON", 600, 0)
+	var _, captureErr = serviceClient.CaptureHold(released.Id)
+	expectStatus(t, captureErr, 409, "capturing a released hold")
+
+	var expiring, _ = serviceClient.HoldPoints(&domain.PointsSpendTransaction{Points: 500})
+	expectHeldBalanceForTest(t, serviceClient, "DANNON", 100, 500)
+	time.Sleep(300 * time.Millisecond)
+	expectHeldBalanceForTest(t, serviceClient, "DANNON", 600, 0)
+	var _, expiredErr = serviceClient.CaptureHold(expiring.Id)
+	expectStatus(t, expiredErr, 409, "capturing an expired hold")
+	var expired, _ = transactionService.ExpireHolds(context.Background(), time.Now())
+	if len(expired) != 1 || expired[0].Id != expiring.Id {
+		t.Fatalf("Expected the sweep to record the one expired hold but recorded %d", len(expired))
+	}
+	if hold, _ := serviceClient.GetHold(expiring.Id); hold.Status != domain.HoldStatusExpired {
+		t.Fatalf("Expected the hold to be recorded as expired but was %s", hold.Status)
+	}
+}
+
+func TestHoldsSurviveRestart(t *testing.T) {
+	var journalPath = filepath.Join(t.TempDir(), "ledger.journal")
+	var journal, _ = dao.OpenFileJournal(journalPath, false)
+	var transactionService, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), journal)
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 600})
+	var hold, _ = transactionService.HoldPoints(context.Background(), &domain.PointsSpendTransaction{Points: 250})
+	transactionService.Close()
+
+	var reopened, _ = dao.OpenFileJournal(journalPath, false)
+	var restarted, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), reopened)
+	defer restarted.Close()
+	var dannon, _ = restarted.GetPointsProgressForPayer(context.Background(), "DANNON")
+	if dannon.Points != 350 || dannon.Held != 250 {
+		t.Fatalf("Expected the hold to be restored holding 250 but found %+v", dannon)
+	}
+	if _, captureErr := restarted.CaptureHold(context.Background(), hold.Id); captureErr != nil {
+		t.Fatalf("Expected the restored hold to be captured: %s", captureErr)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func openJournaledServiceForTest(t *testing.T, path string) (*service.LocalTransactionService, *dao.FileJournal) {
+	var journal, openErr = dao.OpenFileJournal(path, true)
+	if openErr != nil {
+		t.Fatalf("Unable to open journal: %s", openErr)
+	}
+	var transactionService, replayErr = service.NewLocalTransactionServiceWithJournal(context.Background(), journal)
+	if replayErr != nil {
+		t.Fatalf("Unable to replay journal: %s", replayErr)
+	}
+	return transactionService, journal
+}
+
+func TestJournalSurvivesRestart(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "ledger.journal")
+	var transactionService, journal = openJournaledServiceForTest(t, path)
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 300})
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "UNILEVER", Points: 200})
+	transactionService.SpendPoints(context.Background(), 400)
+	journal.Close()
+
+	var restarted, restartedJournal = openJournaledServiceForTest(t, path)
+	defer restartedJournal.Close()
+	if len(restarted.ListPayers(context.Background())) != 2 {
+		t.Fatalf("Expected both payers to be replayed but found %d", len(restarted.ListPayers(context.Background())))
+	}
+	var dannon, _ = restarted.GetPointsProgressForPayer(context.Background(), "DANNON")
+	var unilever, _ = restarted.GetPointsProgressForPayer(context.Background(), "UNILEVER")
+	if dannon.Points != 0 || unilever.Points != 100 {
+		t.Fatalf("Expected balances of 0 and 100 after replay but were %d and %d", dannon.Points, unilever.Points)
+	}
+}
+
+func TestJournalDiscardsTornRecord(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "ledger.journal")
+	var transactionService, journal = openJournaledServiceForTest(t, path)
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 300})
+	journal.Close()
+	var file, _ = os.OpenFile(path, os.O_APPEND | os.O_WRONLY, 0o644)
+	file.WriteString(`{"sequence":3,"transactions":[{"payer":"DANNON","poi`)
+	file.Close()
+
+	var restarted, restartedJournal = openJournaledServiceForTest(t, path)
+	defer restartedJournal.Close()
+	var dannon, _ = restarted.GetPointsProgressForPayer(context.Background(), "DANNON")
+	if dannon.Points != 300 {
+		t.Fatalf("Expected the torn record to be ignored leaving 300 points but found %d", dannon.Points)
+	}
+	if _, purchaseErr := restarted.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 5}); purchaseErr != nil {
+		t.Fatalf("Expected the journal to accept writes after discarding the torn record: %s", purchaseErr)
+	}
+}
+
+func TestExpirePointsConsumesOldestLots(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.SetExpiryPolicy(service.ExpiryPolicy{PointsLifetime: time.Hour})
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.ImportLedger(context.Background(), &domain.LedgerExport{Transactions: []*domain.RewardTransaction{
+		{Payer: "DANNON", Points: 300, TransactionTimestamp: time.Now().Add(-2 * time.Hour)},
+		{Payer: "DANNON", Points: -100, TransactionTimestamp: time.Now().Add(-90 * time.Minute)},
+		{Payer: "DANNON", Points: 500, TransactionTimestamp: time.Now().Add(-time.Minute)},
+	}})
+
+	var expiries, expireErr = transactionService.ExpirePoints(context.Background(), time.Now())
+	if expireErr != nil || len(expiries) != 1 {
+		t.Fatalf("Expected a single expiry transaction but got %d (%v)", len(expiries), expireErr)
+	}
+	if expiries[0].Points != -200 || expiries[0].Kind != domain.TransactionKindExpiry {
+		t.Fatalf("Expected the 200 points remaining of the old lot to expire but %d expired", -expiries[0].Points)
+	}
+	var dannon, _ = transactionService.GetPointsProgressForPayer(context.Background(), "DANNON")
+	if dannon.Points != 500 {
+		t.Fatalf("Expected only the fresh lot of 500 to remain but found %d", dannon.Points)
+	}
+	expiries, _ = transactionService.ExpirePoints(context.Background(), time.Now())
+	if len(expiries) != 0 {
+		t.Fatalf("Expected nothing further to expire")
+	}
+}
+
+func TestSpendPointsRejectsShortfall(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.SetSpendPolicy(service.SpendPolicy{RejectShortfall: true})
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 100})
+
+	var _, spendErr = transactionService.SpendPoints(context.Background(), 150)
+	if _, isShortfall := spendErr.(service.InsufficientPointsError); !isShortfall {
+		t.Fatalf("Expected an insufficient points error but got %v", spendErr)
+	}
+	var dannon, _ = transactionService.GetPointsProgressForPayer(context.Background(), "DANNON")
+	if dannon.Points != 100 {
+		t.Fatalf("Expected a rejected spend to leave the balance untouched but found %d", dannon.Points)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"github.com/gorilla/mux"
+	"purchase-tracker-service/domain"
+)
+
+func (a *Application) HandleGetPayerLimits() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.GetPayerLimits(r.Context(), mux.Vars(r)["payerId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandlePutPayerLimits() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits, requestDecodeErr := decodePayerLimitsRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.transactionService.PutPayerLimits(r.Context(), limits)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+// The limits are those of the Payer in the path; a body naming a different one is refused.
+func decodePayerLimitsRequest(_ context.Context, r *http.Request) (*domain.PayerLimits, error) {
+	var request domain.PayerLimits
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	var payerId = mux.Vars(r)["payerId"]
+	if request.Payer != "" && request.Payer != payerId {
+		return nil, errors.New("payer must match the path")
+	}
+	request.Payer = payerId
+	return &request, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func TestPayerLimitsRefusePurchasesAndAlertNearTheCap(t *testing.T) {
+	var journalPath = filepath.Join(t.TempDir(), "ledger.journal")
+	var journal, _ = dao.OpenFileJournal(journalPath, false)
+	var transactionService, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), journal)
+	var alerts []*domain.PayerCapApproached
+	transactionService.AddCommitObserver(func(commit *service.LedgerCommit) {
+		if commit.CapAlert != nil {
+			alerts = append(alerts, commit.CapAlert)
+		}
+	})
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+
+	var _, unknownErr = serviceClient.GetPayerLimits("DANNON")
+	expectStatus(t, unknownErr, 404, "looking up limits never set")
+	var _, invalidErr = serviceClient.PutPayerLimits(&domain.PayerLimits{Payer: "DANNON", AlertThreshold: 1.5})
+	expectStatus(t, invalidErr, 400, "an alert threshold above 1")
+	var limits, putErr = serviceClient.PutPayerLimits(&domain.PayerLimits{Payer: "DANNON", MaxOutstandingPoints: 1000, MaxPointsPerPurchase: 400, DailyLimit: 1200})
+	if putErr != nil || limits.AlertThreshold != 0.9 {
+		t.Fatalf("Expected the limits to be stored with the default alert threshold but got %+v (%v)", limits, putErr)
+	}
+
+	var _, perPurchaseErr = serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Points: 401})
+	expectStatus(t, perPurchaseErr, 409, "a purchase above the per-purchase limit")
+	serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Points: 400})
+	serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Points: 400})
+	if len(alerts) != 0 {
+		t.Fatalf("Expected no alert below 900 outstanding points but got %d", len(alerts))
+	}
+	serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Points: 150})
+	if len(alerts) != 1 || alerts[0].OutstandingPoints != 950 {
+		t.Fatalf("Expected one alert on reaching 950 outstanding points but got %v", alerts)
+	}
+	var _, outstandingErr = transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 51})
+	var exceeded service.PayerLimitExceededError
+	if !errors.As(outstandingErr, &exceeded) || exceeded.Limit != service.PayerLimitOutstanding || exceeded.Available != 50 {
+		t.Fatalf("Expected the purchase to be refused by the cap on outstanding points but got %v", outstandingErr)
+	}
+	if _, adjustErr := serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Points: -100}); adjustErr != nil {
+		t.Fatalf("Expected an adjustment taking points away to be accepted: %s", adjustErr)
+	}
+	transactionService.SpendPoints(context.Background(), 500)
+	var _, dailyErr = transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 251})
+	if !errors.As(dailyErr, &exceeded) || exceeded.Limit != service.PayerLimitDaily || exceeded.Available != 250 {
+		t.Fatalf("Expected the purchase to be refused by the daily limit but got %v", dailyErr)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("Expected refused purchases to raise no alerts but got %d", len(alerts))
+	}
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 350)
+	transactionService.Close()
+
+	var reopened, _ = dao.OpenFileJournal(journalPath, false)
+	var restarted, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), reopened)
+	defer restarted.Close()
+	if restored, _ := restarted.GetPayerLimits(context.Background(), "DANNON"); restored == nil || restored.MaxOutstandingPoints != 1000 {
+		t.Fatalf("Expected the limits to be restored but got %+v", restored)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	stdlog "log"
+	"net/http"
+	"time"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.opentelemetry.io/otel/trace"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+const (
+	requestIdHeader = "X-Request-Id"
+	maxRequestIdLength = 128
+)
+
+// Build the process logger from the logging configuration.  Lines still written through the
+// standard library logger are routed through it at info level so every line shares one format.
+func newLogger(loggingConfig config.LoggingConfig, w io.Writer) log.Logger {
+	var logger log.Logger
+	if loggingConfig.Format == config.LogFormatJson {
+		logger = log.NewJSONLogger(log.NewSyncWriter(w))
+	} else {
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(w))
+	}
+	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+	logger = level.NewFilter(logger, levelOption(loggingConfig.Level))
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(log.NewStdlibAdapter(level.Info(logger)))
+	return logger
+}
+
+func levelOption(name string) level.Option {
+	switch name {
+	case "debug":
+		return level.AllowDebug()
+	case "warn":
+		return level.AllowWarn()
+	case "error":
+		return level.AllowError()
+	default:
+		return level.AllowInfo()
+	}
+}
+
+// Router middleware giving every request an id, taken from the X-Request-Id header when the
+// caller sent a usable one, and a context carrying a logger tagged with it and, when the request
+// is traced, the trace id.  The id is echoed in the response and each request is logged once it
+// has been handled.
+func (a *Application) RequestContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var started = time.Now()
+		var requestId = r.Header.Get(requestIdHeader)
+		if !isUsableRequestId(requestId) {
+			requestId = domain.NewIdentifier()
+		}
+		w.Header().Set(requestIdHeader, requestId)
+		var logger = a.logger
+		if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+			logger = log.With(logger, "trace_id", spanContext.TraceID().String())
+		}
+		var ctx = logging.WithRequestId(logging.WithLogger(r.Context(), logger), requestId)
+		var recorder = &statusRecordingResponseWriter{ResponseWriter: w, statusCode: 200}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		level.Info(logging.FromContext(ctx)).Log("msg", "Handled request", "method", r.Method, "path", r.URL.Path, "status", recorder.statusCode, "duration", time.Since(started))
+	})
+}
+
+// Ids chosen by callers end up in log lines, so only short ids of plain characters are kept.
+func isUsableRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > maxRequestIdLength {
+		return false
+	}
+	for _, character := range requestId {
+		var isPlain = (character >= 'a' && character <= 'z') || (character >= 'A' && character <= 'Z') ||
+			(character >= '0' && character <= '9') || character == '-' || character == '_' || character == '.'
+		if !isPlain {
+			return false
+		}
+	}
+	return true
+}
+
+type statusRecordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *statusRecordingResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusRecordingResponseWriter) Flush() {
+	if flusher, isFlusher := w.ResponseWriter.(http.Flusher); isFlusher {
+		flusher.Flush()
+	}
+}
+
+func (w *statusRecordingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"purchase-tracker-service/domain"
+)
+
+// The keys every ledger event is logged with so that lines about the same Payer, Purchaser or
+// spend can be found together whichever layer wrote them.
+const (
+	RequestIdKey = "request_id"
+	PayerKey = "payer"
+	PurchaserKey = "purchaser"
+	PointsKey = "points"
+	SpendIdKey = "spend_id"
+)
+
+type contextKey int
+
+const (
+	loggerContextKey contextKey = iota
+	requestIdContextKey
+)
+
+// Carry logger in ctx so that the service and DAO layers log with whatever fields, such as the
+// request id, were attached where ctx began.
+func WithLogger(ctx context.Context, logger log.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// The logger carried by ctx, or one that discards everything when ctx carries none.
+func FromContext(ctx context.Context) log.Logger {
+	if logger, hasLogger := ctx.Value(loggerContextKey).(log.Logger); hasLogger {
+		return logger
+	}
+	return log.NewNopLogger()
+}
+
+// Attach the id of the request ctx serves, adding it to the logger ctx carries.
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	ctx = context.WithValue(ctx, requestIdContextKey, requestId)
+	return WithLogger(ctx, log.With(FromContext(ctx), RequestIdKey, requestId))
+}
+
+func RequestId(ctx context.Context) string {
+	var requestId, _ = ctx.Value(requestIdContextKey).(string)
+	return requestId
+}
+
+// Add the fields a ledger event about transaction is logged with; the Purchaser and spend id are
+// only included when the Transaction has them.
+func WithTransaction(logger log.Logger, transaction *domain.RewardTransaction) log.Logger {
+	var fields = []interface{}{PayerKey, transaction.Payer, PointsKey, transaction.Points, "kind", transaction.Kind}
+	if transaction.Purchaser != "" {
+		fields = append(fields, PurchaserKey, transaction.Purchaser)
+	}
+	if transaction.SpendId != "" {
+		fields = append(fields, SpendIdKey, transaction.SpendId)
+	}
+	return log.With(logger, fields...)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/service"
+)
+
+func decodeLogLines(t *testing.T, output *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var fields map[string]interface{}
+		if decodeErr := json.Unmarshal([]byte(line), &fields); decodeErr != nil {
+			t.Fatalf("Expected every log line to be JSON but got %s", line)
+		}
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func findLogLine(lines []map[string]interface{}, message string) map[string]interface{} {
+	for _, line := range lines {
+		if line["msg"] == message {
+			return line
+		}
+	}
+	return nil
+}
+
+func TestRequestIdFollowsLedgerEvents(t *testing.T) {
+	var output bytes.Buffer
+	var logger = newLogger(config.LoggingConfig{Level: "debug", Format: config.LogFormatJson}, &output)
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var application = NewApplication(transactionService)
+	application.SetLogger(logger)
+	var router = application.NewRouter()
+
+	var request = httptest.NewRequest("POST", "/purchases", strings.NewReader(`{"payer": "DANNON", "points": 300, "purchaser": "alice"}`))
+	request.Header.Set(requestIdHeader, "checkout-42")
+	var recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Header().Get(requestIdHeader) != "checkout-42" {
+		t.Fatalf("Expected the caller's request id to be echoed but got %s", recorder.Header().Get(requestIdHeader))
+	}
+
+	var lines = decodeLogLines(t, &output)
+	for _, message := range []string{"Received purchase", "Applied transaction to balance", "Handled request"} {
+		var line = findLogLine(lines, message)
+		if line == nil {
+			t.Fatalf("Expected a %q log line", message)
+		}
+		if line["request_id"] != "checkout-42" {
+			t.Fatalf("Expected %q to be logged with the request id but got %v", message, line)
+		}
+	}
+	var purchase = findLogLine(lines, "Received purchase")
+	if purchase["payer"] != "DANNON" || purchase["purchaser"] != "alice" || purchase["points"] != float64(300) {
+		t.Fatalf("Expected the purchase to be logged with its payer, purchaser and points but got %v", purchase)
+	}
+}
+
+func TestSpendIsLoggedWithSpendId(t *testing.T) {
+	var output bytes.Buffer
+	var logger = newLogger(config.LoggingConfig{Level: "info", Format: config.LogFormatJson}, &output)
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var application = NewApplication(transactionService)
+	application.SetLogger(logger)
+	var router = application.NewRouter()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/purchases", strings.NewReader(`{"payer": "DANNON", "points": 300}`)))
+
+	var request = httptest.NewRequest("POST", "/rewards/spend", strings.NewReader(`{"points": 100}`))
+	request.Header.Set(requestIdHeader, "not a usable id\n")
+	var recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	var requestId = recorder.Header().Get(requestIdHeader)
+	if requestId == "" || strings.Contains(requestId, " ") {
+		t.Fatalf("Expected an unusable request id to be replaced but got %q", requestId)
+	}
+
+	var spend = findLogLine(decodeLogLines(t, &output), "Spent points")
+	if spend == nil || spend["spend_id"] == nil || spend["request_id"] != requestId {
+		t.Fatalf("Expected the spend to be logged with its spend id and request id but got %v", spend)
+	}
+	var transactionLog = transactionService.GetTransactionLog(context.Background())
+	if spent := transactionLog[len(transactionLog) - 1]; spent.SpendId != spend["spend_id"] {
+		t.Fatalf("Expected the spend Transaction to carry the logged spend id but got %q", spent.SpendId)
+	}
+}
@@ -3,46 +3,334 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
 	"github.com/gorilla/mux"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/dao"
 	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
 	"purchase-tracker-service/service"
+	"purchase-tracker-service/webhooks"
+)
+
+const (
+	defaultAuditEntries = 100
+	maxAuditEntries = 1000
 )
 
 type Application struct {
 	transactionService *service.LocalTransactionService
-	context context.Context
+	// Each request is served with its own context, derived from the server's, which carries this
+	// logger; see RequestContextMiddleware.
+	logger log.Logger
+	metrics *ServiceMetrics
+	// Nil when authentication is disabled; see SetAccessService.
+	access *service.LocalAccessService
+	// Nil when bearer tokens are not accepted; see SetTokenVerifier.
+	tokenVerifier *auth.TokenVerifier
+	// Nil when requests are not rate limited; see SetRateLimiter.
+	rateLimiter *RateLimiter
+	// Nil when no webhook endpoints are configured; see SetWebhookDispatcher.
+	webhooks *webhooks.Dispatcher
+	balanceStreams *balanceStreams
+}
+
+func NewApplication(transactionService *service.LocalTransactionService) *Application {
+	return NewApplicationWithMetrics(transactionService, NewDiscardMetrics())
+}
+
+func NewApplicationWithMetrics(transactionService *service.LocalTransactionService, serviceMetrics *ServiceMetrics) *Application {
+	return &Application{
+		transactionService: transactionService,
+		logger: log.NewNopLogger(),
+		metrics: serviceMetrics,
+		balanceStreams: newBalanceStreams(transactionService),
+	}
+}
+
+// Log every request, and every ledger event a request causes, through logger.
+func (a *Application) SetLogger(logger log.Logger) {
+	a.logger = logger
 }
 
 func main() {
+	if len(os.Args) > 1 && IsCliCommand(os.Args[1]) {
+		os.Exit(RunCli(os.Args[1:], os.Stdout, os.Stderr))
+	}
 	var flagSet = flag.NewFlagSet("http-server", flag.ExitOnError)
-	var (
-		serverHttpAddress = flagSet.String("http-address", ":8999", "The host:port address to bind to a server socket and listen for requests.")
-	)
-	var transactionService = service.NewLocalTransactionService()
-	var application = Application{
-		transactionService,
-		context.Background(),
+	var configFlags = config.RegisterFlags(flagSet)
+	flagSet.Parse(os.Args[1:])
+	var serviceConfig, configErr = configFlags.Load(os.LookupEnv)
+	if configErr != nil {
+		fmt.Fprintln(os.Stderr, configErr)
+		os.Exit(2)
+	}
+	var logger = newLogger(serviceConfig.Logging, os.Stderr)
+	var shutdownTracing, tracingErr = startTracing(context.Background(), serviceConfig.Tracing, os.Stdout)
+	if tracingErr != nil {
+		level.Error(logger).Log("msg", "Unable to start tracing", "err", tracingErr)
+		os.Exit(1)
+	}
+	var shutdownContext, stopSignals = signal.NotifyContext(logging.WithLogger(context.Background(), logger), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+
+	// the probes are served as soon as the listener opens so that an orchestrator can watch the
+	// journal being replayed
+	var probes = NewProbes()
+	var serviceMetrics = NewPrometheusMetrics()
+	var handler = newProbedHandler(probes, serviceMetrics.Handler())
+	var server = newHttpServer(serviceConfig.Server, handler)
+	var listener, listenErr = net.Listen("tcp", serviceConfig.Server.HttpAddress)
+	if listenErr != nil {
+		level.Error(logger).Log("msg", "Unable to listen", "address", serviceConfig.Server.HttpAddress, "err", listenErr)
+		os.Exit(1)
+	}
+	level.Info(logger).Log("msg", "Listening with HTTP server", "address", listener.Addr())
+	var serveResult = make(chan error, 1)
+	go func() {
+		serveResult <- serveUntilShutdown(shutdownContext, server, listener, probes, time.Duration(serviceConfig.Server.DrainDelay), time.Duration(serviceConfig.Server.ShutdownTimeout), logger)
+	}()
+
+	var transactionService, serviceErr = newTransactionService(shutdownContext, serviceConfig)
+	if serviceErr != nil {
+		level.Error(logger).Log("msg", "Unable to start the transaction service", "err", serviceErr)
+		os.Exit(1)
+	}
+	serviceMetrics.Observe(transactionService)
+	var application = NewApplicationWithMetrics(transactionService, serviceMetrics)
+	application.SetLogger(logger)
+	server.RegisterOnShutdown(application.CloseBalanceStreams)
+	if serviceConfig.RateLimits.Enabled {
+		application.SetRateLimiter(NewRateLimiter(serviceConfig.RateLimits, serviceMetrics))
+	}
+	if serviceConfig.Auth.Enabled {
+		var access, accessErr = newAccessService(serviceConfig.Auth, transactionService)
+		if accessErr != nil {
+			level.Error(logger).Log("msg", "Unable to open the API key store", "err", accessErr)
+			os.Exit(1)
+		}
+		application.SetAccessService(access)
+		if serviceConfig.Auth.Jwt.Jwks != "" {
+			var verifier, verifierErr = newTokenVerifier(serviceConfig.Auth.Jwt)
+			if verifierErr != nil {
+				level.Error(logger).Log("msg", "Unable to load the JWKS", "err", verifierErr)
+				os.Exit(1)
+			}
+			application.SetTokenVerifier(verifier)
+		}
+	}
+	// everything running in the background that may commit to the ledger, waited for before the
+	// ledger's storage is closed
+	var background sync.WaitGroup
+	var dispatcher *webhooks.Dispatcher
+	if len(serviceConfig.Webhooks.Endpoints) > 0 {
+		dispatcher = newWebhookDispatcher(shutdownContext, &background, serviceConfig.Webhooks, transactionService, logger)
+		application.SetWebhookDispatcher(dispatcher)
+	}
+	handler.SetApplication(application.NewRouter())
+	probes.AddCheck("storage", transactionService.CheckStorage)
+	if serviceConfig.Expiry.PointsLifetime > 0 {
+		runInBackground(&background, func() {
+			runExpirySweeper(shutdownContext, transactionService, time.Duration(serviceConfig.Expiry.SweepInterval), logger)
+		})
+	}
+	runInBackground(&background, func() {
+		runHoldSweeper(shutdownContext, transactionService, holdSweepInterval, logger)
+	})
+	if len(serviceConfig.Tiers.Levels) > 0 {
+		runInBackground(&background, func() {
+			runTierSweeper(shutdownContext, transactionService, tierSweepInterval, logger)
+		})
+	}
+	probes.MarkReady()
+	level.Info(logger).Log("msg", "Ready", "payers", len(transactionService.ListPayers(shutdownContext)))
+
+	var exitCode = 0
+	if serveErr := <-serveResult; serveErr != nil {
+		level.Error(logger).Log("msg", "HTTP server stopped abnormally", "err", serveErr)
+		exitCode = 1
+	}
+	// the server may have stopped without a signal, so the sweepers and relay are told to stop too
+	stopSignals()
+	background.Wait()
+	if dispatcher != nil {
+		dispatcher.Close()
+	}
+	if closeErr := transactionService.Close(); closeErr != nil {
+		level.Error(logger).Log("msg", "Unable to flush storage", "err", closeErr)
+		exitCode = 1
+	}
+	var flushContext, cancelFlush = context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancelFlush()
+	if flushErr := shutdownTracing(flushContext); flushErr != nil {
+		level.Error(logger).Log("msg", "Unable to flush spans", "err", flushErr)
+	}
+	level.Info(logger).Log("msg", "Stopped")
+	os.Exit(exitCode)
+}
+
+// Open the configured storage, replay it, apply the configured policies and register any seed
+// Payers not already known.
+func newTransactionService(ctx context.Context, serviceConfig *config.Config) (*service.LocalTransactionService, error) {
+	var transactionService *service.LocalTransactionService
+	if serviceConfig.Storage.Backend == config.StorageBackendJournal {
+		var journal, openErr = dao.OpenFileJournal(serviceConfig.Storage.Path, serviceConfig.Storage.SyncWrites)
+		if openErr != nil {
+			return nil, openErr
+		}
+		var replayErr error
+		if transactionService, replayErr = service.NewLocalTransactionServiceWithJournal(ctx, journal); replayErr != nil {
+			journal.Close()
+			return nil, replayErr
+		}
+	} else {
+		transactionService = service.NewLocalTransactionService()
+	}
+	var allocation, allocationErr = service.AllocationStrategyNamed(serviceConfig.SpendPolicy.Allocation, serviceConfig.SpendPolicy.PayerPriority)
+	if allocationErr != nil {
+		return nil, allocationErr
+	}
+	transactionService.SetSpendPolicy(service.SpendPolicy{
+		RejectShortfall: serviceConfig.SpendPolicy.Shortfall == config.ShortfallReject,
+		Allocation: allocation,
+		HoldTtl: time.Duration(serviceConfig.SpendPolicy.HoldTtl),
+	})
+	transactionService.SetExpiryPolicy(service.ExpiryPolicy{
+		PointsLifetime: time.Duration(serviceConfig.Expiry.PointsLifetime),
+	})
+	transactionService.SetTierPolicy(service.TierPolicy{
+		Window: time.Duration(serviceConfig.Tiers.Window),
+		Tiers: serviceConfig.Tiers.Levels,
+	})
+	transactionService.SetPurchaserPolicy(service.PurchaserPolicy{
+		Closure: serviceConfig.Purchasers.Closure,
+	})
+	transactionService.SetTransferPolicy(service.TransferPolicy{
+		MaxPoints: serviceConfig.Transfers.MaxPoints,
+		DailyLimit: serviceConfig.Transfers.DailyLimit,
+	})
+	if len(serviceConfig.Webhooks.Endpoints) > 0 {
+		transactionService.EnableOutbox()
+	}
+	// seed Payers are audited as added by the configuration
+	var seedContext = auth.WithIdentity(ctx, &auth.Identity{Subject: "configuration"})
+	for _, payer := range serviceConfig.Payers {
+		if _, getErr := transactionService.GetPayer(seedContext, payer.Id); getErr == nil {
+			continue
+		}
+		if addErr := transactionService.AddPayer(seedContext, payer.Id, payer.Name); addErr != nil {
+			return nil, addErr
+		}
 	}
+	return transactionService, nil
+}
+
+// Build the router with every endpoint the service exposes mapped to its handler and the roles
+// that may call it, which only matter once an access service is set.
+func (a *Application) NewRouter() *mux.Router {
 	var httpRouter = mux.NewRouter()
-	transactionService.AddPayer("DANNON", "Dannon")
-	transactionService.AddPayer("UNILEVER", "Unilever")
-	transactionService.AddPayer("MILLER COORS", "Miller Coors")
-	httpRouter.Handle("/payers/balances", application.HandleGetAllPayersBalances()).Methods("GET")
-	httpRouter.Handle("/payers/${payerId}/balances", application.HandleGetPayerBalances()).Methods("GET")
-	httpRouter.Handle("/purchases", application.HandleAddPurchaseTransaction()).Methods("POST")
-	httpRouter.Handle("/rewards/spend", application.HandleNewPointsSpendTransaction()).Methods("POST")
-	http.Handle("/", httpRouter)
-	log.Printf("Listening with HTTP server on %s", *serverHttpAddress)
-	log.Fatal(http.ListenAndServe(*serverHttpAddress, nil))
+	httpRouter.Handle("/payers", a.authorize(a.HandleListPayers())).Methods("GET")
+	httpRouter.Handle("/payers", a.authorize(a.HandleAddPayer(), auth.RoleAdmin)).Methods("POST")
+	httpRouter.Handle("/payers/balances", a.authorize(a.HandleGetAllPayersBalances(), auth.RoleAdmin, auth.RolePurchaser)).Methods("GET")
+	httpRouter.Handle("/payers/{payerId}", a.authorize(a.HandleGetPayer())).Methods("GET")
+	httpRouter.Handle("/payers/{payerId}/balances", a.authorize(a.HandleGetPayerBalances(), auth.RoleAdmin, auth.RolePurchaser)).Methods("GET")
+	httpRouter.Handle("/payers/{payerId}/earning-rules", a.authorize(a.HandleGetEarningRules(), auth.RoleAdmin, auth.RolePayer)).Methods("GET")
+	httpRouter.Handle("/payers/{payerId}/earning-rules", a.authorize(a.HandlePutEarningRules(), auth.RoleAdmin)).Methods("PUT")
+	httpRouter.Handle("/payers/{payerId}/limits", a.authorize(a.HandleGetPayerLimits(), auth.RoleAdmin, auth.RolePayer)).Methods("GET")
+	httpRouter.Handle("/payers/{payerId}/limits", a.authorize(a.HandlePutPayerLimits(), auth.RoleAdmin)).Methods("PUT")
+	httpRouter.Handle("/payers/{payerId}/campaigns", a.authorize(a.HandleListCampaigns(), auth.RoleAdmin, auth.RolePayer)).Methods("GET")
+	httpRouter.Handle("/payers/{payerId}/campaigns", a.authorize(a.HandleCreateCampaign(), auth.RoleAdmin)).Methods("POST")
+	httpRouter.Handle("/campaigns/{campaignId}", a.authorize(a.HandleGetCampaign(), auth.RoleAdmin, auth.RolePayer)).Methods("GET")
+	httpRouter.Handle("/campaigns/{campaignId}/reverse", a.authorize(a.HandleReverseCampaign(), auth.RoleAdmin)).Methods("POST")
+	httpRouter.Handle("/purchasers", a.authorize(a.HandleListPurchasers(), auth.RoleAdmin)).Methods("GET")
+	httpRouter.Handle("/purchasers", a.authorize(a.HandleCreatePurchaser(), auth.RoleAdmin)).Methods("POST")
+	httpRouter.Handle("/purchasers/{purchaserId}", a.authorize(a.HandleGetPurchaser(), auth.RoleAdmin, auth.RolePurchaser)).Methods("GET")
+	httpRouter.Handle("/purchasers/{purchaserId}", a.authorize(a.HandleUpdatePurchaser(), auth.RoleAdmin)).Methods("PUT")
+	httpRouter.Handle("/purchasers/{purchaserId}/suspend", a.authorize(a.HandleSuspendPurchaser(), auth.RoleAdmin)).Methods("POST")
+	httpRouter.Handle("/purchasers/{purchaserId}/reactivate", a.authorize(a.HandleReactivatePurchaser(), auth.RoleAdmin)).Methods("POST")
+	httpRouter.Handle("/purchasers/{purchaserId}/close", a.authorize(a.HandleClosePurchaser(), auth.RoleAdmin)).Methods("POST")
+	httpRouter.Handle("/purchasers/{purchaserId}/transfers", a.authorize(a.HandleListTransfers(), auth.RoleAdmin, auth.RolePurchaser)).Methods("GET")
+	httpRouter.Handle("/transfers", a.authorize(a.HandleTransferPoints(), auth.RoleAdmin, auth.RolePurchaser)).Methods("POST")
+	httpRouter.Handle("/transfers/{transferId}", a.authorize(a.HandleGetTransfer(), auth.RoleAdmin, auth.RolePurchaser)).Methods("GET")
+	httpRouter.Handle("/transfers/{transferId}/reverse", a.authorize(a.HandleReverseTransfer(), auth.RoleAdmin)).Methods("POST")
+	httpRouter.Handle("/purchasers/{purchaserId}/tier", a.authorize(a.HandleGetPurchaserTier(), auth.RoleAdmin, auth.RolePurchaser)).Methods("GET")
+	httpRouter.Handle("/purchases", a.authorize(a.HandleAddPurchaseTransaction(), auth.RoleAdmin, auth.RolePayer)).Methods("POST")
+	httpRouter.Handle("/rewards/spend", a.authorize(a.HandleNewPointsSpendTransaction(), auth.RoleAdmin, auth.RolePurchaser)).Methods("POST")
+	httpRouter.Handle("/rewards/spend:preview", a.authorize(a.HandlePreviewPointsSpend(), auth.RoleAdmin, auth.RolePurchaser)).Methods("POST")
+	httpRouter.Handle("/rewards/holds", a.authorize(a.HandleHoldPoints(), auth.RoleAdmin, auth.RolePurchaser)).Methods("POST")
+	httpRouter.Handle("/rewards/holds/{holdId}", a.authorize(a.HandleGetHold(), auth.RoleAdmin, auth.RolePurchaser)).Methods("GET")
+	httpRouter.Handle("/rewards/holds/{holdId}/capture", a.authorize(a.HandleCaptureHold(), auth.RoleAdmin, auth.RolePurchaser)).Methods("POST")
+	httpRouter.Handle("/rewards/holds/{holdId}/release", a.authorize(a.HandleReleaseHold(), auth.RoleAdmin, auth.RolePurchaser)).Methods("POST")
+	httpRouter.Handle("/catalog/items", a.authorize(a.HandleListCatalogItems())).Methods("GET")
+	httpRouter.Handle("/catalog/items/{itemId}", a.authorize(a.HandleGetCatalogItem())).Methods("GET")
+	httpRouter.Handle("/catalog/items/{itemId}", a.authorize(a.HandlePutCatalogItem(), auth.RoleAdmin)).Methods("PUT")
+	httpRouter.Handle("/redemptions", a.authorize(a.HandleRedeem(), auth.RoleAdmin, auth.RolePurchaser)).Methods("POST")
+	httpRouter.Handle("/redemptions/{redemptionId}", a.authorize(a.HandleGetRedemption(), auth.RoleAdmin, auth.RolePurchaser)).Methods("GET")
+	httpRouter.Handle("/redemptions/{redemptionId}/cancel", a.authorize(a.HandleCancelRedemption(), auth.RoleAdmin, auth.RolePurchaser)).Methods("POST")
+	httpRouter.Handle("/events/balances", a.authorize(a.HandleBalanceEvents(), auth.RoleAdmin, auth.RolePurchaser)).Methods("GET")
+	httpRouter.Handle("/transactions", a.authorize(a.HandleGetTransactionLog(), auth.RoleAdmin)).Methods("GET")
+	httpRouter.Handle("/ledger/export", a.authorize(a.HandleExportLedger(), auth.RoleAdmin)).Methods("GET")
+	httpRouter.Handle("/ledger/import", a.authorize(a.HandleImportLedger(), auth.RoleAdmin)).Methods("POST")
+	httpRouter.Handle("/admin/audit", a.authorize(a.HandleListAuditEntries(), auth.RoleAdmin)).Methods("GET")
+	if a.access != nil {
+		httpRouter.Handle("/admin/api-keys", a.authorize(a.HandleListApiKeys(), auth.RoleAdmin)).Methods("GET")
+		httpRouter.Handle("/admin/api-keys", a.authorize(a.HandleIssueApiKey(), auth.RoleAdmin)).Methods("POST")
+		httpRouter.Handle("/admin/api-keys/{keyId}", a.authorize(a.HandleRevokeApiKey(), auth.RoleAdmin)).Methods("DELETE")
+	}
+	if a.webhooks != nil {
+		httpRouter.Handle("/admin/webhooks", a.authorize(a.HandleListWebhookEndpoints(), auth.RoleAdmin)).Methods("GET")
+		httpRouter.Handle("/admin/webhooks/dead-letters", a.authorize(a.HandleListDeadLetters(), auth.RoleAdmin)).Methods("GET")
+		httpRouter.Handle("/admin/webhooks/dead-letters/{deadLetterId}/redeliver", a.authorize(a.HandleRedeliverDeadLetter(), auth.RoleAdmin)).Methods("POST")
+	}
+	httpRouter.NotFoundHandler = tracingMiddleware(a.RequestContextMiddleware(a.metrics.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteNotMappedResponse(w)
+	}))))
+	httpRouter.Use(tracingMiddleware, a.RequestContextMiddleware, a.metrics.Middleware, a.AuthenticationMiddleware, a.RateLimitMiddleware)
+	return httpRouter
+}
+
+func (a *Application) HandleListPayers() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteServiceResponse(w, a.transactionService.ListPayers(r.Context()), nil)
+	})
+}
+
+func (a *Application) HandleAddPayer() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payer, requestDecodeErr := decodePayerAccountRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.AddPayer(r.Context(), payer)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+func (a *Application) HandleGetPayer() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payerId = mux.Vars(r)["payerId"]
+		var result, serviceError = a.transactionService.GetPayer(r.Context(), payerId)
+		WriteServiceResponse(w, result, serviceError)
+	})
 }
 
 func (a *Application) HandleGetAllPayersBalances() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var result = a.GetAllPayersBalances()
+		var result = a.GetAllPayersBalances(r.Context())
 		WriteServiceResponse(w, result, nil)
 	})
 }
@@ -50,18 +338,18 @@ func (a *Application) HandleGetAllPayersBalances() http.Handler {
 func (a *Application) HandleGetPayerBalances() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var payerId = mux.Vars(r)["payerId"]
-		var result, serviceError = a.GetPayerBalance(payerId)
+		var result, serviceError = a.GetPayerBalance(r.Context(), payerId)
 		WriteServiceResponse(w, result, serviceError)
 	})
 }
 
 func (a *Application) HandleAddPurchaseTransaction() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		transaction, requestDecodeErr := decodePurchaseTransactionRequest(a.context, r)
+		transaction, requestDecodeErr := decodePurchaseTransactionRequest(r.Context(), r)
 		if requestDecodeErr != nil {
 			WriteDecodeErrorResponse(w, requestDecodeErr)
 		} else {
-			result, serviceError := a.AddPurchaseTransaction(transaction)
+			result, serviceError := a.AddPurchaseTransaction(r.Context(), transaction)
 			WriteServiceResponse(w, result, serviceError)
 		}
 	})
@@ -69,31 +357,113 @@ func (a *Application) HandleAddPurchaseTransaction() http.Handler {
 
 func (a *Application) HandleNewPointsSpendTransaction() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		transaction, requestDecodeErr := decodePointsSpendTransactionRequest(a.context, r)
+		transaction, requestDecodeErr := decodePointsSpendTransactionRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.SpendPoints(r.Context(), transaction)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+// Answer with what the spend requested would do, changing nothing.
+func (a *Application) HandlePreviewPointsSpend() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		transaction, requestDecodeErr := decodePointsSpendTransactionRequest(r.Context(), r)
 		if requestDecodeErr != nil {
 			WriteDecodeErrorResponse(w, requestDecodeErr)
 		} else {
-			result := a.SpendPoints(transaction)
-			WriteServiceResponse(w, result, nil)
+			result, serviceError := a.transactionService.PreviewSpend(r.Context(), transaction)
+			WriteServiceResponse(w, result, serviceError)
 		}
 	})
 }
 
-func (a *Application) GetAllPayersBalances() []*domain.RewardsAccumulateProgress {
-	return a.transactionService.GetAllPointsProgressesForPayers()
+func (a *Application) HandleGetTransactionLog() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteServiceResponse(w, a.transactionService.GetTransactionLog(r.Context()), nil)
+	})
+}
+
+func (a *Application) HandleExportLedger() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteServiceResponse(w, a.transactionService.ExportLedger(r.Context()), nil)
+	})
+}
+
+func (a *Application) HandleImportLedger() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ledger, requestDecodeErr := decodeLedgerExportRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.transactionService.ImportLedger(r.Context(), ledger)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+func (a *Application) HandleListAuditEntries() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, requestDecodeErr := decodeAuditFilterRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			WriteServiceResponse(w, a.transactionService.ListAuditEntries(r.Context(), filter), nil)
+		}
+	})
+}
+
+func (a *Application) AddPayer(ctx context.Context, payer *domain.PayerAccount) (*domain.PayerAccount, error) {
+	if serviceError := a.transactionService.AddPayer(ctx, payer.Id, payer.Name); serviceError != nil {
+		return nil, serviceError
+	}
+	return a.transactionService.GetPayer(ctx, payer.Id)
+}
+
+func (a *Application) GetAllPayersBalances(ctx context.Context) []*domain.RewardsAccumulateProgress {
+	return a.transactionService.GetAllPointsProgressesForPayers(ctx)
 }
 
-func (a *Application) GetPayerBalance(payerId string) (*domain.RewardsAccumulateProgress, error) {
-	return a.transactionService.GetPointsProgressForPayer(payerId)
+func (a *Application) GetPayerBalance(ctx context.Context, payerId string) (*domain.RewardsAccumulateProgress, error) {
+	return a.transactionService.GetPointsProgressForPayer(ctx, payerId)
 }
 
-func (a *Application) AddPurchaseTransaction(transaction *domain.RewardTransaction) (*domain.RewardsAccumulateProgress, error) {
-	return a.transactionService.ReceiveNewPurchase(transaction)
+func (a *Application) AddPurchaseTransaction(ctx context.Context, transaction *domain.RewardTransaction) (*domain.RewardsAccumulateProgress, error) {
+	return a.transactionService.ReceiveNewPurchase(ctx, transaction)
 }
 
-func (a *Application) SpendPoints(transaction *domain.PointsSpendTransaction) []*domain.RewardsAccumulateProgress {
-	a.transactionService.SpendPoints(transaction.Points)
-	return a.GetAllPayersBalances()
+func (a *Application) SpendPoints(ctx context.Context, transaction *domain.PointsSpendTransaction) ([]*domain.RewardsAccumulateProgress, error) {
+	var allocations, serviceError = a.transactionService.Spend(ctx, transaction)
+	if serviceError != nil {
+		if errors.As(serviceError, &service.InsufficientPointsError{}) || errors.As(serviceError, &service.RestrictedFundsError{}) {
+			a.metrics.SpendShortfall("rejected")
+		}
+		return nil, serviceError
+	}
+	var pointsAllocated = 0
+	for _, allocation := range allocations {
+		pointsAllocated -= allocation.Points
+	}
+	if pointsAllocated < transaction.Points {
+		a.metrics.SpendShortfall("partial")
+	}
+	return a.GetAllPayersBalances(ctx), nil
+}
+
+func decodePayerAccountRequest(_ context.Context, r *http.Request) (*domain.PayerAccount, error) {
+	var request domain.PayerAccount
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	if request.Id == "" {
+		return nil, errors.New("payer id is required")
+	}
+	if request.Name == "" {
+		request.Name = request.Id
+	}
+	return &request, nil
 }
 
 func decodePurchaseTransactionRequest(_ context.Context, r *http.Request) (*domain.RewardTransaction, error) {
@@ -112,7 +482,52 @@ func decodePointsSpendTransactionRequest(_ context.Context, r *http.Request) (*d
 	return &request, nil
 }
 
+// Read the filter of an audit query from its query string; at most maxAuditEntries are returned
+// at once, so later entries are paged through with the after parameter.
+func decodeAuditFilterRequest(_ context.Context, r *http.Request) (*domain.AuditFilter, error) {
+	var query = r.URL.Query()
+	var filter = &domain.AuditFilter{
+		Actor: query.Get("actor"),
+		Action: query.Get("action"),
+		Result: query.Get("result"),
+		Payer: query.Get("payer"),
+		Limit: defaultAuditEntries,
+	}
+	var parseErr error
+	if since := query.Get("since"); since != "" {
+		if filter.Since, parseErr = time.Parse(time.RFC3339, since); parseErr != nil {
+			return nil, fmt.Errorf("since must be an RFC 3339 timestamp")
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		if filter.Until, parseErr = time.Parse(time.RFC3339, until); parseErr != nil {
+			return nil, fmt.Errorf("until must be an RFC 3339 timestamp")
+		}
+	}
+	if after := query.Get("after"); after != "" {
+		if filter.AfterSequence, parseErr = strconv.ParseInt(after, 10, 64); parseErr != nil {
+			return nil, fmt.Errorf("after must be the sequence of an audit entry")
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, parseErr = strconv.Atoi(limit); parseErr != nil || filter.Limit < 1 || filter.Limit > maxAuditEntries {
+			return nil, fmt.Errorf("limit must be a whole number from 1 to %d", maxAuditEntries)
+		}
+	}
+	return filter, nil
+}
+
+func decodeLedgerExportRequest(_ context.Context, r *http.Request) (*domain.LedgerExport, error) {
+	var request domain.LedgerExport
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
 func WriteDecodeErrorResponse(w http.ResponseWriter, requestDecodeErr error) {
+	recordRejection(w, rejectReasonInvalidRequest)
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(422)
 	json.NewEncoder(w).Encode(map[string]string {
 		"status": "UNPROCESSIBLE ENITTY",
@@ -121,10 +536,15 @@ func WriteDecodeErrorResponse(w http.ResponseWriter, requestDecodeErr error) {
 }
 
 func WriteServiceResponse(w http.ResponseWriter, result interface{}, error error) {
+	w.Header().Set("Content-Type", "application/json")
 	if error != nil {
-		w.WriteHeader(500)
+		var statusCode, status, rejectReason = serviceErrorStatus(error)
+		if rejectReason != "" {
+			recordRejection(w, rejectReason)
+		}
+		w.WriteHeader(statusCode)
 		json.NewEncoder(w).Encode(map[string]string {
-			"status": "Internal Failure",
+			"status": status,
 			"message": error.Error(),
 		})
 	} else {
@@ -133,7 +553,111 @@ func WriteServiceResponse(w http.ResponseWriter, result interface{}, error error
 	}
 }
 
+// Map the errors the service layer is known to return onto HTTP statuses and the reason the
+// request was refused; anything else is treated as an internal failure.
+func serviceErrorStatus(error error) (int, string, string) {
+	var payerNotFound service.PayerNotFoundError
+	var accountExists dao.AccountExistsError
+	var insufficientPoints service.InsufficientPointsError
+	var restrictedFunds service.RestrictedFundsError
+	var unauthenticated service.UnauthenticatedError
+	var forbidden service.ForbiddenError
+	var invalidApiKeyRequest service.InvalidApiKeyRequestError
+	var invalidSpendRequest service.InvalidSpendRequestError
+	var apiKeyNotFound dao.ApiKeyNotFoundError
+	var invalidToken auth.InvalidTokenError
+	var deadLetterNotFound webhooks.DeadLetterNotFoundError
+	var holdNotFound service.HoldNotFoundError
+	var holdNotActive service.HoldNotActiveError
+	var invalidCatalogItem service.InvalidCatalogItemError
+	var catalogItemNotFound service.CatalogItemNotFoundError
+	var itemUnavailable service.ItemUnavailableError
+	var redemptionNotFound service.RedemptionNotFoundError
+	var redemptionCancelled service.RedemptionCancelledError
+	var invalidEarningRules service.InvalidEarningRulesError
+	var earningRulesNotFound service.EarningRulesNotFoundError
+	var invalidPurchase service.InvalidPurchaseError
+	var invalidCampaign service.InvalidCampaignError
+	var campaignNotFound service.CampaignNotFoundError
+	var campaignReversed service.CampaignReversedError
+	var tiersNotConfigured service.TiersNotConfiguredError
+	var invalidPurchaser service.InvalidPurchaserError
+	var purchaserNotFound dao.PurchaserNotFoundError
+	var purchaserExists dao.PurchaserExistsError
+	var purchaserStatus service.PurchaserStatusError
+	var purchaserHoldsActive service.PurchaserHoldsActiveError
+	var invalidTransfer service.InvalidTransferError
+	var transferLimit service.TransferLimitError
+	var transferNotFound service.TransferNotFoundError
+	var transferReversed service.TransferReversedError
+	var invalidPayerLimits service.InvalidPayerLimitsError
+	var payerLimitsNotFound service.PayerLimitsNotFoundError
+	var payerLimitExceeded service.PayerLimitExceededError
+	switch {
+	case errors.As(error, &payerNotFound):
+		return 404, "NOT FOUND", rejectReasonPayerNotFound
+	case errors.As(error, &accountExists):
+		return 409, "CONFLICT", rejectReasonPayerExists
+	case errors.As(error, &insufficientPoints), errors.As(error, &restrictedFunds):
+		return 409, "CONFLICT", rejectReasonInsufficientPoints
+	case errors.As(error, &unauthenticated), errors.As(error, &invalidToken):
+		return 401, "UNAUTHORIZED", rejectReasonUnauthenticated
+	case errors.As(error, &forbidden):
+		return 403, "FORBIDDEN", rejectReasonForbidden
+	case errors.As(error, &invalidApiKeyRequest), errors.As(error, &invalidSpendRequest), errors.As(error, &invalidCatalogItem),
+		errors.As(error, &invalidEarningRules), errors.As(error, &invalidPurchase), errors.As(error, &invalidCampaign),
+		errors.As(error, &invalidPurchaser), errors.As(error, &invalidTransfer), errors.As(error, &invalidPayerLimits):
+		return 400, "BAD REQUEST", rejectReasonInvalidRequest
+	case errors.As(error, &apiKeyNotFound):
+		return 404, "NOT FOUND", rejectReasonApiKeyNotFound
+	case errors.As(error, &deadLetterNotFound):
+		return 404, "NOT FOUND", rejectReasonDeadLetterNotFound
+	case errors.As(error, &holdNotFound):
+		return 404, "NOT FOUND", rejectReasonHoldNotFound
+	case errors.As(error, &holdNotActive):
+		return 409, "CONFLICT", rejectReasonHoldNotActive
+	case errors.As(error, &catalogItemNotFound):
+		return 404, "NOT FOUND", rejectReasonCatalogItemNotFound
+	case errors.As(error, &itemUnavailable):
+		return 409, "CONFLICT", rejectReasonItemUnavailable
+	case errors.As(error, &redemptionNotFound):
+		return 404, "NOT FOUND", rejectReasonRedemptionNotFound
+	case errors.As(error, &redemptionCancelled):
+		return 409, "CONFLICT", rejectReasonRedemptionCancelled
+	case errors.As(error, &earningRulesNotFound):
+		return 404, "NOT FOUND", rejectReasonEarningRulesNotFound
+	case errors.As(error, &campaignNotFound):
+		return 404, "NOT FOUND", rejectReasonCampaignNotFound
+	case errors.As(error, &campaignReversed):
+		return 409, "CONFLICT", rejectReasonCampaignReversed
+	case errors.As(error, &tiersNotConfigured):
+		return 404, "NOT FOUND", rejectReasonTiersNotConfigured
+	case errors.As(error, &purchaserNotFound):
+		return 404, "NOT FOUND", rejectReasonPurchaserNotFound
+	case errors.As(error, &purchaserExists):
+		return 409, "CONFLICT", rejectReasonPurchaserExists
+	case errors.As(error, &purchaserStatus):
+		return 409, "CONFLICT", rejectReasonPurchaserStatus
+	case errors.As(error, &purchaserHoldsActive):
+		return 409, "CONFLICT", rejectReasonPurchaserHoldsActive
+	case errors.As(error, &transferLimit):
+		return 409, "CONFLICT", rejectReasonTransferLimit
+	case errors.As(error, &transferNotFound):
+		return 404, "NOT FOUND", rejectReasonTransferNotFound
+	case errors.As(error, &transferReversed):
+		return 409, "CONFLICT", rejectReasonTransferReversed
+	case errors.As(error, &payerLimitsNotFound):
+		return 404, "NOT FOUND", rejectReasonPayerLimitsNotFound
+	case errors.As(error, &payerLimitExceeded):
+		return 409, "CONFLICT", rejectReasonPayerLimitExceeded
+	default:
+		return 500, "Internal Failure", ""
+	}
+}
+
 func WriteNotMappedResponse(w http.ResponseWriter) {
+	recordRejection(w, rejectReasonNotMapped)
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(404)
 	json.NewEncoder(w).Encode(map[string]string {
 		"status": "NOT FOUND",
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/gorilla/mux"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+const (
+	metricsNamespace = "purchase_tracker"
+	// reasons a request is rejected, used as the reason label of rejected requests
+	rejectReasonInvalidRequest = "invalid_request"
+	rejectReasonPayerNotFound = "payer_not_found"
+	rejectReasonPayerExists = "payer_exists"
+	rejectReasonInsufficientPoints = "insufficient_points"
+	rejectReasonNotMapped = "not_mapped"
+	rejectReasonUnauthenticated = "unauthenticated"
+	rejectReasonForbidden = "forbidden"
+	rejectReasonApiKeyNotFound = "api_key_not_found"
+	rejectReasonRateLimited = "rate_limited"
+	rejectReasonDeadLetterNotFound = "dead_letter_not_found"
+	rejectReasonHoldNotFound = "hold_not_found"
+	rejectReasonHoldNotActive = "hold_not_active"
+	rejectReasonCatalogItemNotFound = "catalog_item_not_found"
+	rejectReasonItemUnavailable = "item_unavailable"
+	rejectReasonRedemptionNotFound = "redemption_not_found"
+	rejectReasonRedemptionCancelled = "redemption_cancelled"
+	rejectReasonEarningRulesNotFound = "earning_rules_not_found"
+	rejectReasonCampaignNotFound = "campaign_not_found"
+	rejectReasonCampaignReversed = "campaign_reversed"
+	rejectReasonTiersNotConfigured = "tiers_not_configured"
+	rejectReasonPurchaserNotFound = "purchaser_not_found"
+	rejectReasonPurchaserExists = "purchaser_exists"
+	rejectReasonPurchaserStatus = "purchaser_status"
+	rejectReasonPurchaserHoldsActive = "purchaser_holds_active"
+	rejectReasonTransferLimit = "transfer_limit"
+	rejectReasonTransferNotFound = "transfer_not_found"
+	rejectReasonTransferReversed = "transfer_reversed"
+	rejectReasonPayerLimitsNotFound = "payer_limits_not_found"
+	rejectReasonPayerLimitExceeded = "payer_limit_exceeded"
+)
+
+// The instruments the service reports through.  They are go-kit metrics so that handlers and
+// tests need not care whether they are backed by Prometheus or discarded.
+type ServiceMetrics struct {
+	requests metrics.Counter
+	requestDuration metrics.Histogram
+	rejectedRequests metrics.Counter
+	throttledRequests metrics.Counter
+	pointsAccrued metrics.Counter
+	pointsSpent metrics.Counter
+	pointsExpired metrics.Counter
+	pointsRefunded metrics.Counter
+	bonusPoints metrics.Counter
+	closedPoints metrics.Counter
+	transferredPoints metrics.Counter
+	capAlerts metrics.Counter
+	spendShortfalls metrics.Counter
+	outstandingPoints metrics.Gauge
+	transactionLogSize metrics.Gauge
+	handler http.Handler
+}
+
+func NewDiscardMetrics() *ServiceMetrics {
+	return &ServiceMetrics{
+		requests: discard.NewCounter(),
+		requestDuration: discard.NewHistogram(),
+		rejectedRequests: discard.NewCounter(),
+		throttledRequests: discard.NewCounter(),
+		pointsAccrued: discard.NewCounter(),
+		pointsSpent: discard.NewCounter(),
+		pointsExpired: discard.NewCounter(),
+		pointsRefunded: discard.NewCounter(),
+		bonusPoints: discard.NewCounter(),
+		closedPoints: discard.NewCounter(),
+		transferredPoints: discard.NewCounter(),
+		capAlerts: discard.NewCounter(),
+		spendShortfalls: discard.NewCounter(),
+		outstandingPoints: discard.NewGauge(),
+		transactionLogSize: discard.NewGauge(),
+		handler: http.NotFoundHandler(),
+	}
+}
+
+// Build metrics registered with their own registry, which is what the handler exposes, so that
+// more than one set may exist in a process.
+func NewPrometheusMetrics() *ServiceMetrics {
+	var registry = stdprometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	var counter = func(name string, help string, labelNames ...string) metrics.Counter {
+		var vector = stdprometheus.NewCounterVec(stdprometheus.CounterOpts{Namespace: metricsNamespace, Name: name, Help: help}, labelNames)
+		registry.MustRegister(vector)
+		return kitprometheus.NewCounter(vector)
+	}
+	var gauge = func(name string, help string, labelNames ...string) metrics.Gauge {
+		var vector = stdprometheus.NewGaugeVec(stdprometheus.GaugeOpts{Namespace: metricsNamespace, Name: name, Help: help}, labelNames)
+		registry.MustRegister(vector)
+		return kitprometheus.NewGauge(vector)
+	}
+	var requestDuration = stdprometheus.NewHistogramVec(stdprometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name: "http_request_duration_seconds",
+		Help: "Latency of HTTP requests by route, method and status.",
+		Buckets: stdprometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	registry.MustRegister(requestDuration)
+	return &ServiceMetrics{
+		requests: counter("http_requests_total", "HTTP requests by route, method and status.", "route", "method", "status"),
+		requestDuration: kitprometheus.NewHistogram(requestDuration),
+		rejectedRequests: counter("rejected_requests_total", "Requests refused by the service, by reason.", "reason"),
+		throttledRequests: counter("throttled_requests_total", "Requests refused by rate limits, by the scope and budget used up.", "scope", "budget"),
+		pointsAccrued: counter("points_accrued_total", "Points accumulated by Purchases, by Payer.", "payer"),
+		pointsSpent: counter("points_spent_total", "Points deducted from Payers to fund spends, by Payer.", "payer"),
+		pointsExpired: counter("points_expired_total", "Points removed by expiry, by Payer.", "payer"),
+		pointsRefunded: counter("points_refunded_total", "Points given back to Payers by reversed spends, by Payer.", "payer"),
+		bonusPoints: counter("bonus_points_total", "Bonus Points booked by campaigns, by Payer and whether awarded or reversed.", "payer", "outcome"),
+		closedPoints: counter("closed_points_total", "Points settled by closing Purchasers' accounts, by Payer and whether forfeited or paid out.", "payer", "disposition"),
+		transferredPoints: counter("points_transferred_total", "Points moved between Purchasers by transfers and their reversals, by Payer.", "payer"),
+		capAlerts: counter("payer_cap_alerts_total", "Times a Payer's balance reached the alert threshold of its cap on outstanding Points, by Payer.", "payer"),
+		spendShortfalls: counter("spend_shortfalls_total", "Spends the Payers' balances could not fully cover, by outcome.", "outcome"),
+		outstandingPoints: gauge("outstanding_points", "Current Points balance by Payer.", "payer"),
+		transactionLogSize: gauge("transaction_log_size", "Number of Transactions in the Transaction Log."),
+		handler: promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+	}
+}
+
+func (m *ServiceMetrics) Handler() http.Handler {
+	return m.handler
+}
+
+// Seed the ledger gauges from the service's current state and keep every counter and gauge up to
+// date with each change committed from now on.
+func (m *ServiceMetrics) Observe(transactionService *service.LocalTransactionService) {
+	for _, progress := range transactionService.GetAllPointsProgressesForPayers(context.Background()) {
+		m.outstandingPoints.With("payer", progress.Payer.Id).Set(float64(progress.Points))
+	}
+	m.transactionLogSize.Set(float64(len(transactionService.GetTransactionLog(context.Background()))))
+	transactionService.AddCommitObserver(m.observeCommit)
+}
+
+func (m *ServiceMetrics) observeCommit(commit *service.LedgerCommit) {
+	if commit.CapAlert != nil {
+		m.capAlerts.With("payer", commit.CapAlert.Payer).Add(1)
+	}
+	for _, transaction := range commit.Transactions {
+		switch {
+		case transaction.Kind == domain.TransactionKindSpend:
+			m.pointsSpent.With("payer", transaction.Payer).Add(float64(-transaction.Points))
+		case transaction.Kind == domain.TransactionKindExpiry:
+			m.pointsExpired.With("payer", transaction.Payer).Add(float64(-transaction.Points))
+		case transaction.Kind == domain.TransactionKindRefund:
+			m.pointsRefunded.With("payer", transaction.Payer).Add(float64(transaction.Points))
+		case transaction.Kind == domain.TransactionKindBonus && transaction.Points > 0:
+			m.bonusPoints.With("payer", transaction.Payer, "outcome", "awarded").Add(float64(transaction.Points))
+		case transaction.Kind == domain.TransactionKindBonus:
+			m.bonusPoints.With("payer", transaction.Payer, "outcome", "reversed").Add(float64(-transaction.Points))
+		case transaction.Kind == domain.TransactionKindTransfer:
+			if transaction.Points > 0 {
+				m.transferredPoints.With("payer", transaction.Payer).Add(float64(transaction.Points))
+			}
+		case transaction.Kind == domain.TransactionKindForfeit:
+			m.closedPoints.With("payer", transaction.Payer, "disposition", domain.ClosureForfeit).Add(float64(-transaction.Points))
+		case transaction.Kind == domain.TransactionKindPayout:
+			m.closedPoints.With("payer", transaction.Payer, "disposition", domain.ClosurePayout).Add(float64(-transaction.Points))
+		case transaction.Points > 0:
+			m.pointsAccrued.With("payer", transaction.Payer).Add(float64(transaction.Points))
+		}
+	}
+	for payerId, points := range commit.PointsByPayer {
+		m.outstandingPoints.With("payer", payerId).Set(float64(points))
+	}
+	m.transactionLogSize.Set(float64(commit.TransactionLogSize))
+}
+
+// Count a spend the balances could not cover; outcome is "partial" when whatever was available
+// was spent and "rejected" when the spend was refused.
+func (m *ServiceMetrics) SpendShortfall(outcome string) {
+	m.spendShortfalls.With("outcome", outcome).Add(1)
+}
+
+// Count a request refused because the budget of a rate limit scope was used up.
+func (m *ServiceMetrics) Throttled(scope string, budget string) {
+	m.throttledRequests.With("scope", scope, "budget", budget).Add(1)
+}
+
+// Implemented by the response writer of instrumented requests so the response helpers can record
+// why a request was refused without every handler knowing about metrics.
+type rejectionRecorder interface {
+	RecordRejection(reason string)
+}
+
+func recordRejection(w http.ResponseWriter, reason string) {
+	if recorder, isRecorder := w.(rejectionRecorder); isRecorder {
+		recorder.RecordRejection(reason)
+	}
+}
+
+type instrumentedResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	rejectReason string
+}
+
+func (w *instrumentedResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *instrumentedResponseWriter) RecordRejection(reason string) {
+	w.rejectReason = reason
+}
+
+func (w *instrumentedResponseWriter) Flush() {
+	if flusher, isFlusher := w.ResponseWriter.(http.Flusher); isFlusher {
+		flusher.Flush()
+	}
+}
+
+// Lets an http.ResponseController reach the connection's deadlines through the wrapper.
+func (w *instrumentedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Router middleware counting and timing every request by its route template, so that requests
+// for different Payers share one series.
+func (m *ServiceMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var started = time.Now()
+		var instrumented = &instrumentedResponseWriter{ResponseWriter: w, statusCode: 200}
+		next.ServeHTTP(instrumented, r)
+		var labels = []string{"route", routeTemplate(r), "method", r.Method, "status", strconv.Itoa(instrumented.statusCode)}
+		m.requests.With(labels...).Add(1)
+		m.requestDuration.With(labels...).Observe(time.Since(started).Seconds())
+		if instrumented.rejectReason != "" {
+			m.rejectedRequests.With("reason", instrumented.rejectReason).Add(1)
+		}
+	})
+}
+
+// The template of the route r matched, such as /payers/{payerId}, or "unmatched".
+func routeTemplate(r *http.Request) string {
+	if currentRoute := mux.CurrentRoute(r); currentRoute != nil {
+		if template, templateErr := currentRoute.GetPathTemplate(); templateErr == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
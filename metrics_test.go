@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"purchase-tracker-service/service"
+)
+
+func scrapeMetrics(t *testing.T, serviceMetrics *ServiceMetrics) string {
+	var recorder = httptest.NewRecorder()
+	serviceMetrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	var body, _ = io.ReadAll(recorder.Body)
+	return string(body)
+}
+
+func TestMetricsFollowLedgerActivity(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var serviceMetrics = NewPrometheusMetrics()
+	serviceMetrics.Observe(transactionService)
+	var server = httptest.NewServer(NewApplicationWithMetrics(transactionService, serviceMetrics).NewRouter())
+	defer server.Close()
+
+	var post = func(path string, body string) int {
+		var response, postErr = http.Post(server.URL + path, "application/json", bytes.NewBufferString(body))
+		if postErr != nil {
+			t.Fatalf("Expected POST %s to be answered: %s", path, postErr)
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	post("/purchases", `{"payer": "DANNON", "points": 300}`)
+	post("/rewards/spend", `{"points": 500}`)
+	post("/purchases", `{"payer": "UNILEVER", "points": 100}`)
+	post("/purchases", `not json`)
+	http.Get(server.URL + "/payers/DANNON")
+	http.Get(server.URL + "/nowhere")
+
+	var scraped = scrapeMetrics(t, serviceMetrics)
+	for _, expected := range []string{
+		`purchase_tracker_points_accrued_total{payer="DANNON"} 300`,
+		`purchase_tracker_points_spent_total{payer="DANNON"} 300`,
+		`purchase_tracker_outstanding_points{payer="DANNON"} 0`,
+		`purchase_tracker_spend_shortfalls_total{outcome="partial"} 1`,
+		`purchase_tracker_rejected_requests_total{reason="payer_not_found"} 1`,
+		`purchase_tracker_rejected_requests_total{reason="invalid_request"} 1`,
+		`purchase_tracker_rejected_requests_total{reason="not_mapped"} 1`,
+		`purchase_tracker_http_requests_total{method="GET",route="/payers/{payerId}",status="200"} 1`,
+		`purchase_tracker_http_requests_total{method="POST",route="/purchases",status="200"} 1`,
+		`purchase_tracker_transaction_log_size 2`,
+		`purchase_tracker_http_request_duration_seconds_count{method="POST",route="/rewards/spend",status="200"} 1`,
+	} {
+		if !strings.Contains(scraped, expected) {
+			t.Errorf("Expected the scrape to contain %s", expected)
+		}
+	}
+}
+
+func TestMetricsReportRejectedSpends(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.SetSpendPolicy(service.SpendPolicy{RejectShortfall: true})
+	var serviceMetrics = NewPrometheusMetrics()
+	serviceMetrics.Observe(transactionService)
+	var router = NewApplicationWithMetrics(transactionService, serviceMetrics).NewRouter()
+
+	var recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/rewards/spend", strings.NewReader(`{"points": 10}`)))
+	if recorder.Code != 409 {
+		t.Fatalf("Expected an uncovered spend to be refused but got %d", recorder.Code)
+	}
+	var scraped = scrapeMetrics(t, serviceMetrics)
+	for _, expected := range []string{
+		`purchase_tracker_spend_shortfalls_total{outcome="rejected"} 1`,
+		`purchase_tracker_rejected_requests_total{reason="insufficient_points"} 1`,
+	} {
+		if !strings.Contains(scraped, expected) {
+			t.Errorf("Expected the scrape to contain %s", expected)
+		}
+	}
+}
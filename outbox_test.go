@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+// Refuses every mark of published events, as if the process died between publishing events and
+// marking them.
+type unmarkableJournal struct {
+	dao.JournalDao
+}
+
+func (j unmarkableJournal) Append(ctx context.Context, record *dao.JournalRecord) error {
+	if record.PublishedThrough > 0 {
+		return errors.New("crashed before marking events published")
+	}
+	return j.JournalDao.Append(ctx, record)
+}
+
+// A consumer discarding the events it has already seen by id.
+type deduplicatingConsumer struct {
+	lock sync.Mutex
+	seen map[string]bool
+	events []*domain.DomainEvent
+	deliveries int
+}
+
+func (c *deduplicatingConsumer) publish(_ context.Context, event *domain.DomainEvent) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deliveries++
+	if !c.seen[event.Id] {
+		c.seen[event.Id] = true
+		c.events = append(c.events, event)
+	}
+	return nil
+}
+
+func (c *deduplicatingConsumer) received() ([]*domain.DomainEvent, int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]*domain.DomainEvent{}, c.events...), c.deliveries
+}
+
+// Relay the outbox of transactionService to publish until the returned function is called.
+func startRelayForTest(transactionService *service.LocalTransactionService, publish service.EventPublisher) func() {
+	var ctx, stop = context.WithCancel(context.Background())
+	var stopped = make(chan struct{})
+	go func() {
+		transactionService.RelayOutbox(ctx, publish, time.Millisecond)
+		close(stopped)
+	}()
+	return func() {
+		stop()
+		<-stopped
+	}
+}
+
+func TestOutboxPublishesCommittedEventsAtLeastOnceAcrossCrashes(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "ledger.journal")
+	var consumer = &deduplicatingConsumer{seen: make(map[string]bool)}
+
+	// the process dies once the changes are committed, before any of their events are published
+	var committed, committedJournal = openJournaledServiceForTest(t, path)
+	committed.EnableOutbox()
+	committed.AddPayer(context.Background(), "DANNON", "Dannon")
+	committed.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 300})
+	committed.SpendPoints(context.Background(), 100)
+	committedJournal.Close()
+
+	// after restarting, the events are published but the process dies before marking them published
+	var journal, openErr = dao.OpenFileJournal(path, true)
+	if openErr != nil {
+		t.Fatalf("Unable to open journal: %s", openErr)
+	}
+	var unmarked, replayErr = service.NewLocalTransactionServiceWithJournal(context.Background(), unmarkableJournal{journal})
+	if replayErr != nil {
+		t.Fatalf("Unable to replay journal: %s", replayErr)
+	}
+	if unmarked.PendingEvents(context.Background()) != 3 {
+		t.Fatalf("Expected the 3 committed events to be pending after the crash but found %d", unmarked.PendingEvents(context.Background()))
+	}
+	var stopUnmarked = startRelayForTest(unmarked, consumer.publish)
+	waitFor(t, "the unmarked event to be published again", func() bool {
+		var _, deliveries = consumer.received()
+		return deliveries >= 2
+	})
+	stopUnmarked()
+	journal.Close()
+	var events, _ = consumer.received()
+	if len(events) != 1 || events[0].Type != domain.EventTypePayerCreated {
+		t.Fatalf("Expected the relay to hold at the first change it could not mark but the consumer kept %d events", len(events))
+	}
+
+	// after restarting again, the same events are published once more and finally marked
+	var restarted, restartedJournal = openJournaledServiceForTest(t, path)
+	restarted.EnableOutbox()
+	var _, deliveriesBefore = consumer.received()
+	var stopRestarted = startRelayForTest(restarted, consumer.publish)
+	restarted.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 50})
+	waitFor(t, "every event to be marked published", func() bool {
+		return restarted.PendingEvents(context.Background()) == 0
+	})
+	stopRestarted()
+	restartedJournal.Close()
+	var republished, deliveriesAfter = consumer.received()
+	if deliveriesAfter - deliveriesBefore != 4 || len(republished) != 4 || republished[0].Id != events[0].Id {
+		t.Fatalf("Expected the 3 unmarked events to be redelivered with their ids and the new purchase once, but got %d deliveries of %d distinct events", deliveriesAfter - deliveriesBefore, len(republished))
+	}
+	var expectedTypes = []string{domain.EventTypePayerCreated, domain.EventTypePurchaseRecorded, domain.EventTypePointsSpent, domain.EventTypePurchaseRecorded}
+	for i, event := range republished {
+		if event.Type != expectedTypes[i] {
+			t.Fatalf("Expected event %d to be %s but was %s", i, expectedTypes[i], event.Type)
+		}
+	}
+
+	var final, finalJournal = openJournaledServiceForTest(t, path)
+	defer finalJournal.Close()
+	if final.PendingEvents(context.Background()) != 0 {
+		t.Fatalf("Expected no events to be pending once marked published but found %d", final.PendingEvents(context.Background()))
+	}
+}
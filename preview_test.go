@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func TestSpendPreviewMatchesTheSpendMadeAfterIt(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.SetExpiryPolicy(service.ExpiryPolicy{PointsLifetime: time.Hour})
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	transactionService.AddPayer(context.Background(), "MILLER COORS", "Miller Coors")
+	transactionService.ImportLedger(context.Background(), &domain.LedgerExport{Transactions: []*domain.RewardTransaction{
+		// due to expire, so neither the preview nor the spend may draw on it
+		{Payer: "DANNON", Purchaser: "alice", Points: 400, TransactionTimestamp: time.Now().Add(-2 * time.Hour)},
+		{Payer: "UNILEVER", Purchaser: "alice", Points: 200, TransactionTimestamp: time.Now().Add(-30 * time.Minute)},
+		{Payer: "DANNON", Purchaser: "bob", Points: 300, TransactionTimestamp: time.Now().Add(-20 * time.Minute)},
+		{Payer: "UNILEVER", Purchaser: "bob", Points: 100, TransactionTimestamp: time.Now().Add(-10 * time.Minute)},
+	}})
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+
+	var logBefore, _ = serviceClient.GetTransactionLog()
+	var preview, previewErr = serviceClient.PreviewSpend(&domain.PointsSpendTransaction{Points: 450})
+	if previewErr != nil {
+		t.Fatalf("Expected the spend to be previewed: %s", previewErr)
+	}
+	if logAfter, _ := serviceClient.GetTransactionLog(); len(logAfter) != len(logBefore) {
+		t.Fatalf("Expected the preview to record nothing but the log grew from %d to %d", len(logBefore), len(logAfter))
+	}
+	if preview.Allocation != domain.AllocationFifo || preview.Shortfall != 0 {
+		t.Fatalf("Expected a fifo preview without shortfall but got %+v", preview)
+	}
+	var previewed = make(map[string]int)
+	for _, allocation := range preview.Allocations {
+		previewed[allocation.Payer.Id] = allocation.Points
+	}
+	if fmt.Sprint(previewed) != fmt.Sprint(map[string]int{"UNILEVER": -200, "DANNON": -250}) {
+		t.Fatalf("Expected the expiring lot to be passed over but the preview allocated %v", previewed)
+	}
+
+	var balances, spendErr = serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: 450})
+	if spendErr != nil {
+		t.Fatalf("Expected the spend to be made: %s", spendErr)
+	}
+	if fmt.Sprint(balancesByPayerForTest(balances)) != fmt.Sprint(balancesByPayerForTest(preview.Balances)) {
+		t.Fatalf("Expected the spend to leave %v as previewed but left %v", balancesByPayerForTest(preview.Balances), balancesByPayerForTest(balances))
+	}
+	var spent = make(map[string]int)
+	var transactionLog, _ = serviceClient.GetTransactionLog()
+	for _, transaction := range transactionLog {
+		if transaction.Kind == domain.TransactionKindSpend {
+			spent[transaction.Payer] += transaction.Points
+		}
+	}
+	if fmt.Sprint(spent) != fmt.Sprint(previewed) {
+		t.Fatalf("Expected the spend to allocate %v as previewed but allocated %v", previewed, spent)
+	}
+}
+
+func TestSpendPreviewRefusesWhatTheSpendWould(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.SetSpendPolicy(service.SpendPolicy{RejectShortfall: true})
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 100})
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+
+	var _, shortfallErr = serviceClient.PreviewSpend(&domain.PointsSpendTransaction{Points: 150})
+	expectStatus(t, shortfallErr, 409, "a preview of a spend falling short")
+	var _, allocationErr = serviceClient.PreviewSpend(&domain.PointsSpendTransaction{Points: 50, Allocation: "random"})
+	expectStatus(t, allocationErr, 400, "a preview naming an unknown allocation")
+	var _, zeroErr = serviceClient.PreviewSpend(&domain.PointsSpendTransaction{Points: 0})
+	expectStatus(t, zeroErr, 400, "a preview of a spend of no points")
+	var _, negativeErr = serviceClient.SpendPoints(&domain.PointsSpendTransaction{Points: -50})
+	expectStatus(t, negativeErr, 400, "a spend of negative points")
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 100)
+}
+
+func balancesByPayerForTest(balances []*domain.RewardsAccumulateProgress) map[string]int {
+	var byPayer = make(map[string]int)
+	for _, balance := range balances {
+		byPayer[balance.Payer.Id] = balance.Points
+	}
+	return byPayer
+}
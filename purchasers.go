@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"github.com/gorilla/mux"
+	"purchase-tracker-service/domain"
+)
+
+func (a *Application) HandleListPurchasers() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteServiceResponse(w, a.transactionService.ListPurchasers(r.Context()), nil)
+	})
+}
+
+func (a *Application) HandleCreatePurchaser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var purchaser domain.PurchaserAccount
+		if requestDecodeErr := json.NewDecoder(r.Body).Decode(&purchaser); requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.transactionService.CreatePurchaser(r.Context(), &purchaser)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+func (a *Application) HandleGetPurchaser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.GetPurchaser(r.Context(), mux.Vars(r)["purchaserId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandleUpdatePurchaser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		purchaser, requestDecodeErr := decodePurchaserRequest(r.Context(), r)
+		if requestDecodeErr != nil {
+			WriteDecodeErrorResponse(w, requestDecodeErr)
+		} else {
+			result, serviceError := a.transactionService.UpdatePurchaser(r.Context(), purchaser)
+			WriteServiceResponse(w, result, serviceError)
+		}
+	})
+}
+
+func (a *Application) HandleSuspendPurchaser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.SuspendPurchaser(r.Context(), mux.Vars(r)["purchaserId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandleReactivatePurchaser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.ReactivatePurchaser(r.Context(), mux.Vars(r)["purchaserId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+func (a *Application) HandleClosePurchaser() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.ClosePurchaser(r.Context(), mux.Vars(r)["purchaserId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
+
+// The account updated is the one in the path; a body naming a different one is refused.
+func decodePurchaserRequest(_ context.Context, r *http.Request) (*domain.PurchaserAccount, error) {
+	var request domain.PurchaserAccount
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	var purchaserId = mux.Vars(r)["purchaserId"]
+	if request.Id != "" && request.Id != purchaserId {
+		return nil, errors.New("id must match the path")
+	}
+	request.Id = purchaserId
+	return &request, nil
+}
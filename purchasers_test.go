@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func purchaserContextForTest(purchaserId string) context.Context {
+	return auth.WithIdentity(context.Background(), &auth.Identity{Subject: purchaserId, Roles: []string{auth.RolePurchaser}, PurchaserId: purchaserId})
+}
+
+func TestPurchaserAccountLifecycle(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+
+	var alice, createErr = serviceClient.CreatePurchaser(&domain.PurchaserAccount{Id: "alice", Name: "Alice", Email: "alice@example.com"})
+	if createErr != nil || alice.Status != domain.PurchaserStatusActive {
+		t.Fatalf("Expected alice to be registered active but got %+v (%v)", alice, createErr)
+	}
+	var _, duplicateErr = serviceClient.CreatePurchaser(&domain.PurchaserAccount{Id: "alice"})
+	expectStatus(t, duplicateErr, 409, "registering a Purchaser twice")
+	var _, invalidErr = serviceClient.CreatePurchaser(&domain.PurchaserAccount{Id: "bob", Email: "bob"})
+	expectStatus(t, invalidErr, 400, "registering a Purchaser with a malformed email")
+	var _, unknownErr = serviceClient.GetPurchaser("carol")
+	expectStatus(t, unknownErr, 404, "looking up an unregistered Purchaser")
+	if updated, _ := serviceClient.UpdatePurchaser(&domain.PurchaserAccount{Id: "alice", Name: "Alice Smith"}); updated.Name != "Alice Smith" || updated.Email != "" {
+		t.Fatalf("Expected the name and email to be replaced but got %+v", updated)
+	}
+
+	serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: "alice", Points: 300})
+	serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "UNILEVER", Purchaser: "alice", Points: 200})
+	serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: "bob", Points: 50})
+	if _, suspendErr := serviceClient.SuspendPurchaser("alice"); suspendErr != nil {
+		t.Fatalf("Expected alice to be suspended: %s", suspendErr)
+	}
+	var _, suspendAgainErr = serviceClient.SuspendPurchaser("alice")
+	expectStatus(t, suspendAgainErr, 409, "suspending a suspended Purchaser")
+	if _, spendErr := transactionService.SpendPoints(purchaserContextForTest("alice"), 100); spendErr == nil {
+		t.Fatalf("Expected a suspended Purchaser to be refused a spend")
+	}
+	if _, holdErr := transactionService.HoldPoints(purchaserContextForTest("alice"), &domain.PointsSpendTransaction{Points: 100}); holdErr == nil {
+		t.Fatalf("Expected a suspended Purchaser to be refused a hold")
+	}
+	if _, spendErr := transactionService.SpendPoints(purchaserContextForTest("bob"), 10); spendErr != nil {
+		t.Fatalf("Expected a Purchaser without an account to spend: %s", spendErr)
+	}
+	serviceClient.ReactivatePurchaser("alice")
+	if _, spendErr := transactionService.SpendPoints(purchaserContextForTest("alice"), 100); spendErr != nil {
+		t.Fatalf("Expected a reactivated Purchaser to spend: %s", spendErr)
+	}
+
+	var closed, closeErr = serviceClient.ClosePurchaser("alice")
+	if closeErr != nil || closed.Status != domain.PurchaserStatusClosed || closed.Closure == nil ||
+		closed.Closure.Disposition != domain.ClosureForfeit || closed.Closure.Points != 400 {
+		t.Fatalf("Expected alice's remaining 400 points to be forfeited but got %+v (%v)", closed, closeErr)
+	}
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 40)
+	expectPayerBalanceForTest(t, transactionService, "UNILEVER", 0)
+	var _, purchaseErr = serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: "alice", Points: 10})
+	expectStatus(t, purchaseErr, 409, "a purchase by a closed Purchaser")
+	var _, updateErr = serviceClient.UpdatePurchaser(&domain.PurchaserAccount{Id: "alice", Name: "Alice"})
+	expectStatus(t, updateErr, 409, "updating a closed Purchaser")
+	if purchasers, _ := serviceClient.ListPurchasers(); len(purchasers) != 1 || purchasers[0].Id != "alice" {
+		t.Fatalf("Expected alice to be the only Purchaser listed but got %d", len(purchasers))
+	}
+	if _, forbiddenErr := transactionService.GetPurchaser(purchaserContextForTest("bob"), "alice"); forbiddenErr == nil {
+		t.Fatalf("Expected a Purchaser to be refused the account of another")
+	}
+}
+
+func TestPurchaserClosurePaysOutAfterHoldsSettle(t *testing.T) {
+	var journalPath = filepath.Join(t.TempDir(), "ledger.journal")
+	var journal, _ = dao.OpenFileJournal(journalPath, false)
+	var transactionService, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), journal)
+	transactionService.SetPurchaserPolicy(service.PurchaserPolicy{Closure: domain.ClosurePayout})
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.CreatePurchaser(context.Background(), &domain.PurchaserAccount{Id: "alice"})
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Purchaser: "alice", Points: 300})
+	var hold, _ = transactionService.HoldPoints(purchaserContextForTest("alice"), &domain.PointsSpendTransaction{Points: 100})
+	if _, closeErr := transactionService.ClosePurchaser(context.Background(), "alice"); closeErr == nil {
+		t.Fatalf("Expected closing a Purchaser with an active hold to be refused")
+	}
+	transactionService.ReleaseHold(context.Background(), hold.Id)
+	if closed, closeErr := transactionService.ClosePurchaser(context.Background(), "alice"); closeErr != nil || closed.Closure.Points != 300 {
+		t.Fatalf("Expected all 300 points to be paid out but got %+v (%v)", closed, closeErr)
+	}
+	var transactionLog = transactionService.GetTransactionLog(context.Background())
+	if payout := transactionLog[len(transactionLog) - 1]; payout.Kind != domain.TransactionKindPayout || payout.Points != -300 {
+		t.Fatalf("Expected the closure to be booked as a payout of 300 but was %+v", payout)
+	}
+	transactionService.Close()
+
+	var reopened, _ = dao.OpenFileJournal(journalPath, false)
+	var restarted, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), reopened)
+	defer restarted.Close()
+	if alice, _ := restarted.GetPurchaser(context.Background(), "alice"); alice.Status != domain.PurchaserStatusClosed {
+		t.Fatalf("Expected alice to be restored closed but was %s", alice.Status)
+	}
+	expectPayerBalanceForTest(t, restarted, "DANNON", 0)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/config"
+)
+
+const (
+	// Requests are charged to the read budget when they cannot change anything and to the write
+	// budget otherwise.
+	rateLimitBudgetRead = "read"
+	rateLimitBudgetWrite = "write"
+	// What a bucket is keyed by: the caller's address, its credential, either an API key or a
+	// bearer token's subject, or the Purchaser it acts as.
+	rateLimitScopeAddress = "address"
+	rateLimitScopeCredential = "credential"
+	rateLimitScopePurchaser = "purchaser"
+	// How often buckets that have refilled completely, and so are no different from new ones, are
+	// forgotten.
+	rateLimitSweepInterval = time.Minute
+)
+
+type rateLimitBudget struct {
+	perSecond float64
+	burst float64
+}
+
+type bucketKey struct {
+	scope string
+	budget string
+	id string
+}
+
+type tokenBucket struct {
+	tokens float64
+	updated time.Time
+}
+
+// Token buckets, one per credential, Purchaser and caller address for each of the read and write
+// budgets.  An authenticated request is charged to its credential and Purchaser, so that callers
+// sharing an address, such as those behind a gateway, do not share a budget; any other request,
+// including one whose credentials were refused, is charged to its address.  A request must find a
+// token in every bucket it is charged to.
+type RateLimiter struct {
+	lock sync.Mutex
+	budgets map[string]rateLimitBudget
+	buckets map[bucketKey]*tokenBucket
+	metrics *ServiceMetrics
+	now func() time.Time
+	swept time.Time
+}
+
+func NewRateLimiter(rateLimitConfig config.RateLimitConfig, serviceMetrics *ServiceMetrics) *RateLimiter {
+	return &RateLimiter{
+		budgets: map[string]rateLimitBudget{
+			rateLimitBudgetRead: {rateLimitConfig.ReadsPerSecond, float64(rateLimitConfig.ReadBurst)},
+			rateLimitBudgetWrite: {rateLimitConfig.WritesPerSecond, float64(rateLimitConfig.WriteBurst)},
+		},
+		buckets: make(map[bucketKey]*tokenBucket),
+		metrics: serviceMetrics,
+		now: time.Now,
+	}
+}
+
+// Throttle every request once its callers have used up their budgets; without a rate limiter
+// nothing is throttled.
+func (a *Application) SetRateLimiter(rateLimiter *RateLimiter) {
+	a.rateLimiter = rateLimiter
+}
+
+func requestBudget(r *http.Request) string {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return rateLimitBudgetRead
+	default:
+		return rateLimitBudgetWrite
+	}
+}
+
+func addressBucketKey(r *http.Request) bucketKey {
+	var address, _, splitErr = net.SplitHostPort(r.RemoteAddr)
+	if splitErr != nil {
+		address = r.RemoteAddr
+	}
+	return bucketKey{rateLimitScopeAddress, requestBudget(r), address}
+}
+
+// Router middleware, following authentication, charging every request to the buckets of its
+// caller.
+func (a *Application) RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.rateLimiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var keys = []bucketKey{addressBucketKey(r)}
+		if identity := auth.FromContext(r.Context()); identity != nil {
+			var budget = requestBudget(r)
+			keys = []bucketKey{{rateLimitScopeCredential, budget, identity.Subject}}
+			if identity.PurchaserId != "" {
+				keys = append(keys, bucketKey{rateLimitScopePurchaser, budget, identity.PurchaserId})
+			}
+		}
+		if !a.rateLimiter.allow(w, keys...) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Answer a request whose address has used up its budget with credentials that were refused, before
+// any further credentials from it are checked, so they cannot be guessed at.
+func (a *Application) throttleRefusedAddress(w http.ResponseWriter, r *http.Request) bool {
+	if a.rateLimiter == nil {
+		return false
+	}
+	var retryAfter, isExhausted = a.rateLimiter.exhausted(addressBucketKey(r))
+	if isExhausted {
+		a.rateLimiter.throttle(w, addressBucketKey(r), retryAfter)
+	}
+	return isExhausted
+}
+
+// Charge the address of a request whose credentials were refused; false when it was throttled,
+// and so already answered.
+func (a *Application) chargeRefusedAddress(w http.ResponseWriter, r *http.Request) bool {
+	return a.rateLimiter == nil || a.rateLimiter.allow(w, addressBucketKey(r))
+}
+
+// Take a token from the buckets of keys, or answer the request with 429 and return false.
+func (l *RateLimiter) allow(w http.ResponseWriter, keys ...bucketKey) bool {
+	var throttledKey, retryAfter, isAllowed = l.take(keys)
+	if !isAllowed {
+		l.throttle(w, throttledKey, retryAfter)
+	}
+	return isAllowed
+}
+
+func (l *RateLimiter) throttle(w http.ResponseWriter, throttledKey bucketKey, retryAfter time.Duration) {
+	l.metrics.Throttled(throttledKey.scope, throttledKey.budget)
+	WriteThrottledResponse(w, throttledKey, retryAfter)
+}
+
+// Whether the bucket of key holds no token, without taking one, and how long until it does.
+func (l *RateLimiter) exhausted(key bucketKey) (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var bucket, isKnown = l.buckets[key]
+	if !isKnown {
+		return 0, false
+	}
+	return l.refill(key, bucket, l.now())
+}
+
+// Bring bucket up to date as of now, returning how long until it holds a token when it holds none.
+func (l *RateLimiter) refill(key bucketKey, bucket *tokenBucket, now time.Time) (time.Duration, bool) {
+	var budget = l.budgets[key.budget]
+	bucket.tokens = math.Min(budget.burst, bucket.tokens + now.Sub(bucket.updated).Seconds() * budget.perSecond)
+	bucket.updated = now
+	if bucket.tokens >= 1 {
+		return 0, false
+	}
+	return time.Duration((1 - bucket.tokens) / budget.perSecond * float64(time.Second)), true
+}
+
+// Take a token from every bucket of keys, or from none of them when any is empty, in which case
+// the first empty bucket and how long until it holds a token again are returned.
+func (l *RateLimiter) take(keys []bucketKey) (bucketKey, time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var now = l.now()
+	l.sweep(now)
+	var buckets = make([]*tokenBucket, len(keys))
+	for i, key := range keys {
+		var bucket, isKnown = l.buckets[key]
+		if !isKnown {
+			bucket = &tokenBucket{tokens: l.budgets[key.budget].burst, updated: now}
+			l.buckets[key] = bucket
+		}
+		if wait, isEmpty := l.refill(key, bucket, now); isEmpty {
+			return key, wait, false
+		}
+		buckets[i] = bucket
+	}
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return bucketKey{}, 0, true
+}
+
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < rateLimitSweepInterval {
+		return
+	}
+	l.swept = now
+	for key, bucket := range l.buckets {
+		var budget = l.budgets[key.budget]
+		if bucket.tokens + now.Sub(bucket.updated).Seconds() * budget.perSecond >= budget.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func WriteThrottledResponse(w http.ResponseWriter, throttledKey bucketKey, retryAfter time.Duration) {
+	recordRejection(w, rejectReasonRateLimited)
+	var retryAfterSeconds = int(math.Ceil(retryAfter.Seconds()))
+	if retryAfterSeconds < 1 {
+		retryAfterSeconds = 1
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	w.WriteHeader(429)
+	json.NewEncoder(w).Encode(map[string]string {
+		"status": "TOO MANY REQUESTS",
+		"message": fmt.Sprintf("The %s budget of this %s is used up; retry after %d seconds", throttledKey.budget, throttledKey.scope, retryAfterSeconds),
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func TestRateLimitsThrottleEachCallerAndBudget(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var serviceMetrics = NewPrometheusMetrics()
+	var application = NewApplicationWithMetrics(transactionService, serviceMetrics)
+	var access, _ = newAccessService(config.AuthConfig{Enabled: true, BootstrapAdminKey: testBootstrapAdminKey}, transactionService)
+	application.SetAccessService(access)
+	var rateLimiter = NewRateLimiter(config.RateLimitConfig{Enabled: true, ReadsPerSecond: 10, ReadBurst: 20, WritesPerSecond: 0.5, WriteBurst: 2}, serviceMetrics)
+	var now = time.Now()
+	rateLimiter.now = func() time.Time {
+		return now
+	}
+	application.SetRateLimiter(rateLimiter)
+	var server = httptest.NewServer(application.NewRouter())
+	defer server.Close()
+	var admin = newClientWithKey(server.URL, testBootstrapAdminKey)
+	var aliceKey = issueKeyForTest(t, admin, &domain.ApiKey{Role: "purchaser", PurchaserId: "alice"})
+	var bobKey = issueKeyForTest(t, admin, &domain.ApiKey{Role: "purchaser", PurchaserId: "bob"})
+
+	var spend = func(key string) *http.Response {
+		var request, _ = http.NewRequest("POST", server.URL + "/rewards/spend", strings.NewReader(`{"points": 1}`))
+		request.Header.Set(apiKeyHeader, key)
+		var response, requestErr = http.DefaultClient.Do(request)
+		if requestErr != nil {
+			t.Fatalf("Expected the spend to be answered: %s", requestErr)
+		}
+		response.Body.Close()
+		return response
+	}
+	spend(aliceKey)
+	spend(aliceKey)
+	var throttled = spend(aliceKey)
+	if throttled.StatusCode != 429 || throttled.Header.Get("Retry-After") != "2" {
+		t.Fatalf("Expected alice's third write to be throttled for 2 seconds but got %d with Retry-After %q", throttled.StatusCode, throttled.Header.Get("Retry-After"))
+	}
+	if _, readErr := newClientWithKey(server.URL, aliceKey).GetAllPayersBalances(); readErr != nil {
+		t.Fatalf("Expected alice's reads to have their own budget: %s", readErr)
+	}
+	if response := spend(bobKey); response.StatusCode != 200 {
+		t.Fatalf("Expected bob's writes to have their own budget but got %d", response.StatusCode)
+	}
+	now = now.Add(2 * time.Second)
+	if response := spend(aliceKey); response.StatusCode != 200 {
+		t.Fatalf("Expected alice's budget to have refilled a token but got %d", response.StatusCode)
+	}
+
+	var scraped = scrapeMetrics(t, serviceMetrics)
+	for _, expected := range []string{
+		`purchase_tracker_throttled_requests_total{budget="write",scope="credential"} 1`,
+		`purchase_tracker_rejected_requests_total{reason="rate_limited"} 1`,
+	} {
+		if !strings.Contains(scraped, expected) {
+			t.Errorf("Expected the scrape to contain %s", expected)
+		}
+	}
+}
+
+func TestRateLimitsThrottleUnauthenticatedAddresses(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	var serviceMetrics = NewPrometheusMetrics()
+	var application = NewApplicationWithMetrics(transactionService, serviceMetrics)
+	var access, _ = newAccessService(config.AuthConfig{Enabled: true, BootstrapAdminKey: testBootstrapAdminKey}, transactionService)
+	application.SetAccessService(access)
+	application.SetRateLimiter(NewRateLimiter(config.RateLimitConfig{Enabled: true, ReadsPerSecond: 1, ReadBurst: 3, WritesPerSecond: 1, WriteBurst: 3}, serviceMetrics))
+	var server = httptest.NewServer(application.NewRouter())
+	defer server.Close()
+
+	var statuses []int
+	for i := 0; i < 4; i++ {
+		var response, getErr = http.Get(server.URL + "/payers")
+		if getErr != nil {
+			t.Fatalf("Expected the request to be answered: %s", getErr)
+		}
+		response.Body.Close()
+		statuses = append(statuses, response.StatusCode)
+	}
+	if statuses[0] != 401 || statuses[3] != 429 {
+		t.Fatalf("Expected guesses without a key to be refused and then throttled but got %v", statuses)
+	}
+	if !strings.Contains(scrapeMetrics(t, serviceMetrics), `purchase_tracker_throttled_requests_total{budget="read",scope="address"} 1`) {
+		t.Fatalf("Expected the throttled address to be counted")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func TestRedemptionSpendsAndTakesStockUntilCancelled(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	var server, serviceClient = newHoldTestServer(transactionService)
+	defer server.Close()
+	serviceClient.PutCatalogItem(&domain.CatalogItem{Id: "mug", Name: "Mug", Points: 200, Stock: 3, FundingPayers: []string{"UNILEVER"}})
+	serviceClient.PutCatalogItem(&domain.CatalogItem{Id: "hat", Name: "Hat", Points: 150, Stock: 5})
+
+	var redemption, redeemErr = serviceClient.Redeem(&domain.RedemptionRequest{ItemId: "mug", Quantity: 2})
+	if redeemErr != nil || redemption.Status != domain.RedemptionStatusCompleted || redemption.Points != 400 || redemption.SpendId == "" {
+		t.Fatalf("Expected two mugs to be redeemed for 400 points but got %+v (%v)", redemption, redeemErr)
+	}
+	if len(redemption.Allocations) != 1 || redemption.Allocations[0].Payer != "UNILEVER" {
+		t.Fatalf("Expected the mugs to be funded by UNILEVER alone but were funded by %+v", redemption.Allocations)
+	}
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 600)
+	expectPayerBalanceForTest(t, transactionService, "UNILEVER", 0)
+	if mug, _ := serviceClient.GetCatalogItem("mug"); mug.Stock != 1 {
+		t.Fatalf("Expected one mug to be left in stock but %d were", mug.Stock)
+	}
+
+	// the only funding Payer is spent out, whatever DANNON holds
+	var _, fundingErr = serviceClient.Redeem(&domain.RedemptionRequest{ItemId: "mug"})
+	expectStatus(t, fundingErr, 409, "a redemption its funding Payers cannot cover")
+	var _, stockErr = serviceClient.Redeem(&domain.RedemptionRequest{ItemId: "hat", Quantity: 6})
+	expectStatus(t, stockErr, 409, "a redemption of more than the stock")
+	var _, shortErr = serviceClient.Redeem(&domain.RedemptionRequest{ItemId: "hat", Quantity: 5})
+	expectStatus(t, shortErr, 409, "a redemption the balances cannot pay for in full")
+	var _, unknownErr = serviceClient.Redeem(&domain.RedemptionRequest{ItemId: "boat"})
+	expectStatus(t, unknownErr, 404, "a redemption of an unknown item")
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 600)
+
+	var cancelled, cancelErr = serviceClient.CancelRedemption(redemption.Id)
+	if cancelErr != nil || cancelled.Status != domain.RedemptionStatusCancelled || cancelled.CancellationTimestamp == nil {
+		t.Fatalf("Expected the redemption to be cancelled but got %+v (%v)", cancelled, cancelErr)
+	}
+	expectPayerBalanceForTest(t, transactionService, "UNILEVER", 400)
+	if mug, _ := serviceClient.GetCatalogItem("mug"); mug.Stock != 3 {
+		t.Fatalf("Expected the mugs to be returned to stock but %d are in stock", mug.Stock)
+	}
+	var _, recancelErr = serviceClient.CancelRedemption(redemption.Id)
+	expectStatus(t, recancelErr, 409, "cancelling a redemption twice")
+	expectPayerBalanceForTest(t, transactionService, "UNILEVER", 400)
+}
+
+func TestCatalogItemsAreValidatedAndRedeemedOnlyWhileActive(t *testing.T) {
+	var server, serviceClient = newHoldTestServer(service.NewLocalTransactionService())
+	defer server.Close()
+	var yesterday = time.Now().Add(-24 * time.Hour)
+	var tomorrow = time.Now().Add(24 * time.Hour)
+
+	var _, pointsErr = serviceClient.PutCatalogItem(&domain.CatalogItem{Id: "mug", Name: "Mug", Stock: 1})
+	expectStatus(t, pointsErr, 400, "an item costing no points")
+	var _, windowErr = serviceClient.PutCatalogItem(&domain.CatalogItem{Id: "mug", Name: "Mug", Points: 10, ActiveFrom: &tomorrow, ActiveUntil: &yesterday})
+	expectStatus(t, windowErr, 400, "an item active until before it is active from")
+	var _, payerErr = serviceClient.PutCatalogItem(&domain.CatalogItem{Id: "mug", Name: "Mug", Points: 10, FundingPayers: []string{"NESTLE"}})
+	expectStatus(t, payerErr, 404, "an item funded by an unknown Payer")
+
+	serviceClient.PutCatalogItem(&domain.CatalogItem{Id: "ended", Name: "Ended", Points: 10, Stock: 1, ActiveUntil: &yesterday})
+	serviceClient.PutCatalogItem(&domain.CatalogItem{Id: "upcoming", Name: "Upcoming", Points: 10, Stock: 1, ActiveFrom: &tomorrow})
+	var _, endedErr = serviceClient.Redeem(&domain.RedemptionRequest{ItemId: "ended"})
+	expectStatus(t, endedErr, 409, "redeeming an item past its active window")
+	var _, upcomingErr = serviceClient.Redeem(&domain.RedemptionRequest{ItemId: "upcoming"})
+	expectStatus(t, upcomingErr, 409, "redeeming an item before its active window")
+	if items, _ := serviceClient.ListCatalogItems(); len(items) != 2 || items[0].Id != "ended" {
+		t.Fatalf("Expected the two valid items listed by Id but got %d", len(items))
+	}
+}
+
+func TestRedemptionsSurviveRestart(t *testing.T) {
+	var journalPath = filepath.Join(t.TempDir(), "ledger.journal")
+	var journal, _ = dao.OpenFileJournal(journalPath, false)
+	var transactionService, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), journal)
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 600})
+	transactionService.PutCatalogItem(context.Background(), &domain.CatalogItem{Id: "mug", Name: "Mug", Points: 250, Stock: 2})
+	var redemption, _ = transactionService.Redeem(context.Background(), &domain.RedemptionRequest{ItemId: "mug"})
+	transactionService.Close()
+
+	var reopened, _ = dao.OpenFileJournal(journalPath, false)
+	var restarted, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), reopened)
+	defer restarted.Close()
+	if mug, _ := restarted.GetCatalogItem(context.Background(), "mug"); mug.Stock != 1 {
+		t.Fatalf("Expected the restored stock to be 1 but was %d", mug.Stock)
+	}
+	if _, cancelErr := restarted.CancelRedemption(context.Background(), redemption.Id); cancelErr != nil {
+		t.Fatalf("Expected the restored redemption to be cancelled: %s", cancelErr)
+	}
+	expectPayerBalanceForTest(t, restarted, "DANNON", 600)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/service"
+)
+
+func newHttpServer(serverConfig config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr: serverConfig.HttpAddress,
+		Handler: handler,
+		ReadHeaderTimeout: time.Duration(serverConfig.ReadTimeout),
+		ReadTimeout: time.Duration(serverConfig.ReadTimeout),
+		WriteTimeout: time.Duration(serverConfig.WriteTimeout),
+		IdleTimeout: time.Duration(serverConfig.IdleTimeout),
+	}
+}
+
+// Serve requests from listener until ctx is done.  Readiness then flips to not ready for
+// drainDelay before the server stops accepting connections and gives the requests already in
+// flight until shutdownTimeout to complete before forcibly closing them.
+func serveUntilShutdown(ctx context.Context, server *http.Server, listener net.Listener, probes *Probes, drainDelay time.Duration, shutdownTimeout time.Duration, logger log.Logger) error {
+	var serveErrors = make(chan error, 1)
+	go func() {
+		serveErrors <- server.Serve(listener)
+	}()
+	select {
+	case serveErr := <-serveErrors:
+		return serveErr
+	case <-ctx.Done():
+	}
+	probes.MarkShuttingDown()
+	if drainDelay > 0 {
+		level.Info(logger).Log("msg", "Shutting down; reporting not ready before closing the listener", "delay", drainDelay)
+		time.Sleep(drainDelay)
+	}
+	level.Info(logger).Log("msg", "Shutting down; draining in-flight requests", "timeout", shutdownTimeout)
+	var shutdownContext, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownContext); shutdownErr != nil {
+		server.Close()
+		return shutdownErr
+	}
+	if serveErr := <-serveErrors; !errors.Is(serveErr, http.ErrServerClosed) {
+		return serveErr
+	}
+	return nil
+}
+
+// Run task in a goroutine that background waits for.
+func runInBackground(background *sync.WaitGroup, task func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		task()
+	}()
+}
+
+// Record the expiry of holds that outlived their TTL every interval until ctx is done.  Expired
+// holds stop reserving Points whether or not the sweep has run.
+func runHoldSweeper(ctx context.Context, transactionService *service.LocalTransactionService, interval time.Duration, logger log.Logger) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	var sweeperContext = auth.WithIdentity(ctx, &auth.Identity{Subject: "hold-sweeper"})
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, expireErr := transactionService.ExpireHolds(sweeperContext, now); expireErr != nil {
+				level.Error(logger).Log("msg", "Unable to expire holds", "err", expireErr)
+			}
+		}
+	}
+}
+
+func runExpirySweeper(ctx context.Context, transactionService *service.LocalTransactionService, interval time.Duration, logger log.Logger) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	// the sweeper is the actor of the expiries it audits
+	var sweeperContext = auth.WithIdentity(ctx, &auth.Identity{Subject: "expiry-sweeper"})
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, expireErr := transactionService.ExpirePoints(sweeperContext, now); expireErr != nil {
+				level.Error(logger).Log("msg", "Unable to expire points", "err", expireErr)
+			}
+		}
+	}
+}
+
+// Move Purchasers whose Points left the tier window to the tier they fell to every interval until
+// ctx is done.  Tiers shown and applied to Purchases are current whether or not the sweep has run.
+func runTierSweeper(ctx context.Context, transactionService *service.LocalTransactionService, interval time.Duration, logger log.Logger) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	var sweeperContext = auth.WithIdentity(ctx, &auth.Identity{Subject: "tier-sweeper"})
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, sweepErr := transactionService.SweepTiers(sweeperContext, now); sweepErr != nil {
+				level.Error(logger).Log("msg", "Unable to sweep tiers", "err", sweepErr)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"github.com/go-kit/kit/log"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func TestShutdownCompletesInFlightSpend(t *testing.T) {
+	var journalPath = filepath.Join(t.TempDir(), "ledger.journal")
+	var journal, _ = dao.OpenFileJournal(journalPath, false)
+	var transactionService, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), journal)
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Points: 300})
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "UNILEVER", Points: 200})
+	var application = NewApplication(transactionService)
+
+	// hold the spend inside the handler until shutdown has begun
+	var spendEntered = make(chan struct{})
+	var releaseSpend = make(chan struct{})
+	var router = application.NewRouter()
+	var handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rewards/spend" {
+			close(spendEntered)
+			<-releaseSpend
+		}
+		router.ServeHTTP(w, r)
+	})
+	var serverConfig = config.Default().Server
+	var server = newHttpServer(serverConfig, handler)
+	var listener, _ = net.Listen("tcp", "127.0.0.1:0")
+	var shutdownContext, beginShutdown = context.WithCancel(context.Background())
+	var serveResult = make(chan error, 1)
+	go func() {
+		serveResult <- serveUntilShutdown(shutdownContext, server, listener, NewProbes(), 0, 5 * time.Second, log.NewNopLogger())
+	}()
+
+	var spendResponse = make(chan *http.Response, 1)
+	var spendErrors = make(chan error, 1)
+	go func() {
+		var response, postErr = http.Post("http://" + listener.Addr().String() + "/rewards/spend", "application/json", strings.NewReader(`{"points": 400}`))
+		if postErr != nil {
+			spendErrors <- postErr
+			return
+		}
+		spendResponse <- response
+	}()
+	<-spendEntered
+	beginShutdown()
+
+	// new connections are refused while the spend is still being held
+	var refused = false
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if connection, dialErr := net.Dial("tcp", listener.Addr().String()); dialErr != nil {
+			refused = true
+			break
+		} else {
+			connection.Close()
+		}
+	}
+	if !refused {
+		t.Fatalf("Expected the listener to stop accepting connections once shutdown began")
+	}
+	select {
+	case serveErr := <-serveResult:
+		t.Fatalf("Expected shutdown to wait for the in-flight spend but it returned %v", serveErr)
+	default:
+	}
+
+	close(releaseSpend)
+	select {
+	case response := <-spendResponse:
+		if response.StatusCode != 200 {
+			t.Fatalf("Expected the in-flight spend to succeed but got HTTP %d", response.StatusCode)
+		}
+		response.Body.Close()
+	case postErr := <-spendErrors:
+		t.Fatalf("Expected the in-flight spend to complete but it failed: %s", postErr)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the in-flight spend")
+	}
+	if serveErr := <-serveResult; serveErr != nil {
+		t.Fatalf("Expected a clean shutdown but got %s", serveErr)
+	}
+	if closeErr := transactionService.Close(); closeErr != nil {
+		t.Fatalf("Expected storage to flush cleanly but got %s", closeErr)
+	}
+
+	var restartedJournal, _ = dao.OpenFileJournal(journalPath, false)
+	defer restartedJournal.Close()
+	var restarted, replayErr = service.NewLocalTransactionServiceWithJournal(context.Background(), restartedJournal)
+	if replayErr != nil {
+		t.Fatalf("Unable to replay the journal: %s", replayErr)
+	}
+	var dannon, _ = restarted.GetPointsProgressForPayer(context.Background(), "DANNON")
+	var unilever, _ = restarted.GetPointsProgressForPayer(context.Background(), "UNILEVER")
+	if dannon.Points != 0 || unilever.Points != 100 {
+		t.Fatalf("Expected the spend to be durable with balances 0 and 100 but found %d and %d", dannon.Points, unilever.Points)
+	}
+}
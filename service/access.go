@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+// Issues, revokes and authenticates the API keys callers present.
+type AccessService interface {
+	IssueApiKey(ctx context.Context, request *domain.ApiKey) (*domain.IssuedApiKey, error)
+	ListApiKeys(ctx context.Context) []*domain.ApiKey
+	RevokeApiKey(ctx context.Context, keyId string) (*domain.ApiKey, error)
+	// Identify the caller presenting key.
+	Authenticate(ctx context.Context, key string) (*auth.Identity, error)
+}
+
+type LocalAccessService struct {
+	lock sync.Mutex
+	keyStore dao.ApiKeysDao
+	transactionService *LocalTransactionService
+	// Hashes of keys from the configuration, which are never stored and so cannot be revoked.
+	bootstrapKeyHashes map[string]bool
+}
+
+// Build an access service issuing keys into keyStore; transactionService is consulted to check
+// that payer keys name a registered Payer.
+func NewLocalAccessService(keyStore dao.ApiKeysDao, transactionService *LocalTransactionService) *LocalAccessService {
+	return &LocalAccessService{
+		keyStore: keyStore,
+		transactionService: transactionService,
+		bootstrapKeyHashes: make(map[string]bool),
+	}
+}
+
+// Accept key as an administrator's key, so the first keys can be issued.
+func (s *LocalAccessService) AddBootstrapAdminKey(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.bootstrapKeyHashes[auth.HashApiKey(key)] = true
+}
+
+type InvalidApiKeyRequestError struct {
+	Reason string
+}
+
+func (e InvalidApiKeyRequestError) Error() string {
+	return fmt.Sprintf("Invalid API key request: %s", e.Reason)
+}
+
+// Returned for any key that does not authenticate, without saying why.
+type UnauthenticatedError struct {
+}
+
+func (e UnauthenticatedError) Error() string {
+	return "The API key is not valid"
+}
+
+func (s *LocalAccessService) IssueApiKey(ctx context.Context, request *domain.ApiKey) (*domain.IssuedApiKey, error) {
+	ctx, span := startSpan(ctx, "AccessService.IssueApiKey")
+	defer span.End()
+	switch request.Role {
+	case auth.RoleAdmin:
+	case auth.RolePayer:
+		if request.PayerId == "" {
+			return nil, InvalidApiKeyRequestError{"a payer key requires a payerId"}
+		}
+		if _, getErr := s.transactionService.GetPayer(ctx, request.PayerId); getErr != nil {
+			return nil, getErr
+		}
+	case auth.RolePurchaser:
+		if request.PurchaserId == "" {
+			return nil, InvalidApiKeyRequestError{"a purchaser key requires a purchaserId"}
+		}
+	default:
+		return nil, InvalidApiKeyRequestError{fmt.Sprintf("role must be %s, %s or %s", auth.RoleAdmin, auth.RolePayer, auth.RolePurchaser)}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var keyId, key = auth.GenerateApiKey()
+	var apiKey = &domain.ApiKey{
+		Id: keyId,
+		Name: request.Name,
+		Role: request.Role,
+		PayerId: request.PayerId,
+		PurchaserId: request.PurchaserId,
+		CreationTimestamp: time.Now(),
+	}
+	if addErr := s.keyStore.AddKey(ctx, apiKey, auth.HashApiKey(key)); addErr != nil {
+		return nil, recordSpanError(span, addErr)
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Issued API key", "key_id", keyId, "role", apiKey.Role, logging.PayerKey, apiKey.PayerId, logging.PurchaserKey, apiKey.PurchaserId)
+	return &domain.IssuedApiKey{ApiKey: apiKey, Key: key}, nil
+}
+
+func (s *LocalAccessService) ListApiKeys(ctx context.Context) []*domain.ApiKey {
+	ctx, span := startSpan(ctx, "AccessService.ListApiKeys")
+	defer span.End()
+	return s.keyStore.ListKeys(ctx)
+}
+
+func (s *LocalAccessService) RevokeApiKey(ctx context.Context, keyId string) (*domain.ApiKey, error) {
+	ctx, span := startSpan(ctx, "AccessService.RevokeApiKey")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var apiKey, _ = s.keyStore.GetKey(ctx, keyId)
+	if apiKey == nil {
+		return nil, dao.ApiKeyNotFoundError{KeyId: keyId}
+	}
+	if apiKey.RevokedTimestamp != nil {
+		return apiKey, nil
+	}
+	var revoked = *apiKey
+	var now = time.Now()
+	revoked.RevokedTimestamp = &now
+	if updateErr := s.keyStore.UpdateKey(ctx, &revoked); updateErr != nil {
+		return nil, recordSpanError(span, updateErr)
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Revoked API key", "key_id", keyId)
+	return &revoked, nil
+}
+
+func (s *LocalAccessService) Authenticate(ctx context.Context, key string) (*auth.Identity, error) {
+	ctx, span := startSpan(ctx, "AccessService.Authenticate")
+	defer span.End()
+	s.lock.Lock()
+	var isBootstrapKey = s.bootstrapKeyHashes[auth.HashApiKey(key)]
+	s.lock.Unlock()
+	if isBootstrapKey {
+		return &auth.Identity{Subject: "bootstrap", Roles: []string{auth.RoleAdmin}}, nil
+	}
+	var keyId, isWellFormed = auth.ApiKeyId(key)
+	if !isWellFormed {
+		return nil, UnauthenticatedError{}
+	}
+	var apiKey, keyHash = s.keyStore.GetKey(ctx, keyId)
+	if apiKey == nil || apiKey.RevokedTimestamp != nil || !auth.ApiKeyMatches(key, keyHash) {
+		return nil, UnauthenticatedError{}
+	}
+	return &auth.Identity{
+		Subject: apiKey.Id,
+		Roles: []string{apiKey.Role},
+		PayerId: apiKey.PayerId,
+		PurchaserId: apiKey.PurchaserId,
+	}, nil
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"purchase-tracker-service/domain"
+)
+
+// What a spend may draw on from one Payer: its balance, as the spender sees it, and the lots of
+// Points making it up.  The lots may hold more than Balance, since adjustments are not always
+// matched to them, but never less.
+type PayerFunds struct {
+	Payer string
+	Balance int
+	// Oldest first.
+	Lots []*FundsLot
+}
+
+type FundsLot struct {
+	Points int
+	Accumulated time.Time
+	// Zero when the Points never expire.
+	Expires time.Time
+}
+
+// Decides which Payers fund a spend.  Allocate is given no more points than the funds' balances
+// total and must divide exactly that many among the Payers, taking no more than its Balance from
+// any of them.
+type AllocationStrategy interface {
+	Name() string
+	Allocate(points int, funds []*PayerFunds) map[string]int
+}
+
+type InvalidSpendRequestError struct {
+	Reason string
+}
+
+func (e InvalidSpendRequestError) Error() string {
+	return fmt.Sprintf("Invalid spend request: %s", e.Reason)
+}
+
+// Find the strategy called name; payerPriority orders the Payers of the payer-priority strategy.
+func AllocationStrategyNamed(name string, payerPriority []string) (AllocationStrategy, error) {
+	switch name {
+	case domain.AllocationFifo:
+		return FifoAllocation{}, nil
+	case domain.AllocationSoonestExpiring:
+		return SoonestExpiringAllocation{}, nil
+	case domain.AllocationPayerPriority:
+		if len(payerPriority) == 0 {
+			return nil, InvalidSpendRequestError{"the payer-priority allocation requires a payerPriority list"}
+		}
+		return PayerPriorityAllocation{payerPriority}, nil
+	case domain.AllocationProportional:
+		return ProportionalAllocation{}, nil
+	case domain.AllocationLargestBalance:
+		return LargestBalanceAllocation{}, nil
+	default:
+		return nil, InvalidSpendRequestError{fmt.Sprintf("allocation must be one of %s but was '%s'", strings.Join(domain.AllocationNames(), ", "), name)}
+	}
+}
+
+// Draws on the oldest Points first, whichever Payer they were accumulated under.
+type FifoAllocation struct {
+}
+
+func (a FifoAllocation) Name() string {
+	return domain.AllocationFifo
+}
+
+func (a FifoAllocation) Allocate(points int, funds []*PayerFunds) map[string]int {
+	return allocateLots(points, funds, func(first *FundsLot, second *FundsLot) bool {
+		return first.Accumulated.Before(second.Accumulated)
+	})
+}
+
+// Draws on the Points that would expire soonest first, then those that never expire, oldest
+// first.  While every lot shares the configured Points lifetime this is the order of FIFO.
+type SoonestExpiringAllocation struct {
+}
+
+func (a SoonestExpiringAllocation) Name() string {
+	return domain.AllocationSoonestExpiring
+}
+
+func (a SoonestExpiringAllocation) Allocate(points int, funds []*PayerFunds) map[string]int {
+	return allocateLots(points, funds, func(first *FundsLot, second *FundsLot) bool {
+		if first.Expires.IsZero() != second.Expires.IsZero() {
+			return second.Expires.IsZero()
+		}
+		if !first.Expires.Equal(second.Expires) {
+			return first.Expires.Before(second.Expires)
+		}
+		return first.Accumulated.Before(second.Accumulated)
+	})
+}
+
+// Drains the Payers of Priority in turn, then any others oldest Points first.
+type PayerPriorityAllocation struct {
+	Priority []string
+}
+
+func (a PayerPriorityAllocation) Name() string {
+	return domain.AllocationPayerPriority
+}
+
+func (a PayerPriorityAllocation) Allocate(points int, funds []*PayerFunds) map[string]int {
+	var fundsByPayer = make(map[string]*PayerFunds)
+	for _, payerFunds := range funds {
+		fundsByPayer[payerFunds.Payer] = payerFunds
+	}
+	var allocation = make(map[string]int)
+	var drained = make(map[string]bool)
+	for _, payerId := range a.Priority {
+		var payerFunds, isKnown = fundsByPayer[payerId]
+		if !isKnown || drained[payerId] {
+			continue
+		}
+		drained[payerId] = true
+		var taken = minInt(payerFunds.Balance, points)
+		if taken > 0 {
+			allocation[payerId] = taken
+			points -= taken
+		}
+	}
+	var rest []*PayerFunds
+	for _, payerFunds := range funds {
+		if !drained[payerFunds.Payer] {
+			rest = append(rest, payerFunds)
+		}
+	}
+	for payerId, taken := range (FifoAllocation{}).Allocate(points, rest) {
+		allocation[payerId] += taken
+	}
+	return allocation
+}
+
+// Draws on every Payer in proportion to its balance; the Points left over by rounding down go to
+// the Payers whose shares were rounded down the most.
+type ProportionalAllocation struct {
+}
+
+func (a ProportionalAllocation) Name() string {
+	return domain.AllocationProportional
+}
+
+func (a ProportionalAllocation) Allocate(points int, funds []*PayerFunds) map[string]int {
+	var total = 0
+	for _, payerFunds := range funds {
+		total += payerFunds.Balance
+	}
+	var allocation = make(map[string]int)
+	if total <= 0 || points <= 0 {
+		return allocation
+	}
+	type share struct {
+		payer string
+		balance int
+		remainder int64
+	}
+	var shares []*share
+	var allocated = 0
+	for _, payerFunds := range funds {
+		if payerFunds.Balance <= 0 {
+			continue
+		}
+		var exact = int64(points) * int64(payerFunds.Balance)
+		var taken = int(exact / int64(total))
+		if taken > 0 {
+			allocation[payerFunds.Payer] = taken
+		}
+		allocated += taken
+		shares = append(shares, &share{payerFunds.Payer, payerFunds.Balance, exact % int64(total)})
+	}
+	sort.SliceStable(shares, func(i int, j int) bool {
+		if shares[i].remainder != shares[j].remainder {
+			return shares[i].remainder > shares[j].remainder
+		}
+		return shares[i].payer < shares[j].payer
+	})
+	for i := 0; allocated < points && i < len(shares); i++ {
+		if allocation[shares[i].payer] < shares[i].balance {
+			allocation[shares[i].payer]++
+			allocated++
+		}
+	}
+	return allocation
+}
+
+// Drains the Payer with the largest balance first.
+type LargestBalanceAllocation struct {
+}
+
+func (a LargestBalanceAllocation) Name() string {
+	return domain.AllocationLargestBalance
+}
+
+func (a LargestBalanceAllocation) Allocate(points int, funds []*PayerFunds) map[string]int {
+	var ordered = append([]*PayerFunds{}, funds...)
+	sort.SliceStable(ordered, func(i int, j int) bool {
+		if ordered[i].Balance != ordered[j].Balance {
+			return ordered[i].Balance > ordered[j].Balance
+		}
+		return ordered[i].Payer < ordered[j].Payer
+	})
+	var allocation = make(map[string]int)
+	for _, payerFunds := range ordered {
+		var taken = minInt(payerFunds.Balance, points)
+		if taken > 0 {
+			allocation[payerFunds.Payer] = taken
+			points -= taken
+		}
+	}
+	return allocation
+}
+
+// The funds spend may draw on: those of the Payers it includes, or all, less those it excludes,
+// with balances cut down to its caps.
+func restrictFunds(spend *domain.PointsSpendTransaction, funds []*PayerFunds) []*PayerFunds {
+	if !spend.IsRestricted() {
+		return funds
+	}
+	var included = make(map[string]bool)
+	for _, payerId := range spend.IncludePayers {
+		included[payerId] = true
+	}
+	var excluded = make(map[string]bool)
+	for _, payerId := range spend.ExcludePayers {
+		excluded[payerId] = true
+	}
+	var restricted []*PayerFunds
+	for _, payerFunds := range funds {
+		if excluded[payerFunds.Payer] || (len(included) > 0 && !included[payerFunds.Payer]) {
+			continue
+		}
+		if limit, isCapped := spend.PayerCaps[payerFunds.Payer]; isCapped && limit < payerFunds.Balance {
+			if limit == 0 {
+				continue
+			}
+			payerFunds = &PayerFunds{Payer: payerFunds.Payer, Balance: limit, Lots: payerFunds.Lots}
+		}
+		restricted = append(restricted, payerFunds)
+	}
+	return restricted
+}
+
+// Take points from the lots of funds in the order before sorts them, never more than a Payer's
+// balance.
+func allocateLots(points int, funds []*PayerFunds, before func(first *FundsLot, second *FundsLot) bool) map[string]int {
+	type payerLot struct {
+		payer *PayerFunds
+		lot *FundsLot
+	}
+	var lots []payerLot
+	for _, payerFunds := range funds {
+		for _, lot := range payerFunds.Lots {
+			lots = append(lots, payerLot{payerFunds, lot})
+		}
+	}
+	sort.SliceStable(lots, func(i int, j int) bool {
+		return before(lots[i].lot, lots[j].lot)
+	})
+	var allocation = make(map[string]int)
+	for _, candidate := range lots {
+		if points == 0 {
+			break
+		}
+		var available = candidate.payer.Balance - allocation[candidate.payer.Payer]
+		var taken = minInt(minInt(candidate.lot.Points, available), points)
+		if taken > 0 {
+			allocation[candidate.payer.Payer] += taken
+			points -= taken
+		}
+	}
+	// Lots should never fall short of a balance, but should they, the balance still counts.
+	for _, payerFunds := range funds {
+		var taken = minInt(payerFunds.Balance - allocation[payerFunds.Payer], points)
+		if taken > 0 {
+			allocation[payerFunds.Payer] += taken
+			points -= taken
+		}
+	}
+	return allocation
+}
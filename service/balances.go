@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/domain"
+)
+
+// Return the changes to the balances visible to the caller made after position, oldest first,
+// and the position of the latest Transaction, to resume from next time.  A negative position
+// returns no changes, only the latest position; one beyond the latest, such as a position from
+// before a restart that lost the ledger, starts over from the first Transaction.  A Purchaser sees
+// only the changes to its own Points.
+func (s *LocalTransactionService) GetBalanceChangesSince(ctx context.Context, position int) ([]*domain.BalanceChange, int) {
+	ctx, span := startSpan(ctx, "TransactionService.GetBalanceChangesSince", attribute.Int("ledger.position", position))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var latest = s.transactionsStore.Count(ctx)
+	if position < 0 {
+		return nil, latest
+	}
+	if position > latest {
+		position = 0
+	}
+	var purchaserId, isScoped = auth.PurchaserScope(ctx)
+	var changes []*domain.BalanceChange
+	for i, transaction := range s.transactionsStore.GetTransactionsAddedSince(ctx, position) {
+		if isScoped && transaction.Purchaser != purchaserId {
+			continue
+		}
+		changes = append(changes, &domain.BalanceChange{
+			Position: position + i + 1,
+			Payer: transaction.Payer,
+			Purchaser: transaction.Purchaser,
+			Kind: transaction.Kind,
+			Points: transaction.Points,
+			TransactionTimestamp: transaction.TransactionTimestamp,
+		})
+	}
+	// each balance is worked back from the current one through the changes made since
+	var balances = make(map[string]int)
+	for i := len(changes) - 1; i >= 0; i-- {
+		var balance, isKnown = balances[changes[i].Payer]
+		if !isKnown {
+			balance = s.getVisiblePointsForPayer(ctx, changes[i].Payer)
+		}
+		changes[i].Balance = balance
+		balances[changes[i].Payer] = balance - changes[i].Points
+	}
+	span.SetAttributes(attribute.Int("ledger.balance_changes", len(changes)))
+	return changes, latest
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+type InvalidCampaignError struct {
+	Reason string
+}
+
+func (e InvalidCampaignError) Error() string {
+	return fmt.Sprintf("Campaign is invalid: %s", e.Reason)
+}
+
+type CampaignNotFoundError struct {
+	CampaignId string
+}
+
+func (e CampaignNotFoundError) Error() string {
+	return fmt.Sprintf("Campaign was not found: %s", e.CampaignId)
+}
+
+type CampaignReversedError struct {
+	CampaignId string
+}
+
+func (e CampaignReversedError) Error() string {
+	return fmt.Sprintf("Campaign %s is already reversed", e.CampaignId)
+}
+
+// Start a campaign under the Payer it names; its Id is assigned.
+func (s *LocalTransactionService) CreateCampaign(ctx context.Context, campaign *domain.Campaign) (*domain.Campaign, error) {
+	ctx, span := startSpan(ctx, "TransactionService.CreateCampaign", payerAttribute.String(campaign.Payer))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var created, createErr = s.createCampaign(ctx, campaign, time.Now())
+	s.audit(ctx, domain.AuditActionCreateCampaign, campaign.Payer, campaign, createErr)
+	return created, recordSpanError(span, createErr)
+}
+
+func (s *LocalTransactionService) createCampaign(ctx context.Context, campaign *domain.Campaign, now time.Time) (*domain.Campaign, error) {
+	if s.payerStore.GetWithId(ctx, campaign.Payer) == nil {
+		return nil, PayerNotFoundError{campaign.Payer}
+	}
+	if validateErr := validateCampaign(campaign); validateErr != nil {
+		return nil, validateErr
+	}
+	var created = *campaign
+	created.Id = domain.NewIdentifier()
+	created.Name = strings.TrimSpace(campaign.Name)
+	created.Awarded = 0
+	created.CreationTimestamp = now
+	created.ReversedTimestamp = nil
+	if commitErr := s.commit(ctx, &dao.JournalRecord{Campaign: &created}); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Created campaign", "campaign_id", created.Id, logging.PayerKey, created.Payer, "start", created.StartTimestamp, "end", created.EndTimestamp)
+	return &created, nil
+}
+
+func validateCampaign(campaign *domain.Campaign) error {
+	switch {
+	case strings.TrimSpace(campaign.Name) == "":
+		return InvalidCampaignError{"name is required"}
+	case !campaign.StartTimestamp.Before(campaign.EndTimestamp):
+		return InvalidCampaignError{"startTimestamp must be before endTimestamp"}
+	case campaign.Multiplier != 0 && campaign.Multiplier < 1:
+		return InvalidCampaignError{"multiplier must be at least 1"}
+	case campaign.FlatBonus < 0:
+		return InvalidCampaignError{"flatBonus must not be negative"}
+	case campaign.Multiplier <= 1 && campaign.FlatBonus == 0:
+		return InvalidCampaignError{"a multiplier above 1 or a flat bonus is required"}
+	case campaign.Budget < 0:
+		return InvalidCampaignError{"budget must not be negative"}
+	}
+	if eligibility := campaign.Eligibility; eligibility != nil && (eligibility.MinimumPoints < 0 || eligibility.MinimumAmount < 0) {
+		return InvalidCampaignError{"eligibility minimums must not be negative"}
+	}
+	return nil
+}
+
+func (s *LocalTransactionService) ListCampaigns(ctx context.Context, payerId string) ([]*domain.Campaign, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ListCampaigns", payerAttribute.String(payerId))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if visibleErr := checkPayerVisible(ctx, payerId); visibleErr != nil {
+		return nil, recordSpanError(span, visibleErr)
+	}
+	if s.payerStore.GetWithId(ctx, payerId) == nil {
+		return nil, recordSpanError(span, PayerNotFoundError{payerId})
+	}
+	var awarded = s.bonusesAwarded(ctx)
+	var campaigns = []*domain.Campaign{}
+	for _, campaign := range s.campaignStore.ListForPayer(ctx, payerId) {
+		campaigns = append(campaigns, withAwarded(campaign, awarded))
+	}
+	return campaigns, nil
+}
+
+func (s *LocalTransactionService) GetCampaign(ctx context.Context, campaignId string) (*domain.Campaign, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetCampaign")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var campaign, findErr = s.findCampaign(ctx, campaignId)
+	if findErr != nil {
+		return nil, recordSpanError(span, findErr)
+	}
+	return withAwarded(campaign, s.bonusesAwarded(ctx)), nil
+}
+
+// Take back every bonus the campaign booked and stop it booking more.  Bonus Points already spent
+// cannot be taken back, so each holder gives back at most what it has left.
+func (s *LocalTransactionService) ReverseCampaign(ctx context.Context, campaignId string) (*domain.Campaign, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ReverseCampaign")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var campaign, reverseErr = s.reverseCampaign(ctx, campaignId, time.Now())
+	var payerId = ""
+	if campaign != nil {
+		payerId = campaign.Payer
+	}
+	s.audit(ctx, domain.AuditActionReverseCampaign, payerId, map[string]string{"campaignId": campaignId}, reverseErr)
+	return campaign, recordSpanError(span, reverseErr)
+}
+
+func (s *LocalTransactionService) reverseCampaign(ctx context.Context, campaignId string, now time.Time) (*domain.Campaign, error) {
+	var campaign, findErr = s.findCampaign(ctx, campaignId)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if campaign.ReversedTimestamp != nil {
+		return nil, CampaignReversedError{campaignId}
+	}
+	var bonusByHolder = make(map[pointsHolder]int)
+	for _, transaction := range s.transactionsStore.GetTransactionLog(ctx) {
+		if transaction.Kind == domain.TransactionKindBonus && transaction.CampaignId == campaignId {
+			bonusByHolder[holderOf(transaction)] += transaction.Points
+		}
+	}
+	var remainingByHolder = make(map[pointsHolder]int)
+	for _, lot := range buildPointsLots(s.getLogWith(ctx, s.heldTransactions(ctx, now))) {
+		remainingByHolder[holderOf(lot.transaction)] += lot.remaining
+	}
+	var reversed = *campaign
+	reversed.ReversedTimestamp = &now
+	var record = &dao.JournalRecord{Campaign: &reversed}
+	for holder, bonus := range bonusByHolder {
+		if points := minInt(bonus, remainingByHolder[holder]); points > 0 {
+			record.Transactions = append(record.Transactions, &domain.RewardTransaction{
+				Payer: holder.payer,
+				Purchaser: holder.purchaser,
+				Points: -points,
+				TransactionTimestamp: now,
+				Kind: domain.TransactionKindBonus,
+				CampaignId: campaignId,
+			})
+		}
+	}
+	if commitErr := s.commit(ctx, record); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Reversed campaign", "campaign_id", campaignId, logging.PayerKey, campaign.Payer, "holders", len(record.Transactions))
+	return withAwarded(&reversed, s.bonusesAwarded(ctx)), nil
+}
+
+// Look up a campaign the caller of ctx may see.
+func (s *LocalTransactionService) findCampaign(ctx context.Context, campaignId string) (*domain.Campaign, error) {
+	var campaign = s.campaignStore.GetCampaign(ctx, campaignId)
+	if campaign == nil || checkPayerVisible(ctx, campaign.Payer) != nil {
+		return nil, CampaignNotFoundError{campaignId}
+	}
+	return campaign, nil
+}
+
+// The bonuses the Payer's campaigns book for transaction, a Purchase recorded at its timestamp.
+// Each campaign's bonus is worked out from the Purchase's own Points, so campaigns do not compound.
+func (s *LocalTransactionService) campaignBonuses(ctx context.Context, transaction *domain.RewardTransaction) []*domain.RewardTransaction {
+	if transaction.Points <= 0 {
+		return nil
+	}
+	var bonuses []*domain.RewardTransaction
+	var awarded map[string]int
+	for _, campaign := range s.campaignStore.ListForPayer(ctx, transaction.Payer) {
+		if !campaign.IsActive(transaction.TransactionTimestamp) || !isEligible(campaign.Eligibility, transaction) {
+			continue
+		}
+		var bonus = campaign.FlatBonus
+		if campaign.Multiplier > 1 {
+			bonus += int(math.Floor(float64(transaction.Points) * (campaign.Multiplier - 1)))
+		}
+		if campaign.Budget > 0 {
+			if awarded == nil {
+				awarded = s.bonusesAwarded(ctx)
+			}
+			bonus = minInt(bonus, campaign.Budget - awarded[campaign.Id])
+		}
+		if bonus <= 0 {
+			continue
+		}
+		bonuses = append(bonuses, &domain.RewardTransaction{
+			Payer: transaction.Payer,
+			Purchaser: transaction.Purchaser,
+			Points: bonus,
+			TransactionTimestamp: transaction.TransactionTimestamp,
+			Kind: domain.TransactionKindBonus,
+			CampaignId: campaign.Id,
+		})
+	}
+	return bonuses
+}
+
+func isEligible(eligibility *domain.CampaignEligibility, transaction *domain.RewardTransaction) bool {
+	if eligibility == nil {
+		return true
+	}
+	if transaction.Points < eligibility.MinimumPoints || transaction.Amount < eligibility.MinimumAmount {
+		return false
+	}
+	if len(eligibility.Channels) > 0 && !containsString(eligibility.Channels, transaction.Channel) {
+		return false
+	}
+	if len(eligibility.Categories) > 0 {
+		for _, category := range transaction.Categories {
+			if containsString(eligibility.Categories, category) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// The bonus Points each campaign has booked, net of reversals.
+func (s *LocalTransactionService) bonusesAwarded(ctx context.Context) map[string]int {
+	var awarded = make(map[string]int)
+	for _, transaction := range s.transactionsStore.GetTransactionLog(ctx) {
+		if transaction.Kind == domain.TransactionKindBonus {
+			awarded[transaction.CampaignId] += transaction.Points
+		}
+	}
+	return awarded
+}
+
+// A copy of campaign reporting what it has booked, leaving the campaign as journaled untouched.
+func withAwarded(campaign *domain.Campaign, awarded map[string]int) *domain.Campaign {
+	var reported = *campaign
+	reported.Awarded = awarded[campaign.Id]
+	return &reported
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+type InvalidCatalogItemError struct {
+	Reason string
+}
+
+func (e InvalidCatalogItemError) Error() string {
+	return fmt.Sprintf("Catalog item is invalid: %s", e.Reason)
+}
+
+type CatalogItemNotFoundError struct {
+	ItemId string
+}
+
+func (e CatalogItemNotFoundError) Error() string {
+	return fmt.Sprintf("Catalog item was not found: %s", e.ItemId)
+}
+
+type ItemUnavailableError struct {
+	ItemId string
+	Reason string
+}
+
+func (e ItemUnavailableError) Error() string {
+	return fmt.Sprintf("Catalog item %s cannot be redeemed: %s", e.ItemId, e.Reason)
+}
+
+type RedemptionNotFoundError struct {
+	RedemptionId string
+}
+
+func (e RedemptionNotFoundError) Error() string {
+	return fmt.Sprintf("Redemption was not found: %s", e.RedemptionId)
+}
+
+type RedemptionCancelledError struct {
+	RedemptionId string
+}
+
+func (e RedemptionCancelledError) Error() string {
+	return fmt.Sprintf("Redemption %s is already cancelled", e.RedemptionId)
+}
+
+// Add item to the catalog or replace the item stored under its Id, keeping when it was created.
+func (s *LocalTransactionService) PutCatalogItem(ctx context.Context, item *domain.CatalogItem) (*domain.CatalogItem, error) {
+	ctx, span := startSpan(ctx, "TransactionService.PutCatalogItem")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var stored, putErr = s.putCatalogItem(ctx, item, time.Now())
+	s.audit(ctx, domain.AuditActionPutCatalogItem, "", item, putErr)
+	return stored, recordSpanError(span, putErr)
+}
+
+func (s *LocalTransactionService) putCatalogItem(ctx context.Context, item *domain.CatalogItem, now time.Time) (*domain.CatalogItem, error) {
+	if validateErr := s.validateCatalogItem(ctx, item); validateErr != nil {
+		return nil, validateErr
+	}
+	var stored = *item
+	stored.Name = strings.TrimSpace(item.Name)
+	stored.CreationTimestamp = now
+	if existing := s.catalogStore.GetItem(ctx, item.Id); existing != nil {
+		stored.CreationTimestamp = existing.CreationTimestamp
+	}
+	if commitErr := s.commit(ctx, &dao.JournalRecord{CatalogItem: &stored}); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Stored catalog item", "item_id", stored.Id, logging.PointsKey, stored.Points, "stock", stored.Stock)
+	return &stored, nil
+}
+
+func (s *LocalTransactionService) validateCatalogItem(ctx context.Context, item *domain.CatalogItem) error {
+	switch {
+	case item.Id == "":
+		return InvalidCatalogItemError{"id is required"}
+	case strings.TrimSpace(item.Name) == "":
+		return InvalidCatalogItemError{"name is required"}
+	case item.Points <= 0:
+		return InvalidCatalogItemError{"points must be positive"}
+	case item.Stock < 0:
+		return InvalidCatalogItemError{"stock must not be negative"}
+	case item.ActiveFrom != nil && item.ActiveUntil != nil && !item.ActiveFrom.Before(*item.ActiveUntil):
+		return InvalidCatalogItemError{"activeFrom must be before activeUntil"}
+	}
+	for _, payerId := range item.FundingPayers {
+		if s.payerStore.GetWithId(ctx, payerId) == nil {
+			return PayerNotFoundError{payerId}
+		}
+	}
+	return nil
+}
+
+func (s *LocalTransactionService) ListCatalogItems(ctx context.Context) []*domain.CatalogItem {
+	ctx, span := startSpan(ctx, "TransactionService.ListCatalogItems")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.catalogStore.ListItems(ctx)
+}
+
+func (s *LocalTransactionService) GetCatalogItem(ctx context.Context, itemId string) (*domain.CatalogItem, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetCatalogItem")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var item = s.catalogStore.GetItem(ctx, itemId)
+	if item == nil {
+		return nil, recordSpanError(span, CatalogItemNotFoundError{itemId})
+	}
+	return item, nil
+}
+
+// Redeem units of a catalog item, spending their Points from the item's funding Payers and taking
+// them out of stock in the same journal record, so neither happens without the other.
+func (s *LocalTransactionService) Redeem(ctx context.Context, request *domain.RedemptionRequest) (*domain.Redemption, error) {
+	ctx, span := startSpan(ctx, "TransactionService.Redeem")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var redemption, redeemErr = s.redeem(ctx, request, time.Now())
+	s.audit(ctx, domain.AuditActionRedeem, "", request, redeemErr)
+	return redemption, recordSpanError(span, redeemErr)
+}
+
+func (s *LocalTransactionService) redeem(ctx context.Context, request *domain.RedemptionRequest, now time.Time) (*domain.Redemption, error) {
+	var quantity = request.Quantity
+	if quantity == 0 {
+		quantity = 1
+	}
+	if quantity < 0 {
+		return nil, InvalidSpendRequestError{"quantity must be positive"}
+	}
+	var item = s.catalogStore.GetItem(ctx, request.ItemId)
+	if item == nil {
+		return nil, CatalogItemNotFoundError{request.ItemId}
+	}
+	if !item.IsActive(now) {
+		return nil, ItemUnavailableError{item.Id, "it is outside its active window"}
+	}
+	if item.Stock < quantity {
+		return nil, ItemUnavailableError{item.Id, fmt.Sprintf("only %d left in stock", item.Stock)}
+	}
+	var redemption = &domain.Redemption{
+		Id: domain.NewIdentifier(),
+		ItemId: item.Id,
+		Quantity: quantity,
+		Points: item.Points * quantity,
+		Status: domain.RedemptionStatusCompleted,
+		SpendId: domain.NewIdentifier(),
+		CreationTimestamp: now,
+	}
+	redemption.Purchaser, _ = auth.PurchaserScope(ctx)
+	var spend = &domain.PointsSpendTransaction{Points: redemption.Points, IncludePayers: item.FundingPayers}
+	var plan, planErr = s.planSpend(ctx, redemption.SpendId, spend, now)
+	if planErr != nil {
+		return nil, planErr
+	}
+	// an order is paid for in full or not at all
+	if plan.shortfall > 0 {
+		return nil, InsufficientPointsError{spend.Points, spend.Points - plan.shortfall}
+	}
+	for _, credit := range plan.credits {
+		redemption.Allocations = append(redemption.Allocations, &domain.PointsSpentAllocation{Payer: credit.Payer, Purchaser: credit.Purchaser, Points: -credit.Points})
+	}
+	var remaining = *item
+	remaining.Stock -= quantity
+	if expireErr := s.commitExpiries(ctx, plan.expiries); expireErr != nil {
+		return nil, expireErr
+	}
+	if commitErr := s.commit(ctx, &dao.JournalRecord{Transactions: plan.credits, CatalogItem: &remaining, Redemption: redemption}); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Redeemed catalog item", "redemption_id", redemption.Id, "item_id", item.Id, "quantity", quantity, logging.SpendIdKey, redemption.SpendId, logging.PointsKey, redemption.Points)
+	return redemption, nil
+}
+
+func (s *LocalTransactionService) GetRedemption(ctx context.Context, redemptionId string) (*domain.Redemption, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetRedemption")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var redemption, findErr = s.findRedemption(ctx, redemptionId)
+	return redemption, recordSpanError(span, findErr)
+}
+
+// Cancel a redemption, refunding its Points to the Payers and Purchasers that funded it and putting
+// its units back in stock.
+func (s *LocalTransactionService) CancelRedemption(ctx context.Context, redemptionId string) (*domain.Redemption, error) {
+	ctx, span := startSpan(ctx, "TransactionService.CancelRedemption")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var redemption, cancelErr = s.cancelRedemption(ctx, redemptionId, time.Now())
+	s.audit(ctx, domain.AuditActionCancelRedemption, "", map[string]string{"redemptionId": redemptionId}, cancelErr)
+	return redemption, recordSpanError(span, cancelErr)
+}
+
+func (s *LocalTransactionService) cancelRedemption(ctx context.Context, redemptionId string, now time.Time) (*domain.Redemption, error) {
+	var redemption, findErr = s.findRedemption(ctx, redemptionId)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if redemption.Status == domain.RedemptionStatusCancelled {
+		return nil, RedemptionCancelledError{redemptionId}
+	}
+	var cancelled = *redemption
+	cancelled.Status = domain.RedemptionStatusCancelled
+	cancelled.CancellationTimestamp = &now
+	var record = &dao.JournalRecord{Redemption: &cancelled}
+	for _, allocation := range redemption.Allocations {
+		record.Transactions = append(record.Transactions, &domain.RewardTransaction{
+			Payer: allocation.Payer,
+			Purchaser: allocation.Purchaser,
+			Points: allocation.Points,
+			TransactionTimestamp: now,
+			Kind: domain.TransactionKindRefund,
+			SpendId: redemption.SpendId,
+		})
+	}
+	if item := s.catalogStore.GetItem(ctx, redemption.ItemId); item != nil {
+		var restocked = *item
+		restocked.Stock += redemption.Quantity
+		record.CatalogItem = &restocked
+	}
+	if commitErr := s.commit(ctx, record); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Cancelled redemption", "redemption_id", redemption.Id, logging.SpendIdKey, redemption.SpendId, logging.PointsKey, redemption.Points)
+	return &cancelled, nil
+}
+
+// Look up a redemption the caller of ctx may see: any redemption for an unrestricted caller,
+// otherwise only those its Purchaser made.
+func (s *LocalTransactionService) findRedemption(ctx context.Context, redemptionId string) (*domain.Redemption, error) {
+	var redemption = s.catalogStore.GetRedemption(ctx, redemptionId)
+	if purchaserId, isScoped := auth.PurchaserScope(ctx); redemption == nil || (isScoped && redemption.Purchaser != purchaserId) {
+		return nil, RedemptionNotFoundError{redemptionId}
+	}
+	return redemption, nil
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+type InvalidEarningRulesError struct {
+	Reason string
+}
+
+func (e InvalidEarningRulesError) Error() string {
+	return fmt.Sprintf("Earning rules are invalid: %s", e.Reason)
+}
+
+type EarningRulesNotFoundError struct {
+	PayerId string
+}
+
+func (e EarningRulesNotFoundError) Error() string {
+	return fmt.Sprintf("Payer %s has no earning rules", e.PayerId)
+}
+
+type InvalidPurchaseError struct {
+	Reason string
+}
+
+func (e InvalidPurchaseError) Error() string {
+	return fmt.Sprintf("Purchase is invalid: %s", e.Reason)
+}
+
+// Replace the earning rules of the Payer rules names.
+func (s *LocalTransactionService) PutEarningRules(ctx context.Context, rules *domain.EarningRules) (*domain.EarningRules, error) {
+	ctx, span := startSpan(ctx, "TransactionService.PutEarningRules", payerAttribute.String(rules.Payer))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var stored, putErr = s.putEarningRules(ctx, rules, time.Now())
+	s.audit(ctx, domain.AuditActionPutEarningRules, rules.Payer, rules, putErr)
+	return stored, recordSpanError(span, putErr)
+}
+
+func (s *LocalTransactionService) putEarningRules(ctx context.Context, rules *domain.EarningRules, now time.Time) (*domain.EarningRules, error) {
+	if s.payerStore.GetWithId(ctx, rules.Payer) == nil {
+		return nil, PayerNotFoundError{rules.Payer}
+	}
+	if validateErr := validateEarningRules(rules); validateErr != nil {
+		return nil, validateErr
+	}
+	var stored = *rules
+	stored.Rates = make(map[string]*domain.EarningRate)
+	for currency, rate := range rules.Rates {
+		stored.Rates[strings.ToUpper(currency)] = rate
+	}
+	if stored.Rounding == "" {
+		stored.Rounding = domain.RoundingDown
+	}
+	stored.UpdatedTimestamp = now
+	if commitErr := s.commit(ctx, &dao.JournalRecord{EarningRules: &stored}); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Stored earning rules", logging.PayerKey, stored.Payer, "currencies", len(stored.Rates))
+	return &stored, nil
+}
+
+func validateEarningRules(rules *domain.EarningRules) error {
+	if len(rules.Rates) == 0 {
+		return InvalidEarningRulesError{"at least one currency rate is required"}
+	}
+	for currency, rate := range rules.Rates {
+		switch {
+		case strings.TrimSpace(currency) == "":
+			return InvalidEarningRulesError{"currency codes may not be empty"}
+		case rate == nil || rate.PointsPerUnit <= 0:
+			return InvalidEarningRulesError{fmt.Sprintf("the points per unit of %s must be positive", currency)}
+		case rate.MinimumAmount < 0:
+			return InvalidEarningRulesError{fmt.Sprintf("the minimum amount of %s must not be negative", currency)}
+		}
+	}
+	for category, multiplier := range rules.CategoryMultipliers {
+		if multiplier < 0 {
+			return InvalidEarningRulesError{fmt.Sprintf("the multiplier of category '%s' must not be negative", category)}
+		}
+	}
+	if rules.Rounding != "" && !isRounding(rules.Rounding) {
+		return InvalidEarningRulesError{fmt.Sprintf("rounding must be one of %s", strings.Join(domain.RoundingNames(), ", "))}
+	}
+	if rules.DailyCap < 0 {
+		return InvalidEarningRulesError{"the daily cap must not be negative"}
+	}
+	return nil
+}
+
+func isRounding(rounding string) bool {
+	for _, name := range domain.RoundingNames() {
+		if rounding == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *LocalTransactionService) GetEarningRules(ctx context.Context, payerId string) (*domain.EarningRules, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetEarningRules", payerAttribute.String(payerId))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if visibleErr := checkPayerVisible(ctx, payerId); visibleErr != nil {
+		return nil, recordSpanError(span, visibleErr)
+	}
+	var rules = s.earningRulesStore.GetRules(ctx, payerId)
+	if rules == nil {
+		return nil, recordSpanError(span, EarningRulesNotFoundError{payerId})
+	}
+	return rules, nil
+}
+
+// A Payer's integration may only see the rules and campaigns of its own Payer.
+func checkPayerVisible(ctx context.Context, payerId string) error {
+	if identity := auth.FromContext(ctx); identity != nil && identity.HasRole(auth.RolePayer) && !identity.HasRole(auth.RoleAdmin) && identity.PayerId != payerId {
+		return ForbiddenError{fmt.Sprintf("may not see the settings of payer '%s'", payerId)}
+	}
+	return nil
+}
+
+// Whether transaction asks for its Points to be earned by its Payer's rules.
+func earnsByRules(transaction *domain.RewardTransaction) bool {
+	return transaction.Amount != 0 || transaction.Currency != ""
+}
+
+// Work out the Points transaction earns by its Payer's rules as of now: the amount at the
+// currency's rate, times the largest multiplier of its categories, rounded, and then cut down to
+// what is left of the Purchaser's daily cap.
+func (s *LocalTransactionService) earnPoints(ctx context.Context, transaction *domain.RewardTransaction, now time.Time) (*domain.EarningBreakdown, error) {
+	switch {
+	case transaction.Points != 0:
+		return nil, InvalidPurchaseError{"points are earned from the amount and may not also be given"}
+	case transaction.Currency == "":
+		return nil, InvalidPurchaseError{"a currency is required with an amount"}
+	case transaction.Amount <= 0:
+		return nil, InvalidPurchaseError{"the amount must be positive"}
+	}
+	var rules = s.earningRulesStore.GetRules(ctx, transaction.Payer)
+	if rules == nil {
+		return nil, InvalidPurchaseError{fmt.Sprintf("payer '%s' has no earning rules", transaction.Payer)}
+	}
+	transaction.Currency = strings.ToUpper(transaction.Currency)
+	var rate = rules.Rates[transaction.Currency]
+	if rate == nil {
+		return nil, InvalidPurchaseError{fmt.Sprintf("payer '%s' does not earn in %s", transaction.Payer, transaction.Currency)}
+	}
+	var breakdown = &domain.EarningBreakdown{
+		Amount: transaction.Amount,
+		Currency: transaction.Currency,
+		PointsPerUnit: rate.PointsPerUnit,
+		Multiplier: 1,
+		Rounding: rules.Rounding,
+	}
+	for _, category := range transaction.Categories {
+		if multiplier, isKnown := rules.CategoryMultipliers[category]; isKnown && (breakdown.Category == "" || multiplier > breakdown.Multiplier) {
+			breakdown.Category = category
+			breakdown.Multiplier = multiplier
+		}
+	}
+	if transaction.Amount < rate.MinimumAmount {
+		breakdown.BelowMinimum = true
+	} else {
+		breakdown.Earned = roundPoints(transaction.Amount * rate.PointsPerUnit * breakdown.Multiplier, rules.Rounding)
+	}
+	breakdown.Points = breakdown.Earned
+	if rules.DailyCap > 0 {
+		var left = maxInt(rules.DailyCap - s.pointsEarnedOn(ctx, holderOf(transaction), now), 0)
+		breakdown.Points = minInt(breakdown.Earned, left)
+		breakdown.Capped = breakdown.Earned - breakdown.Points
+	}
+	return breakdown, nil
+}
+
+func roundPoints(points float64, rounding string) int {
+	// amounts are decimal, so products such as 10.1 * 10 are taken back to the nearest millionth
+	// before rounding rather than floored to 100
+	points = math.Round(points * 1e6) / 1e6
+	switch rounding {
+	case domain.RoundingUp:
+		return int(math.Ceil(points))
+	case domain.RoundingNearest:
+		return int(math.Round(points))
+	default:
+		return int(math.Floor(points))
+	}
+}
+
+// The Points holder earned by earning rules on the UTC day of now.
+func (s *LocalTransactionService) pointsEarnedOn(ctx context.Context, holder pointsHolder, now time.Time) int {
+	var day = now.UTC().Truncate(24 * time.Hour)
+	var earned = 0
+	for _, transaction := range s.transactionsStore.GetTransactionLog(ctx) {
+		if earnsByRules(transaction) && holderOf(transaction) == holder && !transaction.TransactionTimestamp.Before(day) {
+			earned += transaction.Points
+		}
+	}
+	return earned
+}
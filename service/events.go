@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+// Record the domain events of every change committed from now on in the outbox, for RelayOutbox to
+// publish.  Enable it before the first change whose events matter, as changes committed without it
+// emit none.
+func (s *LocalTransactionService) EnableOutbox() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.outboxEnabled = true
+}
+
+// Publishes one domain event, returning only once it has been handed on for good; an error leaves
+// it to be published again.
+type EventPublisher func(ctx context.Context, event *domain.DomainEvent) error
+
+// Publish the events of every committed change through publish, in the order they were committed,
+// until ctx is done.  The events of a change are journaled with it and only marked published once
+// publish has accepted every one of them, so each is published at least once, surviving crashes,
+// and possibly more than once; consumers discard those they have seen by event id.  A failed
+// publish or mark is retried after retryInterval.  Only one relay may run per service.
+func (s *LocalTransactionService) RelayOutbox(ctx context.Context, publish EventPublisher, retryInterval time.Duration) {
+	var logger = logging.FromContext(ctx)
+	for {
+		var relayErr = s.relayPendingEvents(ctx, publish)
+		if ctx.Err() != nil {
+			return
+		}
+		var wait <-chan time.Time
+		if relayErr != nil {
+			level.Warn(logger).Log("msg", "Unable to relay events; retrying", "retry_interval", retryInterval, "err", relayErr)
+			wait = time.After(retryInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.outboxChanged:
+		case <-wait:
+		}
+	}
+}
+
+func (s *LocalTransactionService) relayPendingEvents(ctx context.Context, publish EventPublisher) error {
+	for _, entry := range s.pendingOutboxEntries(ctx) {
+		for _, event := range entry.Events {
+			if publishErr := publish(ctx, event); publishErr != nil {
+				return publishErr
+			}
+		}
+		if markErr := s.markPublished(ctx, entry.Sequence); markErr != nil {
+			return markErr
+		}
+	}
+	return nil
+}
+
+// The number of committed events not yet published.
+func (s *LocalTransactionService) PendingEvents(ctx context.Context) int {
+	var pending = 0
+	for _, entry := range s.pendingOutboxEntries(ctx) {
+		pending += len(entry.Events)
+	}
+	return pending
+}
+
+func (s *LocalTransactionService) pendingOutboxEntries(ctx context.Context) []*dao.OutboxEntry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.outboxStore.PendingEntries(ctx)
+}
+
+func (s *LocalTransactionService) markPublished(ctx context.Context, sequence int64) error {
+	ctx, span := startSpan(ctx, "TransactionService.markPublished")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return recordSpanError(span, s.commit(ctx, &dao.JournalRecord{PublishedThrough: sequence}))
+}
+
+func (s *LocalTransactionService) signalOutbox() {
+	select {
+	case s.outboxChanged <- struct{}{}:
+	default:
+	}
+}
+
+// The domain events telling of the change record made: one per Payer, Purchase and expiry, and one
+// per spend or refund however many Payers funded it.
+func ledgerEvents(record *dao.JournalRecord) []*domain.DomainEvent {
+	var events []*domain.DomainEvent
+	var newEvent = func(eventType string, data interface{}) *domain.DomainEvent {
+		return &domain.DomainEvent{
+			Id: domain.NewIdentifier(),
+			Type: eventType,
+			Timestamp: record.Timestamp,
+			Data: data,
+		}
+	}
+	if record.Payer != nil {
+		events = append(events, newEvent(domain.EventTypePayerCreated, &domain.PayerCreated{Payer: record.Payer}))
+	}
+	if record.TierChange != nil {
+		events = append(events, newEvent(domain.EventTypeTierChanged, record.TierChange))
+	}
+	if record.CapAlert != nil {
+		events = append(events, newEvent(domain.EventTypePayerCapApproached, record.CapAlert))
+	}
+	var closed *domain.PurchaserClosed
+	if record.Purchaser != nil && record.Purchaser.Closure != nil {
+		closed = &domain.PurchaserClosed{
+			Purchaser: record.Purchaser.Id,
+			Disposition: record.Purchaser.Closure.Disposition,
+			Points: record.Purchaser.Closure.Points,
+			Allocations: []*domain.PointsSpentAllocation{},
+		}
+		events = append(events, newEvent(domain.EventTypePurchaserClosed, closed))
+	}
+	var transferred *domain.PointsTransferred
+	if record.Transfer != nil {
+		transferred = &domain.PointsTransferred{
+			TransferId: record.Transfer.Id,
+			From: record.Transfer.From,
+			To: record.Transfer.To,
+			Points: record.Transfer.Points,
+			Allocations: []*domain.PointsSpentAllocation{},
+		}
+		if record.Transfer.Status == domain.TransferStatusReversed {
+			transferred.From, transferred.To = record.Transfer.To, record.Transfer.From
+			transferred.Points = record.Transfer.ReversedPoints
+			transferred.Reversal = true
+		}
+		events = append(events, newEvent(domain.EventTypePointsTransferred, transferred))
+	}
+	var spendsById = make(map[string]*domain.PointsSpent)
+	var refundsById = make(map[string]*domain.PointsRefunded)
+	for _, transaction := range record.Transactions {
+		switch transaction.Kind {
+		case domain.TransactionKindSpend:
+			var spend, isKnown = spendsById[transaction.SpendId]
+			if !isKnown {
+				spend = &domain.PointsSpent{SpendId: transaction.SpendId}
+				spendsById[transaction.SpendId] = spend
+				events = append(events, newEvent(domain.EventTypePointsSpent, spend))
+			}
+			spend.Points -= transaction.Points
+			spend.Allocations = append(spend.Allocations, &domain.PointsSpentAllocation{
+				Payer: transaction.Payer,
+				Purchaser: transaction.Purchaser,
+				Points: -transaction.Points,
+			})
+		case domain.TransactionKindRefund:
+			var refund, isKnown = refundsById[transaction.SpendId]
+			if !isKnown {
+				refund = &domain.PointsRefunded{SpendId: transaction.SpendId}
+				refundsById[transaction.SpendId] = refund
+				events = append(events, newEvent(domain.EventTypePointsRefunded, refund))
+			}
+			refund.Points += transaction.Points
+			refund.Allocations = append(refund.Allocations, &domain.PointsSpentAllocation{
+				Payer: transaction.Payer,
+				Purchaser: transaction.Purchaser,
+				Points: transaction.Points,
+			})
+		case domain.TransactionKindBonus:
+			events = append(events, newEvent(domain.EventTypeBonusAwarded, &domain.BonusAwarded{
+				CampaignId: transaction.CampaignId,
+				Payer: transaction.Payer,
+				Purchaser: transaction.Purchaser,
+				Points: transaction.Points,
+			}))
+		case domain.TransactionKindForfeit, domain.TransactionKindPayout:
+			if closed != nil {
+				closed.Allocations = append(closed.Allocations, &domain.PointsSpentAllocation{
+					Payer: transaction.Payer,
+					Purchaser: transaction.Purchaser,
+					Points: -transaction.Points,
+				})
+			}
+		case domain.TransactionKindTransfer:
+			if transferred != nil && transaction.Points > 0 {
+				transferred.Allocations = append(transferred.Allocations, &domain.PointsSpentAllocation{
+					Payer: transaction.Payer,
+					Purchaser: transaction.Purchaser,
+					Points: transaction.Points,
+				})
+			}
+		case domain.TransactionKindExpiry:
+			events = append(events, newEvent(domain.EventTypePointsExpired, &domain.PointsExpired{
+				Payer: transaction.Payer,
+				Purchaser: transaction.Purchaser,
+				Points: -transaction.Points,
+			}))
+		default:
+			events = append(events, newEvent(domain.EventTypePurchaseRecorded, &domain.PurchaseRecorded{
+				Payer: transaction.Payer,
+				Purchaser: transaction.Purchaser,
+				Points: transaction.Points,
+				TransactionTimestamp: transaction.TransactionTimestamp,
+			}))
+		}
+	}
+	return events
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+// How long a hold reserves its Points when the spend policy does not say.
+const defaultHoldTtl = 15 * time.Minute
+
+type HoldNotFoundError struct {
+	HoldId string
+}
+
+func (e HoldNotFoundError) Error() string {
+	return fmt.Sprintf("Hold was not found: %s", e.HoldId)
+}
+
+type HoldNotActiveError struct {
+	HoldId string
+	Status string
+}
+
+func (e HoldNotActiveError) Error() string {
+	return fmt.Sprintf("Hold %s is %s and can no longer be captured or released", e.HoldId, e.Status)
+}
+
+// Reserve Points as spend would allocate them, without spending them yet.  The hold lasts for the
+// spend policy's hold TTL unless captured or released first.
+func (s *LocalTransactionService) HoldPoints(ctx context.Context, spend *domain.PointsSpendTransaction) (*domain.SpendHold, error) {
+	ctx, span := startSpan(ctx, "TransactionService.HoldPoints", pointsAttribute.Int(spend.Points))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var hold, holdErr = s.holdPoints(ctx, spend, time.Now())
+	s.audit(ctx, domain.AuditActionHoldPoints, "", spend, holdErr)
+	return hold, recordSpanError(span, holdErr)
+}
+
+func (s *LocalTransactionService) holdPoints(ctx context.Context, spend *domain.PointsSpendTransaction, now time.Time) (*domain.SpendHold, error) {
+	var holdId = domain.NewIdentifier()
+	var plan, planErr = s.planSpend(ctx, holdId, spend, now)
+	if planErr != nil {
+		return nil, planErr
+	}
+	var hold = &domain.SpendHold{
+		Id: holdId,
+		Status: domain.HoldStatusHeld,
+		Allocation: plan.strategy.Name(),
+		CreationTimestamp: now,
+		ExpiresTimestamp: now.Add(s.holdTtl()),
+	}
+	hold.Purchaser, _ = auth.PurchaserScope(ctx)
+	for _, credit := range plan.credits {
+		hold.Points -= credit.Points
+		hold.Allocations = append(hold.Allocations, &domain.HoldAllocation{Payer: credit.Payer, Purchaser: credit.Purchaser, Points: -credit.Points})
+	}
+	if hold.Points == 0 {
+		return nil, InsufficientPointsError{spend.Points, 0}
+	}
+	if expireErr := s.commitExpiries(ctx, plan.expiries); expireErr != nil {
+		return nil, expireErr
+	}
+	if commitErr := s.commit(ctx, &dao.JournalRecord{Hold: hold}); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Held points", "hold_id", hold.Id, logging.PointsKey, hold.Points, "expires", hold.ExpiresTimestamp)
+	return hold, nil
+}
+
+func (s *LocalTransactionService) GetHold(ctx context.Context, holdId string) (*domain.SpendHold, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetHold")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var hold, findErr = s.findHold(ctx, holdId)
+	return hold, recordSpanError(span, findErr)
+}
+
+// Spend the Points a hold reserved, from the same Payers and Purchasers it reserved them from.
+func (s *LocalTransactionService) CaptureHold(ctx context.Context, holdId string) (*domain.SpendHold, error) {
+	ctx, span := startSpan(ctx, "TransactionService.CaptureHold")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var hold, captureErr = s.settleHold(ctx, holdId, domain.HoldStatusCaptured, time.Now())
+	s.audit(ctx, domain.AuditActionCaptureHold, "", map[string]string{"holdId": holdId}, captureErr)
+	return hold, recordSpanError(span, captureErr)
+}
+
+// Give the Points a hold reserved back to the balances they were reserved from.
+func (s *LocalTransactionService) ReleaseHold(ctx context.Context, holdId string) (*domain.SpendHold, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ReleaseHold")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var hold, releaseErr = s.settleHold(ctx, holdId, domain.HoldStatusReleased, time.Now())
+	s.audit(ctx, domain.AuditActionReleaseHold, "", map[string]string{"holdId": holdId}, releaseErr)
+	return hold, recordSpanError(span, releaseErr)
+}
+
+// Record the expiry of every hold that outlived its TTL as of now.  Expired holds stop reserving
+// their Points as soon as they expire whether or not this has run; it keeps their state current.
+func (s *LocalTransactionService) ExpireHolds(ctx context.Context, now time.Time) ([]*domain.SpendHold, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ExpireHolds")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var expired []*domain.SpendHold
+	for _, hold := range s.holdStore.ListHeld(ctx) {
+		if hold.IsActive(now) {
+			continue
+		}
+		var settled = settledHold(hold, domain.HoldStatusExpired, now)
+		if commitErr := s.commit(ctx, &dao.JournalRecord{Hold: settled}); commitErr != nil {
+			s.audit(ctx, domain.AuditActionExpireHolds, "", map[string]time.Time{"now": now}, commitErr)
+			return expired, recordSpanError(span, commitErr)
+		}
+		level.Info(logging.FromContext(ctx)).Log("msg", "Expired hold", "hold_id", hold.Id, logging.PointsKey, hold.Points)
+		expired = append(expired, settled)
+	}
+	if len(expired) > 0 {
+		s.audit(ctx, domain.AuditActionExpireHolds, "", map[string]time.Time{"now": now}, nil)
+	}
+	return expired, nil
+}
+
+// Look up a hold the caller of ctx may see: any hold for an unrestricted caller, otherwise only
+// those its Purchaser placed.
+func (s *LocalTransactionService) findHold(ctx context.Context, holdId string) (*domain.SpendHold, error) {
+	var hold = s.holdStore.GetHold(ctx, holdId)
+	if purchaserId, isScoped := auth.PurchaserScope(ctx); hold == nil || (isScoped && hold.Purchaser != purchaserId) {
+		return nil, HoldNotFoundError{holdId}
+	}
+	return hold, nil
+}
+
+// Capture or release a hold as of now; capturing journals its spend with it.
+func (s *LocalTransactionService) settleHold(ctx context.Context, holdId string, status string, now time.Time) (*domain.SpendHold, error) {
+	var hold, findErr = s.findHold(ctx, holdId)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if !hold.IsActive(now) {
+		var holdStatus = hold.Status
+		if holdStatus == domain.HoldStatusHeld {
+			holdStatus = domain.HoldStatusExpired
+		}
+		return nil, HoldNotActiveError{holdId, holdStatus}
+	}
+	if status == domain.HoldStatusCaptured && hold.Purchaser != "" {
+		if purchaserErr := s.checkPurchaserMaySpend(ctx, hold.Purchaser); purchaserErr != nil {
+			return nil, purchaserErr
+		}
+	}
+	var settled = settledHold(hold, status, now)
+	var record = &dao.JournalRecord{Hold: settled}
+	if status == domain.HoldStatusCaptured {
+		settled.SpendId = domain.NewIdentifier()
+		for _, allocation := range hold.Allocations {
+			record.Transactions = append(record.Transactions, s.creditPayer(settled.SpendId, allocation.Payer, allocation.Purchaser, allocation.Points, now))
+		}
+	}
+	if commitErr := s.commit(ctx, record); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Settled hold", "hold_id", hold.Id, "status", status, logging.PointsKey, hold.Points)
+	return settled, nil
+}
+
+// A copy of hold in status as of now, leaving the hold as journaled untouched.
+func settledHold(hold *domain.SpendHold, status string, now time.Time) *domain.SpendHold {
+	var settled = *hold
+	settled.Status = status
+	settled.SettledTimestamp = &now
+	return &settled
+}
+
+func (s *LocalTransactionService) holdTtl() time.Duration {
+	if s.spendPolicy.HoldTtl > 0 {
+		return s.spendPolicy.HoldTtl
+	}
+	return defaultHoldTtl
+}
+
+// The Points every active hold reserves, as Transactions taking them from their holders so that
+// lots and expiries pass over them.
+func (s *LocalTransactionService) heldTransactions(ctx context.Context, now time.Time) []*domain.RewardTransaction {
+	var held []*domain.RewardTransaction
+	for _, hold := range s.holdStore.ListHeld(ctx) {
+		if !hold.IsActive(now) {
+			continue
+		}
+		for _, allocation := range hold.Allocations {
+			held = append(held, &domain.RewardTransaction{
+				Payer: allocation.Payer,
+				Purchaser: allocation.Purchaser,
+				Points: -allocation.Points,
+				TransactionTimestamp: hold.CreationTimestamp,
+			})
+		}
+	}
+	return held
+}
+
+// The Points under every Payer that active holds reserve from those the caller of ctx may see.
+func (s *LocalTransactionService) getVisibleHeldPoints(ctx context.Context, now time.Time) map[string]int {
+	var purchaserId, isScoped = auth.PurchaserScope(ctx)
+	var heldByPayer = make(map[string]int)
+	for _, held := range s.heldTransactions(ctx, now) {
+		if !isScoped || held.Purchaser == purchaserId {
+			heldByPayer[held.Payer] -= held.Points
+		}
+	}
+	return heldByPayer
+}
+
+// The Transaction Log followed by pending Transactions not yet recorded, such as holds and due
+// expiries, to work out lots as they will stand.
+func (s *LocalTransactionService) getLogWith(ctx context.Context, pending ...[]*domain.RewardTransaction) []*domain.RewardTransaction {
+	var txLog = append([]*domain.RewardTransaction{}, s.transactionsStore.GetTransactionLog(ctx)...)
+	for _, transactions := range pending {
+		txLog = append(txLog, transactions...)
+	}
+	return txLog
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+// The fraction of a Payer's cap at which it is alerted, when its limits name none.
+const defaultAlertThreshold = 0.9
+
+type InvalidPayerLimitsError struct {
+	Reason string
+}
+
+func (e InvalidPayerLimitsError) Error() string {
+	return fmt.Sprintf("Payer limits are invalid: %s", e.Reason)
+}
+
+type PayerLimitsNotFoundError struct {
+	PayerId string
+}
+
+func (e PayerLimitsNotFoundError) Error() string {
+	return fmt.Sprintf("Payer %s has no limits", e.PayerId)
+}
+
+// The limits of Payer PayerId refuse a purchase booking Points when only Available are left
+// under Limit.
+type PayerLimitExceededError struct {
+	PayerId string
+	// One of the PayerLimit constants.
+	Limit string
+	Points int
+	Available int
+}
+
+// The limits a purchase may exceed, as named by PayerLimitExceededError.
+const (
+	PayerLimitOutstanding = "maxOutstandingPoints"
+	PayerLimitPerPurchase = "maxPointsPerPurchase"
+	PayerLimitDaily = "dailyLimit"
+)
+
+func (e PayerLimitExceededError) Error() string {
+	return fmt.Sprintf("Payer %s funds only %d more points under its %s but the purchase books %d", e.PayerId, e.Available, e.Limit, e.Points)
+}
+
+// Replace the funding limits of the Payer limits names.
+func (s *LocalTransactionService) PutPayerLimits(ctx context.Context, limits *domain.PayerLimits) (*domain.PayerLimits, error) {
+	ctx, span := startSpan(ctx, "TransactionService.PutPayerLimits", payerAttribute.String(limits.Payer))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var stored, putErr = s.putPayerLimits(ctx, limits, time.Now())
+	s.audit(ctx, domain.AuditActionPutPayerLimits, limits.Payer, limits, putErr)
+	return stored, recordSpanError(span, putErr)
+}
+
+func (s *LocalTransactionService) putPayerLimits(ctx context.Context, limits *domain.PayerLimits, now time.Time) (*domain.PayerLimits, error) {
+	if s.payerStore.GetWithId(ctx, limits.Payer) == nil {
+		return nil, PayerNotFoundError{limits.Payer}
+	}
+	switch {
+	case limits.MaxOutstandingPoints < 0 || limits.MaxPointsPerPurchase < 0 || limits.DailyLimit < 0:
+		return nil, InvalidPayerLimitsError{"limits must not be negative"}
+	case limits.AlertThreshold < 0 || limits.AlertThreshold > 1:
+		return nil, InvalidPayerLimitsError{"the alert threshold must be a fraction between 0 and 1"}
+	}
+	var stored = *limits
+	if stored.AlertThreshold == 0 && stored.MaxOutstandingPoints > 0 {
+		stored.AlertThreshold = defaultAlertThreshold
+	}
+	stored.UpdatedTimestamp = now
+	if commitErr := s.commit(ctx, &dao.JournalRecord{PayerLimits: &stored}); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Stored payer limits", logging.PayerKey, stored.Payer, "max_outstanding_points", stored.MaxOutstandingPoints)
+	return &stored, nil
+}
+
+func (s *LocalTransactionService) GetPayerLimits(ctx context.Context, payerId string) (*domain.PayerLimits, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetPayerLimits", payerAttribute.String(payerId))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if visibleErr := checkPayerVisible(ctx, payerId); visibleErr != nil {
+		return nil, recordSpanError(span, visibleErr)
+	}
+	var limits = s.payerLimitsStore.GetLimits(ctx, payerId)
+	if limits == nil {
+		return nil, recordSpanError(span, PayerLimitsNotFoundError{payerId})
+	}
+	return limits, nil
+}
+
+// Check the Points the Transactions of a purchase book under payerId against its limits, and
+// work out whether they take its balance to the alert threshold of its cap.  Limits only hold back
+// purchases adding Points; adjustments taking them away are always accepted.
+func (s *LocalTransactionService) checkPayerLimits(ctx context.Context, payerId string, transactions []*domain.RewardTransaction, now time.Time) (*domain.PayerCapApproached, error) {
+	var limits = s.payerLimitsStore.GetLimits(ctx, payerId)
+	var booked = 0
+	for _, transaction := range transactions {
+		booked += transaction.Points
+	}
+	if limits == nil || booked <= 0 {
+		return nil, nil
+	}
+	if limits.MaxPointsPerPurchase > 0 && booked > limits.MaxPointsPerPurchase {
+		return nil, PayerLimitExceededError{payerId, PayerLimitPerPurchase, booked, limits.MaxPointsPerPurchase}
+	}
+	if limits.DailyLimit > 0 {
+		var left = maxInt(limits.DailyLimit - s.pointsBookedOn(ctx, payerId, now), 0)
+		if booked > left {
+			return nil, PayerLimitExceededError{payerId, PayerLimitDaily, booked, left}
+		}
+	}
+	if limits.MaxOutstandingPoints <= 0 {
+		return nil, nil
+	}
+	var outstanding = s.getPointsForPayer(ctx, payerId)
+	if left := maxInt(limits.MaxOutstandingPoints - outstanding, 0); booked > left {
+		return nil, PayerLimitExceededError{payerId, PayerLimitOutstanding, booked, left}
+	}
+	var threshold = int(math.Ceil(float64(limits.MaxOutstandingPoints) * limits.AlertThreshold))
+	if outstanding >= threshold || outstanding + booked < threshold {
+		return nil, nil
+	}
+	return &domain.PayerCapApproached{
+		Payer: payerId,
+		OutstandingPoints: outstanding + booked,
+		MaxOutstandingPoints: limits.MaxOutstandingPoints,
+		AlertThreshold: limits.AlertThreshold,
+		Timestamp: now,
+	}, nil
+}
+
+// The Points purchases and their bonuses booked under payerId on the UTC day of now.
+func (s *LocalTransactionService) pointsBookedOn(ctx context.Context, payerId string, now time.Time) int {
+	var day = now.UTC().Truncate(24 * time.Hour)
+	var booked = 0
+	for _, transaction := range s.transactionsStore.GetTransactionLog(ctx) {
+		var isBooked = transaction.Kind == domain.TransactionKindPurchase || transaction.Kind == domain.TransactionKindBonus
+		if isBooked && transaction.Payer == payerId && transaction.Points > 0 && !transaction.TransactionTimestamp.Before(day) {
+			booked += transaction.Points
+		}
+	}
+	return booked
+}
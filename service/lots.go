@@ -0,0 +1,125 @@
+package service
+
+import (
+	"sort"
+	"time"
+	"purchase-tracker-service/domain"
+)
+
+// Points are held by a Purchaser under a Payer; Points accumulated without naming a Purchaser
+// are held by the empty Purchaser.
+type pointsHolder struct {
+	payer string
+	purchaser string
+}
+
+func holderOf(transaction *domain.RewardTransaction) pointsHolder {
+	return pointsHolder{transaction.Payer, transaction.Purchaser}
+}
+
+// The still unspent remainder of a Transaction that accumulated Points.
+type pointsLot struct {
+	transaction *domain.RewardTransaction
+	remaining int
+}
+
+// When the lot's Points were first accumulated, which Points moved by a transfer keep.
+func (l *pointsLot) accumulated() time.Time {
+	return accumulatedAt(l.transaction)
+}
+
+func accumulatedAt(transaction *domain.RewardTransaction) time.Time {
+	if transaction.AccumulatedTimestamp != nil {
+		return *transaction.AccumulatedTimestamp
+	}
+	return transaction.TransactionTimestamp
+}
+
+// Work out what is left of every positive Transaction by letting each negative Transaction consume
+// the oldest remaining lots of the same holder first.  The log must be in Transaction Timestamp order;
+// the lots are returned oldest accumulated first.
+func buildPointsLots(txLog []*domain.RewardTransaction) []*pointsLot {
+	var lots []*pointsLot
+	var openLotsByHolder = make(map[pointsHolder][]*pointsLot)
+	for _, tx := range txLog {
+		var holder = holderOf(tx)
+		if tx.Points > 0 {
+			var lot = &pointsLot{tx, tx.Points}
+			lots = append(lots, lot)
+			openLotsByHolder[holder] = insertLot(openLotsByHolder[holder], lot)
+			continue
+		}
+		var pointsToConsume = -tx.Points
+		var openLots = openLotsByHolder[holder]
+		for pointsToConsume > 0 && len(openLots) > 0 {
+			var consumed = minInt(openLots[0].remaining, pointsToConsume)
+			openLots[0].remaining -= consumed
+			pointsToConsume -= consumed
+			if openLots[0].remaining == 0 {
+				openLots = openLots[1:]
+			}
+		}
+		openLotsByHolder[holder] = openLots
+	}
+	sort.SliceStable(lots, func(i int, j int) bool {
+		return lots[i].accumulated().Before(lots[j].accumulated())
+	})
+	return lots
+}
+
+// Insert lot among openLots, which are in the order they were accumulated; only transferred Points
+// arrive accumulated earlier than lots already open.
+func insertLot(openLots []*pointsLot, lot *pointsLot) []*pointsLot {
+	var position = len(openLots)
+	for position > 0 && openLots[position - 1].accumulated().After(lot.accumulated()) {
+		position--
+	}
+	openLots = append(openLots, nil)
+	copy(openLots[position + 1:], openLots[position:])
+	openLots[position] = lot
+	return openLots
+}
+
+// Total the remaining Points, by holder, of lots that have outlived lifetime as of now.
+func expiredPointsByHolder(lots []*pointsLot, lifetime time.Duration, now time.Time) map[pointsHolder]int {
+	var expired = make(map[pointsHolder]int)
+	for _, lot := range lots {
+		if lot.remaining > 0 && !lot.accumulated().Add(lifetime).After(now) {
+			expired[holderOf(lot.transaction)] += lot.remaining
+		}
+	}
+	return expired
+}
+
+// Divide the Points spent from a Payer among the Purchasers holding them, oldest lot first, so
+// that every Purchaser's balance stays in step with the Payer's.  The remaining lots of a Payer
+// always hold at least its balance, so no more than that may be divided.
+func splitAmongPurchasers(lots []*pointsLot, payerId string, points int) map[string]int {
+	var pointsByPurchaser = make(map[string]int)
+	for _, lot := range lots {
+		if points == 0 {
+			break
+		}
+		if lot.transaction.Payer != payerId || lot.remaining == 0 {
+			continue
+		}
+		var taken = minInt(lot.remaining, points)
+		pointsByPurchaser[lot.transaction.Purchaser] += taken
+		points -= taken
+	}
+	return pointsByPurchaser
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+type InvalidPurchaserError struct {
+	Reason string
+}
+
+func (e InvalidPurchaserError) Error() string {
+	return fmt.Sprintf("Purchaser Account is invalid: %s", e.Reason)
+}
+
+type PurchaserStatusError struct {
+	PurchaserId string
+	Status string
+}
+
+func (e PurchaserStatusError) Error() string {
+	return fmt.Sprintf("Purchaser %s is %s", e.PurchaserId, e.Status)
+}
+
+type PurchaserHoldsActiveError struct {
+	PurchaserId string
+	Holds int
+}
+
+func (e PurchaserHoldsActiveError) Error() string {
+	return fmt.Sprintf("Purchaser %s has %d active holds to capture or release first", e.PurchaserId, e.Holds)
+}
+
+// Register a Purchaser's account, active from now.
+func (s *LocalTransactionService) CreatePurchaser(ctx context.Context, purchaser *domain.PurchaserAccount) (*domain.PurchaserAccount, error) {
+	ctx, span := startSpan(ctx, "TransactionService.CreatePurchaser")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var created, createErr = s.createPurchaser(ctx, purchaser, time.Now())
+	s.audit(ctx, domain.AuditActionCreatePurchaser, "", purchaser, createErr)
+	return created, recordSpanError(span, createErr)
+}
+
+func (s *LocalTransactionService) createPurchaser(ctx context.Context, purchaser *domain.PurchaserAccount, now time.Time) (*domain.PurchaserAccount, error) {
+	if strings.TrimSpace(purchaser.Id) == "" {
+		return nil, InvalidPurchaserError{"id is required"}
+	}
+	if validateErr := validatePurchaser(purchaser); validateErr != nil {
+		return nil, validateErr
+	}
+	if s.purchaserStore.GetWithId(ctx, purchaser.Id) != nil {
+		return nil, dao.PurchaserExistsError{PurchaserId: purchaser.Id}
+	}
+	var created = &domain.PurchaserAccount{
+		Id: purchaser.Id,
+		Name: strings.TrimSpace(purchaser.Name),
+		Email: strings.TrimSpace(purchaser.Email),
+		Status: domain.PurchaserStatusActive,
+		CreationTimestamp: now,
+		UpdatedTimestamp: now,
+	}
+	if commitErr := s.commit(ctx, &dao.JournalRecord{Purchaser: created}); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Registered purchaser", logging.PurchaserKey, created.Id)
+	return created, nil
+}
+
+func validatePurchaser(purchaser *domain.PurchaserAccount) error {
+	if email := strings.TrimSpace(purchaser.Email); email != "" && !strings.Contains(email, "@") {
+		return InvalidPurchaserError{"email must be an email address"}
+	}
+	return nil
+}
+
+func (s *LocalTransactionService) ListPurchasers(ctx context.Context) []*domain.PurchaserAccount {
+	ctx, span := startSpan(ctx, "TransactionService.ListPurchasers")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var allPurchasers = s.purchaserStore.ListAllAccounts(ctx)
+	sort.Slice(allPurchasers, func(i int, j int) bool {
+		return allPurchasers[i].Id < allPurchasers[j].Id
+	})
+	return allPurchasers
+}
+
+// Look up a Purchaser's account; a Purchaser may only see its own.
+func (s *LocalTransactionService) GetPurchaser(ctx context.Context, purchaserId string) (*domain.PurchaserAccount, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetPurchaser")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if scopedId, isScoped := auth.PurchaserScope(ctx); isScoped && scopedId != purchaserId {
+		return nil, recordSpanError(span, ForbiddenError{fmt.Sprintf("may not see the account of purchaser '%s'", purchaserId)})
+	}
+	var purchaser, findErr = s.findPurchaser(ctx, purchaserId)
+	return purchaser, recordSpanError(span, findErr)
+}
+
+// Replace the name and email of a Purchaser's account.
+func (s *LocalTransactionService) UpdatePurchaser(ctx context.Context, purchaser *domain.PurchaserAccount) (*domain.PurchaserAccount, error) {
+	ctx, span := startSpan(ctx, "TransactionService.UpdatePurchaser")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var updated, updateErr = s.updatePurchaser(ctx, purchaser, time.Now())
+	s.audit(ctx, domain.AuditActionUpdatePurchaser, "", purchaser, updateErr)
+	return updated, recordSpanError(span, updateErr)
+}
+
+func (s *LocalTransactionService) updatePurchaser(ctx context.Context, purchaser *domain.PurchaserAccount, now time.Time) (*domain.PurchaserAccount, error) {
+	var existing, findErr = s.findPurchaser(ctx, purchaser.Id)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if existing.Status == domain.PurchaserStatusClosed {
+		return nil, PurchaserStatusError{existing.Id, existing.Status}
+	}
+	if validateErr := validatePurchaser(purchaser); validateErr != nil {
+		return nil, validateErr
+	}
+	var updated = *existing
+	updated.Name = strings.TrimSpace(purchaser.Name)
+	updated.Email = strings.TrimSpace(purchaser.Email)
+	updated.UpdatedTimestamp = now
+	if commitErr := s.commit(ctx, &dao.JournalRecord{Purchaser: &updated}); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Updated purchaser", logging.PurchaserKey, updated.Id)
+	return &updated, nil
+}
+
+// Stop an active Purchaser spending until it is reactivated; it keeps accumulating Points.
+func (s *LocalTransactionService) SuspendPurchaser(ctx context.Context, purchaserId string) (*domain.PurchaserAccount, error) {
+	ctx, span := startSpan(ctx, "TransactionService.SuspendPurchaser")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var suspended, suspendErr = s.changePurchaserStatus(ctx, purchaserId, domain.PurchaserStatusActive, domain.PurchaserStatusSuspended, time.Now())
+	s.audit(ctx, domain.AuditActionSuspendPurchaser, "", map[string]string{"purchaserId": purchaserId}, suspendErr)
+	return suspended, recordSpanError(span, suspendErr)
+}
+
+func (s *LocalTransactionService) ReactivatePurchaser(ctx context.Context, purchaserId string) (*domain.PurchaserAccount, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ReactivatePurchaser")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var reactivated, reactivateErr = s.changePurchaserStatus(ctx, purchaserId, domain.PurchaserStatusSuspended, domain.PurchaserStatusActive, time.Now())
+	s.audit(ctx, domain.AuditActionReactivatePurchaser, "", map[string]string{"purchaserId": purchaserId}, reactivateErr)
+	return reactivated, recordSpanError(span, reactivateErr)
+}
+
+func (s *LocalTransactionService) changePurchaserStatus(ctx context.Context, purchaserId string, from string, to string, now time.Time) (*domain.PurchaserAccount, error) {
+	var existing, findErr = s.findPurchaser(ctx, purchaserId)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if existing.Status != from {
+		return nil, PurchaserStatusError{existing.Id, existing.Status}
+	}
+	var changed = *existing
+	changed.Status = to
+	changed.UpdatedTimestamp = now
+	if commitErr := s.commit(ctx, &dao.JournalRecord{Purchaser: &changed}); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Changed purchaser status", logging.PurchaserKey, changed.Id, "status", to)
+	return &changed, nil
+}
+
+// Close a Purchaser's account for good, forfeiting or paying out the Points it holds under every
+// Payer as the purchaser policy says.  A Purchaser with active holds must see them settled first.
+func (s *LocalTransactionService) ClosePurchaser(ctx context.Context, purchaserId string) (*domain.PurchaserAccount, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ClosePurchaser")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var closed, closeErr = s.closePurchaser(ctx, purchaserId, time.Now())
+	s.audit(ctx, domain.AuditActionClosePurchaser, "", map[string]string{"purchaserId": purchaserId}, closeErr)
+	return closed, recordSpanError(span, closeErr)
+}
+
+func (s *LocalTransactionService) closePurchaser(ctx context.Context, purchaserId string, now time.Time) (*domain.PurchaserAccount, error) {
+	var existing, findErr = s.findPurchaser(ctx, purchaserId)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if existing.Status == domain.PurchaserStatusClosed {
+		return nil, PurchaserStatusError{existing.Id, existing.Status}
+	}
+	if holds := s.activeHoldsOf(ctx, purchaserId, now); holds > 0 {
+		return nil, PurchaserHoldsActiveError{purchaserId, holds}
+	}
+	if expireErr := s.commitExpiries(ctx, s.dueExpiries(ctx, now)); expireErr != nil {
+		return nil, expireErr
+	}
+	var pointsByPayer = make(map[string]int)
+	for _, lot := range buildPointsLots(s.transactionsStore.GetTransactionLog(ctx)) {
+		if lot.transaction.Purchaser == purchaserId {
+			pointsByPayer[lot.transaction.Payer] += lot.remaining
+		}
+	}
+	var closure = &domain.PurchaserClosure{Disposition: s.closureDisposition(), Timestamp: now}
+	var kind = domain.TransactionKindForfeit
+	if closure.Disposition == domain.ClosurePayout {
+		kind = domain.TransactionKindPayout
+	}
+	var closed = *existing
+	closed.Status = domain.PurchaserStatusClosed
+	closed.UpdatedTimestamp = now
+	closed.Closure = closure
+	var record = &dao.JournalRecord{Purchaser: &closed}
+	for _, payerId := range sortedKeys(pointsByPayer) {
+		if points := pointsByPayer[payerId]; points > 0 {
+			closure.Points += points
+			record.Transactions = append(record.Transactions, &domain.RewardTransaction{
+				Payer: payerId,
+				Purchaser: purchaserId,
+				Points: -points,
+				TransactionTimestamp: now,
+				Kind: kind,
+			})
+		}
+	}
+	if commitErr := s.commit(ctx, record); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Closed purchaser", logging.PurchaserKey, closed.Id, "disposition", closure.Disposition, logging.PointsKey, closure.Points)
+	return &closed, nil
+}
+
+func (s *LocalTransactionService) closureDisposition() string {
+	if s.purchaserPolicy.Closure == domain.ClosurePayout {
+		return domain.ClosurePayout
+	}
+	return domain.ClosureForfeit
+}
+
+// The number of holds, active as of now, reserving Points of purchaserId.
+func (s *LocalTransactionService) activeHoldsOf(ctx context.Context, purchaserId string, now time.Time) int {
+	var holds = 0
+	for _, hold := range s.holdStore.ListHeld(ctx) {
+		if !hold.IsActive(now) {
+			continue
+		}
+		for _, allocation := range hold.Allocations {
+			if allocation.Purchaser == purchaserId {
+				holds++
+				break
+			}
+		}
+	}
+	return holds
+}
+
+func (s *LocalTransactionService) findPurchaser(ctx context.Context, purchaserId string) (*domain.PurchaserAccount, error) {
+	var purchaser = s.purchaserStore.GetWithId(ctx, purchaserId)
+	if purchaser == nil {
+		return nil, dao.PurchaserNotFoundError{PurchaserId: purchaserId}
+	}
+	return purchaser, nil
+}
+
+// Only active Purchasers may spend; Purchasers without an account always may.
+func (s *LocalTransactionService) checkPurchaserMaySpend(ctx context.Context, purchaserId string) error {
+	if purchaser := s.purchaserStore.GetWithId(ctx, purchaserId); purchaser != nil && purchaser.Status != domain.PurchaserStatusActive {
+		return PurchaserStatusError{purchaserId, purchaser.Status}
+	}
+	return nil
+}
+
+// Closed Purchasers no longer accumulate Points.
+func (s *LocalTransactionService) checkPurchaserMayAccumulate(ctx context.Context, purchaserId string) error {
+	if purchaser := s.purchaserStore.GetWithId(ctx, purchaserId); purchaser != nil && purchaser.Status == domain.PurchaserStatusClosed {
+		return PurchaserStatusError{purchaserId, purchaser.Status}
+	}
+	return nil
+}
+
+func sortedKeys(values map[string]int) []string {
+	var keys = make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+type TiersNotConfiguredError struct{}
+
+func (e TiersNotConfiguredError) Error() string {
+	return "Purchasers are not tiered"
+}
+
+// Where the Purchaser stands among the tiers as of now.  A Purchaser may only see its own tier.
+func (s *LocalTransactionService) GetPurchaserTier(ctx context.Context, purchaserId string) (*domain.PurchaserTier, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetPurchaserTier")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if scopedId, isScoped := auth.PurchaserScope(ctx); isScoped && scopedId != purchaserId {
+		return nil, recordSpanError(span, ForbiddenError{fmt.Sprintf("may not see the tier of purchaser '%s'", purchaserId)})
+	}
+	if len(s.tierPolicy.Tiers) == 0 {
+		return nil, recordSpanError(span, TiersNotConfiguredError{})
+	}
+	return s.purchaserTier(ctx, purchaserId, time.Now()), nil
+}
+
+func (s *LocalTransactionService) purchaserTier(ctx context.Context, purchaserId string, now time.Time) *domain.PurchaserTier {
+	var qualifying = s.qualifyingTransactions(ctx, purchaserId, now)
+	var points = 0
+	for _, transaction := range qualifying {
+		points += transaction.Points
+	}
+	var index = s.tierIndexFor(points)
+	var tier = s.tierPolicy.Tiers[index]
+	var standing = &domain.PurchaserTier{
+		Purchaser: purchaserId,
+		Tier: tier.Name,
+		Multiplier: tier.Multiplier,
+		Points: points,
+		WindowStart: now.Add(-s.tierPolicy.Window),
+	}
+	if index + 1 < len(s.tierPolicy.Tiers) {
+		standing.NextTier = s.tierPolicy.Tiers[index + 1].Name
+		standing.PointsToNextTier = s.tierPolicy.Tiers[index + 1].MinimumPoints - points
+	}
+	// the oldest Points leave the window first; the tier lapses once what remains falls short
+	var remaining = points
+	for _, transaction := range qualifying {
+		if index == 0 {
+			break
+		}
+		if remaining -= transaction.Points; remaining < tier.MinimumPoints {
+			var expires = transaction.TransactionTimestamp.Add(s.tierPolicy.Window)
+			standing.ExpiresTimestamp = &expires
+			break
+		}
+	}
+	return standing
+}
+
+// The Purchases of purchaserId that accumulated Points within the window ending now, oldest first.
+func (s *LocalTransactionService) qualifyingTransactions(ctx context.Context, purchaserId string, now time.Time) []*domain.RewardTransaction {
+	var windowStart = now.Add(-s.tierPolicy.Window)
+	var qualifying []*domain.RewardTransaction
+	for _, transaction := range s.transactionsStore.GetTransactionLog(ctx) {
+		if transaction.Purchaser == purchaserId && transaction.Kind == domain.TransactionKindPurchase && transaction.Points > 0 &&
+			transaction.TransactionTimestamp.After(windowStart) && !transaction.TransactionTimestamp.After(now) {
+			qualifying = append(qualifying, transaction)
+		}
+	}
+	return qualifying
+}
+
+// The index of the highest tier points reach; the lowest tier needs none.
+func (s *LocalTransactionService) tierIndexFor(points int) int {
+	var index = 0
+	for i, tier := range s.tierPolicy.Tiers {
+		if points >= tier.MinimumPoints {
+			index = i
+		}
+	}
+	return index
+}
+
+// The tier purchaserId was last moved to; Purchasers never moved are in the lowest.
+func (s *LocalTransactionService) recordedTier(ctx context.Context, purchaserId string) string {
+	if tier, isKnown := s.tierStore.GetTier(ctx, purchaserId); isKnown {
+		return tier
+	}
+	return s.tierPolicy.Tiers[0].Name
+}
+
+// Apply the multiplier of the tier the Purchaser of transaction is in to its Points, and work out
+// whether the Points then move the Purchaser to another tier.
+func (s *LocalTransactionService) applyTier(ctx context.Context, transaction *domain.RewardTransaction) (*domain.TierEarning, *domain.TierChange) {
+	if len(s.tierPolicy.Tiers) == 0 || transaction.Purchaser == "" || transaction.Points <= 0 {
+		return nil, nil
+	}
+	var now = transaction.TransactionTimestamp
+	var standing = s.purchaserTier(ctx, transaction.Purchaser, now)
+	var earning = &domain.TierEarning{
+		Tier: standing.Tier,
+		Multiplier: standing.Multiplier,
+		BasePoints: transaction.Points,
+		Points: roundPoints(float64(transaction.Points) * standing.Multiplier, domain.RoundingDown),
+	}
+	transaction.Tier = standing.Tier
+	transaction.Points = earning.Points
+	var reached = s.tierPolicy.Tiers[s.tierIndexFor(standing.Points + transaction.Points)].Name
+	if previous := s.recordedTier(ctx, transaction.Purchaser); reached != previous {
+		return earning, &domain.TierChange{
+			Purchaser: transaction.Purchaser,
+			PreviousTier: previous,
+			Tier: reached,
+			Points: standing.Points + transaction.Points,
+			Timestamp: now,
+		}
+	}
+	return earning, nil
+}
+
+// Record the tier changes of every Purchaser whose tier, as of now, is not the one it was last
+// moved to, such as those whose Points left the window.  Tiers shown and applied to Purchases are
+// always current; this keeps the recorded tiers, and the events telling of them, current too.
+func (s *LocalTransactionService) SweepTiers(ctx context.Context, now time.Time) ([]*domain.TierChange, error) {
+	ctx, span := startSpan(ctx, "TransactionService.SweepTiers")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.tierPolicy.Tiers) == 0 {
+		return nil, nil
+	}
+	var purchasers = make(map[string]bool)
+	for _, purchaserId := range s.tierStore.ListPurchasers(ctx) {
+		purchasers[purchaserId] = true
+	}
+	for _, transaction := range s.transactionsStore.GetTransactionLog(ctx) {
+		if transaction.Purchaser != "" {
+			purchasers[transaction.Purchaser] = true
+		}
+	}
+	var changes []*domain.TierChange
+	for purchaserId := range purchasers {
+		var standing = s.purchaserTier(ctx, purchaserId, now)
+		var previous = s.recordedTier(ctx, purchaserId)
+		if standing.Tier == previous {
+			continue
+		}
+		var change = &domain.TierChange{Purchaser: purchaserId, PreviousTier: previous, Tier: standing.Tier, Points: standing.Points, Timestamp: now}
+		if commitErr := s.commit(ctx, &dao.JournalRecord{TierChange: change}); commitErr != nil {
+			s.audit(ctx, domain.AuditActionSweepTiers, "", map[string]time.Time{"now": now}, commitErr)
+			return changes, recordSpanError(span, commitErr)
+		}
+		level.Info(logging.FromContext(ctx)).Log("msg", "Changed tier", "purchaser", purchaserId, "previous_tier", previous, "tier", standing.Tier)
+		changes = append(changes, change)
+	}
+	if len(changes) > 0 {
+		s.audit(ctx, domain.AuditActionSweepTiers, "", map[string]time.Time{"now": now}, nil)
+	}
+	return changes, nil
+}
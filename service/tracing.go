@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"purchase-tracker-service/dao"
+)
+
+// Attributes ledger spans are tagged with, named like the fields ledger events are logged with.
+const (
+	payerAttribute = attribute.Key("ledger.payer")
+	pointsAttribute = attribute.Key("ledger.points")
+	spendIdAttribute = attribute.Key("ledger.spend_id")
+)
+
+// Spans of every service call; they are only recorded once a tracer provider is installed.
+var tracer = otel.Tracer("purchase-tracker-service/service")
+
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// Mark span failed when err is an error the service could not handle, passing err through.
+// Errors that only refuse a request, such as an unknown Payer, leave the span successful.
+func recordSpanError(span trace.Span, err error) error {
+	if err == nil {
+		return nil
+	}
+	if isRefusal(err) {
+		span.SetAttributes(attribute.String("ledger.refused", err.Error()))
+	} else {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// Whether err only refuses a request rather than reporting a failure of the service.
+func isRefusal(err error) bool {
+	switch err.(type) {
+	case PayerNotFoundError, InsufficientPointsError, RestrictedFundsError, ForbiddenError, UnauthenticatedError,
+		InvalidApiKeyRequestError, InvalidSpendRequestError, HoldNotFoundError, HoldNotActiveError,
+		InvalidCatalogItemError, CatalogItemNotFoundError, ItemUnavailableError, RedemptionNotFoundError, RedemptionCancelledError,
+		InvalidEarningRulesError, EarningRulesNotFoundError, InvalidPurchaseError,
+		InvalidCampaignError, CampaignNotFoundError, CampaignReversedError, TiersNotConfiguredError,
+		InvalidPurchaserError, PurchaserStatusError, PurchaserHoldsActiveError,
+		InvalidTransferError, TransferLimitError, TransferNotFoundError, TransferReversedError,
+		InvalidPayerLimitsError, PayerLimitsNotFoundError, PayerLimitExceededError,
+		dao.AccountExistsError, dao.ApiKeyNotFoundError, dao.PurchaserExistsError, dao.PurchaserNotFoundError:
+		return true
+	default:
+		return false
+	}
+}
@@ -1,62 +1,462 @@
 package service
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
-	"log"
-	"math"
+	"sort"
+	"sync"
 	"time"
 	"purchase-tracker-service/dao"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.opentelemetry.io/otel/attribute"
+	"purchase-tracker-service/auth"
 	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
 )
 
+// Every method takes the context of the request it serves; the logger it carries, see
+// logging.WithLogger, is what the service and the stores beneath it log ledger events with.
+// When ctx carries the identity of a Purchaser, see auth.WithIdentity, balances and spends are
+// restricted to the Points that Purchaser accumulated; a Payer's integration may only post
+// Purchases for its own Payer.
 type TransactionService interface {
-	AddPayer(id string, name string) error
+	AddPayer(ctx context.Context, id string, name string) error
+	// List every Payer known to the system.
+	ListPayers(ctx context.Context) []*domain.PayerAccount
+	// Look up a single Payer by its Id.
+	GetPayer(ctx context.Context, payerId string) (*domain.PayerAccount, error)
 	// Get the Current Points Balance/Progress for all known Payers.
-	GetAllPointsProgressesForPayers() []*domain.RewardsAccumulateProgress
+	GetAllPointsProgressesForPayers(ctx context.Context) []*domain.RewardsAccumulateProgress
 	// Get the Current Points Balance/Progress for a single Payer.
-	GetPointsProgressForPayer(payerId string) (*domain.RewardsAccumulateProgress, error)
-	// When a Purchaser makes a new Purchase, this will accumulate Points under a Payer.
-	ReceiveNewPurchase(transaction *domain.RewardTransaction) (*domain.RewardsAccumulateProgress, error)
+	GetPointsProgressForPayer(ctx context.Context, payerId string) (*domain.RewardsAccumulateProgress, error)
+	// When a Purchaser makes a new Purchase, this will accumulate Points under a Payer; a Purchase
+	// carrying an amount earns the Points its Payer's earning rules work out.
+	ReceiveNewPurchase(ctx context.Context, transaction *domain.RewardTransaction) (*domain.RewardsAccumulateProgress, error)
+	// Replace the rules by which a Payer's Purchases carrying an amount earn Points.
+	PutEarningRules(ctx context.Context, rules *domain.EarningRules) (*domain.EarningRules, error)
+	GetEarningRules(ctx context.Context, payerId string) (*domain.EarningRules, error)
+	// Replace the limits on the Points a Payer funds, which its Purchases are refused for exceeding.
+	PutPayerLimits(ctx context.Context, limits *domain.PayerLimits) (*domain.PayerLimits, error)
+	GetPayerLimits(ctx context.Context, payerId string) (*domain.PayerLimits, error)
+	// Start a campaign booking bonus Points for a Payer's Purchases while it runs.
+	CreateCampaign(ctx context.Context, campaign *domain.Campaign) (*domain.Campaign, error)
+	ListCampaigns(ctx context.Context, payerId string) ([]*domain.Campaign, error)
+	GetCampaign(ctx context.Context, campaignId string) (*domain.Campaign, error)
+	// Take back the bonuses a campaign booked and end it.
+	ReverseCampaign(ctx context.Context, campaignId string) (*domain.Campaign, error)
+	// Register a Purchaser's account.
+	CreatePurchaser(ctx context.Context, purchaser *domain.PurchaserAccount) (*domain.PurchaserAccount, error)
+	ListPurchasers(ctx context.Context) []*domain.PurchaserAccount
+	GetPurchaser(ctx context.Context, purchaserId string) (*domain.PurchaserAccount, error)
+	// Replace the name and email of a Purchaser's account.
+	UpdatePurchaser(ctx context.Context, purchaser *domain.PurchaserAccount) (*domain.PurchaserAccount, error)
+	// Stop a Purchaser spending, or let it spend again.
+	SuspendPurchaser(ctx context.Context, purchaserId string) (*domain.PurchaserAccount, error)
+	ReactivatePurchaser(ctx context.Context, purchaserId string) (*domain.PurchaserAccount, error)
+	// Close a Purchaser's account, settling the Points it holds as the purchaser policy says.
+	ClosePurchaser(ctx context.Context, purchaserId string) (*domain.PurchaserAccount, error)
+	// Move Points from one Purchaser to another, keeping their Payer and when they were accumulated.
+	TransferPoints(ctx context.Context, request *domain.TransferRequest) (*domain.PointsTransfer, error)
+	GetTransfer(ctx context.Context, transferId string) (*domain.PointsTransfer, error)
+	ListTransfers(ctx context.Context, purchaserId string) ([]*domain.PointsTransfer, error)
+	// Move what is left of a transfer's Points back to the giver.
+	ReverseTransfer(ctx context.Context, transferId string) (*domain.PointsTransfer, error)
+	// Where a Purchaser stands among the loyalty tiers: its tier, how far it is from the next and when
+	// its status lapses.
+	GetPurchaserTier(ctx context.Context, purchaserId string) (*domain.PurchaserTier, error)
+	// Record the tier every Purchaser has reached or fallen to as of now.
+	SweepTiers(ctx context.Context, now time.Time) ([]*domain.TierChange, error)
 	// Spend Points using internal allocation logic gather values from Partners' balances.
-	SpendPoints(numberOfPoints int) []*domain.RewardsSpendAllocation
+	SpendPoints(ctx context.Context, numberOfPoints int) ([]*domain.RewardsSpendAllocation, error)
+	// Spend Points, choosing the Payers that fund the spend by the allocation strategy it names.
+	Spend(ctx context.Context, spend *domain.PointsSpendTransaction) ([]*domain.RewardsSpendAllocation, error)
+	// Show what Spend would do right now without changing anything.
+	PreviewSpend(ctx context.Context, spend *domain.PointsSpendTransaction) (*domain.SpendPreview, error)
+	// Reserve Points as Spend would allocate them, to be captured or released later.
+	HoldPoints(ctx context.Context, spend *domain.PointsSpendTransaction) (*domain.SpendHold, error)
+	GetHold(ctx context.Context, holdId string) (*domain.SpendHold, error)
+	// Spend the Points a hold reserved.
+	CaptureHold(ctx context.Context, holdId string) (*domain.SpendHold, error)
+	// Free the Points a hold reserved.
+	ReleaseHold(ctx context.Context, holdId string) (*domain.SpendHold, error)
+	// Add an item to the reward catalog, or replace the item with the same Id.
+	PutCatalogItem(ctx context.Context, item *domain.CatalogItem) (*domain.CatalogItem, error)
+	ListCatalogItems(ctx context.Context) []*domain.CatalogItem
+	GetCatalogItem(ctx context.Context, itemId string) (*domain.CatalogItem, error)
+	// Spend the Points units of a catalog item cost and take them out of stock.
+	Redeem(ctx context.Context, request *domain.RedemptionRequest) (*domain.Redemption, error)
+	GetRedemption(ctx context.Context, redemptionId string) (*domain.Redemption, error)
+	// Refund a redemption's Points and return its units to stock.
+	CancelRedemption(ctx context.Context, redemptionId string) (*domain.Redemption, error)
+	// Book the expiry of every lot of Points that has outlived the Points lifetime as of now.
+	ExpirePoints(ctx context.Context, now time.Time) ([]*domain.RewardTransaction, error)
+	// Return every Transaction recorded so far in Transaction Timestamp order.
+	GetTransactionLog(ctx context.Context) []*domain.RewardTransaction
+	// Return the audit trail of state-changing calls that filter selects, in the order they were made.
+	ListAuditEntries(ctx context.Context, filter *domain.AuditFilter) []*domain.AuditEntry
+	// Capture the Payers and Transaction Log so they may be imported into another instance.
+	ExportLedger(ctx context.Context) *domain.LedgerExport
+	// Register the Payers and replay the Transactions of an export, keeping their timestamps.
+	ImportLedger(ctx context.Context, ledger *domain.LedgerExport) (*domain.LedgerImportResult, error)
+}
+
+// How a spend behaves when the Payers' balances cannot cover the requested Points.
+type SpendPolicy struct {
+	// Refuse the whole spend rather than spending whatever is available.
+	RejectShortfall bool
+	// Decides which Payers fund a spend not naming a strategy of its own; nil means FIFO.
+	Allocation AllocationStrategy
+	// How long a hold reserves its Points unless captured or released; zero means 15 minutes.
+	HoldTtl time.Duration
+}
+
+type ExpiryPolicy struct {
+	// How long Points remain spendable after the Transaction that accumulated them; zero means
+	// Points never expire.
+	PointsLifetime time.Duration
+}
+
+// The loyalty tiers Purchasers reach by the Points their Purchases accumulate within a rolling
+// window.  No tiers means Purchasers are not tiered.
+type TierPolicy struct {
+	Window time.Duration
+	// In order of MinimumPoints, the first needing none.
+	Tiers []domain.Tier
+}
+
+type PurchaserPolicy struct {
+	// What becomes of the Points of a Purchaser whose account closes: domain.ClosureForfeit, the
+	// default, or domain.ClosurePayout.
+	Closure string
+}
+
+// The limits on the Points a Purchaser may transfer; zero means unlimited.
+type TransferPolicy struct {
+	MaxPoints int
+	// The Points a Purchaser may give away each UTC day.
+	DailyLimit int
+}
+
+// A change just committed to the ledger, handed to commit observers such as metrics.
+type LedgerCommit struct {
+	Payer *domain.PayerAccount
+	Transactions []*domain.RewardTransaction
+	// Set when the commit took a Payer's balance to the alert threshold of its cap.
+	CapAlert *domain.PayerCapApproached
+	// Balances, after the commit, of every Payer the commit touched.
+	PointsByPayer map[string]int
+	TransactionLogSize int
 }
 
 type LocalTransactionService struct {
+	lock sync.Mutex
 	payerStore *dao.LocalPayerStore
 	transactionsStore *dao.LocalTransactionsStore
 	rewardsStore *dao.LocalRewardsStore
+	auditStore *dao.LocalAuditStore
+	outboxStore *dao.LocalOutboxStore
+	holdStore *dao.LocalHoldStore
+	catalogStore *dao.LocalCatalogStore
+	earningRulesStore *dao.LocalEarningRulesStore
+	payerLimitsStore *dao.LocalPayerLimitsStore
+	campaignStore *dao.LocalCampaignStore
+	tierStore *dao.LocalTierStore
+	purchaserStore *dao.LocalPurchaserStore
+	transferStore *dao.LocalTransferStore
+	journal dao.JournalDao
+	spendPolicy SpendPolicy
+	expiryPolicy ExpiryPolicy
+	tierPolicy TierPolicy
+	purchaserPolicy PurchaserPolicy
+	transferPolicy TransferPolicy
+	commitObservers []func(commit *LedgerCommit)
+	// Whether commits record their domain events in the outbox; see EnableOutbox.
+	outboxEnabled bool
+	// Signalled, without blocking, whenever events are added to the outbox; see RelayOutbox.
+	outboxChanged chan struct{}
 }
 
 func NewLocalTransactionService() *LocalTransactionService {
 	return &LocalTransactionService{
-		dao.NewLocalPayerStore(),
-		dao.NewLocalTransactionsStore(),
-		dao.NewLocalRewardsStore(),
+		payerStore: dao.NewLocalPayerStore(),
+		transactionsStore: dao.NewLocalTransactionsStore(),
+		rewardsStore: dao.NewLocalRewardsStore(),
+		auditStore: dao.NewLocalAuditStore(),
+		outboxStore: dao.NewLocalOutboxStore(),
+		holdStore: dao.NewLocalHoldStore(),
+		catalogStore: dao.NewLocalCatalogStore(),
+		earningRulesStore: dao.NewLocalEarningRulesStore(),
+		payerLimitsStore: dao.NewLocalPayerLimitsStore(),
+		campaignStore: dao.NewLocalCampaignStore(),
+		tierStore: dao.NewLocalTierStore(),
+		purchaserStore: dao.NewLocalPurchaserStore(),
+		transferStore: dao.NewLocalTransferStore(),
+		journal: dao.NewLocalJournal(),
+		outboxChanged: make(chan struct{}, 1),
+	}
+}
+
+// Build a service whose changes are recorded to journal, first replaying whatever the journal
+// already holds to restore the Payers and Transaction Log.
+func NewLocalTransactionServiceWithJournal(ctx context.Context, journal dao.JournalDao) (*LocalTransactionService, error) {
+	var s = NewLocalTransactionService()
+	s.journal = journal
+	var replayErr = journal.Replay(ctx, func(record *dao.JournalRecord) error {
+		return s.applyJournalRecord(ctx, record)
+	})
+	if replayErr != nil {
+		return nil, replayErr
+	}
+	return s, nil
+}
+
+func (s *LocalTransactionService) SetSpendPolicy(policy SpendPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.spendPolicy = policy
+}
+
+func (s *LocalTransactionService) SetExpiryPolicy(policy ExpiryPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.expiryPolicy = policy
+}
+
+func (s *LocalTransactionService) SetTierPolicy(policy TierPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tierPolicy = policy
+}
+
+func (s *LocalTransactionService) SetPurchaserPolicy(policy PurchaserPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.purchaserPolicy = policy
+}
+
+func (s *LocalTransactionService) SetTransferPolicy(policy TransferPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.transferPolicy = policy
+}
+
+// Force any buffered journal records to stable storage.
+func (s *LocalTransactionService) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.journal.Flush()
+}
+
+// Report why changes could not currently be made durable, if they could not.
+func (s *LocalTransactionService) CheckStorage() error {
+	return s.journal.Check()
+}
+
+// Flush and release the journal once no further changes will be made.
+func (s *LocalTransactionService) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.journal.Close()
+}
+
+func (s *LocalTransactionService) applyJournalRecord(ctx context.Context, record *dao.JournalRecord) error {
+	if record.Payer != nil {
+		if addErr := s.payerStore.AddAccount(ctx, record.Payer); addErr != nil {
+			return addErr
+		}
+	}
+	if record.Purchaser != nil {
+		var putErr error
+		if s.purchaserStore.GetWithId(ctx, record.Purchaser.Id) == nil {
+			putErr = s.purchaserStore.AddAccount(ctx, record.Purchaser)
+		} else {
+			putErr = s.purchaserStore.UpdateAccount(ctx, record.Purchaser)
+		}
+		if putErr != nil {
+			return putErr
+		}
+	}
+	for _, transaction := range record.Transactions {
+		s.addTransaction(ctx, transaction)
+	}
+	if record.Hold != nil {
+		s.holdStore.PutHold(ctx, record.Hold)
+	}
+	if record.CatalogItem != nil {
+		s.catalogStore.PutItem(ctx, record.CatalogItem)
+	}
+	if record.Redemption != nil {
+		s.catalogStore.PutRedemption(ctx, record.Redemption)
+	}
+	if record.EarningRules != nil {
+		s.earningRulesStore.PutRules(ctx, record.EarningRules)
+	}
+	if record.PayerLimits != nil {
+		s.payerLimitsStore.PutLimits(ctx, record.PayerLimits)
+	}
+	if record.Campaign != nil {
+		s.campaignStore.PutCampaign(ctx, record.Campaign)
+	}
+	if record.Transfer != nil {
+		s.transferStore.PutTransfer(ctx, record.Transfer)
+	}
+	if record.TierChange != nil {
+		s.tierStore.PutTierChange(ctx, record.TierChange)
+	}
+	if record.Audit != nil {
+		record.Audit.Sequence = record.Sequence
+		s.auditStore.AddEntry(ctx, record.Audit)
+	}
+	if len(record.Events) > 0 {
+		s.outboxStore.AddEntry(ctx, &dao.OutboxEntry{Sequence: record.Sequence, Events: record.Events})
+		s.signalOutbox()
+	}
+	if record.PublishedThrough > 0 {
+		s.outboxStore.MarkPublished(ctx, record.PublishedThrough)
+	}
+	return nil
+}
+
+// Register an observer of every change committed from now on.  Observers are called while the
+// service's lock is held, so they must not call back into the service.
+func (s *LocalTransactionService) AddCommitObserver(observer func(commit *LedgerCommit)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.commitObservers = append(s.commitObservers, observer)
+}
+
+// Journal a change, with the domain events it emits, and only once it is durable apply it to the
+// in-memory stores.
+func (s *LocalTransactionService) commit(ctx context.Context, record *dao.JournalRecord) error {
+	ctx, span := startSpan(ctx, "TransactionService.commit", attribute.Int("ledger.transactions", len(record.Transactions)))
+	defer span.End()
+	record.Timestamp = time.Now()
+	if s.outboxEnabled {
+		record.Events = ledgerEvents(record)
+	}
+	if appendErr := s.journal.Append(ctx, record); appendErr != nil {
+		return recordSpanError(span, appendErr)
+	}
+	if applyErr := s.applyJournalRecord(ctx, record); applyErr != nil {
+		return recordSpanError(span, applyErr)
+	}
+	s.notifyCommitObservers(ctx, record)
+	return nil
+}
+
+func (s *LocalTransactionService) notifyCommitObservers(ctx context.Context, record *dao.JournalRecord) {
+	if len(s.commitObservers) == 0 {
+		return
+	}
+	var commit = &LedgerCommit{
+		Payer: record.Payer,
+		Transactions: record.Transactions,
+		CapAlert: record.CapAlert,
+		PointsByPayer: make(map[string]int),
+		TransactionLogSize: s.transactionsStore.Count(ctx),
+	}
+	if record.Payer != nil {
+		commit.PointsByPayer[record.Payer.Id] = s.getPointsForPayer(ctx, record.Payer.Id)
+	}
+	for _, transaction := range record.Transactions {
+		commit.PointsByPayer[transaction.Payer] = s.getPointsForPayer(ctx, transaction.Payer)
+	}
+	for _, observer := range s.commitObservers {
+		observer(commit)
 	}
 }
 
-func (s *LocalTransactionService) AddPayer(id string, name string) error {
-	return s.payerStore.AddAccount(&domain.PayerAccount{
-		id,
-		name,
-		time.Now(),
+func (s *LocalTransactionService) AddPayer(ctx context.Context, id string, name string) error {
+	ctx, span := startSpan(ctx, "TransactionService.AddPayer", payerAttribute.String(id))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var addErr = s.addPayer(ctx, &domain.PayerAccount{
+		Id: id,
+		Name: name,
+		CreationTimestamp: time.Now(),
 	})
+	s.audit(ctx, domain.AuditActionAddPayer, id, &domain.PayerAccount{Id: id, Name: name}, addErr)
+	return recordSpanError(span, addErr)
 }
 
-func (s *LocalTransactionService) GetPointsProgressForPayer(payerId string) (*domain.RewardsAccumulateProgress, error) {
-	var payer = s.payerStore.GetWithId(payerId)
+func (s *LocalTransactionService) addPayer(ctx context.Context, payer *domain.PayerAccount) error {
+	if s.payerStore.GetWithId(ctx, payer.Id) != nil {
+		return dao.AccountExistsError{PayerId: payer.Id}
+	}
+	if commitErr := s.commit(ctx, &dao.JournalRecord{Payer: payer}); commitErr != nil {
+		return commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Registered payer", logging.PayerKey, payer.Id)
+	return nil
+}
+
+func (s *LocalTransactionService) ListPayers(ctx context.Context) []*domain.PayerAccount {
+	ctx, span := startSpan(ctx, "TransactionService.ListPayers")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.listPayers(ctx)
+}
+
+func (s *LocalTransactionService) listPayers(ctx context.Context) []*domain.PayerAccount {
+	var allPayers = s.payerStore.ListAllAccounts(ctx)
+	sort.Slice(allPayers, func(i int, j int) bool {
+		return allPayers[i].Id < allPayers[j].Id
+	})
+	return allPayers
+}
+
+func (s *LocalTransactionService) GetPayer(ctx context.Context, payerId string) (*domain.PayerAccount, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetPayer", payerAttribute.String(payerId))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var payer = s.payerStore.GetWithId(ctx, payerId)
 	if payer == nil {
 		return nil, PayerNotFoundError{payerId}
 	}
-	return s.getPointsProgressWithPayer(payer), nil
+	return payer, nil
+}
+
+func (s *LocalTransactionService) GetPointsProgressForPayer(ctx context.Context, payerId string) (*domain.RewardsAccumulateProgress, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetPointsProgressForPayer", payerAttribute.String(payerId))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var payer = s.payerStore.GetWithId(ctx, payerId)
+	if payer == nil {
+		return nil, PayerNotFoundError{payerId}
+	}
+	return s.getPointsProgressWithPayer(ctx, payer), nil
+}
+
+// Held Points are reported apart from, and are not part of, the Points available.
+func (s *LocalTransactionService) getPointsProgressWithPayer(ctx context.Context, payer *domain.PayerAccount) *domain.RewardsAccumulateProgress {
+	var held = s.getVisibleHeldPoints(ctx, time.Now())[payer.Id]
+	return &domain.RewardsAccumulateProgress{Payer: payer, Points: s.getVisiblePointsForPayer(ctx, payer.Id) - held, Held: held}
 }
 
-func (s *LocalTransactionService) getPointsProgressWithPayer(payer *domain.PayerAccount) *domain.RewardsAccumulateProgress {
-	return &domain.RewardsAccumulateProgress{payer, s.getPointsForPayer(payer.Id)}
+// The Points under a Payer the caller of ctx may see: those of its Purchaser, if it is restricted
+// to one, otherwise the Payer's whole balance.
+func (s *LocalTransactionService) getVisiblePointsForPayer(ctx context.Context, payerId string) int {
+	var purchaserId, isScoped = auth.PurchaserScope(ctx)
+	if !isScoped {
+		return s.getPointsForPayer(ctx, payerId)
+	}
+	var pointsForPurchaser = s.rewardsStore.GetPointsForPurchaser(ctx, purchaserId, payerId)
+	if pointsForPurchaser == nil {
+		return 0
+	}
+	return *pointsForPurchaser
 }
 
-func (s *LocalTransactionService) getPointsForPayer(payerId string) int {
-	var pointsForPayer = s.rewardsStore.GetPointsForPayer(payerId)
+func (s *LocalTransactionService) getPointsForPayer(ctx context.Context, payerId string) int {
+	var pointsForPayer = s.rewardsStore.GetPointsForPayer(ctx, payerId)
 	if pointsForPayer == nil {
 		return 0
 	} else {
@@ -64,101 +464,528 @@ func (s *LocalTransactionService) getPointsForPayer(payerId string) int {
 	}
 }
 
-func (s *LocalTransactionService) GetAllPointsProgressesForPayers() []*domain.RewardsAccumulateProgress {
-	var allPayers = s.payerStore.ListAllAccounts()
+func (s *LocalTransactionService) GetAllPointsProgressesForPayers(ctx context.Context) []*domain.RewardsAccumulateProgress {
+	ctx, span := startSpan(ctx, "TransactionService.GetAllPointsProgressesForPayers")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var allPayers = s.payerStore.ListAllAccounts(ctx)
 	var allProgresses []*domain.RewardsAccumulateProgress
 	for _, payer := range allPayers {
-		allProgresses = append(allProgresses, s.getPointsProgressWithPayer(payer))
+		allProgresses = append(allProgresses, s.getPointsProgressWithPayer(ctx, payer))
 	}
 	return allProgresses
 }
 
-func (s *LocalTransactionService) getAllPointsForPayers() map[string]int {
-	var allPayers = s.payerStore.ListAllAccounts()
+func (s *LocalTransactionService) getAllPointsForPayers(ctx context.Context) map[string]int {
+	var allPayers = s.payerStore.ListAllAccounts(ctx)
 	var pointsByPayer map[string]int = make(map[string]int)
 	for _, payer := range allPayers {
-		pointsByPayer[payer.Id] = s.getPointsForPayer(payer.Id)
+		pointsByPayer[payer.Id] = s.getVisiblePointsForPayer(ctx, payer.Id)
 	}
 	return pointsByPayer
 }
 
-func (s *LocalTransactionService) ReceiveNewPurchase(transaction *domain.RewardTransaction) (*domain.RewardsAccumulateProgress, error) {
-	var payer = s.payerStore.GetWithId(transaction.Payer)
+func (s *LocalTransactionService) ReceiveNewPurchase(ctx context.Context, transaction *domain.RewardTransaction) (*domain.RewardsAccumulateProgress, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ReceiveNewPurchase", payerAttribute.String(transaction.Payer), pointsAttribute.Int(transaction.Points))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var payloadHash = hashPayload(transaction)
+	var progress, purchaseErr = s.receiveNewPurchase(ctx, transaction)
+	s.auditWithHash(ctx, domain.AuditActionReceivePurchase, transaction.Payer, payloadHash, purchaseErr)
+	return progress, recordSpanError(span, purchaseErr)
+}
+
+func (s *LocalTransactionService) receiveNewPurchase(ctx context.Context, transaction *domain.RewardTransaction) (*domain.RewardsAccumulateProgress, error) {
+	if identity := auth.FromContext(ctx); identity != nil && !identity.HasRole(auth.RoleAdmin) {
+		if !identity.HasRole(auth.RolePayer) || identity.PayerId != transaction.Payer {
+			return nil, ForbiddenError{fmt.Sprintf("may not post purchases for payer '%s'", transaction.Payer)}
+		}
+	}
+	var payer = s.payerStore.GetWithId(ctx, transaction.Payer)
 	if payer == nil {
 		return nil, PayerNotFoundError{transaction.Payer}
 	}
+	if purchaserErr := s.checkPurchaserMayAccumulate(ctx, transaction.Purchaser); purchaserErr != nil {
+		return nil, purchaserErr
+	}
 	transaction.TransactionTimestamp = time.Now()
-	log.Printf("Adding Transaction %s", transaction)
-	s.addTransaction(transaction)
-	return s.getPointsProgressWithPayer(payer), nil
+	transaction.Kind = domain.TransactionKindPurchase
+	// these are only ever set by the ledger itself; taken from a caller they would let a purchase
+	// be backdated, or be mistaken for one side of a transfer, spend or campaign
+	transaction.SpendId = ""
+	transaction.CampaignId = ""
+	transaction.Tier = ""
+	transaction.TransferId = ""
+	transaction.AccumulatedTimestamp = nil
+	var earning *domain.EarningBreakdown
+	if earnsByRules(transaction) {
+		var earnErr error
+		if earning, earnErr = s.earnPoints(ctx, transaction, transaction.TransactionTimestamp); earnErr != nil {
+			return nil, earnErr
+		}
+		transaction.Points = earning.Points
+	}
+	var tierEarning, tierChange = s.applyTier(ctx, transaction)
+	// bonuses are booked as Transactions of their own, in the same record so they never go missing
+	var bonuses = s.campaignBonuses(ctx, transaction)
+	var booked = append([]*domain.RewardTransaction{transaction}, bonuses...)
+	// checked under the lock with everything the purchase books, so concurrent purchases cannot
+	// together exceed the Payer's limits
+	var capAlert, limitErr = s.checkPayerLimits(ctx, transaction.Payer, booked, transaction.TransactionTimestamp)
+	if limitErr != nil {
+		return nil, limitErr
+	}
+	if commitErr := s.commit(ctx, &dao.JournalRecord{Transactions: booked, TierChange: tierChange, CapAlert: capAlert}); commitErr != nil {
+		return nil, commitErr
+	}
+	if capAlert != nil {
+		level.Warn(logging.FromContext(ctx)).Log("msg", "Payer is nearing its cap on outstanding points", logging.PayerKey, capAlert.Payer, logging.PointsKey, capAlert.OutstandingPoints, "max_outstanding_points", capAlert.MaxOutstandingPoints)
+	}
+	level.Info(logging.WithTransaction(logging.FromContext(ctx), transaction)).Log("msg", "Received purchase", "bonuses", len(bonuses))
+	var progress = s.getPointsProgressWithPayer(ctx, payer)
+	progress.Earning = earning
+	progress.Tier = tierEarning
+	for _, bonus := range bonuses {
+		progress.Bonuses = append(progress.Bonuses, &domain.CampaignBonus{CampaignId: bonus.CampaignId, Points: bonus.Points})
+	}
+	return progress, nil
 }
 
-func (s *LocalTransactionService) creditPayer(payerId string, pointsToCredit int) {
-	log.Printf("Payer %s being credited %d", payerId, pointsToCredit)
-	s.addTransaction(&domain.RewardTransaction{
-		payerId,
-		-pointsToCredit,
-		time.Now(),
-	})
+func (s *LocalTransactionService) creditPayer(spendId string, payerId string, purchaserId string, pointsToCredit int, now time.Time) *domain.RewardTransaction {
+	return &domain.RewardTransaction{
+		Payer: payerId,
+		Purchaser: purchaserId,
+		Points: -pointsToCredit,
+		TransactionTimestamp: now,
+		Kind: domain.TransactionKindSpend,
+		SpendId: spendId,
+	}
 }
 
-func (s *LocalTransactionService) addTransaction(transaction *domain.RewardTransaction) {
-	s.transactionsStore.AddTransaction(transaction)
-	s.rewardsStore.AddTransaction(transaction)
-}
-
-// TODO: I do not recall instructions on how the service should behave if we are unable to grab
-//       the number of points requested from Payers.
-func (s *LocalTransactionService) SpendPoints(numberOfPoints int) []*domain.RewardsSpendAllocation {
-	var txLog = s.transactionsStore.GetTransactionLog()
-	var currentSpendBalance int = numberOfPoints
-	var currentBalances = s.getAllPointsForPayers()
-	var payerSpendAllocation map[string]int = make(map[string]int)
-	var payerSpendBalance map[string]int = make(map[string]int)
-	for payer, balance := range currentBalances {
-		payerSpendBalance[payer] = balance
-		payerSpendAllocation[payer] = 0
-	}
-	for _, tx := range txLog {
-		currentPayerBalance := payerSpendBalance[tx.Payer]
-		currentPayerAllocation := payerSpendAllocation[tx.Payer]
-		if tx.Points != 0 {
-			// we are applying points to a rewards to removing points from the reward
-			// depending on whether the transaction is a negative or positive.
-			amountToApply := int(math.Min(math.Min(float64(currentPayerBalance), float64(tx.Points)), float64(currentSpendBalance)))
-			// TODO: there is a logical issue in that there is mathematical borrowing happening from later transactions
-			// that needs to be discounted when later transactions are observed.
-			payerSpendBalance[tx.Payer] = currentPayerBalance - amountToApply
-			payerSpendAllocation[tx.Payer] = currentPayerAllocation + amountToApply
-			currentSpendBalance = currentSpendBalance - amountToApply
-			log.Printf("Apply %d points from Payer %s and resulting in a points allocation balance of %d", amountToApply, tx.Payer, currentSpendBalance)
-		}
-		if currentSpendBalance == 0 {
-			break
-		}
+func (s *LocalTransactionService) addTransaction(ctx context.Context, transaction *domain.RewardTransaction) {
+	s.transactionsStore.AddTransaction(ctx, transaction)
+	s.rewardsStore.AddTransaction(ctx, transaction)
+}
+
+func (s *LocalTransactionService) SpendPoints(ctx context.Context, numberOfPoints int) ([]*domain.RewardsSpendAllocation, error) {
+	return s.Spend(ctx, &domain.PointsSpendTransaction{Points: numberOfPoints})
+}
+
+func (s *LocalTransactionService) Spend(ctx context.Context, spend *domain.PointsSpendTransaction) ([]*domain.RewardsSpendAllocation, error) {
+	var spendId = domain.NewIdentifier()
+	ctx, span := startSpan(ctx, "TransactionService.SpendPoints", pointsAttribute.Int(spend.Points), spendIdAttribute.String(spendId))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var allocations, spendErr = s.spendPoints(ctx, spendId, spend)
+	s.audit(ctx, domain.AuditActionSpendPoints, "", spend, spendErr)
+	return allocations, recordSpanError(span, spendErr)
+}
+
+func (s *LocalTransactionService) spendPoints(ctx context.Context, spendId string, spend *domain.PointsSpendTransaction) ([]*domain.RewardsSpendAllocation, error) {
+	var plan, planErr = s.planSpend(ctx, spendId, spend, time.Now())
+	if planErr != nil {
+		return nil, planErr
+	}
+	if expireErr := s.commitExpiries(ctx, plan.expiries); expireErr != nil {
+		return nil, expireErr
 	}
 	// Now, we have to credit these payer accounts the amount of Points being spent here
-	s.creditPayerAccountsViaAllocation(payerSpendAllocation)
-	return s.buildRewardAllocations(payerSpendAllocation)
+	if creditErr := s.commit(ctx, &dao.JournalRecord{Transactions: plan.credits}); creditErr != nil {
+		return nil, creditErr
+	}
+	level.Info(log.With(logging.FromContext(ctx), logging.SpendIdKey, spendId)).Log("msg", "Spent points", logging.PointsKey, spend.Points, "allocation", plan.strategy.Name(), "shortfall", plan.shortfall)
+	return s.buildRewardAllocations(ctx, plan.allocation), nil
 }
 
-func (s *LocalTransactionService) creditPayerAccountsViaAllocation(spendAllocationByPayerId map[string]int) {
+func (s *LocalTransactionService) PreviewSpend(ctx context.Context, spend *domain.PointsSpendTransaction) (*domain.SpendPreview, error) {
+	ctx, span := startSpan(ctx, "TransactionService.PreviewSpend", pointsAttribute.Int(spend.Points))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var plan, planErr = s.planSpend(ctx, "", spend, time.Now())
+	if planErr != nil {
+		return nil, recordSpanError(span, planErr)
+	}
+	var preview = &domain.SpendPreview{
+		Points: spend.Points,
+		Allocation: plan.strategy.Name(),
+		Allocations: s.buildRewardAllocations(ctx, plan.allocation),
+		Shortfall: plan.shortfall,
+	}
+	for _, payer := range s.payerStore.ListAllAccounts(ctx) {
+		preview.Balances = append(preview.Balances, &domain.RewardsAccumulateProgress{
+			Payer: payer,
+			Points: plan.balances[payer.Id] - plan.allocation[payer.Id],
+			Held: plan.held[payer.Id],
+		})
+	}
+	return preview, nil
+}
+
+// A spend worked out against the ledger as it stands, ready to be committed.
+type spendPlan struct {
+	strategy AllocationStrategy
+	// The expiries due as of the spend, committed ahead of it.
+	expiries []*domain.RewardTransaction
+	// The balances available, as the spender sees them, once the expiries are booked.
+	balances map[string]int
+	// The Points held from the spender's balances, which are not available.
+	held map[string]int
+	allocation map[string]int
+	credits []*domain.RewardTransaction
+	shortfall int
+}
+
+// Work out, without changing anything, what spend would do as of now: the Points due to expire
+// first, which Payers fund it and the credits dividing each Payer's share among the Purchasers
+// holding it.  Spends and previews share it, so a preview shows exactly what a spend on the same
+// ledger does.
+func (s *LocalTransactionService) planSpend(ctx context.Context, spendId string, spend *domain.PointsSpendTransaction, now time.Time) (*spendPlan, error) {
+	if spend.Points <= 0 {
+		return nil, InvalidSpendRequestError{"points must be positive"}
+	}
+	var strategy, strategyErr = s.allocationStrategyFor(spend)
+	if strategyErr != nil {
+		return nil, strategyErr
+	}
+	if restrictionErr := s.checkRestrictions(ctx, spend); restrictionErr != nil {
+		return nil, restrictionErr
+	}
+	if purchaserId, isScoped := auth.PurchaserScope(ctx); isScoped {
+		if purchaserErr := s.checkPurchaserMaySpend(ctx, purchaserId); purchaserErr != nil {
+			return nil, purchaserErr
+		}
+	}
+	var logger = log.With(logging.FromContext(ctx), logging.SpendIdKey, spendId)
+	var plan = &spendPlan{strategy: strategy, expiries: s.dueExpiries(ctx, now)}
+	var lots = buildPointsLots(s.getLogWith(ctx, s.heldTransactions(ctx, now), plan.expiries))
+	plan.balances = s.getAllPointsForPayers(ctx)
+	plan.held = s.getVisibleHeldPoints(ctx, now)
+	for payerId, held := range plan.held {
+		plan.balances[payerId] -= held
+	}
+	var purchaserId, isScoped = auth.PurchaserScope(ctx)
+	for _, expiry := range plan.expiries {
+		if !isScoped || expiry.Purchaser == purchaserId {
+			plan.balances[expiry.Payer] += expiry.Points
+		}
+	}
+	var funds = restrictFunds(spend, s.getSpendableFunds(ctx, lots, plan.balances))
+	var availablePoints = 0
+	for _, payerFunds := range funds {
+		availablePoints += payerFunds.Balance
+	}
+	// a restricted spend is never partial, since what it falls short by cannot be made up elsewhere
+	if spend.IsRestricted() && availablePoints < spend.Points {
+		level.Info(logger).Log("msg", "Refused restricted spend", logging.PointsKey, spend.Points, "available", availablePoints)
+		return nil, RestrictedFundsError{spend.Points, availablePoints}
+	}
+	if s.spendPolicy.RejectShortfall && availablePoints < spend.Points {
+		level.Info(logger).Log("msg", "Refused spend", logging.PointsKey, spend.Points, "available", availablePoints)
+		return nil, InsufficientPointsError{spend.Points, availablePoints}
+	}
+	var _, allocateSpan = startSpan(ctx, "TransactionService.allocate", attribute.String("ledger.allocation", strategy.Name()), attribute.Int("ledger.payers", len(funds)))
+	plan.allocation = strategy.Allocate(minInt(spend.Points, availablePoints), funds)
+	for payerId, points := range plan.allocation {
+		level.Debug(logger).Log("msg", "Allocated points", logging.PayerKey, payerId, logging.PointsKey, points)
+	}
+	allocateSpan.End()
+	plan.shortfall = spend.Points - minInt(spend.Points, availablePoints)
+	plan.credits = s.creditPayerAccountsViaAllocation(ctx, spendId, lots, plan.allocation, now)
+	return plan, nil
+}
+
+// Every Payer a spend includes, excludes or caps must be known, and a cap may not be negative.
+func (s *LocalTransactionService) checkRestrictions(ctx context.Context, spend *domain.PointsSpendTransaction) error {
+	var named = append(append([]string{}, spend.IncludePayers...), spend.ExcludePayers...)
+	for payerId, limit := range spend.PayerCaps {
+		if limit < 0 {
+			return InvalidSpendRequestError{fmt.Sprintf("the cap on payer '%s' must not be negative", payerId)}
+		}
+		named = append(named, payerId)
+	}
+	for _, payerId := range named {
+		if s.payerStore.GetWithId(ctx, payerId) == nil {
+			return PayerNotFoundError{payerId}
+		}
+	}
+	return nil
+}
+
+// The strategy spend names, or else the configured one.
+func (s *LocalTransactionService) allocationStrategyFor(spend *domain.PointsSpendTransaction) (AllocationStrategy, error) {
+	if spend.Allocation != "" {
+		return AllocationStrategyNamed(spend.Allocation, spend.PayerPriority)
+	}
+	if s.spendPolicy.Allocation != nil {
+		return s.spendPolicy.Allocation, nil
+	}
+	return FifoAllocation{}, nil
+}
+
+// What a spend by the caller of ctx may draw on from every Payer with a balance: the Points of its
+// Purchaser, if it is restricted to one, otherwise the Payers' whole balances.
+func (s *LocalTransactionService) getSpendableFunds(ctx context.Context, lots []*pointsLot, balances map[string]int) []*PayerFunds {
+	var purchaserId, isScoped = auth.PurchaserScope(ctx)
+	var lotsByPayer = make(map[string][]*FundsLot)
+	for _, lot := range lots {
+		if lot.remaining == 0 || (isScoped && lot.transaction.Purchaser != purchaserId) {
+			continue
+		}
+		var fundsLot = &FundsLot{Points: lot.remaining, Accumulated: lot.accumulated()}
+		if s.expiryPolicy.PointsLifetime > 0 {
+			fundsLot.Expires = lot.accumulated().Add(s.expiryPolicy.PointsLifetime)
+		}
+		lotsByPayer[lot.transaction.Payer] = append(lotsByPayer[lot.transaction.Payer], fundsLot)
+	}
+	var funds []*PayerFunds
+	for _, payer := range s.payerStore.ListAllAccounts(ctx) {
+		if balance := balances[payer.Id]; balance > 0 {
+			funds = append(funds, &PayerFunds{Payer: payer.Id, Balance: balance, Lots: lotsByPayer[payer.Id]})
+		}
+	}
+	return funds
+}
+
+// The credits of a spend, journaled as one record so a spend is never left half applied.  A
+// Purchaser's spend is credited to that Purchaser's Points; any other spend is divided among the
+// Purchasers holding each Payer's Points.
+func (s *LocalTransactionService) creditPayerAccountsViaAllocation(ctx context.Context, spendId string, lots []*pointsLot, spendAllocationByPayerId map[string]int, now time.Time) []*domain.RewardTransaction {
+	var credits []*domain.RewardTransaction
+	var purchaserId, isScoped = auth.PurchaserScope(ctx)
 	for payerId, pointsSpent := range spendAllocationByPayerId {
-		s.creditPayer(payerId, pointsSpent)
+		if isScoped {
+			credits = append(credits, s.creditPayer(spendId, payerId, purchaserId, pointsSpent, now))
+			continue
+		}
+		var pointsByPurchaser = splitAmongPurchasers(lots, payerId, pointsSpent)
+		if len(pointsByPurchaser) == 0 {
+			credits = append(credits, s.creditPayer(spendId, payerId, "", pointsSpent, now))
+		}
+		for purchaser, points := range pointsByPurchaser {
+			credits = append(credits, s.creditPayer(spendId, payerId, purchaser, points, now))
+		}
 	}
+	return credits
 }
 
-func (s *LocalTransactionService) buildRewardAllocations(spendAllocationByPayerId map[string]int) []*domain.RewardsSpendAllocation {
+func (s *LocalTransactionService) buildRewardAllocations(ctx context.Context, spendAllocationByPayerId map[string]int) []*domain.RewardsSpendAllocation {
 	var payerAllocations []*domain.RewardsSpendAllocation
 	for payerId, pointsSpent := range spendAllocationByPayerId {
 		payerAllocations = append(payerAllocations, &domain.RewardsSpendAllocation{
-			s.payerStore.GetWithId(payerId),
-			-pointsSpent,
+			Payer: s.payerStore.GetWithId(ctx, payerId),
+			Points: -pointsSpent,
 		})
 	}
 	return payerAllocations
 }
 
+func (s *LocalTransactionService) ExpirePoints(ctx context.Context, now time.Time) ([]*domain.RewardTransaction, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ExpirePoints")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var expiries, expireErr = s.expirePoints(ctx, now)
+	// sweeps that found nothing to expire changed nothing and are not worth auditing
+	if len(expiries) > 0 || expireErr != nil {
+		s.audit(ctx, domain.AuditActionExpirePoints, "", map[string]time.Time{"now": now}, expireErr)
+	}
+	return expiries, recordSpanError(span, expireErr)
+}
+
+// Expiry Transactions consume the oldest lots of a Purchaser under a Payer just as spends do,
+// which are exactly the lots that have outlived the lifetime.
+func (s *LocalTransactionService) expirePoints(ctx context.Context, now time.Time) ([]*domain.RewardTransaction, error) {
+	var expiries = s.dueExpiries(ctx, now)
+	if commitErr := s.commitExpiries(ctx, expiries); commitErr != nil {
+		return nil, commitErr
+	}
+	return expiries, nil
+}
+
+// The expiries of every holder's lots that have outlived the Points lifetime as of now.
+func (s *LocalTransactionService) dueExpiries(ctx context.Context, now time.Time) []*domain.RewardTransaction {
+	if s.expiryPolicy.PointsLifetime <= 0 {
+		return nil
+	}
+	ctx, span := startSpan(ctx, "TransactionService.dueExpiries")
+	defer span.End()
+	// held Points are reserved and do not expire until released
+	var lots = buildPointsLots(s.getLogWith(ctx, s.heldTransactions(ctx, now)))
+	var expiries []*domain.RewardTransaction
+	for holder, points := range expiredPointsByHolder(lots, s.expiryPolicy.PointsLifetime, now) {
+		expiries = append(expiries, &domain.RewardTransaction{
+			Payer: holder.payer,
+			Purchaser: holder.purchaser,
+			Points: -points,
+			TransactionTimestamp: now,
+			Kind: domain.TransactionKindExpiry,
+		})
+	}
+	return expiries
+}
+
+func (s *LocalTransactionService) commitExpiries(ctx context.Context, expiries []*domain.RewardTransaction) error {
+	if len(expiries) == 0 {
+		return nil
+	}
+	if commitErr := s.commit(ctx, &dao.JournalRecord{Transactions: expiries}); commitErr != nil {
+		return commitErr
+	}
+	for _, expiry := range expiries {
+		level.Info(logging.WithTransaction(logging.FromContext(ctx), expiry)).Log("msg", "Expired points")
+	}
+	return nil
+}
+
+func (s *LocalTransactionService) GetTransactionLog(ctx context.Context) []*domain.RewardTransaction {
+	ctx, span := startSpan(ctx, "TransactionService.GetTransactionLog")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*domain.RewardTransaction{}, s.transactionsStore.GetTransactionLog(ctx)...)
+}
+
+func (s *LocalTransactionService) ListAuditEntries(ctx context.Context, filter *domain.AuditFilter) []*domain.AuditEntry {
+	ctx, span := startSpan(ctx, "TransactionService.ListAuditEntries")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.auditStore.ListEntries(ctx, filter)
+}
+
+func (s *LocalTransactionService) audit(ctx context.Context, action string, payerId string, payload interface{}, actionErr error) {
+	s.auditWithHash(ctx, action, payerId, hashPayload(payload), actionErr)
+}
+
+// Journal who attempted action and how it ended.  The entry follows the change it audits in its
+// own record; should it fail to be written the change stands, as the caller has been told it did,
+// and the failure is logged instead.
+func (s *LocalTransactionService) auditWithHash(ctx context.Context, action string, payerId string, payloadHash string, actionErr error) {
+	var entry = &domain.AuditEntry{
+		Timestamp: time.Now(),
+		Actor: "anonymous",
+		RequestId: logging.RequestId(ctx),
+		Action: action,
+		Payer: payerId,
+		PayloadHash: payloadHash,
+		Result: domain.AuditResultSucceeded,
+	}
+	if identity := auth.FromContext(ctx); identity != nil {
+		entry.Actor = identity.Subject
+		entry.Roles = identity.Roles
+	}
+	if actionErr != nil {
+		entry.Result = domain.AuditResultFailed
+		if isRefusal(actionErr) {
+			entry.Result = domain.AuditResultRefused
+		}
+		entry.Error = actionErr.Error()
+	}
+	if commitErr := s.commit(ctx, &dao.JournalRecord{Audit: entry}); commitErr != nil {
+		level.Error(logging.FromContext(ctx)).Log("msg", "Unable to record audit entry", "action", action, "err", commitErr)
+	}
+}
+
+func hashPayload(payload interface{}) string {
+	var encoded, _ = json.Marshal(payload)
+	var digest = sha256.Sum256(encoded)
+	return hex.EncodeToString(digest[:])
+}
+
+func (s *LocalTransactionService) ExportLedger(ctx context.Context) *domain.LedgerExport {
+	ctx, span := startSpan(ctx, "TransactionService.ExportLedger")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return &domain.LedgerExport{
+		Payers: s.listPayers(ctx),
+		Transactions: append([]*domain.RewardTransaction{}, s.transactionsStore.GetTransactionLog(ctx)...),
+		ExportTimestamp: time.Now(),
+	}
+}
+
+// Payers already registered, and Transactions already recorded, are left untouched so that an
+// export may be imported more than once; every Transaction must name a Payer that is either
+// registered or part of the same import.
+func (s *LocalTransactionService) ImportLedger(ctx context.Context, ledger *domain.LedgerExport) (*domain.LedgerImportResult, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ImportLedger", attribute.Int("ledger.transactions", len(ledger.Transactions)))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var payloadHash = hashPayload(ledger)
+	var result, importErr = s.importLedger(ctx, ledger)
+	s.auditWithHash(ctx, domain.AuditActionImportLedger, "", payloadHash, importErr)
+	return result, recordSpanError(span, importErr)
+}
+
+func (s *LocalTransactionService) importLedger(ctx context.Context, ledger *domain.LedgerExport) (*domain.LedgerImportResult, error) {
+	var result = &domain.LedgerImportResult{}
+	for _, transaction := range ledger.Transactions {
+		if s.payerStore.GetWithId(ctx, transaction.Payer) == nil && !ledger.HasPayer(transaction.Payer) {
+			return nil, PayerNotFoundError{transaction.Payer}
+		}
+	}
+	for _, payer := range ledger.Payers {
+		if s.payerStore.GetWithId(ctx, payer.Id) != nil {
+			result.PayersSkipped++
+			continue
+		}
+		if payer.CreationTimestamp.IsZero() {
+			payer.CreationTimestamp = time.Now()
+		}
+		if addError := s.addPayer(ctx, payer); addError != nil {
+			return nil, addError
+		}
+		result.PayersAdded++
+	}
+	var recorded = make(map[string]bool)
+	for _, transaction := range s.transactionsStore.GetTransactionLog(ctx) {
+		recorded[transactionIdentity(transaction)] = true
+	}
+	var imported []*domain.RewardTransaction
+	for _, transaction := range ledger.Transactions {
+		if transaction.TransactionTimestamp.IsZero() {
+			transaction.TransactionTimestamp = time.Now()
+		}
+		if transaction.Kind == "" {
+			transaction.Kind = domain.TransactionKindPurchase
+		}
+		var identity = transactionIdentity(transaction)
+		if recorded[identity] {
+			result.TransactionsSkipped++
+			continue
+		}
+		recorded[identity] = true
+		imported = append(imported, transaction)
+	}
+	if len(imported) > 0 {
+		if commitErr := s.commit(ctx, &dao.JournalRecord{Transactions: imported}); commitErr != nil {
+			return nil, commitErr
+		}
+	}
+	result.TransactionsAdded = len(imported)
+	level.Info(logging.FromContext(ctx)).Log("msg", "Imported ledger", "payers", result.PayersAdded, "transactions", result.TransactionsAdded)
+	return result, nil
+}
+
+// What tells a Transaction apart from every other; Transactions have no id of their own, but no
+// two recorded share all of these.
+func transactionIdentity(transaction *domain.RewardTransaction) string {
+	var kind = transaction.Kind
+	if kind == "" {
+		kind = domain.TransactionKindPurchase
+	}
+	var accumulated int64
+	if transaction.AccumulatedTimestamp != nil {
+		accumulated = transaction.AccumulatedTimestamp.UnixNano()
+	}
+	return fmt.Sprintf("%s|%s|%s|%d|%d|%d|%s|%s|%s", kind, transaction.Payer, transaction.Purchaser, transaction.Points, transaction.TransactionTimestamp.UnixNano(), accumulated, transaction.SpendId, transaction.TransferId, transaction.CampaignId)
+}
+
 type PayerNotFoundError struct {
 	PayerId string
 }
@@ -166,3 +993,31 @@ type PayerNotFoundError struct {
 func (e PayerNotFoundError) Error() string {
 	return fmt.Sprintf("Payer was not found in the system '%s'", e.PayerId)
 }
+
+type InsufficientPointsError struct {
+	RequestedPoints int
+	AvailablePoints int
+}
+
+func (e InsufficientPointsError) Error() string {
+	return fmt.Sprintf("Unable to spend %d points; only %d points are available", e.RequestedPoints, e.AvailablePoints)
+}
+
+// The Payers a spend was restricted to could not cover it.
+type RestrictedFundsError struct {
+	RequestedPoints int
+	AvailablePoints int
+}
+
+func (e RestrictedFundsError) Error() string {
+	return fmt.Sprintf("Unable to spend %d points from the payers the spend is restricted to; only %d points are available from them", e.RequestedPoints, e.AvailablePoints)
+}
+
+// The caller's identity does not permit the request.
+type ForbiddenError struct {
+	Reason string
+}
+
+func (e ForbiddenError) Error() string {
+	return fmt.Sprintf("Forbidden: %s", e.Reason)
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/logging"
+)
+
+type InvalidTransferError struct {
+	Reason string
+}
+
+func (e InvalidTransferError) Error() string {
+	return fmt.Sprintf("Transfer is invalid: %s", e.Reason)
+}
+
+type TransferLimitError struct {
+	Reason string
+}
+
+func (e TransferLimitError) Error() string {
+	return fmt.Sprintf("Transfer exceeds its limit: %s", e.Reason)
+}
+
+type TransferNotFoundError struct {
+	TransferId string
+}
+
+func (e TransferNotFoundError) Error() string {
+	return fmt.Sprintf("Transfer was not found: %s", e.TransferId)
+}
+
+type TransferReversedError struct {
+	TransferId string
+}
+
+func (e TransferReversedError) Error() string {
+	return fmt.Sprintf("Transfer %s is already reversed", e.TransferId)
+}
+
+// Move Points from one Purchaser to another, oldest first.  The moved Points keep their Payer and
+// when they were accumulated, so they are spent and expire at the recipient as they would have at
+// the giver.  A transfer moves all the Points requested or none.
+func (s *LocalTransactionService) TransferPoints(ctx context.Context, request *domain.TransferRequest) (*domain.PointsTransfer, error) {
+	ctx, span := startSpan(ctx, "TransactionService.TransferPoints", pointsAttribute.Int(request.Points))
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var transfer, transferErr = s.transferPoints(ctx, request, time.Now())
+	s.audit(ctx, domain.AuditActionTransferPoints, "", request, transferErr)
+	return transfer, recordSpanError(span, transferErr)
+}
+
+func (s *LocalTransactionService) transferPoints(ctx context.Context, request *domain.TransferRequest, now time.Time) (*domain.PointsTransfer, error) {
+	var transfer = &domain.PointsTransfer{
+		Id: domain.NewIdentifier(),
+		From: request.From,
+		To: request.To,
+		Points: request.Points,
+		Status: domain.TransferStatusCompleted,
+		CreationTimestamp: now,
+	}
+	if purchaserId, isScoped := auth.PurchaserScope(ctx); isScoped {
+		if transfer.From != "" && transfer.From != purchaserId {
+			return nil, ForbiddenError{fmt.Sprintf("may not transfer the points of purchaser '%s'", transfer.From)}
+		}
+		transfer.From = purchaserId
+	}
+	if validateErr := s.validateTransfer(ctx, transfer, now); validateErr != nil {
+		return nil, validateErr
+	}
+	// the moved lots are those the giver's debits consume, so held Points are only left out of
+	// what is available
+	var expiries = s.dueExpiries(ctx, now)
+	var available = 0
+	for _, lot := range buildPointsLots(s.getLogWith(ctx, s.heldTransactions(ctx, now), expiries)) {
+		if lot.transaction.Purchaser == transfer.From {
+			available += lot.remaining
+		}
+	}
+	if available < transfer.Points {
+		return nil, InsufficientPointsError{transfer.Points, available}
+	}
+	var remaining = transfer.Points
+	for _, lot := range buildPointsLots(s.getLogWith(ctx, expiries)) {
+		if remaining == 0 {
+			break
+		}
+		if lot.transaction.Purchaser != transfer.From || lot.remaining == 0 {
+			continue
+		}
+		var moved = minInt(lot.remaining, remaining)
+		transfer.Allocations = append(transfer.Allocations, &domain.TransferAllocation{Payer: lot.transaction.Payer, Points: moved, AccumulatedTimestamp: lot.accumulated()})
+		remaining -= moved
+	}
+	if expireErr := s.commitExpiries(ctx, expiries); expireErr != nil {
+		return nil, expireErr
+	}
+	var record = &dao.JournalRecord{Transfer: transfer, Transactions: transferTransactions(transfer, transfer.From, transfer.To, transfer.Allocations, now)}
+	if commitErr := s.commit(ctx, record); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Transferred points", "transfer_id", transfer.Id, "from", transfer.From, "to", transfer.To, logging.PointsKey, transfer.Points)
+	return transfer, nil
+}
+
+func (s *LocalTransactionService) validateTransfer(ctx context.Context, transfer *domain.PointsTransfer, now time.Time) error {
+	switch {
+	case transfer.From == "" || transfer.To == "":
+		return InvalidTransferError{"from and to are required"}
+	case transfer.From == transfer.To:
+		return InvalidTransferError{"a Purchaser may not transfer to itself"}
+	case transfer.Points <= 0:
+		return InvalidTransferError{"points must be positive"}
+	}
+	if purchaserErr := s.checkPurchaserMaySpend(ctx, transfer.From); purchaserErr != nil {
+		return purchaserErr
+	}
+	if purchaserErr := s.checkPurchaserMayAccumulate(ctx, transfer.To); purchaserErr != nil {
+		return purchaserErr
+	}
+	if s.transferPolicy.MaxPoints > 0 && transfer.Points > s.transferPolicy.MaxPoints {
+		return TransferLimitError{fmt.Sprintf("a transfer may move at most %d points", s.transferPolicy.MaxPoints)}
+	}
+	if s.transferPolicy.DailyLimit > 0 {
+		var left = maxInt(s.transferPolicy.DailyLimit - s.pointsTransferredOn(ctx, transfer.From, now), 0)
+		if transfer.Points > left {
+			return TransferLimitError{fmt.Sprintf("purchaser '%s' may transfer %d more points today", transfer.From, left)}
+		}
+	}
+	return nil
+}
+
+// The Points purchaserId gave away on the UTC day of now, reversed transfers included.
+func (s *LocalTransactionService) pointsTransferredOn(ctx context.Context, purchaserId string, now time.Time) int {
+	var day = now.UTC().Truncate(24 * time.Hour)
+	var transferred = 0
+	for _, transfer := range s.transferStore.ListForPurchaser(ctx, purchaserId) {
+		if transfer.From == purchaserId && !transfer.CreationTimestamp.Before(day) {
+			transferred += transfer.Points
+		}
+	}
+	return transferred
+}
+
+// The linked Transactions moving allocations from one Purchaser to another: a debit of the giver
+// under each Payer, then a credit of the recipient for each lot, keeping when it was accumulated.
+func transferTransactions(transfer *domain.PointsTransfer, from string, to string, allocations []*domain.TransferAllocation, now time.Time) []*domain.RewardTransaction {
+	var transactions []*domain.RewardTransaction
+	var debitsByPayer = make(map[string]*domain.RewardTransaction)
+	for _, allocation := range allocations {
+		var debit, isKnown = debitsByPayer[allocation.Payer]
+		if !isKnown {
+			debit = &domain.RewardTransaction{Payer: allocation.Payer, Purchaser: from, TransactionTimestamp: now, Kind: domain.TransactionKindTransfer, TransferId: transfer.Id}
+			debitsByPayer[allocation.Payer] = debit
+			transactions = append(transactions, debit)
+		}
+		debit.Points -= allocation.Points
+	}
+	for _, allocation := range allocations {
+		var accumulated = allocation.AccumulatedTimestamp
+		transactions = append(transactions, &domain.RewardTransaction{
+			Payer: allocation.Payer,
+			Purchaser: to,
+			Points: allocation.Points,
+			TransactionTimestamp: now,
+			Kind: domain.TransactionKindTransfer,
+			TransferId: transfer.Id,
+			AccumulatedTimestamp: &accumulated,
+		})
+	}
+	return transactions
+}
+
+// Look up a transfer; a Purchaser may only see those it gave or received.
+func (s *LocalTransactionService) GetTransfer(ctx context.Context, transferId string) (*domain.PointsTransfer, error) {
+	ctx, span := startSpan(ctx, "TransactionService.GetTransfer")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var transfer, findErr = s.findTransfer(ctx, transferId)
+	return transfer, recordSpanError(span, findErr)
+}
+
+func (s *LocalTransactionService) ListTransfers(ctx context.Context, purchaserId string) ([]*domain.PointsTransfer, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ListTransfers")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if scopedId, isScoped := auth.PurchaserScope(ctx); isScoped && scopedId != purchaserId {
+		return nil, recordSpanError(span, ForbiddenError{fmt.Sprintf("may not see the transfers of purchaser '%s'", purchaserId)})
+	}
+	return s.transferStore.ListForPurchaser(ctx, purchaserId), nil
+}
+
+// Move what is left of a transfer's Points back to the giver, keeping when they were accumulated.
+// Points the recipient already spent cannot be moved back.
+func (s *LocalTransactionService) ReverseTransfer(ctx context.Context, transferId string) (*domain.PointsTransfer, error) {
+	ctx, span := startSpan(ctx, "TransactionService.ReverseTransfer")
+	defer span.End()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var transfer, reverseErr = s.reverseTransfer(ctx, transferId, time.Now())
+	s.audit(ctx, domain.AuditActionReverseTransfer, "", map[string]string{"transferId": transferId}, reverseErr)
+	return transfer, recordSpanError(span, reverseErr)
+}
+
+func (s *LocalTransactionService) reverseTransfer(ctx context.Context, transferId string, now time.Time) (*domain.PointsTransfer, error) {
+	var transfer, findErr = s.findTransfer(ctx, transferId)
+	if findErr != nil {
+		return nil, findErr
+	}
+	if transfer.Status == domain.TransferStatusReversed {
+		return nil, TransferReversedError{transferId}
+	}
+	if purchaserErr := s.checkPurchaserMayAccumulate(ctx, transfer.From); purchaserErr != nil {
+		return nil, purchaserErr
+	}
+	if expireErr := s.commitExpiries(ctx, s.dueExpiries(ctx, now)); expireErr != nil {
+		return nil, expireErr
+	}
+	var reversed = *transfer
+	reversed.Status = domain.TransferStatusReversed
+	reversed.ReversalTimestamp = &now
+	var allocations []*domain.TransferAllocation
+	for _, lot := range buildPointsLots(s.getLogWith(ctx, s.heldTransactions(ctx, now))) {
+		if lot.transaction.TransferId == transferId && lot.transaction.Purchaser == transfer.To && lot.transaction.Points > 0 && lot.remaining > 0 {
+			allocations = append(allocations, &domain.TransferAllocation{Payer: lot.transaction.Payer, Points: lot.remaining, AccumulatedTimestamp: lot.accumulated()})
+			reversed.ReversedPoints += lot.remaining
+		}
+	}
+	var record = &dao.JournalRecord{Transfer: &reversed, Transactions: transferTransactions(&reversed, transfer.To, transfer.From, allocations, now)}
+	if commitErr := s.commit(ctx, record); commitErr != nil {
+		return nil, commitErr
+	}
+	level.Info(logging.FromContext(ctx)).Log("msg", "Reversed transfer", "transfer_id", transferId, logging.PointsKey, reversed.ReversedPoints)
+	return &reversed, nil
+}
+
+func (s *LocalTransactionService) findTransfer(ctx context.Context, transferId string) (*domain.PointsTransfer, error) {
+	var transfer = s.transferStore.GetTransfer(ctx, transferId)
+	if purchaserId, isScoped := auth.PurchaserScope(ctx); transfer == nil || (isScoped && transfer.From != purchaserId && transfer.To != purchaserId) {
+		return nil, TransferNotFoundError{transferId}
+	}
+	return transfer, nil
+}
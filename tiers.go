@@ -0,0 +1,17 @@
+package main
+
+import (
+	"net/http"
+	"time"
+	"github.com/gorilla/mux"
+)
+
+// How often Purchasers whose Points left the tier window are moved to the tier they fell to.
+const tierSweepInterval = time.Hour
+
+func (a *Application) HandleGetPurchaserTier() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, serviceError = a.transactionService.GetPurchaserTier(r.Context(), mux.Vars(r)["purchaserId"])
+		WriteServiceResponse(w, result, serviceError)
+	})
+}
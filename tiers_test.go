@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"purchase-tracker-service/auth"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func newTieredServiceForTest() *service.LocalTransactionService {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.SetTierPolicy(service.TierPolicy{
+		Window: 24 * time.Hour,
+		Tiers: []domain.Tier{{Name: "Bronze", Multiplier: 1}, {Name: "Silver", MinimumPoints: 100, Multiplier: 1.5}, {Name: "Gold", MinimumPoints: 500, Multiplier: 2}},
+	})
+	return transactionService
+}
+
+func TestTiersMultiplyPurchasesAndReportProgress(t *testing.T) {
+	var transactionService = newTieredServiceForTest()
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+
+	var cases = []struct {
+		purchaser string
+		points int
+		expected domain.TierEarning
+	}{
+		// the first purchase is earned in Bronze and reaches Silver
+		{"alice", 100, domain.TierEarning{Tier: "Bronze", Multiplier: 1, BasePoints: 100, Points: 100}},
+		{"alice", 101, domain.TierEarning{Tier: "Silver", Multiplier: 1.5, BasePoints: 101, Points: 151}},
+		{"bob", 10, domain.TierEarning{Tier: "Bronze", Multiplier: 1, BasePoints: 10, Points: 10}},
+	}
+	for _, c := range cases {
+		var progress, purchaseErr = serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: c.purchaser, Points: c.points})
+		if purchaseErr != nil || progress.Tier == nil || *progress.Tier != c.expected {
+			t.Fatalf("Expected the purchase of %d points by %s to earn %+v but got %+v (%v)", c.points, c.purchaser, c.expected, progress, purchaseErr)
+		}
+	}
+	expectPayerBalanceForTest(t, transactionService, "DANNON", 261)
+
+	var alice, tierErr = serviceClient.GetPurchaserTier("alice")
+	if tierErr != nil || alice.Tier != "Silver" || alice.Points != 251 || alice.NextTier != "Gold" || alice.PointsToNextTier != 249 {
+		t.Fatalf("Expected alice to be 249 points short of Gold in Silver but got %+v (%v)", alice, tierErr)
+	}
+	// dropping the first purchase leaves 151, still Silver; dropping the second leaves nothing
+	var transactionLog, _ = serviceClient.GetTransactionLog()
+	if alice.ExpiresTimestamp == nil || !alice.ExpiresTimestamp.Equal(transactionLog[1].TransactionTimestamp.Add(24 * time.Hour)) {
+		t.Fatalf("Expected Silver to lapse a day after the second purchase but got %v", alice.ExpiresTimestamp)
+	}
+	if transactionLog[1].Tier != "Silver" {
+		t.Fatalf("Expected the second purchase to record the tier it was earned in but was '%s'", transactionLog[1].Tier)
+	}
+	if bob, _ := serviceClient.GetPurchaserTier("bob"); bob.Tier != "Bronze" || bob.ExpiresTimestamp != nil || bob.PointsToNextTier != 90 {
+		t.Fatalf("Expected bob to stay in Bronze 90 points short of Silver but got %+v", bob)
+	}
+
+	var purchaserContext = auth.WithIdentity(context.Background(), &auth.Identity{Subject: "bob", Roles: []string{auth.RolePurchaser}, PurchaserId: "bob"})
+	if _, forbiddenErr := transactionService.GetPurchaserTier(purchaserContext, "alice"); forbiddenErr == nil {
+		t.Fatalf("Expected a Purchaser to be refused the tier of another")
+	}
+}
+
+func TestTierSweepRecordsDowngrades(t *testing.T) {
+	var transactionService = newTieredServiceForTest()
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Purchaser: "alice", Points: 600})
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Purchaser: "bob", Points: 50})
+	if changes, _ := transactionService.SweepTiers(context.Background(), time.Now()); len(changes) != 0 {
+		t.Fatalf("Expected the upgrade to Gold to be recorded with the purchase but the sweep changed %d tiers", len(changes))
+	}
+	var changes, sweepErr = transactionService.SweepTiers(context.Background(), time.Now().Add(25 * time.Hour))
+	if sweepErr != nil || len(changes) != 1 || changes[0].Purchaser != "alice" || changes[0].PreviousTier != "Gold" || changes[0].Tier != "Bronze" {
+		t.Fatalf("Expected alice to fall from Gold to Bronze once the purchase left the window but got %+v (%v)", changes, sweepErr)
+	}
+	if again, _ := transactionService.SweepTiers(context.Background(), time.Now().Add(25 * time.Hour)); len(again) != 0 {
+		t.Fatalf("Expected a repeated sweep to change nothing but changed %d tiers", len(again))
+	}
+}
+
+func TestTiersNotConfigured(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+	if progress, _ := serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: "alice", Points: 100}); progress.Tier != nil || progress.Points != 100 {
+		t.Fatalf("Expected an untiered purchase to keep its points but got %+v", progress)
+	}
+	var _, tierErr = serviceClient.GetPurchaserTier("alice")
+	expectStatus(t, tierErr, 404, "the tier of a Purchaser when tiers are not configured")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"purchase-tracker-service/config"
+)
+
+var httpTracer = otel.Tracer("purchase-tracker-service/http")
+
+// Install the tracer provider the tracing configuration asks for as the global provider the
+// handler, service and store layers record spans through.  The returned function flushes any
+// spans not yet exported and must be called before the process exits.
+func startTracing(ctx context.Context, tracingConfig config.TracingConfig, stdout io.Writer) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var exporter sdktrace.SpanExporter
+	var exporterErr error
+	switch tracingConfig.Exporter {
+	case config.TracingExporterStdout:
+		exporter, exporterErr = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	case config.TracingExporterOtlp:
+		var options = []otlptracehttp.Option{otlptracehttp.WithEndpoint(tracingConfig.Endpoint)}
+		if tracingConfig.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, exporterErr = otlptracehttp.New(ctx, options...)
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+	if exporterErr != nil {
+		return nil, fmt.Errorf("Unable to create the %s span exporter: %w", tracingConfig.Exporter, exporterErr)
+	}
+	var serviceResource, resourceErr = resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(tracingConfig.ServiceName),
+		semconv.ServiceVersionKey.String(currentBuildInfo().Commit),
+	))
+	if resourceErr != nil {
+		return nil, resourceErr
+	}
+	var provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(serviceResource),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(tracingConfig.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Router middleware starting a server span for every request, continuing the trace of a caller
+// that sent W3C trace context headers.  The span is named after the route template so that
+// requests for different Payers are grouped together.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var route = routeTemplate(r)
+		var ctx = otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := httpTracer.Start(ctx, r.Method + " " + route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPRouteKey.String(route),
+				semconv.HTTPTargetKey.String(r.URL.RequestURI()),
+			),
+		)
+		defer span.End()
+		var recorder = &statusRecordingResponseWriter{ResponseWriter: w, statusCode: 200}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(recorder.statusCode))
+		if recorder.statusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(recorder.statusCode))
+		}
+	})
+}
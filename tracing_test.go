@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"purchase-tracker-service/service"
+)
+
+// Record spans in memory for the duration of the test, restoring the global provider after.
+func recordSpansForTest(t *testing.T) *tracetest.InMemoryExporter {
+	var exporter = tracetest.NewInMemoryExporter()
+	var provider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	var previousProvider = otel.GetTracerProvider()
+	var previousPropagator = otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter
+}
+
+func TestSpendIsTracedThroughEveryLayer(t *testing.T) {
+	var exporter = recordSpansForTest(t)
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var router = NewApplication(transactionService).NewRouter()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/purchases", strings.NewReader(`{"payer": "DANNON", "points": 300}`)))
+	exporter.Reset()
+
+	const callerTraceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var request = httptest.NewRequest("POST", "/rewards/spend", strings.NewReader(`{"points": 100}`))
+	request.Header.Set("traceparent", "00-" + callerTraceId + "-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	var spansByName = make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		if span.SpanContext.TraceID().String() != callerTraceId {
+			t.Fatalf("Expected span %s to continue the caller's trace but was in %s", span.Name, span.SpanContext.TraceID())
+		}
+		spansByName[span.Name] = span
+	}
+	for _, expected := range []string{
+		"POST /rewards/spend",
+		"TransactionService.SpendPoints",
+		"TransactionService.allocate",
+		"TransactionService.commit",
+		"TransactionsStore.GetTransactionLog",
+		"RewardsStore.AddTransaction",
+	} {
+		if _, recorded := spansByName[expected]; !recorded {
+			t.Fatalf("Expected a %s span to be recorded", expected)
+		}
+	}
+	var serverSpan = spansByName["POST /rewards/spend"]
+	if serviceSpan := spansByName["TransactionService.SpendPoints"]; serviceSpan.Parent.SpanID() != serverSpan.SpanContext.SpanID() {
+		t.Fatalf("Expected the service span to be a child of the request span")
+	}
+}
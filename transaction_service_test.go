@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"strings"
 	"testing"
@@ -17,7 +18,7 @@ func TestGetPointsProgressForPayer(t *testing.T) {
 		time.Now(),
 	}
 
-	var actualProgress, getError = testedObject.GetPointsProgressForPayer(testAccount.Id)
+	var actualProgress, getError = testedObject.GetPointsProgressForPayer(context.Background(), testAccount.Id)
 	if actualProgress != nil {
 		t.Fatalf("Did not expect Account to be found by id %s", testAccount.Id)
 	} else if getError == nil {
@@ -25,8 +26,8 @@ func TestGetPointsProgressForPayer(t *testing.T) {
 	} else if !strings.HasPrefix(getError.Error(), "Payer was not found") {
 		t.Fatalf("Expected the error to be a not found error")
 	}
-	testedObject.AddPayer(testAccount.Id, testAccount.Name)
-	actualProgress, getError = testedObject.GetPointsProgressForPayer(testAccount.Id)
+	testedObject.AddPayer(context.Background(), testAccount.Id, testAccount.Name)
+	actualProgress, getError = testedObject.GetPointsProgressForPayer(context.Background(), testAccount.Id)
 	if actualProgress == nil {
 		t.Fatalf("Expected Account to be found by id %s", testAccount.Id)
 	} else if getError != nil {
@@ -51,17 +52,17 @@ func TestReceiveNewPurchase(t *testing.T) {
 		time.Now(),
 	}
 
-	testedObject.AddPayer(testAccount.Id, testAccount.Name)
+	testedObject.AddPayer(context.Background(), testAccount.Id, testAccount.Name)
 
 	var testTransaction = &domain.RewardTransaction {
-		testAccount.Id,
-		555,
-		time.Time{},
+		Payer: testAccount.Id,
+		Points: 555,
+		TransactionTimestamp: time.Time{},
 	}
 
-	testedObject.ReceiveNewPurchase(testTransaction)
+	testedObject.ReceiveNewPurchase(context.Background(), testTransaction)
 
-	var actualProgress, getError = testedObject.GetPointsProgressForPayer(testAccount.Id)
+	var actualProgress, getError = testedObject.GetPointsProgressForPayer(context.Background(), testAccount.Id)
 	if actualProgress == nil {
 		t.Fatalf("Expected Account to be found by id %s", testAccount.Id)
 	} else if getError != nil {
@@ -80,15 +81,15 @@ func TestReceiveNewPurchase_PayerDoesNotExist(t *testing.T) {
 		time.Now(),
 	}
 
-	testedObject.AddPayer(testAccount.Id, testAccount.Name)
+	testedObject.AddPayer(context.Background(), testAccount.Id, testAccount.Name)
 
 	var testTransaction = &domain.RewardTransaction {
-		"account-2",
-		555,
-		time.Time{},
+		Payer: "account-2",
+		Points: 555,
+		TransactionTimestamp: time.Time{},
 	}
 
-	var actualProgress, txRecvError = testedObject.ReceiveNewPurchase(testTransaction)
+	var actualProgress, txRecvError = testedObject.ReceiveNewPurchase(context.Background(), testTransaction)
 	if actualProgress != nil {
 		t.Fatal("Expected Progress to be nil")
 	} else if txRecvError == nil {
@@ -112,28 +113,28 @@ func TestSpendPoints(t *testing.T) {
 		time.Time{},
 	}
 
-	testedObject.AddPayer(firstAccount.Id, firstAccount.Name)
-	testedObject.AddPayer(secondAccount.Id, secondAccount.Name)
+	testedObject.AddPayer(context.Background(), firstAccount.Id, firstAccount.Name)
+	testedObject.AddPayer(context.Background(), secondAccount.Id, secondAccount.Name)
 
 	// Transactions
-	testedObject.ReceiveNewPurchase(&domain.RewardTransaction {
-		firstAccount.Id,
-		500,
-		time.Time{},
+	testedObject.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction {
+		Payer: firstAccount.Id,
+		Points: 500,
+		TransactionTimestamp: time.Time{},
 	})
-	testedObject.ReceiveNewPurchase(&domain.RewardTransaction {
-		secondAccount.Id,
-		349,
-		time.Time{},
+	testedObject.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction {
+		Payer: secondAccount.Id,
+		Points: 349,
+		TransactionTimestamp: time.Time{},
 	})
-	testedObject.ReceiveNewPurchase(&domain.RewardTransaction {
-		secondAccount.Id,
-		251,
-		time.Time{},
+	testedObject.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction {
+		Payer: secondAccount.Id,
+		Points: 251,
+		TransactionTimestamp: time.Time{},
 	})
 	// the goal is that when we want to spend 850 points, after the second TX,
 	// the allocation is forced to go through all 4 transactions to spend later points.
-	var actualAllocations = testedObject.SpendPoints(850)
+	var actualAllocations, _ = testedObject.SpendPoints(context.Background(), 850)
 	if len(actualAllocations) != 2 {
 		t.Fatalf("Expected 2 alloations since there are 2 Payers set up in the system but %d were returned.", len(actualAllocations))
 	}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	"purchase-tracker-service/dao"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+)
+
+func TestTransferKeepsPayerAndAccumulationDate(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.SetExpiryPolicy(service.ExpiryPolicy{PointsLifetime: 3 * time.Hour})
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.AddPayer(context.Background(), "UNILEVER", "Unilever")
+	transactionService.ImportLedger(context.Background(), &domain.LedgerExport{Transactions: []*domain.RewardTransaction{
+		{Payer: "DANNON", Purchaser: "alice", Points: 100, TransactionTimestamp: time.Now().Add(-2 * time.Hour)},
+		{Payer: "UNILEVER", Purchaser: "bob", Points: 100, TransactionTimestamp: time.Now().Add(-time.Hour)},
+	}})
+
+	var transfer, transferErr = transactionService.TransferPoints(context.Background(), &domain.TransferRequest{From: "alice", To: "bob", Points: 80})
+	if transferErr != nil || len(transfer.Allocations) != 1 || transfer.Allocations[0].Payer != "DANNON" {
+		t.Fatalf("Expected 80 Dannon points to be transferred but got %+v (%v)", transfer, transferErr)
+	}
+	var allocations, spendErr = transactionService.SpendPoints(purchaserContextForTest("bob"), 50)
+	if spendErr != nil || len(allocations) != 1 || allocations[0].Payer.Id != "DANNON" {
+		t.Fatalf("Expected bob's spend to consume the older transferred lot first but got %v (%v)", allocations, spendErr)
+	}
+	var expiries, _ = transactionService.ExpirePoints(context.Background(), time.Now().Add(90 * time.Minute))
+	if len(expiries) != 2 {
+		t.Fatalf("Expected what is left of alice's lot at both Purchasers to expire but got %d expiries", len(expiries))
+	}
+	for _, expiry := range expiries {
+		if expiry.Payer != "DANNON" || (expiry.Purchaser == "bob" && expiry.Points != -30) || (expiry.Purchaser == "alice" && expiry.Points != -20) {
+			t.Fatalf("Expected the transferred points to expire on their original schedule but got %+v", expiry)
+		}
+	}
+	expectPayerBalanceForTest(t, transactionService, "UNILEVER", 100)
+}
+
+func TestTransferLimitsAndRefusals(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.SetTransferPolicy(service.TransferPolicy{MaxPoints: 200, DailyLimit: 250})
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+	serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: "alice", Points: 1000})
+
+	var _, selfErr = serviceClient.TransferPoints(&domain.TransferRequest{From: "alice", To: "alice", Points: 10})
+	expectStatus(t, selfErr, 400, "a transfer to oneself")
+	var _, maxErr = serviceClient.TransferPoints(&domain.TransferRequest{From: "alice", To: "bob", Points: 201})
+	expectStatus(t, maxErr, 409, "a transfer above the per-transfer limit")
+	if _, transferErr := serviceClient.TransferPoints(&domain.TransferRequest{From: "alice", To: "bob", Points: 200}); transferErr != nil {
+		t.Fatalf("Expected a transfer at the limit to succeed: %s", transferErr)
+	}
+	var _, dailyErr = serviceClient.TransferPoints(&domain.TransferRequest{From: "alice", To: "bob", Points: 60})
+	expectStatus(t, dailyErr, 409, "a transfer above the daily limit")
+	var _, shortErr = serviceClient.TransferPoints(&domain.TransferRequest{From: "bob", To: "carol", Points: 201})
+	expectStatus(t, shortErr, 409, "a transfer of more points than held")
+	var _, unknownErr = serviceClient.GetTransfer("unknown")
+	expectStatus(t, unknownErr, 404, "looking up an unknown transfer")
+
+	var transfer, scopedErr = transactionService.TransferPoints(purchaserContextForTest("bob"), &domain.TransferRequest{To: "carol", Points: 50})
+	if scopedErr != nil || transfer.From != "bob" {
+		t.Fatalf("Expected a Purchaser to transfer its own points but got %+v (%v)", transfer, scopedErr)
+	}
+	if _, forbiddenErr := transactionService.TransferPoints(purchaserContextForTest("bob"), &domain.TransferRequest{From: "alice", To: "bob", Points: 10}); forbiddenErr == nil {
+		t.Fatalf("Expected a Purchaser to be refused a transfer of another's points")
+	}
+	if _, hiddenErr := transactionService.GetTransfer(purchaserContextForTest("alice"), transfer.Id); hiddenErr == nil {
+		t.Fatalf("Expected a transfer to be hidden from a Purchaser not party to it")
+	}
+	if transfers, _ := serviceClient.ListTransfers("bob"); len(transfers) != 2 {
+		t.Fatalf("Expected bob to be party to 2 transfers but found %d", len(transfers))
+	}
+}
+
+func TestReverseTransferMovesBackWhatRemains(t *testing.T) {
+	var journalPath = filepath.Join(t.TempDir(), "ledger.journal")
+	var journal, _ = dao.OpenFileJournal(journalPath, false)
+	var transactionService, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), journal)
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	transactionService.ReceiveNewPurchase(context.Background(), &domain.RewardTransaction{Payer: "DANNON", Purchaser: "alice", Points: 300})
+	var transfer, _ = transactionService.TransferPoints(context.Background(), &domain.TransferRequest{From: "alice", To: "bob", Points: 200})
+	transactionService.SpendPoints(purchaserContextForTest("bob"), 50)
+
+	var reversed, reverseErr = transactionService.ReverseTransfer(context.Background(), transfer.Id)
+	if reverseErr != nil || reversed.Status != domain.TransferStatusReversed || reversed.ReversedPoints != 150 {
+		t.Fatalf("Expected the 150 unspent points to be moved back but got %+v (%v)", reversed, reverseErr)
+	}
+	if allocations, _ := transactionService.SpendPoints(purchaserContextForTest("bob"), 1); len(allocations) != 0 {
+		t.Fatalf("Expected bob to have no points left after the reversal but spent %v", allocations)
+	}
+	if _, againErr := transactionService.ReverseTransfer(context.Background(), transfer.Id); againErr == nil {
+		t.Fatalf("Expected reversing a transfer twice to be refused")
+	}
+	transactionService.Close()
+
+	var reopened, _ = dao.OpenFileJournal(journalPath, false)
+	var restarted, _ = service.NewLocalTransactionServiceWithJournal(context.Background(), reopened)
+	defer restarted.Close()
+	if restored, _ := restarted.GetTransfer(context.Background(), transfer.Id); restored == nil || restored.Status != domain.TransferStatusReversed {
+		t.Fatalf("Expected the transfer to be restored reversed but was %+v", restored)
+	}
+	expectPayerBalanceForTest(t, restarted, "DANNON", 250)
+	if allocations, spendErr := restarted.SpendPoints(purchaserContextForTest("alice"), 250); spendErr != nil || allocations[0].Points != -250 {
+		t.Fatalf("Expected alice to hold 250 points again but got %v (%v)", allocations, spendErr)
+	}
+}
+
+func TestPurchaseIgnoresLedgerFieldsPosted(t *testing.T) {
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.AddPayer(context.Background(), "DANNON", "Dannon")
+	var server = httptest.NewServer(NewApplication(transactionService).NewRouter())
+	defer server.Close()
+	var serviceClient = newClientWithKey(server.URL, "")
+	var backdated = time.Now().Add(-30 * 24 * time.Hour)
+	if _, addErr := serviceClient.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Purchaser: "alice", Points: 100, AccumulatedTimestamp: &backdated, TransferId: "forged", SpendId: "forged", CampaignId: "forged", Tier: "gold"}); addErr != nil {
+		t.Fatalf("Expected the purchase to be received: %s", addErr)
+	}
+
+	var transactionLog, _ = serviceClient.GetTransactionLog()
+	if len(transactionLog) != 1 {
+		t.Fatalf("Expected 1 transaction but found %d", len(transactionLog))
+	}
+	var purchase = transactionLog[0]
+	if purchase.AccumulatedTimestamp != nil || purchase.TransferId != "" || purchase.SpendId != "" || purchase.CampaignId != "" || purchase.Tier != "" {
+		t.Fatalf("Expected the ledger fields posted to be ignored but stored %+v", purchase)
+	}
+	if _, reverseErr := serviceClient.ReverseTransfer("forged"); reverseErr == nil {
+		t.Fatalf("Expected a forged transfer id not to make the purchase reversible")
+	}
+}
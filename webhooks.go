@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/service"
+	"purchase-tracker-service/webhooks"
+)
+
+// Report the endpoints and dead letters of dispatcher to administrators; without a dispatcher no
+// webhook endpoints are served.
+func (a *Application) SetWebhookDispatcher(dispatcher *webhooks.Dispatcher) {
+	a.webhooks = dispatcher
+}
+
+// Build the dispatcher delivering the domain events of transactionService to the configured
+// endpoints, start it and relay the service's outbox through it until ctx is done; the relay runs
+// in background and the caller closes the dispatcher once it has returned.
+func newWebhookDispatcher(ctx context.Context, background *sync.WaitGroup, webhooksConfig config.WebhooksConfig, transactionService *service.LocalTransactionService, logger log.Logger) *webhooks.Dispatcher {
+	var endpoints []*webhooks.Endpoint
+	for _, endpoint := range webhooksConfig.Endpoints {
+		endpoints = append(endpoints, &webhooks.Endpoint{
+			Id: endpoint.Id,
+			Url: endpoint.Url,
+			Secret: endpoint.Secret,
+			EventTypes: endpoint.Events,
+		})
+	}
+	var dispatcher = webhooks.NewDispatcher(endpoints, webhooks.RetryPolicy{
+		MaxAttempts: webhooksConfig.MaxAttempts,
+		InitialBackoff: time.Duration(webhooksConfig.InitialBackoff),
+		MaxBackoff: time.Duration(webhooksConfig.MaxBackoff),
+		Timeout: time.Duration(webhooksConfig.Timeout),
+	})
+	dispatcher.SetLogger(log.With(logger, "component", "webhooks"))
+	dispatcher.Start()
+	runInBackground(background, func() {
+		transactionService.RelayOutbox(ctx, dispatcher.Publish, time.Duration(webhooksConfig.InitialBackoff))
+	})
+	return dispatcher
+}
+
+func (a *Application) HandleListWebhookEndpoints() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteServiceResponse(w, a.webhooks.Endpoints(), nil)
+	})
+}
+
+func (a *Application) HandleListDeadLetters() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteServiceResponse(w, a.webhooks.DeadLetters(), nil)
+	})
+}
+
+func (a *Application) HandleRedeliverDeadLetter() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var result, dispatchError = a.webhooks.Redeliver(mux.Vars(r)["deadLetterId"])
+		WriteServiceResponse(w, result, dispatchError)
+	})
+}
@@ -0,0 +1,321 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"purchase-tracker-service/domain"
+)
+
+// A receiver of domain events.
+type Endpoint struct {
+	Id string `json:"id"`
+	Url string `json:"url"`
+	// Shared with the receiver to sign deliveries; never reported.
+	Secret string `json:"-"`
+	// The event types delivered; empty means every type.
+	EventTypes []string `json:"eventTypes,omitempty"`
+}
+
+func (e *Endpoint) accepts(eventType string) bool {
+	if len(e.EventTypes) == 0 {
+		return true
+	}
+	for _, accepted := range e.EventTypes {
+		if accepted == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// How failed deliveries are retried: after InitialBackoff, doubling each time up to MaxBackoff,
+// until MaxAttempts deliveries have failed and the event is dead-lettered.
+type RetryPolicy struct {
+	MaxAttempts int
+	InitialBackoff time.Duration
+	MaxBackoff time.Duration
+	// How long a single delivery may take.
+	Timeout time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 8,
+		InitialBackoff: time.Second,
+		MaxBackoff: 5 * time.Minute,
+		Timeout: 10 * time.Second,
+	}
+}
+
+func (p RetryPolicy) backoff(failedAttempts int) time.Duration {
+	var delay = p.InitialBackoff
+	for i := 1; i < failedAttempts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+// An event an endpoint never accepted.
+type DeadLetter struct {
+	Id string `json:"id"`
+	EndpointId string `json:"endpointId"`
+	Event *domain.DomainEvent `json:"event"`
+	Attempts int `json:"attempts"`
+	LastError string `json:"lastError"`
+	DeadLetterTimestamp time.Time `json:"deadLetterTimestamp"`
+}
+
+var errDispatcherClosed = errors.New("webhook dispatcher is closed")
+
+type DeadLetterNotFoundError struct {
+	DeadLetterId string
+}
+
+func (e DeadLetterNotFoundError) Error() string {
+	return fmt.Sprintf("Dead letter was not found: %s", e.DeadLetterId)
+}
+
+// An event waiting for an endpoint; done, when set, is called once it is delivered or
+// dead-lettered.
+type queuedEvent struct {
+	event *domain.DomainEvent
+	done func()
+}
+
+// The events waiting for one endpoint, delivered one at a time in the order they were published.
+type endpointQueue struct {
+	endpoint *Endpoint
+	pending []*queuedEvent
+	// Signalled, without blocking, whenever an event is queued.
+	queued chan struct{}
+}
+
+// Delivers published events to every endpoint accepting their type, each endpoint in its own
+// goroutine.  Since Publish waits for every endpoint, a failing receiver holds up the events that
+// follow for all of them until its retries run out.
+type Dispatcher struct {
+	lock sync.Mutex
+	queues []*endpointQueue
+	retryPolicy RetryPolicy
+	httpClient *http.Client
+	deadLetters []*DeadLetter
+	logger log.Logger
+	stop context.CancelFunc
+	// Closed by Close, releasing any Publish still waiting.
+	closed chan struct{}
+	workers sync.WaitGroup
+}
+
+func NewDispatcher(endpoints []*Endpoint, retryPolicy RetryPolicy) *Dispatcher {
+	var dispatcher = &Dispatcher{
+		retryPolicy: retryPolicy,
+		httpClient: &http.Client{Timeout: retryPolicy.Timeout},
+		logger: log.NewNopLogger(),
+		closed: make(chan struct{}),
+	}
+	for _, endpoint := range endpoints {
+		dispatcher.queues = append(dispatcher.queues, &endpointQueue{endpoint: endpoint, queued: make(chan struct{}, 1)})
+	}
+	return dispatcher
+}
+
+func (d *Dispatcher) SetLogger(logger log.Logger) {
+	d.logger = logger
+}
+
+// Begin delivering to every endpoint until Close.
+func (d *Dispatcher) Start() {
+	var ctx, stop = context.WithCancel(context.Background())
+	d.stop = stop
+	for _, queue := range d.queues {
+		d.workers.Add(1)
+		go func(queue *endpointQueue) {
+			defer d.workers.Done()
+			d.deliverQueued(ctx, queue)
+		}(queue)
+	}
+}
+
+// Stop delivering, waiting for any delivery under way to finish.  Events still queued are dropped;
+// their Publish fails, so an outbox relay publishes them again once restarted.
+func (d *Dispatcher) Close() {
+	if d.stop != nil {
+		d.stop()
+	}
+	close(d.closed)
+	d.workers.Wait()
+}
+
+// Queue event for every endpoint accepting its type and wait until each has either accepted it or
+// dead-lettered it; an error means the wait was given up and the event may not have been delivered.
+// Suits service.EventPublisher, so a relay publishing through it marks an event published only once
+// delivery is settled.
+func (d *Dispatcher) Publish(ctx context.Context, event *domain.DomainEvent) error {
+	var settled sync.WaitGroup
+	d.lock.Lock()
+	for _, queue := range d.queues {
+		if queue.endpoint.accepts(event.Type) {
+			settled.Add(1)
+			d.enqueue(queue, &queuedEvent{event: event, done: settled.Done})
+		}
+	}
+	d.lock.Unlock()
+	var allSettled = make(chan struct{})
+	go func() {
+		settled.Wait()
+		close(allSettled)
+	}()
+	select {
+	case <-allSettled:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-d.closed:
+		return errDispatcherClosed
+	}
+}
+
+func (d *Dispatcher) enqueue(queue *endpointQueue, event *queuedEvent) {
+	queue.pending = append(queue.pending, event)
+	select {
+	case queue.queued <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) Endpoints() []*Endpoint {
+	var endpoints []*Endpoint
+	for _, queue := range d.queues {
+		endpoints = append(endpoints, queue.endpoint)
+	}
+	return endpoints
+}
+
+func (d *Dispatcher) DeadLetters() []*DeadLetter {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]*DeadLetter{}, d.deadLetters...)
+}
+
+// Queue a dead-lettered event for its endpoint again, behind any events already waiting.
+func (d *Dispatcher) Redeliver(deadLetterId string) (*DeadLetter, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for i, deadLetter := range d.deadLetters {
+		if deadLetter.Id != deadLetterId {
+			continue
+		}
+		for _, queue := range d.queues {
+			if queue.endpoint.Id == deadLetter.EndpointId {
+				d.deadLetters = append(d.deadLetters[:i], d.deadLetters[i + 1:]...)
+				d.enqueue(queue, &queuedEvent{event: deadLetter.Event})
+				return deadLetter, nil
+			}
+		}
+	}
+	return nil, DeadLetterNotFoundError{deadLetterId}
+}
+
+func (d *Dispatcher) next(queue *endpointQueue) *queuedEvent {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(queue.pending) == 0 {
+		return nil
+	}
+	var event = queue.pending[0]
+	queue.pending = queue.pending[1:]
+	return event
+}
+
+func (d *Dispatcher) deliverQueued(ctx context.Context, queue *endpointQueue) {
+	for {
+		var event = d.next(queue)
+		if event == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-queue.queued:
+				continue
+			}
+		}
+		if !d.deliverWithRetries(ctx, queue.endpoint, event.event) {
+			return
+		}
+		if event.done != nil {
+			event.done()
+		}
+	}
+}
+
+// Deliver event until the endpoint accepts it or the attempts run out, when it is dead-lettered;
+// false only when the dispatcher closed first.
+func (d *Dispatcher) deliverWithRetries(ctx context.Context, endpoint *Endpoint, event *domain.DomainEvent) bool {
+	var logger = log.With(d.logger, "endpoint", endpoint.Id, "event_id", event.Id, "event_type", event.Type)
+	var lastErr error
+	for attempt := 1; attempt <= d.retryPolicy.MaxAttempts; attempt++ {
+		if lastErr = d.deliver(ctx, endpoint, event); lastErr == nil {
+			level.Debug(logger).Log("msg", "Delivered event", "attempt", attempt)
+			return true
+		}
+		if attempt == d.retryPolicy.MaxAttempts {
+			break
+		}
+		var backoff = d.retryPolicy.backoff(attempt)
+		level.Warn(logger).Log("msg", "Unable to deliver event; retrying", "attempt", attempt, "backoff", backoff, "err", lastErr)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+	}
+	level.Error(logger).Log("msg", "Dead-lettered event", "attempts", d.retryPolicy.MaxAttempts, "err", lastErr)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.deadLetters = append(d.deadLetters, &DeadLetter{
+		Id: domain.NewIdentifier(),
+		EndpointId: endpoint.Id,
+		Event: event,
+		Attempts: d.retryPolicy.MaxAttempts,
+		LastError: lastErr.Error(),
+		DeadLetterTimestamp: time.Now(),
+	})
+	return true
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, endpoint *Endpoint, event *domain.DomainEvent) error {
+	var body, encodeErr = json.Marshal(event)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	var request, requestErr = http.NewRequestWithContext(ctx, "POST", endpoint.Url, bytes.NewReader(body))
+	if requestErr != nil {
+		return requestErr
+	}
+	var timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventIdHeader, event.Id)
+	request.Header.Set(EventTypeHeader, event.Type)
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(SignatureHeader, Sign(endpoint.Secret, timestamp, body))
+	var response, responseErr = d.httpClient.Do(request)
+	if responseErr != nil {
+		return responseErr
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("endpoint responded with HTTP %d", response.StatusCode)
+	}
+	return nil
+}
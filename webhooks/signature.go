@@ -0,0 +1,36 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Headers of every delivery.  The signature covers the timestamp and the body, so a receiver that
+// checks it and refuses stale timestamps cannot be sent a replayed or altered delivery.
+const (
+	EventIdHeader = "X-Webhook-Id"
+	EventTypeHeader = "X-Webhook-Event"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+	signaturePrefix = "sha256="
+)
+
+// The signature header of a delivery of body at timestamp, in Unix seconds, to an endpoint
+// sharing secret.
+func Sign(secret string, timestamp string, body []byte) string {
+	var mac = hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Whether signature is the signature of a delivery of body at timestamp; for receivers.
+func VerifySignature(secret string, timestamp string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
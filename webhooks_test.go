@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"github.com/go-kit/kit/log"
+	"purchase-tracker-service/client"
+	"purchase-tracker-service/config"
+	"purchase-tracker-service/domain"
+	"purchase-tracker-service/service"
+	"purchase-tracker-service/webhooks"
+)
+
+// An httptest receiver of webhook deliveries refusing the first failures of them.
+type webhookReceiver struct {
+	lock sync.Mutex
+	secret string
+	failures int
+	events []*domain.DomainEvent
+	attempts int
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.attempts++
+	var body, _ = io.ReadAll(request.Body)
+	if !webhooks.VerifySignature(r.secret, request.Header.Get(webhooks.TimestampHeader), body, request.Header.Get(webhooks.SignatureHeader)) {
+		w.WriteHeader(401)
+		return
+	}
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(503)
+		return
+	}
+	var event domain.DomainEvent
+	if decodeErr := json.Unmarshal(body, &event); decodeErr != nil || event.Id != request.Header.Get(webhooks.EventIdHeader) {
+		w.WriteHeader(400)
+		return
+	}
+	r.events = append(r.events, &event)
+}
+
+func (r *webhookReceiver) received() ([]*domain.DomainEvent, int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]*domain.DomainEvent{}, r.events...), r.attempts
+}
+
+func waitFor(t *testing.T, description string, condition func() bool) {
+	var deadline = time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", description)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDomainEventsAreDeliveredToSignedWebhooksWithRetriesAndDeadLetters(t *testing.T) {
+	var ledger = &webhookReceiver{secret: "ledger-secret", failures: 2}
+	var ledgerServer = httptest.NewServer(ledger)
+	defer ledgerServer.Close()
+	var spends = &webhookReceiver{secret: "spends-secret", failures: 3}
+	var spendsServer = httptest.NewServer(spends)
+	defer spendsServer.Close()
+
+	var transactionService = service.NewLocalTransactionService()
+	transactionService.EnableOutbox()
+	var relayContext, stopRelay = context.WithCancel(context.Background())
+	var relay sync.WaitGroup
+	defer relay.Wait()
+	defer stopRelay()
+	var dispatcher = newWebhookDispatcher(relayContext, &relay, config.WebhooksConfig{
+		Endpoints: []config.WebhookEndpointConfig{
+			{Id: "ledger", Url: ledgerServer.URL, Secret: "ledger-secret"},
+			{Id: "spends", Url: spendsServer.URL, Secret: "spends-secret", Events: []string{domain.EventTypePointsSpent}},
+		},
+		MaxAttempts: 3,
+		InitialBackoff: config.Duration(time.Millisecond),
+		MaxBackoff: config.Duration(5 * time.Millisecond),
+		Timeout: config.Duration(time.Second),
+	}, transactionService, log.NewNopLogger())
+	defer dispatcher.Close()
+	var application = NewApplication(transactionService)
+	application.SetWebhookDispatcher(dispatcher)
+	var server = httptest.NewServer(application.NewRouter())
+	defer server.Close()
+	var api = client.NewClient(server.URL)
+	api.AddPayer("DANNON", "Dannon")
+	api.AddPurchase(&domain.RewardTransaction{Payer: "DANNON", Points: 300})
+	api.SpendPoints(&domain.PointsSpendTransaction{Points: 100})
+
+	waitFor(t, "the ledger receiver to accept every event", func() bool {
+		var events, _ = ledger.received()
+		return len(events) == 3
+	})
+	var events, attempts = ledger.received()
+	if attempts != 5 {
+		t.Errorf("Expected the two refused deliveries to be retried but the receiver saw %d attempts", attempts)
+	}
+	var expectedTypes = []string{domain.EventTypePayerCreated, domain.EventTypePurchaseRecorded, domain.EventTypePointsSpent}
+	for i, event := range events {
+		if event.Type != expectedTypes[i] {
+			t.Fatalf("Expected event %d to be %s but was %s", i, expectedTypes[i], event.Type)
+		}
+	}
+	var spent = events[2].Data.(*domain.PointsSpent)
+	if spent.Points != 100 || len(spent.Allocations) != 1 || spent.Allocations[0].Payer != "DANNON" {
+		t.Fatalf("Expected the spend to be funded by Dannon but got %+v", spent)
+	}
+
+	waitFor(t, "the spend to be dead-lettered", func() bool {
+		return len(dispatcher.DeadLetters()) == 1
+	})
+	var deadLetters, listErr = api.ListDeadLetters()
+	if listErr != nil || len(deadLetters) != 1 || deadLetters[0].EndpointId != "spends" || deadLetters[0].Attempts != 3 || deadLetters[0].Event.Id != events[2].Id {
+		t.Fatalf("Expected the spend to be dead-lettered for the spends endpoint but got %v (%v)", deadLetters, listErr)
+	}
+	var _, redeliverErr = api.RedeliverDeadLetter(deadLetters[0].Id)
+	if redeliverErr != nil {
+		t.Fatalf("Unable to redeliver the dead letter: %v", redeliverErr)
+	}
+	waitFor(t, "the spends receiver to accept the redelivered spend", func() bool {
+		var received, _ = spends.received()
+		return len(received) == 1 && received[0].Id == events[2].Id
+	})
+	if remaining, _ := api.ListDeadLetters(); len(remaining) != 0 {
+		t.Fatalf("Expected redelivery to remove the dead letter but %d remain", len(remaining))
+	}
+	var _, missingErr = api.RedeliverDeadLetter(deadLetters[0].Id)
+	expectStatus(t, missingErr, 404, "redelivering a dead letter already redelivered")
+}